@@ -134,7 +134,7 @@ func cleanUp() {
 	if err := infradb.DeleteAllResources(); err != nil {
 		log.Println("Failed to delete all the resources: ", err)
 	}
-	switch config.GlobalConfig.Buildenv {
+	switch ipu_vendor.GlobalConfig().Buildenv {
 	case intelStr:
 		gen_linux.DeInitialize()
 		intel_e2000_linux.DeInitialize()
@@ -152,6 +152,20 @@ func cleanUp() {
 	}
 }
 
+// reload reloads the configuration of the modules supporting it
+func reload() {
+	// The config is swapped by the reloads, the grpc ones included
+	buildenv := ipu_vendor.GlobalConfig().Buildenv
+	switch buildenv {
+	case intelStr:
+		if err := ipu_vendor.Reload(); err != nil {
+			log.Printf("Failed to reload configuration: %v\n", err)
+		}
+	default:
+		log.Println("Configuration reload not supported for build env", buildenv)
+	}
+}
+
 // main function
 func main() {
 	// setup file and console logger
@@ -184,6 +198,16 @@ func main() {
 		os.Exit(0)
 	}()
 
+	hupChan := make(chan os.Signal, 1)
+	// Notify hupChan on SIGHUP to reload the configuration at runtime.
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			log.Println("Received SIGHUP, reloading configuration.")
+			reload()
+		}
+	}()
+
 	// start the main cmd
 	if err := rootCmd.Execute(); err != nil {
 		log.Panicf("Error in Execute(): %v", err)
@@ -247,6 +271,10 @@ func runGrpcServer(grpcPort uint16, tlsFiles string) {
 	pe.RegisterVrfServiceServer(s, vrfServer)
 	pe.RegisterSviServiceServer(s, sviServer)
 	pc.RegisterInventoryServiceServer(s, &inventory.Server{})
+	if config.GlobalConfig.Buildenv == intelStr {
+		ipu_vendor.RegisterGnmi(s)
+		ipu_vendor.RegisterConfigService(s)
+	}
 
 	reflection.Register(s)
 
@@ -273,11 +301,21 @@ func runGatewayServer(grpcPort uint16, httpPort uint16) {
 		log.Panic("cannot register handler server")
 	}
 
+	// Serve the vendor probes next to the gateway, the admin api has its own
+	// listener
+	httpMux := http.NewServeMux()
+	httpMux.Handle("/", mux)
+	if config.GlobalConfig.Buildenv == intelStr {
+		go runAdminServer(ipu_vendor.AdminListenAddress())
+		httpMux.HandleFunc("/readyz", ipu_vendor.Readyz)
+		httpMux.HandleFunc("/healthz", ipu_vendor.Healthz)
+	}
+
 	// Start HTTP server (and proxy calls to gRPC server endpoint)
 	log.Printf("HTTP Server listening at %v", httpPort)
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", httpPort),
-		Handler:      mux,
+		Handler:      httpMux,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
@@ -287,6 +325,21 @@ func runGatewayServer(grpcPort uint16, httpPort uint16) {
 	}
 }
 
+// runAdminServer serves the vendor admin api on its own listener, bound to
+// loopback unless configured otherwise
+func runAdminServer(addr string) {
+	log.Printf("Admin Server listening at %v", addr)
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      ipu_vendor.AdminHandler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		log.Panic("cannot start admin server")
+	}
+}
+
 // createGrdVrf creates the grd vrf with vni 0
 func createGrdVrf() error {
 	grdVrf, err := infradb.NewVrfWithArgs("//network.opiproject.org/vrfs/GRD", nil, nil, nil)
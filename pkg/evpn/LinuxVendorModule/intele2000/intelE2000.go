@@ -67,6 +67,9 @@ func (h *ModulelvmHandler) HandleEvent(eventType string, objectData *eventbus.Ob
 	case "bridge-port":
 		log.Printf("LVM recevied %s %s\n", eventType, objectData.Name)
 		handlebp(objectData)
+	case "svi":
+		log.Printf("LVM recevied %s %s\n", eventType, objectData.Name)
+		handlesvi(objectData)
 	default:
 		log.Printf("error: Unknown event type %s\n", eventType)
 	}
@@ -170,7 +173,11 @@ func MactoVport(mac *net.HardwareAddr) int {
 // setUpBp sets up a bridge port
 func setUpBp(bp *infradb.BridgePort) (string, bool) {
 	MacAddress := fmt.Sprintf("%+v", *bp.Spec.MacAddress)
-	vportID := MactoVport(bp.Spec.MacAddress)
+	vportID, err := vportOf(bp)
+	if err != nil {
+		log.Printf("LVM: %v\n", err)
+		return fmt.Sprintf("LVM: %v\n", err), false
+	}
 	link := fmt.Sprintf("vport-%+v", vportID)
 	vport := fmt.Sprintf("%+v", vportID)
 	bp.Metadata.VPort = vport
@@ -231,7 +238,11 @@ func setUpBp(bp *infradb.BridgePort) (string, bool) {
 
 // tearDownBp tears down the bridge port
 func tearDownBp(bp *infradb.BridgePort) (string, bool) {
-	vportID := MactoVport(bp.Spec.MacAddress)
+	vportID, err := vportOf(bp)
+	if err != nil {
+		log.Printf("LVM: %v\n", err)
+		return fmt.Sprintf("LVM: %v\n", err), true
+	}
 	link := fmt.Sprintf("vport-%+v", vportID)
 	Intf, err := nlink.LinkByName(ctx, link)
 	if err != nil {
@@ -331,29 +342,30 @@ func handlevrf(objectData *eventbus.ObjectData) {
 	}
 }
 
-// disableRpFilter disables the RP filter
-func disableRpFilter(iface string) {
+// setRpFilter sets the RP filter of an interface to the given value
+func setRpFilter(iface string, value int) bool {
 	// Work-around for the observation that sometimes the sysctl -w command did not take effect.
-	rpFilterDisabled := false
+	rpFilterSet := false
 	for i := 0; i < maxRetries; i++ {
-		rpDisable := fmt.Sprintf("net.ipv4.conf.%s.rp_filter=0", iface)
-		output, errCode := run([]string{"sysctl", "-w", rpDisable}, false)
+		rpSet := fmt.Sprintf("net.ipv4.conf.%s.rp_filter=%d", iface, value)
+		output, errCode := run([]string{"sysctl", "-w", rpSet}, false)
 		if errCode != 0 {
 			log.Printf("Error setting rp_filter: %s\n", output)
 			continue
 		}
 		time.Sleep(200 * time.Millisecond)
-		rpDisable = fmt.Sprintf("net.ipv4.conf.%s.rp_filter", iface)
-		output, errCode = run([]string{"sysctl", "-n", rpDisable}, false)
-		if errCode == 0 && strings.HasPrefix(output, "0") {
-			rpFilterDisabled = true
-			log.Printf("RP filter disabled on interface %s\n", iface)
+		rpSet = fmt.Sprintf("net.ipv4.conf.%s.rp_filter", iface)
+		output, errCode = run([]string{"sysctl", "-n", rpSet}, false)
+		if errCode == 0 && strings.HasPrefix(output, strconv.Itoa(value)) {
+			rpFilterSet = true
+			log.Printf("RP filter set to %d on interface %s\n", value, iface)
 			break
 		}
 	}
-	if !rpFilterDisabled {
-		log.Printf("Failed to disable rp_filter on interface %s\n", iface)
+	if !rpFilterSet {
+		log.Printf("Failed to set rp_filter %d on interface %s\n", value, iface)
 	}
+	return rpFilterSet
 }
 
 // setUpVrf sets up a vrf
@@ -361,7 +373,7 @@ func setUpVrf(vrf *infradb.Vrf) (string, bool) {
 	log.Printf("LVM configure linux function \n")
 	vlanIntf := fmt.Sprintf("rep-%+v", path.Base(vrf.Name))
 	if path.Base(vrf.Name) == "GRD" {
-		disableRpFilter("rep-" + path.Base(vrf.Name))
+		setRpFilter("rep-"+path.Base(vrf.Name), muxRpFilter(vrf.Name))
 		return "", true
 	}
 	muxIntf, err := nlink.LinkByName(ctx, vrfMux)
@@ -393,7 +405,8 @@ func setUpVrf(vrf *infradb.Vrf) (string, bool) {
 		return fmt.Sprintf("Failed to set MTU for %v: %s\n", vlanLink, err), false
 	}
 	log.Printf(" LVM: Executed ip link set rep-%s master %s up mtu %d\n", path.Base(vrf.Name), path.Base(vrf.Name), ipMtu)
-	disableRpFilter("rep-" + path.Base(vrf.Name))
+	setRpFilter("rep-"+path.Base(vrf.Name), muxRpFilter(vrf.Name))
+	setUpVrfUrpf(vrf)
 	return "", true
 }
 
@@ -437,10 +450,16 @@ func Initialize() {
 	brTenant = "br-tenant"
 	ctx = context.Background()
 	nlink = utils.NewNetlinkWrapperWithArgs(config.GlobalConfig.Tracer)
+	loadKeyConfig()
+	loadMacsecConfig()
+	loadUrpfConfig()
+	loadVfReps()
+	setUpMacsec()
 }
 
 // DeInitialize function handles stops functionality
 func DeInitialize() {
 	eb := eventbus.EBus
 	eb.UnsubscribeModule(lvmComp)
+	tearDownMacsec()
 }
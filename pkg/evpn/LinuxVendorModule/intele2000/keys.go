@@ -0,0 +1,329 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package intele2000 handles intel e2000 vendor specific tasks
+// nolint: all
+package intele2000
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// keysKey config key of the key handling section
+const keysKey = "keys"
+
+// key reference schemes, a reference without a scheme is a plain hex key
+const (
+	keyPlain  = "hex"
+	keyFile   = "file"
+	keyEnv    = "env"
+	keySealed = "sealed"
+	keyKms    = "kms"
+)
+
+// redacted replaces the key material in the logs
+const redacted = "<redacted>"
+
+// maxKeyText longest hex text of a key read from a file or a kms helper
+const maxKeyText = 1024
+
+// KeyConfig key handling config structure. The sealing key file holds the
+// hex AES-256 key the sealed keys are opened with, the kms command prints
+// the hex key of the key reference it is given as its only argument
+type KeyConfig struct {
+	SealingKey string `yaml:"sealingkey"`
+	KmsCommand string `yaml:"kmscommand"`
+	KmsTimeout int    `yaml:"kmstimeout"`
+	DenyPlain  bool   `yaml:"denyplain"`
+}
+
+// keyCfg key handling configuration read from the config file
+var keyCfg KeyConfig
+
+// KeyRef reference to a key, scheme:ref with the schemes hex, file, env,
+// sealed and kms. Its formatting never shows the key material
+type KeyRef string
+
+// String shows the scheme and the ref of the references not carrying the key
+func (k KeyRef) String() string {
+	if k == "" {
+		return ""
+	}
+	scheme, ref := splitKeyRef(k)
+	if scheme == keyPlain || scheme == keySealed {
+		return scheme + ":" + redacted
+	}
+	return scheme + ":" + ref
+}
+
+// GoString redacts the key of the %#v formatting
+func (k KeyRef) GoString() string {
+	return k.String()
+}
+
+// MarshalJSON redacts the key of the json dumps
+func (k KeyRef) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", k.String())), nil
+}
+
+// KeySource source of the key material of a scheme, the caller zeroes the
+// key returned once programmed
+type KeySource interface {
+	Fetch(ref string) ([]byte, error)
+}
+
+// KeySourceFunc adapts a function to a key source
+type KeySourceFunc func(ref string) ([]byte, error)
+
+// Fetch returns the key of the reference
+func (f KeySourceFunc) Fetch(ref string) ([]byte, error) {
+	return f(ref)
+}
+
+var (
+	// keySourcesLock guards the key sources
+	keySourcesLock sync.RWMutex
+
+	// keySources key sources keyed by scheme
+	keySources = map[string]KeySource{
+		keyPlain:  KeySourceFunc(plainKey),
+		keyFile:   KeySourceFunc(fileKey),
+		keyEnv:    KeySourceFunc(envKey),
+		keySealed: KeySourceFunc(sealedKey),
+		keyKms:    KeySourceFunc(kmsKey),
+	}
+)
+
+// RegisterKeySource plugs in the source of a key reference scheme, replacing
+// the builtin one of the scheme if any
+func RegisterKeySource(scheme string, source KeySource) {
+	keySourcesLock.Lock()
+	defer keySourcesLock.Unlock()
+	keySources[strings.ToLower(scheme)] = source
+}
+
+// loadKeyConfig reads the key handling configuration
+func loadKeyConfig() {
+	keyCfg = KeyConfig{}
+	if err := viper.UnmarshalKey(keysKey, &keyCfg); err != nil {
+		log.Printf("LVM: Failed to read keys config: %v\n", err)
+	}
+	if keyCfg.KmsTimeout <= 0 {
+		keyCfg.KmsTimeout = 5
+	}
+}
+
+// splitKeyRef returns the scheme and the ref of a key reference
+func splitKeyRef(k KeyRef) (string, string) {
+	scheme, ref, found := strings.Cut(string(k), ":")
+	if !found {
+		return keyPlain, string(k)
+	}
+	return strings.ToLower(scheme), ref
+}
+
+// checkKeyRef checks the scheme of a key reference without fetching its key
+func checkKeyRef(k KeyRef) error {
+	scheme, _ := splitKeyRef(k)
+	if scheme == keyPlain && keyCfg.DenyPlain {
+		return errors.New("plain keys are denied")
+	}
+	keySourcesLock.RLock()
+	defer keySourcesLock.RUnlock()
+	if _, ok := keySources[scheme]; !ok {
+		return fmt.Errorf("unknown key scheme %q", scheme)
+	}
+	return nil
+}
+
+// resolveKey fetches the key of a reference and checks its size, the caller
+// zeroes it once programmed
+func resolveKey(k KeyRef, size int) ([]byte, error) {
+	if err := checkKeyRef(k); err != nil {
+		return nil, err
+	}
+	scheme, ref := splitKeyRef(k)
+	keySourcesLock.RLock()
+	source := keySources[scheme]
+	keySourcesLock.RUnlock()
+	key, err := source.Fetch(ref)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", k, err)
+	}
+	if len(key) != size {
+		zero(key)
+		return nil, fmt.Errorf("key %s has %d bytes, %d expected", k, len(key), size)
+	}
+	return key, nil
+}
+
+// zero wipes key material
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// decodeKey decodes a hex key, the error never quotes the text
+func decodeKey(text []byte) ([]byte, error) {
+	text = bytes.TrimSpace(text)
+	key := make([]byte, hex.DecodedLen(len(text)))
+	if _, err := hex.Decode(key, text); err != nil {
+		zero(key)
+		return nil, errors.New("key is not hex")
+	}
+	return key, nil
+}
+
+// readKey reads a hex key into a fixed buffer zeroed once decoded, so no
+// copy of the text is left behind by a growing buffer
+func readKey(r io.Reader) ([]byte, error) {
+	buf := make([]byte, maxKeyText)
+	defer zero(buf)
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err == io.EOF {
+			return decodeKey(buf[:n])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, errors.New("key text too long")
+}
+
+// plainKey decodes a key written in hex in the config file. The config keeps
+// it as a string which can not be wiped, prefer the other schemes
+func plainKey(ref string) ([]byte, error) {
+	text := []byte(ref)
+	defer zero(text)
+	return decodeKey(text)
+}
+
+// fileKey reads the hex key of a file
+func fileKey(ref string) ([]byte, error) {
+	f, err := os.Open(ref)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readKey(f)
+}
+
+// envKey decodes the hex key of an environment variable
+func envKey(ref string) ([]byte, error) {
+	text, ok := os.LookupEnv(ref)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s not set", ref)
+	}
+	return plainKey(text)
+}
+
+// sealedKey opens a key sealed with the sealing key, the base64 of a nonce
+// followed by the AES-256-GCM ciphertext of the raw key
+func sealedKey(ref string) ([]byte, error) {
+	if keyCfg.SealingKey == "" {
+		return nil, errors.New("no sealing key configured")
+	}
+	blob, err := base64.StdEncoding.DecodeString(ref)
+	if err != nil {
+		return nil, errors.New("sealed key is not base64")
+	}
+	kek, err := fileKey(keyCfg.SealingKey)
+	if err != nil {
+		return nil, fmt.Errorf("sealing key: %w", err)
+	}
+	block, err := aes.NewCipher(kek)
+	zero(kek)
+	if err != nil {
+		return nil, fmt.Errorf("sealing key: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(blob) < gcm.NonceSize() {
+		return nil, errors.New("sealed key too short")
+	}
+	key, err := gcm.Open(nil, blob[:gcm.NonceSize()], blob[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("sealed key does not open with the sealing key")
+	}
+	return key, nil
+}
+
+// kmsKey runs the kms helper on the key reference and reads the hex key it
+// prints, its error output is dropped as it may carry the key
+func kmsKey(ref string) ([]byte, error) {
+	if keyCfg.KmsCommand == "" {
+		return nil, errors.New("no kms command configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(keyCfg.KmsTimeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, keyCfg.KmsCommand, ref) //nolint:gosec
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	key, readErr := readKey(stdout)
+	if err = cmd.Wait(); err != nil {
+		zero(key)
+		return nil, fmt.Errorf("kms command failed: %w", err)
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return key, nil
+}
+
+// runBatch runs ip commands fed on the standard input, the secret they carry
+// stays off the arguments of the process and is redacted from its output
+func runBatch(input []byte, secret []byte) error {
+	cmd := exec.Command("ip", "-batch", "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	_, writeErr := stdin.Write(input)
+	stdin.Close()
+	err = cmd.Wait()
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		output := out.Bytes()
+		if len(secret) != 0 {
+			output = bytes.ReplaceAll(output, secret, []byte(redacted))
+		}
+		log.Printf("LVM: Command ip -batch %s': exit code %s;\n", output, err)
+	}
+	return err
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package intele2000 handles intel e2000 vendor specific tasks
+// nolint: all
+package intele2000
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// macsecKey config key of the macsec section
+const macsecKey = "macsec"
+
+// MacsecSaConfig macsec secure association config structure, the key is a
+// reference resolved when the SA is programmed
+type MacsecSaConfig struct {
+	An    uint8  `yaml:"an"`
+	Pn    uint32 `yaml:"pn"`
+	KeyID string `yaml:"keyid"`
+	Key   KeyRef `yaml:"key"`
+}
+
+// MacsecRxScConfig macsec receive secure channel config structure
+type MacsecRxScConfig struct {
+	PeerMac string           `yaml:"peermac"`
+	Port    uint16           `yaml:"port"`
+	Sa      []MacsecSaConfig `yaml:"sa"`
+}
+
+// MacsecUplinkConfig macsec SecY config structure of an uplink
+type MacsecUplinkConfig struct {
+	Rep     string             `yaml:"rep"`
+	Port    uint16             `yaml:"port"`
+	Cipher  string             `yaml:"cipher"`
+	Offload string             `yaml:"offload"`
+	Encrypt bool               `yaml:"encrypt"`
+	TxSa    MacsecSaConfig     `yaml:"txsa"`
+	RxSc    []MacsecRxScConfig `yaml:"rxsc"`
+}
+
+// MacsecConfig macsec config structure
+type MacsecConfig struct {
+	Enabled bool                 `yaml:"enabled"`
+	Uplinks []MacsecUplinkConfig `yaml:"uplinks"`
+}
+
+// macsecCfg macsec configuration read from the config file
+var macsecCfg MacsecConfig
+
+// secYName returns the name of the SecY device on top of an uplink
+func secYName(rep string) string {
+	return fmt.Sprintf("ms-%s", rep)
+}
+
+// onOff converts bool to the iproute2 on/off notation
+func onOff(flag bool) string {
+	if flag {
+		return "on"
+	}
+	return "off"
+}
+
+// loadMacsecConfig reads the macsec section of the config file
+func loadMacsecConfig() {
+	macsecCfg = MacsecConfig{}
+	if err := viper.UnmarshalKey(macsecKey, &macsecCfg); err != nil {
+		log.Printf("LVM: Failed to read macsec config: %v\n", err)
+		macsecCfg.Enabled = false
+	}
+	for _, uplink := range macsecCfg.Uplinks {
+		sas := []MacsecSaConfig{uplink.TxSa}
+		for _, rxSc := range uplink.RxSc {
+			sas = append(sas, rxSc.Sa...)
+		}
+		for _, sa := range sas {
+			if err := checkKeyRef(sa.Key); err != nil {
+				log.Printf("LVM: Key %s of sa %d on %s is unusable: %v\n", sa.Key, sa.An, uplink.Rep, err)
+			}
+		}
+	}
+}
+
+// keySize returns the SAK size of a cipher suite
+func keySize(cipher string) int {
+	if strings.Contains(cipher, "256") {
+		return 32
+	}
+	return 16
+}
+
+// programSa adds a SA to a SecY through ip batch, its key is resolved only
+// then, never shows in the arguments nor in the logs and is zeroed once
+// written. The key id and the fields of the line are checked as a line
+// holding a separator would inject commands into the batch
+func programSa(cipher string, args []string, sa MacsecSaConfig) error {
+	if _, err := hex.DecodeString(sa.KeyID); err != nil || sa.KeyID == "" {
+		return fmt.Errorf("key id %q is not hex", sa.KeyID)
+	}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, " \t\n;") {
+			return fmt.Errorf("invalid sa field %q", arg)
+		}
+	}
+	key, err := resolveKey(sa.Key, keySize(cipher))
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	prefix := "macsec " + strings.Join(args, " ") + " on key " + sa.KeyID + " "
+	line := make([]byte, len(prefix), len(prefix)+hex.EncodedLen(len(key))+1)
+	copy(line, prefix)
+	line = line[:len(prefix)+hex.EncodedLen(len(key))]
+	hex.Encode(line[len(prefix):], key)
+	line = append(line, '\n')
+	defer zero(line)
+	return runBatch(line, line[len(prefix):len(line)-1])
+}
+
+// setUpSecY creates the SecY of an uplink and programs its SAKs
+func setUpSecY(uplink MacsecUplinkConfig) (string, bool) {
+	secY := secYName(uplink.Rep)
+	cipher := uplink.Cipher
+	if cipher == "" {
+		cipher = "gcm-aes-128"
+	}
+	offload := uplink.Offload
+	if offload == "" {
+		offload = "phy"
+	}
+	port := uplink.Port
+	if port == 0 {
+		port = 1
+	}
+	_, errCode := run([]string{"ip", "link", "add", "link", uplink.Rep, secY, "type", "macsec", "port", strconv.Itoa(int(port)),
+		"encrypt", onOff(uplink.Encrypt), "cipher", cipher}, false)
+	if errCode != 0 {
+		return fmt.Sprintf("LVM: Failed to add SecY %s on %s\n", secY, uplink.Rep), false
+	}
+	log.Printf("LVM: Executed ip link add link %s %s type macsec port %d encrypt %s cipher %s\n", uplink.Rep, secY, port, onOff(uplink.Encrypt), cipher)
+	_, errCode = run([]string{"ip", "macsec", "offload", secY, offload}, false)
+	if errCode != 0 {
+		return fmt.Sprintf("LVM: Failed to enable %s offload on SecY %s\n", offload, secY), false
+	}
+	log.Printf("LVM: Executed ip macsec offload %s %s\n", secY, offload)
+	err := programSa(cipher, []string{"add", secY, "tx", "sa", strconv.Itoa(int(uplink.TxSa.An)), "pn", strconv.FormatUint(uint64(uplink.TxSa.Pn), 10)}, uplink.TxSa)
+	if err != nil {
+		return fmt.Sprintf("LVM: Failed to add tx sa %d on SecY %s: %v\n", uplink.TxSa.An, secY, err), false
+	}
+	log.Printf("LVM: Executed ip macsec add %s tx sa %d pn %d on key %s\n", secY, uplink.TxSa.An, uplink.TxSa.Pn, uplink.TxSa.KeyID)
+	for _, rxSc := range uplink.RxSc {
+		rxPort := rxSc.Port
+		if rxPort == 0 {
+			rxPort = 1
+		}
+		peerMac, err := net.ParseMAC(rxSc.PeerMac)
+		if err != nil {
+			return fmt.Sprintf("LVM: Invalid rx sc peer mac %q on SecY %s\n", rxSc.PeerMac, secY), false
+		}
+		_, errCode = run([]string{"ip", "macsec", "add", secY, "rx", "port", strconv.Itoa(int(rxPort)), "address", peerMac.String()}, false)
+		if errCode != 0 {
+			return fmt.Sprintf("LVM: Failed to add rx sc %s on SecY %s\n", rxSc.PeerMac, secY), false
+		}
+		log.Printf("LVM: Executed ip macsec add %s rx port %d address %s\n", secY, rxPort, rxSc.PeerMac)
+		for _, sa := range rxSc.Sa {
+			err = programSa(cipher, []string{"add", secY, "rx", "port", strconv.Itoa(int(rxPort)), "address", peerMac.String(),
+				"sa", strconv.Itoa(int(sa.An)), "pn", strconv.FormatUint(uint64(sa.Pn), 10)}, sa)
+			if err != nil {
+				return fmt.Sprintf("LVM: Failed to add rx sa %d for %s on SecY %s: %v\n", sa.An, rxSc.PeerMac, secY, err), false
+			}
+			log.Printf("LVM: Executed ip macsec add %s rx port %d address %s sa %d pn %d on key %s\n", secY, rxPort, rxSc.PeerMac, sa.An, sa.Pn, sa.KeyID)
+		}
+	}
+	if _, errCode = run([]string{"ip", "link", "set", secY, "up"}, false); errCode != 0 {
+		return fmt.Sprintf("LVM: Failed to set up SecY %s\n", secY), false
+	}
+	log.Printf("LVM: Executed ip link set %s up\n", secY)
+	return "", true
+}
+
+// tearDownSecY deletes the SecY of an uplink together with all its SAs
+func tearDownSecY(uplink MacsecUplinkConfig) (string, bool) {
+	secY := secYName(uplink.Rep)
+	if _, errCode := run([]string{"ip", "link", "del", secY}, false); errCode != 0 {
+		return fmt.Sprintf("LVM: Failed to delete SecY %s\n", secY), false
+	}
+	log.Printf("LVM: Executed ip link del %s\n", secY)
+	return "", true
+}
+
+// setUpMacsec sets up the SecYs of all the configured uplinks
+func setUpMacsec() {
+	if !macsecCfg.Enabled {
+		return
+	}
+	for _, uplink := range macsecCfg.Uplinks {
+		if details, status := setUpSecY(uplink); !status {
+			log.Printf("%s", details)
+		}
+	}
+}
+
+// tearDownMacsec tears down the SecYs of all the configured uplinks
+func tearDownMacsec() {
+	if !macsecCfg.Enabled {
+		return
+	}
+	for _, uplink := range macsecCfg.Uplinks {
+		if details, status := tearDownSecY(uplink); !status {
+			log.Printf("%s", details)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package intele2000 handles intel e2000 vendor specific tasks
+// nolint: all
+package intele2000
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/common"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/subscriberframework/eventbus"
+	"github.com/spf13/viper"
+)
+
+// urpfKey config key of the reverse path forwarding section
+const urpfKey = "urpf"
+
+// rp_filter values of the urpf modes
+const (
+	rpFilterOff    = 0
+	rpFilterStrict = 1
+	rpFilterLoose  = 2
+)
+
+// UrpfConfig reverse path forwarding config structure, the mode is off,
+// loose or strict per vrf name. The rp_filter only guards the ipv4 traffic
+// of the slow path, the offloaded traffic of both families is checked by the
+// p4 translation of the vrf
+type UrpfConfig struct {
+	Vrfs map[string]string `yaml:"vrfs"`
+}
+
+// urpfCfg reverse path forwarding configuration read from the config file
+var urpfCfg UrpfConfig
+
+// loadUrpfConfig reads the reverse path forwarding configuration
+func loadUrpfConfig() {
+	urpfCfg = UrpfConfig{}
+	if err := viper.UnmarshalKey(urpfKey, &urpfCfg); err != nil {
+		log.Printf("LVM: Failed to read urpf config: %v\n", err)
+		return
+	}
+	for vrf, mode := range urpfCfg.Vrfs {
+		if _, err := rpFilterOf(mode); err != nil {
+			log.Printf("LVM: Ignoring urpf config of vrf %s: %v\n", vrf, err)
+			delete(urpfCfg.Vrfs, vrf)
+		}
+	}
+}
+
+// rpFilterOf converts the urpf mode to its rp_filter value
+func rpFilterOf(mode string) (int, error) {
+	switch strings.ToLower(mode) {
+	case "", "off":
+		return rpFilterOff, nil
+	case "strict":
+		return rpFilterStrict, nil
+	case "loose":
+		return rpFilterLoose, nil
+	default:
+		return rpFilterOff, fmt.Errorf("unknown urpf mode %q", mode)
+	}
+}
+
+// urpfMode returns the rp_filter value configured for a vrf
+func urpfMode(vrfName string) int {
+	value, _ := rpFilterOf(urpfCfg.Vrfs[strings.ToLower(path.Base(vrfName))])
+	return value
+}
+
+// muxRpFilter returns the rp_filter value of the mux representor of a vrf.
+// Strict mode never holds there as the replies do not leave through the mux,
+// so the representor is only checked loosely
+func muxRpFilter(vrfName string) int {
+	if urpfMode(vrfName) == rpFilterOff {
+		return rpFilterOff
+	}
+	return rpFilterLoose
+}
+
+// setUpVrfUrpf applies the urpf mode of a vrf to the bridge of its l3 vni
+func setUpVrfUrpf(vrf *infradb.Vrf) {
+	if vrf.Spec.Vni == nil {
+		return
+	}
+	mode := urpfMode(vrf.Name)
+	if mode == rpFilterOff {
+		return
+	}
+	setRpFilter("br-"+path.Base(vrf.Name), mode)
+}
+
+// setUpSviUrpf applies the urpf mode of the vrf to the linux interface of an svi
+func setUpSviUrpf(svi *infradb.Svi) (string, bool) {
+	mode := urpfMode(svi.Spec.Vrf)
+	if mode == rpFilterOff {
+		return "", true
+	}
+	BrObj, err := infradb.GetLB(svi.Spec.LogicalBridge)
+	if err != nil {
+		log.Printf("LVM: unable to find key %s and error is %v\n", svi.Spec.LogicalBridge, err)
+		return fmt.Sprintf("LVM: unable to find key %s and error is %v\n", svi.Spec.LogicalBridge, err), false
+	}
+	linkSvi := fmt.Sprintf("%+v-%+v", path.Base(svi.Spec.Vrf), BrObj.Spec.VlanID)
+	if !setRpFilter(linkSvi, mode) {
+		return fmt.Sprintf("LVM: Failed to set rp_filter %d on interface %s\n", mode, linkSvi), false
+	}
+	return "", true
+}
+
+// handlesvi applies the urpf mode of the vrf to the svis, nothing is left to
+// undo on delete as the interface goes away with the svi
+func handlesvi(objectData *eventbus.ObjectData) {
+	var comp common.Component
+	svi, err := infradb.GetSvi(objectData.Name)
+	if err != nil {
+		log.Printf("LVM : GetSvi error: %s\n", err)
+		return
+	}
+	if len(svi.Status.Components) != 0 {
+		for i := 0; i < len(svi.Status.Components); i++ {
+			if svi.Status.Components[i].Name == lvmComp {
+				comp = svi.Status.Components[i]
+			}
+		}
+	}
+	comp.Name = lvmComp
+	comp.Details = ""
+	status := true
+	if svi.Status.SviOperStatus != infradb.SviOperStatusToBeDeleted {
+		comp.Details, status = setUpSviUrpf(svi)
+	}
+	if status {
+		comp.CompStatus = common.ComponentStatusSuccess
+		comp.Timer = 0
+	} else {
+		if comp.Timer == 0 {
+			comp.Timer = 2 * time.Second
+		} else {
+			comp.Timer *= 2
+		}
+		comp.CompStatus = common.ComponentStatusError
+	}
+	if err := infradb.UpdateSviStatus(objectData.Name, objectData.ResourceVersion, objectData.NotificationID, nil, comp); err != nil {
+		log.Printf("error updaing svi status %s\n", err)
+	}
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package intele2000 handles intel e2000 vendor specific tasks
+// nolint: all
+package intele2000
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/spf13/viper"
+)
+
+// vfsKey config key of the host vf representors
+const vfsKey = "interfaces.vfs"
+
+// maxVport highest vport, the vport is the S-tag of the bridge port on the
+// port mux
+const maxVport = 4094
+
+// VfRepConfig host vf representor config structure. The bridge ports with
+// the mac of the vf are bound to the vsi of its representor instead of the
+// vport encoded in the mac of the acc vports. Vsi is the ingress vsi of the
+// vf, the pipeline derives the egress vsi from it
+type VfRepConfig struct {
+	Name string `yaml:"name"`
+	Rep  string `yaml:"rep"`
+	Mac  string `yaml:"mac"`
+	Vsi  *int   `yaml:"vsi"`
+}
+
+// vfReps host vf representors keyed by the mac of the vf
+var vfReps = make(map[string]VfRepConfig)
+
+// loadVfReps reads the host vf representors of the config file
+func loadVfReps() {
+	var cfg []VfRepConfig
+	if err := viper.UnmarshalKey(vfsKey, &cfg); err != nil {
+		log.Printf("LVM: Failed to read vf representors config: %v\n", err)
+	}
+	vfReps = make(map[string]VfRepConfig, len(cfg))
+	for _, vf := range cfg {
+		mac, err := net.ParseMAC(vf.Mac)
+		if err != nil {
+			log.Printf("LVM: Ignoring vf %s with invalid mac %q\n", vf.Name, vf.Mac)
+			continue
+		}
+		if vf.Vsi == nil && vf.Rep == "" {
+			log.Printf("LVM: Ignoring vf %s without representor or vsi\n", vf.Name)
+			continue
+		}
+		key := strings.ToLower(mac.String())
+		if other, ok := vfReps[key]; ok {
+			log.Printf("LVM: Ignoring vf %s, mac %s used by vf %s\n", vf.Name, vf.Mac, other.Name)
+			continue
+		}
+		vfReps[key] = vf
+	}
+}
+
+// vfVsi returns the vsi of a host vf, the one configured or the one encoded in
+// the mac of its representor
+func vfVsi(vf VfRepConfig) (int, error) {
+	if vf.Vsi != nil {
+		return *vf.Vsi, nil
+	}
+	link, err := nlink.LinkByName(ctx, vf.Rep)
+	if err != nil {
+		return 0, fmt.Errorf("representor %s of vf %s not found: %v", vf.Rep, vf.Name, err)
+	}
+	mac := link.Attrs().HardwareAddr
+	if len(mac) < 2 {
+		return 0, fmt.Errorf("representor %s of vf %s has no mac", vf.Rep, vf.Name)
+	}
+	return MactoVport(&mac), nil
+}
+
+// vportOf returns the vport of a bridge port, the vsi of the host vf having
+// its mac or the vport encoded in the mac of an acc vport
+func vportOf(bp *infradb.BridgePort) (int, error) {
+	vport := MactoVport(bp.Spec.MacAddress)
+	if vf, ok := vfReps[strings.ToLower(bp.Spec.MacAddress.String())]; ok {
+		vsi, err := vfVsi(vf)
+		if err != nil {
+			return 0, err
+		}
+		vport = vsi
+	}
+	if vport < 0 || vport > maxVport {
+		return 0, fmt.Errorf("vport %d of bridge port %s is out of range 0-%d", vport, bp.Name, maxVport)
+	}
+	return vport, nil
+}
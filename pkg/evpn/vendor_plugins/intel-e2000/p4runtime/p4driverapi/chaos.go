@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4driverapi handles p4 driver realted functionality
+//
+//nolint:all
+package p4driverapi
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Chaos failure injection settings of the client, a write fails with the
+// probability of WriteFailure without reaching the device and the client
+// loses the device for DisconnectFor with the probability of Disconnect,
+// every call fails while it is disconnected
+type Chaos struct {
+	WriteFailure  float64
+	Disconnect    float64
+	DisconnectFor time.Duration
+	Seed          int64
+}
+
+// ChaosStats counters of the injected failures
+type ChaosStats struct {
+	Enabled      bool   `json:"enabled"`
+	Writes       uint64 `json:"writes"`
+	Failed       uint64 `json:"failed"`
+	Disconnects  uint64 `json:"disconnects"`
+	Disconnected bool   `json:"disconnected"`
+}
+
+var (
+	// chaosOn set while the failure injection is enabled, the calls to the
+	// device check it without taking the lock
+	chaosOn atomic.Bool
+
+	// chaosLock guards the failure injection state
+	chaosLock sync.Mutex
+
+	// chaos failure injection settings, nil when disabled
+	chaos *Chaos
+
+	// chaosRand random source of the failure injection
+	chaosRand *rand.Rand
+
+	// disconnectedUntil end of the injected disconnect
+	disconnectedUntil time.Time
+
+	// chaosStats counters of the injected failures
+	chaosStats ChaosStats
+)
+
+// injectedCodes status codes of the injected write failures
+var injectedCodes = []codes.Code{codes.Internal, codes.ResourceExhausted, codes.DeadlineExceeded}
+
+// SetChaos enables the failure injection, nil disables it. A zero seed
+// seeds the random source from the clock
+func SetChaos(c *Chaos) {
+	chaosLock.Lock()
+	defer chaosLock.Unlock()
+	disconnectedUntil = time.Time{}
+	chaosStats = ChaosStats{}
+	if c == nil {
+		chaos = nil
+		chaosOn.Store(false)
+		return
+	}
+	cfg := *c
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	chaos = &cfg
+	chaosRand = rand.New(rand.NewSource(seed))
+	chaosStats.Enabled = true
+	chaosOn.Store(true)
+}
+
+// GetChaosStats returns the counters of the injected failures
+func GetChaosStats() ChaosStats {
+	chaosLock.Lock()
+	defer chaosLock.Unlock()
+	stats := chaosStats
+	stats.Disconnected = time.Now().Before(disconnectedUntil)
+	return stats
+}
+
+// ChaosDisconnected checks if the client is in an injected disconnect
+func ChaosDisconnected() bool {
+	if !chaosOn.Load() {
+		return false
+	}
+	chaosLock.Lock()
+	defer chaosLock.Unlock()
+	return chaos != nil && time.Now().Before(disconnectedUntil)
+}
+
+// injectFault returns the failure injected in a call to the device, the
+// reads only fail while disconnected. The disabled path takes no lock so the
+// writes to the device are not serialized
+func injectFault(write bool) error {
+	if !chaosOn.Load() {
+		return nil
+	}
+	chaosLock.Lock()
+	defer chaosLock.Unlock()
+	if chaos == nil {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(disconnectedUntil) {
+		chaosStats.Failed++
+		return status.Error(codes.Unavailable, "chaos: device disconnected")
+	}
+	if !write {
+		return nil
+	}
+	chaosStats.Writes++
+	if chaosRand.Float64() < chaos.Disconnect {
+		chaosStats.Disconnects++
+		chaosStats.Failed++
+		disconnectedUntil = now.Add(chaos.DisconnectFor)
+		return status.Error(codes.Unavailable, "chaos: injected disconnect")
+	}
+	if chaosRand.Float64() < chaos.WriteFailure {
+		chaosStats.Failed++
+		return status.Error(injectedCodes[chaosRand.Intn(len(injectedCodes))], "chaos: injected write failure")
+	}
+	return nil
+}
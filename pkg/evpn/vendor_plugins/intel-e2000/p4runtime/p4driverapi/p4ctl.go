@@ -16,6 +16,9 @@ import (
 	"net"
 
 	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc"
@@ -37,8 +40,17 @@ var (
 
 	// P4RtC var of \p4 runtime client
 	P4RtC *client.Client
+
+	// standby set while the client is not the primary of a failover pair,
+	// the writes are skipped as the device belongs to the active instance
+	standby atomic.Bool
 )
 
+// IsStandby checks if the client runs as the standby of a failover pair
+func IsStandby() bool {
+	return standby.Load()
+}
+
 // TableEntry p4 table entry type
 type TableEntry struct {
 	Tablename string
@@ -78,11 +90,45 @@ func uint32toBytes(num uint32) []byte {
 	return bytes
 }
 
+// fullMasks masks of the ternary fields by width in bytes, shared as the
+// client only reads them
+var fullMasks = map[int][]byte{
+	2:  bytes.Repeat([]byte{0xff}, 2),
+	4:  bytes.Repeat([]byte{0xff}, 4),
+	16: bytes.Repeat([]byte{0xff}, 16),
+}
+
+// FullMask returns the mask matching all the bits of a value of the given
+// width in bytes, the client lays the ternary value out by its mask so the
+// mask has to be as wide as the value
+func FullMask(width int) []byte {
+	if mask, ok := fullMasks[width]; ok {
+		return mask
+	}
+	return bytes.Repeat([]byte{0xff}, width)
+}
+
+// mfsPool match field maps reused across the entries, the client copies the
+// match fields into the p4runtime entry so a map is free once it is built
+var mfsPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[string]client.MatchInterface, 4)
+	},
+}
+
+// releaseMfs returns a match field map to the pool
+func releaseMfs(mfs map[string]client.MatchInterface) {
+	for key := range mfs {
+		delete(mfs, key)
+	}
+	mfsPool.Put(mfs)
+}
+
 // Buildmfs builds the match fields
 func Buildmfs(tablefield TableField) (map[string]client.MatchInterface, bool, error) {
 	var isTernary bool
 	isTernary = false
-	mfs := map[string]client.MatchInterface{}
+	mfs := mfsPool.Get().(map[string]client.MatchInterface)
 	for key, value := range tablefield.FieldValue {
 		switch v := value[0].(type) {
 		case net.HardwareAddr:
@@ -93,19 +139,23 @@ func Buildmfs(tablefield TableField) (map[string]client.MatchInterface, bool, er
 				mfs[key] = &client.LpmMatch{Value: uint16toBytes(value[0].(uint16)), PLen: 31}
 			case ternaryStr:
 				isTernary = true
-				mfs[key] = &client.TernaryMatch{Value: uint16toBytes(value[0].(uint16)), Mask: uint32toBytes(4294967295)}
+				mfs[key] = &client.TernaryMatch{Value: uint16toBytes(value[0].(uint16)), Mask: FullMask(2)}
 			default:
 				mfs[key] = &client.ExactMatch{Value: uint16toBytes(value[0].(uint16))}
 			}
 		case *net.IPNet:
 			maskSize, _ := v.Mask.Size()
 			ip := v.IP.To4()
+			if ip == nil {
+				// ipv6 prefix of the v6 tables
+				ip = v.IP.To16()
+			}
 			switch value[1].(string) {
 			case lpmStr:
-				mfs[key] = &client.LpmMatch{Value: v.IP.To4(), PLen: int32(maskSize)}
+				mfs[key] = &client.LpmMatch{Value: ip, PLen: int32(maskSize)}
 			case ternaryStr:
 				isTernary = true
-				mfs[key] = &client.TernaryMatch{Value: []byte(ip), Mask: uint32toBytes(4294967295)}
+				mfs[key] = &client.TernaryMatch{Value: []byte(ip), Mask: FullMask(len(ip))}
 			default:
 				mfs[key] = &client.ExactMatch{Value: []byte(ip)}
 			}
@@ -117,7 +167,11 @@ func Buildmfs(tablefield TableField) (map[string]client.MatchInterface, bool, er
 				mfs[key] = &client.LpmMatch{Value: value[0].(net.IP).To4(), PLen: 24}
 			case ternaryStr:
 				isTernary = true
-				mfs[key] = &client.TernaryMatch{Value: []byte(v), Mask: uint32toBytes(4294967295)}
+				ip := v.To4()
+				if ip == nil {
+					ip = v.To16()
+				}
+				mfs[key] = &client.TernaryMatch{Value: []byte(ip), Mask: FullMask(len(ip))}
 			default:
 				mfs[key] = &client.ExactMatch{Value: []byte(v)}
 			}
@@ -130,7 +184,7 @@ func Buildmfs(tablefield TableField) (map[string]client.MatchInterface, bool, er
 				mfs[key] = &client.LpmMatch{Value: uint32toBytes(value[0].(uint32)), PLen: 31}
 			case ternaryStr:
 				isTernary = true
-				mfs[key] = &client.TernaryMatch{Value: uint32toBytes(value[0].(uint32)), Mask: uint32toBytes(4294967295)}
+				mfs[key] = &client.TernaryMatch{Value: uint32toBytes(value[0].(uint32)), Mask: FullMask(4)}
 			default:
 				mfs[key] = &client.ExactMatch{Value: uint32toBytes(value[0].(uint32))}
 			}
@@ -144,83 +198,299 @@ func Buildmfs(tablefield TableField) (map[string]client.MatchInterface, bool, er
 
 // GetEntry get the entry
 func GetEntry(table string) ([]*p4_v1.TableEntry, error) {
+	if err := injectFault(false); err != nil {
+		return nil, err
+	}
 	entry, err1 := P4RtC.ReadTableEntryWildcard(Ctx, table)
 	return entry, err1
 }
 
-// DelEntry deletes the entry
-func DelEntry(entry TableEntry) error {
-	Options := &client.TableEntryOptions{
-		Priority: entry.TableField.Priority,
+// ReadCounter reads the direct counter of an entry, the table has to carry a
+// direct counter in the pipeline. The read carries an empty counter data so
+// the server returns the counter along with the entry
+func ReadCounter(entry TableEntry) (*p4_v1.CounterData, error) {
+	entryP, err := newTableEntry(entry, nil)
+	if err != nil {
+		return nil, err
+	}
+	entryP.CounterData = &p4_v1.CounterData{}
+	if err := injectFault(false); err != nil {
+		return nil, err
+	}
+	read, err := P4RtC.ReadEntitySingle(Ctx, &p4_v1.Entity{Entity: &p4_v1.Entity_TableEntry{TableEntry: entryP}})
+	if err != nil {
+		return nil, err
+	}
+	if read.GetTableEntry() == nil {
+		return nil, fmt.Errorf("read of %s returned no table entry", entry.Tablename)
+	}
+	if read.GetTableEntry().GetCounterData() == nil {
+		return &p4_v1.CounterData{}, nil
+	}
+	return read.GetTableEntry().GetCounterData(), nil
+}
+
+// canonical strips the leading zero bytes the server may drop from a value
+func canonical(value []byte) []byte {
+	value = bytes.TrimLeft(value, "\x00")
+	if len(value) == 0 {
+		return []byte{0}
+	}
+	return value
+}
+
+// matchValue returns the value and mask or prefix length of a match field
+func matchValue(m *p4_v1.FieldMatch) ([]byte, []byte, int32) {
+	if e := m.GetExact(); e != nil {
+		return canonical(e.Value), nil, 0
+	}
+	if l := m.GetLpm(); l != nil {
+		return canonical(l.Value), nil, l.PrefixLen
 	}
+	if t := m.GetTernary(); t != nil {
+		return canonical(t.Value), canonical(t.Mask), 0
+	}
+	return nil, nil, 0
+}
+
+// sameMatch checks if two entries of a table have the same match fields
+func sameMatch(a *p4_v1.TableEntry, b *p4_v1.TableEntry) bool {
+	if a.GetPriority() != b.GetPriority() || len(a.GetMatch()) != len(b.GetMatch()) {
+		return false
+	}
+	fields := make(map[uint32]*p4_v1.FieldMatch, len(b.GetMatch()))
+	for _, m := range b.GetMatch() {
+		fields[m.GetFieldId()] = m
+	}
+	for _, m := range a.GetMatch() {
+		o, ok := fields[m.GetFieldId()]
+		if !ok {
+			return false
+		}
+		av, am, ap := matchValue(m)
+		ov, om, op := matchValue(o)
+		if !bytes.Equal(av, ov) || !bytes.Equal(am, om) || ap != op {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchKey returns a key identifying the match fields of a programmed entry
+func MatchKey(entry *p4_v1.TableEntry) string {
+	fields := make([]string, 0, len(entry.GetMatch()))
+	for _, m := range entry.GetMatch() {
+		value, mask, plen := matchValue(m)
+		fields = append(fields, fmt.Sprintf("%d=%x/%x/%d", m.GetFieldId(), value, mask, plen))
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("%d%v/%d", entry.GetTableId(), fields, entry.GetPriority())
+}
+
+// ExactKey returns the value of the single exact match field of a programmed
+// entry, e.g. the mod pointer keying the mod table entries
+func ExactKey(entry *p4_v1.TableEntry) (uint32, bool) {
+	if len(entry.GetMatch()) != 1 || entry.GetMatch()[0].GetExact() == nil {
+		return 0, false
+	}
+	value := canonical(entry.GetMatch()[0].GetExact().Value)
+	if len(value) > 4 {
+		return 0, false
+	}
+	var key uint32
+	for _, b := range value {
+		key = key<<8 | uint32(b)
+	}
+	return key, true
+}
+
+// newTableEntry builds the p4runtime entry, the priority is only set on the
+// entries with ternary fields
+func newTableEntry(entry TableEntry, action *p4_v1.TableAction) (*p4_v1.TableEntry, error) {
 	mfs, isTernary, err := Buildmfs(entry.TableField)
 	if err != nil {
-		log.Fatalf("intel-e2000: Error in Building mfs: %v", err)
-		return err
+		return nil, err
 	}
+	defer releaseMfs(mfs)
 	if isTernary {
-		entry := P4RtC.NewTableEntry(entry.Tablename, mfs, nil, Options)
-		return P4RtC.DeleteTableEntry(Ctx, entry)
+		Options := &client.TableEntryOptions{
+			Priority: entry.TableField.Priority,
+		}
+		return P4RtC.NewTableEntry(entry.Tablename, mfs, action, Options), nil
 	}
+	return P4RtC.NewTableEntry(entry.Tablename, mfs, action, nil), nil
+}
 
-	entryP := P4RtC.NewTableEntry(entry.Tablename, mfs, nil, nil)
-	return P4RtC.DeleteTableEntry(Ctx, entryP)
+// EntryMatchKey returns the match key the entry has once programmed
+func EntryMatchKey(entry TableEntry) (string, error) {
+	entryP, err := newTableEntry(entry, nil)
+	if err != nil {
+		return "", err
+	}
+	return MatchKey(entryP), nil
 }
 
-// AddEntry adds an entry
-func AddEntry(entry TableEntry) error {
-	Options := &client.TableEntryOptions{
-		Priority: entry.TableField.Priority,
+// DelProgrammedEntry deletes an entry as read from the device
+func DelProgrammedEntry(entry *p4_v1.TableEntry) error {
+	if err := injectFault(true); err != nil {
+		return err
 	}
-	mfs, isTernary, err := Buildmfs(entry.TableField)
+	return P4RtC.DeleteTableEntry(Ctx, entry)
+}
+
+// EntryExists checks if the entry is among the entries read from its table
+func EntryExists(entry TableEntry, programmed []*p4_v1.TableEntry) (bool, error) {
+	entryP, err := newTableEntry(entry, nil)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range programmed {
+		if sameMatch(entryP, p) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DelEntry deletes the entry
+func DelEntry(entry TableEntry) error {
+	entryP, err := newTableEntry(entry, nil)
 	if err != nil {
 		log.Fatalf("intel-e2000: Error in Building mfs: %v", err)
 		return err
 	}
+	if IsStandby() {
+		return nil
+	}
+	if err := injectFault(true); err != nil {
+		return err
+	}
+	return P4RtC.DeleteTableEntry(Ctx, entryP)
+}
+
+// buildEntry builds the p4runtime table entry carrying the action, the
+// integer params share one buffer
+func buildEntry(entry TableEntry) (*p4_v1.TableEntry, error) {
+	var size int
+	for _, param := range entry.Action.Params {
+		switch param.(type) {
+		case uint16:
+			size += 2
+		case uint32:
+			size += 4
+		}
+	}
+	buf := make([]byte, size)
 	params := make([][]byte, len(entry.Action.Params))
 	for i := 0; i < len(entry.Action.Params); i++ {
 		switch v := entry.Action.Params[i].(type) {
 		case uint16:
-			buf := new(bytes.Buffer)
-			err1 := binary.Write(buf, binary.BigEndian, v)
-			if err1 != nil {
-				log.Println("intel-e2000: binary.Write failed:", err1)
-				return err1
-			}
-			params[i] = buf.Bytes()
+			binary.BigEndian.PutUint16(buf, v)
+			params[i], buf = buf[:2:2], buf[2:]
 		case uint32:
-			buf := new(bytes.Buffer)
-			err1 := binary.Write(buf, binary.BigEndian, v)
-			if err1 != nil {
-				log.Println("inte-e2000: binary.Write failed:", err1)
-				return err1
-			}
-			params[i] = buf.Bytes()
+			binary.BigEndian.PutUint32(buf, v)
+			params[i], buf = buf[:4:4], buf[4:]
 		case net.HardwareAddr:
 			params[i] = v
 		case net.IP:
 			params[i] = v
 		default:
 			log.Println("intel-e2000: Unknown actionparam", v)
-			return nil
+			return nil, nil
 		}
 	}
 
 	actionSet := P4RtC.NewTableActionDirect(entry.Action.ActionName, params)
 
-	if isTernary {
-		entryP := P4RtC.NewTableEntry(entry.Tablename, mfs, actionSet, Options)
-		return P4RtC.InsertTableEntry(Ctx, entryP)
+	entryP, err := newTableEntry(entry, actionSet)
+	if err != nil {
+		log.Fatalf("intel-e2000: Error in Building mfs: %v", err)
+		return nil, err
+	}
+	return entryP, nil
+}
+
+// AddEntry adds an entry
+func AddEntry(entry TableEntry) error {
+	entryP, err := buildEntry(entry)
+	if entryP == nil {
+		return err
+	}
+	if IsStandby() {
+		return nil
+	}
+	if err := injectFault(true); err != nil {
+		return err
 	}
-	entryP := P4RtC.NewTableEntry(entry.Tablename, mfs, actionSet, nil)
 	return P4RtC.InsertTableEntry(Ctx, entryP)
 }
 
+// ModEntry modifies the action of an entry already programmed
+func ModEntry(entry TableEntry) error {
+	entryP, err := buildEntry(entry)
+	if entryP == nil {
+		return err
+	}
+	if IsStandby() {
+		return nil
+	}
+	if err := injectFault(true); err != nil {
+		return err
+	}
+	return P4RtC.ModifyTableEntry(Ctx, entryP)
+}
+
+// SetMeter configures the rates of a meter cell, the rates are in the unit of
+// the meter, a nil config resets the cell to its default
+func SetMeter(meter string, index int64, config *p4_v1.MeterConfig) error {
+	if IsStandby() {
+		return nil
+	}
+	meterID, err := meterID(meter)
+	if err != nil {
+		return err
+	}
+	if err := injectFault(true); err != nil {
+		return err
+	}
+	// The client has no meter modify, the entry is written as an update
+	return P4RtC.WriteUpdate(Ctx, &p4_v1.Update{
+		Type: p4_v1.Update_MODIFY,
+		Entity: &p4_v1.Entity{Entity: &p4_v1.Entity_MeterEntry{MeterEntry: &p4_v1.MeterEntry{
+			MeterId: meterID,
+			Index:   &p4_v1.Index{Index: index},
+			Config:  config,
+		}}},
+	})
+}
+
 // StopCh is used to when to stop the p4rtc when a terminate signal is generated
 var StopCh = make(chan struct{})
 
+// loadFwdPipe loads the p4info of the pipe set by the previous primary into
+// the client, a standby never sets the pipe itself
+func loadFwdPipe() error {
+	pipe, err := P4RtC.GetFwdPipe(Ctx, client.GetFwdPipeP4InfoAndCookie)
+	if err != nil {
+		return err
+	}
+	if pipe == nil || pipe.P4Info == nil {
+		return ErrNoP4Info
+	}
+	setP4Info(pipe)
+	return nil
+}
+
 // NewP4RuntimeClient get the p4 runtime client
 func NewP4RuntimeClient(binPath string, p4infoPath string, conn *grpc.ClientConn) error {
+	return NewP4RuntimeClientWithRole(binPath, p4infoPath, conn, 1, false, nil)
+}
+
+// NewP4RuntimeClientWithRole get the p4 runtime client with the given election
+// id. A standby keeps its stream open without setting the forwarding pipe nor
+// writing, once the server elects it primary it calls promoted and writes
+// from then on, the tables of the previous primary are left in place
+func NewP4RuntimeClientWithRole(binPath string, p4infoPath string, conn *grpc.ClientConn, election uint64, asStandby bool, promoted func()) error {
 	Ctx = context.Background()
 	c := p4_v1.NewP4RuntimeClient(conn)
 	resp, err := c.Capabilities(Ctx, &p4_v1.CapabilitiesRequest{})
@@ -230,8 +500,9 @@ func NewP4RuntimeClient(binPath string, p4infoPath string, conn *grpc.ClientConn
 	}
 	log.Printf("intel-e2000: P4Runtime server version is %s", resp.P4RuntimeApiVersion)
 
-	electionID := &p4_v1.Uint128{High: 0, Low: 1}
+	electionID := &p4_v1.Uint128{High: 0, Low: election}
 
+	standby.Store(asStandby)
 	P4RtC = client.NewClient(c, defaultDeviceID, electionID)
 	arbitrationCh := make(chan bool)
 
@@ -247,7 +518,16 @@ func NewP4RuntimeClient(binPath string, p4infoPath string, conn *grpc.ClientConn
 		for isPrimary := range arbitrationCh {
 			if isPrimary {
 				log.Println("We are the primary client!")
-				if !sent {
+				if IsStandby() {
+					// The client only knows the tables once it has the p4info
+					if err := loadFwdPipe(); err != nil {
+						log.Printf("intel-e2000: Failed to load the forwarding pipe on promotion: %v\n", err)
+					}
+					if standby.Swap(false) && promoted != nil {
+						go promoted()
+					}
+				}
+				if !sent && !asStandby {
 					waitCh <- struct{}{}
 					sent = true
 				}
@@ -257,6 +537,10 @@ func NewP4RuntimeClient(binPath string, p4infoPath string, conn *grpc.ClientConn
 		}
 	}()
 
+	if asStandby {
+		log.Printf("intel-e2000: Standing by with election id %d\n", election)
+		return nil
+	}
 	func() {
 		timeout := 5 * time.Second
 		Ctx2, cancel := context.WithTimeout(Ctx, timeout)
@@ -270,9 +554,11 @@ func NewP4RuntimeClient(binPath string, p4infoPath string, conn *grpc.ClientConn
 		}
 	}()
 	log.Println("Setting forwarding pipe")
-	if _, err := P4RtC.SetFwdPipe(Ctx, binPath, p4infoPath, 0); err != nil {
+	pipe, err := P4RtC.SetFwdPipe(Ctx, binPath, p4infoPath, 0)
+	if err != nil {
 		log.Fatal("Error when setting forwarding pipe: ", err)
 		return err
 	}
+	setP4Info(pipe)
 	return nil
 }
@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4driverapi handles p4 driver realted functionality
+package p4driverapi
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	p4_config_v1 "github.com/p4lang/p4runtime/go/p4/config/v1"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// testTable table of the test pipeline, its keys cover the match kinds
+const testTable = "evpn_gw_control.test_table"
+
+// testAction action of the test table
+const testAction = "evpn_gw_control.test_action"
+
+// testP4Info p4info of the test pipeline
+func testP4Info() *p4_config_v1.P4Info {
+	return &p4_config_v1.P4Info{
+		Tables: []*p4_config_v1.Table{{
+			Preamble: &p4_config_v1.Preamble{Id: 1, Name: testTable},
+			MatchFields: []*p4_config_v1.MatchField{
+				{Id: 1, Name: "vni", Bitwidth: 32, Match: &p4_config_v1.MatchField_MatchType_{MatchType: p4_config_v1.MatchField_EXACT}},
+				{Id: 2, Name: "dst_ip", Bitwidth: 128, Match: &p4_config_v1.MatchField_MatchType_{MatchType: p4_config_v1.MatchField_TERNARY}},
+			},
+			ActionRefs: []*p4_config_v1.ActionRef{{Id: 2}},
+		}},
+		Actions: []*p4_config_v1.Action{{
+			Preamble: &p4_config_v1.Preamble{Id: 2, Name: testAction},
+			Params:   []*p4_config_v1.Action_Param{{Id: 1, Name: "port", Bitwidth: 16}},
+		}},
+	}
+}
+
+// fakeP4Server p4runtime server keeping the pipe and the writes, it elects
+// the client primary unless standby is set and reports counter on the reads
+type fakeP4Server struct {
+	p4_v1.UnimplementedP4RuntimeServer
+	mu      sync.Mutex
+	pipe    *p4_v1.ForwardingPipelineConfig
+	writes  []*p4_v1.Update
+	reads   []*p4_v1.Entity
+	counter *p4_v1.CounterData
+	standby bool
+	promote chan struct{}
+}
+
+func (s *fakeP4Server) Capabilities(context.Context, *p4_v1.CapabilitiesRequest) (*p4_v1.CapabilitiesResponse, error) {
+	return &p4_v1.CapabilitiesResponse{P4RuntimeApiVersion: "1.4.0"}, nil
+}
+
+// arbitration builds the arbitration update of the given status
+func arbitration(code codes.Code) *p4_v1.StreamMessageResponse {
+	return &p4_v1.StreamMessageResponse{Update: &p4_v1.StreamMessageResponse_Arbitration{
+		Arbitration: &p4_v1.MasterArbitrationUpdate{DeviceId: defaultDeviceID, Status: &rpcstatus.Status{Code: int32(code)}},
+	}}
+}
+
+func (s *fakeP4Server) StreamChannel(stream p4_v1.P4Runtime_StreamChannelServer) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	if s.standby {
+		if err := stream.Send(arbitration(codes.AlreadyExists)); err != nil {
+			return err
+		}
+		select {
+		case <-s.promote:
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+	if err := stream.Send(arbitration(codes.OK)); err != nil {
+		return err
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+func (s *fakeP4Server) SetForwardingPipelineConfig(_ context.Context, req *p4_v1.SetForwardingPipelineConfigRequest) (*p4_v1.SetForwardingPipelineConfigResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pipe = req.GetConfig()
+	return &p4_v1.SetForwardingPipelineConfigResponse{}, nil
+}
+
+func (s *fakeP4Server) GetForwardingPipelineConfig(context.Context, *p4_v1.GetForwardingPipelineConfigRequest) (*p4_v1.GetForwardingPipelineConfigResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &p4_v1.GetForwardingPipelineConfigResponse{Config: s.pipe}, nil
+}
+
+func (s *fakeP4Server) Write(_ context.Context, req *p4_v1.WriteRequest) (*p4_v1.WriteResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range req.GetUpdates() {
+		if e := u.GetEntity().GetTableEntry(); e != nil && e.GetTableId() == 0 {
+			return nil, status.Error(codes.InvalidArgument, "unknown table")
+		}
+		s.writes = append(s.writes, u)
+	}
+	return &p4_v1.WriteResponse{}, nil
+}
+
+func (s *fakeP4Server) Read(req *p4_v1.ReadRequest, stream p4_v1.P4Runtime_ReadServer) error {
+	s.mu.Lock()
+	s.reads = append(s.reads, req.GetEntities()...)
+	counter := s.counter
+	s.mu.Unlock()
+	var entities []*p4_v1.Entity
+	for _, e := range req.GetEntities() {
+		entry, ok := proto.Clone(e.GetTableEntry()).(*p4_v1.TableEntry)
+		if !ok || entry == nil {
+			continue
+		}
+		if entry.GetCounterData() != nil {
+			entry.CounterData = counter
+		}
+		entities = append(entities, &p4_v1.Entity{Entity: &p4_v1.Entity_TableEntry{TableEntry: entry}})
+	}
+	return stream.Send(&p4_v1.ReadResponse{Entities: entities})
+}
+
+// startFakeServer serves the fake server in memory and connects a client to
+// it, the pipe of the server is the test one when set
+func startFakeServer(t *testing.T, s *fakeP4Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	p4_v1.RegisterP4RuntimeServer(srv, s)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// pipeFiles writes the test pipe to the files the client loads
+func pipeFiles(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "pipe.bin")
+	info := filepath.Join(dir, "p4info.txt")
+	text, err := prototext.Marshal(testP4Info())
+	if err != nil {
+		t.Fatalf("marshal p4info: %v", err)
+	}
+	if err := os.WriteFile(bin, []byte{0}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(info, text, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return bin, info
+}
+
+// testEntry entry of the test table with a ternary address
+func testEntry(dst net.IP) TableEntry {
+	return TableEntry{
+		Tablename: testTable,
+		TableField: TableField{
+			FieldValue: map[string][2]interface{}{
+				"vni":    {uint32(10), "exact"},
+				"dst_ip": {dst, "ternary"},
+			},
+			Priority: int32(1),
+		},
+		Action: Action{
+			ActionName: testAction,
+			Params:     []interface{}{uint16(3)},
+		},
+	}
+}
+
+func TestReadCounter(t *testing.T) {
+	s := &fakeP4Server{counter: &p4_v1.CounterData{ByteCount: 1500, PacketCount: 3}}
+	conn := startFakeServer(t, s)
+	bin, info := pipeFiles(t)
+	if err := NewP4RuntimeClient(bin, info, conn); err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	data, err := ReadCounter(testEntry(net.ParseIP("10.0.0.1").To4()))
+	if err != nil {
+		t.Fatalf("read counter: %v", err)
+	}
+	if data.GetByteCount() != 1500 || data.GetPacketCount() != 3 {
+		t.Fatalf("counter %v, want 1500 bytes 3 packets", data)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.reads) != 1 {
+		t.Fatalf("%d entities read, want 1", len(s.reads))
+	}
+	read := s.reads[0].GetTableEntry()
+	if read.GetTableId() != 1 || read.GetCounterData() == nil || len(read.GetMatch()) != 2 {
+		t.Fatalf("read %v does not ask the counter of the entry", read)
+	}
+}
+
+func TestStandbyPromotion(t *testing.T) {
+	p4Info.Store(nil)
+	// The pipe was set by the previous primary
+	s := &fakeP4Server{standby: true, promote: make(chan struct{}), pipe: &p4_v1.ForwardingPipelineConfig{P4Info: testP4Info()}}
+	conn := startFakeServer(t, s)
+	promoted := make(chan struct{})
+	if err := NewP4RuntimeClientWithRole("", "", conn, 2, true, func() { close(promoted) }); err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	entry := testEntry(net.ParseIP("2001:db8::1"))
+	if err := AddEntry(entry); err != nil || len(s.writes) != 0 {
+		t.Fatalf("standby wrote the entry: %v", err)
+	}
+	close(s.promote)
+	select {
+	case <-promoted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("standby not promoted")
+	}
+	if err := AddEntry(entry); err != nil {
+		t.Fatalf("add after promotion: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.writes) != 1 || s.writes[0].GetEntity().GetTableEntry().GetTableId() != 1 {
+		t.Fatalf("writes %v, want the entry of table 1", s.writes)
+	}
+	if _, err := MatchFieldWidth(testTable, "dst_ip"); err != nil {
+		t.Fatalf("p4info not loaded on promotion: %v", err)
+	}
+}
+
+func TestTernaryMaskWidth(t *testing.T) {
+	conn := startFakeServer(t, &fakeP4Server{})
+	bin, info := pipeFiles(t)
+	if err := NewP4RuntimeClient(bin, info, conn); err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	for _, dst := range []string{"10.1.2.3", "2001:db8::1"} {
+		ip := net.ParseIP(dst)
+		want := ip.To4()
+		if want == nil {
+			want = ip
+		}
+		// Both the address and the prefix forms of the field
+		_, prefix, _ := net.ParseCIDR(dst + "/24")
+		for _, value := range []interface{}{ip, &net.IPNet{IP: ip, Mask: prefix.Mask}} {
+			entry := testEntry(nil)
+			entry.FieldValue["dst_ip"] = [2]interface{}{value, "ternary"}
+			entryP, err := newTableEntry(entry, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", dst, err)
+			}
+			var ternary *p4_v1.FieldMatch_Ternary
+			for _, m := range entryP.GetMatch() {
+				if m.GetFieldId() == 2 {
+					ternary = m.GetTernary()
+				}
+			}
+			if ternary == nil {
+				t.Fatalf("%s: no ternary match in %v", dst, entryP)
+			}
+			if len(ternary.GetMask()) != len(want) || !net.IP(ternary.GetValue()).Equal(want) {
+				t.Fatalf("%s: value %x mask %x, want the %d bytes of the address", dst, ternary.GetValue(), ternary.GetMask(), len(want))
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4driverapi handles p4 driver realted functionality
+//
+//nolint:all
+package p4driverapi
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/antoninbas/p4runtime-go-client/pkg/client"
+	p4_config_v1 "github.com/p4lang/p4runtime/go/p4/config/v1"
+)
+
+// ErrNoP4Info no p4info was loaded with the forwarding pipe
+var ErrNoP4Info = errors.New("no p4info loaded")
+
+// p4Info p4info of the forwarding pipe set by the client
+var p4Info atomic.Pointer[p4_config_v1.P4Info]
+
+// setP4Info stores the p4info of the forwarding pipe
+func setP4Info(pipe *client.FwdPipeConfig) {
+	if pipe != nil && pipe.P4Info != nil {
+		p4Info.Store(pipe.P4Info)
+	}
+}
+
+// findTable returns the p4info of a table
+func findTable(info *p4_config_v1.P4Info, name string) *p4_config_v1.Table {
+	for _, table := range info.GetTables() {
+		if table.GetPreamble().GetName() == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// findAction returns the p4info of an action
+func findAction(info *p4_config_v1.P4Info, name string) *p4_config_v1.Action {
+	for _, action := range info.GetActions() {
+		if action.GetPreamble().GetName() == name {
+			return action
+		}
+	}
+	return nil
+}
+
+// meterID returns the p4info id of a meter
+func meterID(name string) (uint32, error) {
+	info := p4Info.Load()
+	if info == nil {
+		return 0, ErrNoP4Info
+	}
+	for _, meter := range info.GetMeters() {
+		if meter.GetPreamble().GetName() == name {
+			return meter.GetPreamble().GetId(), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown meter %s", name)
+}
+
+// MatchFieldWidth returns the bit width of a match field of a table
+func MatchFieldWidth(table string, field string) (int32, error) {
+	info := p4Info.Load()
+	if info == nil {
+		return 0, ErrNoP4Info
+	}
+	t := findTable(info, table)
+	if t == nil {
+		return 0, fmt.Errorf("unknown table %s", table)
+	}
+	for _, mf := range t.GetMatchFields() {
+		if mf.GetName() == field {
+			return mf.GetBitwidth(), nil
+		}
+	}
+	return 0, fmt.Errorf("table %s has no match field %s", table, field)
+}
+
+// ActionParamWidths returns the bit widths of the params of an action
+func ActionParamWidths(action string) ([]int32, error) {
+	info := p4Info.Load()
+	if info == nil {
+		return nil, ErrNoP4Info
+	}
+	a := findAction(info, action)
+	if a == nil {
+		return nil, fmt.Errorf("unknown action %s", action)
+	}
+	widths := make([]int32, 0, len(a.GetParams()))
+	for _, param := range a.GetParams() {
+		widths = append(widths, param.GetBitwidth())
+	}
+	return widths, nil
+}
+
+// matchTypes match kinds of the entries by p4info match type
+var matchTypes = map[p4_config_v1.MatchField_MatchType]string{
+	p4_config_v1.MatchField_EXACT:   "exact",
+	p4_config_v1.MatchField_LPM:     lpmStr,
+	p4_config_v1.MatchField_TERNARY: ternaryStr,
+}
+
+// ValidateEntry checks an entry against the p4info, the table, its match
+// fields and their match kind, the action being one of the table and its
+// number of params
+func ValidateEntry(entry TableEntry) error {
+	info := p4Info.Load()
+	if info == nil {
+		return ErrNoP4Info
+	}
+	t := findTable(info, entry.Tablename)
+	if t == nil {
+		return fmt.Errorf("unknown table %s", entry.Tablename)
+	}
+	fields := make(map[string]*p4_config_v1.MatchField)
+	for _, mf := range t.GetMatchFields() {
+		fields[mf.GetName()] = mf
+	}
+	for name, value := range entry.FieldValue {
+		mf, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("table %s has no match field %s", entry.Tablename, name)
+		}
+		if kind, _ := value[1].(string); matchTypes[mf.GetMatchType()] != kind {
+			return fmt.Errorf("match field %s of table %s is not %s", name, entry.Tablename, kind)
+		}
+	}
+	if len(entry.FieldValue) != len(fields) {
+		return fmt.Errorf("table %s has %d match fields, got %d", entry.Tablename, len(fields), len(entry.FieldValue))
+	}
+	a := findAction(info, entry.ActionName)
+	if a == nil {
+		return fmt.Errorf("unknown action %s", entry.ActionName)
+	}
+	var ref bool
+	for _, r := range t.GetActionRefs() {
+		if r.GetId() == a.GetPreamble().GetId() {
+			ref = true
+			break
+		}
+	}
+	if !ref {
+		return fmt.Errorf("action %s is not an action of table %s", entry.ActionName, entry.Tablename)
+	}
+	if len(entry.Params) != len(a.GetParams()) {
+		return fmt.Errorf("action %s takes %d params, got %d", entry.ActionName, len(a.GetParams()), len(entry.Params))
+	}
+	return nil
+}
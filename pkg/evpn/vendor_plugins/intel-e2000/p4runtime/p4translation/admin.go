@@ -0,0 +1,782 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// AdminPrefix path prefix of the intel-e2000 admin api
+const AdminPrefix = "/v1/intel-e2000/"
+
+// adminAPIKey config key of the admin api section
+const adminAPIKey = "adminapi"
+
+// defaultAdminListen address of the admin api, loopback so the destructive
+// endpoints are not reachable from the network unless configured
+const defaultAdminListen = "127.0.0.1:8083"
+
+// AdminAPIConfig admin api config structure, the address its own listener
+// binds apart from the gateway
+type AdminAPIConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+// AdminListenAddress returns the address the admin api listens on
+func AdminListenAddress() string {
+	cfg := AdminAPIConfig{}
+	if err := viper.UnmarshalKey(adminAPIKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read admin api config: %v\n", err)
+	}
+	if cfg.Listen == "" {
+		return defaultAdminListen
+	}
+	return cfg.Listen
+}
+
+// adminScope callers an admin endpoint is open to
+type adminScope int
+
+const (
+	// scopeOperator endpoints of the operator only
+	scopeOperator adminScope = iota
+	// scopeTenant endpoints open to the tenants too, their handlers filter
+	// the objects by the scope of the request
+	scopeTenant
+)
+
+// adminEndpoint endpoint of the admin api, the path is relative to the
+// admin prefix and a trailing slash serves the subtree
+type adminEndpoint struct {
+	path    string
+	scope   adminScope
+	handler http.HandlerFunc
+}
+
+// adminEndpoints registry of the admin api endpoints, each one registered
+// next to its handler
+var adminEndpoints []adminEndpoint
+
+// registerAdmin registers an endpoint of the admin api with the scope of the
+// callers it is open to
+func registerAdmin(path string, scope adminScope, handler http.HandlerFunc) bool {
+	adminEndpoints = append(adminEndpoints, adminEndpoint{path: path, scope: scope, handler: handler})
+	return true
+}
+
+// writeJSON writes the value as json response
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("intel-e2000: failed to encode admin response: %v\n", err)
+	}
+}
+
+// handleUplinks returns the negotiated link state of the uplinks
+func handleUplinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, UplinkLinkStates())
+}
+
+var _ = registerAdmin("uplinks", scopeOperator, handleUplinks)
+
+// handlePorts lists the ports shut administratively on GET, and disables or
+// enables a port on POST <prefix>ports/<name>/disable|enable
+func handlePorts(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPrefix+"ports"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, PortStates())
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || (parts[1] != "disable" && parts[1] != "enable") {
+		http.Error(w, "expected ports/<name>/disable or ports/<name>/enable", http.StatusNotFound)
+		return
+	}
+	if err := SetPortAdminState(parts[0], parts[1] == "enable"); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrUnknownPort) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusOK, PortState{Name: parts[0], AdminDown: parts[1] == "disable"})
+}
+
+var _ = registerAdmin("ports", scopeOperator, handlePorts)
+
+var _ = registerAdmin("ports/", scopeOperator, handlePorts)
+
+// handleDampening returns the flap dampening state of the ports
+func handleDampening(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, DampeningStates())
+}
+
+var _ = registerAdmin("dampening", scopeOperator, handleDampening)
+
+// handleEventStream returns the event stream statistics
+func handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, StreamStats())
+}
+
+var _ = registerAdmin("eventstream", scopeOperator, handleEventStream)
+
+// handleLatency returns the translation latencies and queue depths on GET and
+// clears the latencies on DELETE
+func handleLatency(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, GetLatencyStats())
+	case http.MethodDelete:
+		ResetLatencyStats()
+		writeJSON(w, http.StatusOK, GetLatencyStats())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+var _ = registerAdmin("latency", scopeOperator, handleLatency)
+
+// handleBackpressure returns the back-pressure state of the event producers
+func handleBackpressure(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetBackpressureStats())
+}
+
+var _ = registerAdmin("backpressure", scopeOperator, handleBackpressure)
+
+// handleDependencies lists the objects waiting for their prerequisites
+func handleDependencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, WaitingObjects())
+}
+
+var _ = registerAdmin("dependencies", scopeOperator, handleDependencies)
+
+// handlePending lists the objects waiting for a late detail
+func handlePending(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, PendingObjects())
+}
+
+var _ = registerAdmin("pending", scopeOperator, handlePending)
+
+// handleBulk lists the background programming of the trunk bridge ports
+func handleBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, BulkJobs())
+}
+
+var _ = registerAdmin("bulk", scopeOperator, handleBulk)
+
+// handleStaticEntries lists the operator static entries on GET, declares or
+// replaces one on POST and removes one on DELETE
+func handleStaticEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, StaticEntries())
+		return
+	}
+	var s StaticEntry
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = SetStaticEntry(s)
+	case http.MethodDelete:
+		err = DeleteStaticEntry(s.Name)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+var _ = registerAdmin("staticentries", scopeOperator, handleStaticEntries)
+
+// handleDropRules lists the drop rules with their counters on GET, installs
+// or replaces one on POST and removes one on DELETE
+func handleDropRules(w http.ResponseWriter, r *http.Request) {
+	scope := requestScope(r)
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, scopedDropRules(scope))
+		return
+	}
+	var d DropRule
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if scope != nil && !dropRuleInScope(scope, d, r.Method == http.MethodDelete) {
+		http.Error(w, "drop rule out of the tenant scope", http.StatusForbidden)
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = SetDropRule(d)
+	case http.MethodDelete:
+		err = DeleteDropRule(d.Name)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+var _ = registerAdmin("droprules", scopeTenant, handleDropRules)
+
+// handleDrain returns the drain state on GET, drains the gateway on POST,
+// costing out the ecmp members of the ports of the body, and resumes it on
+// DELETE
+func handleDrain(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Ports []string `json:"ports"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		err = Drain(req.Ports)
+	case http.MethodDelete:
+		err = Resume()
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetDrainState())
+}
+
+var _ = registerAdmin("drain", scopeOperator, handleDrain)
+
+// handleCanary returns the state of the last canary on GET, starts a canary
+// reload on POST and rolls the running canary back on DELETE
+func handleCanary(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		err = StartCanary()
+	case http.MethodDelete:
+		err = AbortCanary()
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetCanaryState())
+}
+
+var _ = registerAdmin("canary", scopeOperator, handleCanary)
+
+// handleForeign returns the foreign entries found by the startup scan
+func handleForeign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, ForeignEntries())
+}
+
+var _ = registerAdmin("foreign", scopeOperator, handleForeign)
+
+// handleRouteProbes returns the routes probed, the silent ones with the
+// number of routes verified
+func handleRouteProbes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	scope := requestScope(r)
+	if scope != nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"routes": scopedRouteProbes(scope)})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"verified": RoutesVerified(),
+		"routes":   RouteProbes(),
+	})
+}
+
+var _ = registerAdmin("routeprobes", scopeTenant, handleRouteProbes)
+
+// handleChurn returns the top flapping prefixes and nexthops, the minutes and
+// top query parameters override the configured window and count
+func handleChurn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var minutes, top int
+	for name, value := range map[string]*int{"minutes": &minutes, "top": &top} {
+		param := r.URL.Query().Get(name)
+		if param == "" {
+			continue
+		}
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid "+name, http.StatusBadRequest)
+			return
+		}
+		*value = n
+	}
+	writeJSON(w, http.StatusOK, scopedChurn(requestScope(r), Churn(minutes, top)))
+}
+
+var _ = registerAdmin("churn", scopeTenant, handleChurn)
+
+// handleNeighbors lists the static neighbors on GET, installs one on POST and
+// removes one on DELETE
+func handleNeighbors(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, StaticNeighbors())
+		return
+	}
+	var n StaticNeighbor
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = AddStaticNeighbor(n)
+	case http.MethodDelete:
+		err = DeleteStaticNeighbor(n)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, n)
+}
+
+var _ = registerAdmin("neighbors", scopeOperator, handleNeighbors)
+
+// handleRouteCandidates lists the routes of the prefixes learnt from more
+// than one protocol
+func handleRouteCandidates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, RouteCandidates())
+}
+
+var _ = registerAdmin("routes/candidates", scopeOperator, handleRouteCandidates)
+
+// handleRoutes lists the injected routes on GET, injects one on POST and
+// withdraws one on DELETE
+func handleRoutes(w http.ResponseWriter, r *http.Request) {
+	scope := requestScope(r)
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, scopedRoutes(scope))
+		return
+	}
+	var route StaticRoute
+	if err := json.NewDecoder(r.Body).Decode(&route); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !scope.allows(route.Vrf) {
+		http.Error(w, "vrf out of the tenant scope", http.StatusForbidden)
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = InjectRoute(route)
+	case http.MethodDelete:
+		err = WithdrawRoute(route)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, route)
+}
+
+var _ = registerAdmin("routes", scopeTenant, handleRoutes)
+
+// handlePools returns the contents of the id pools
+func handlePools(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, PoolStatuses())
+}
+
+var _ = registerAdmin("pools", scopeOperator, handlePools)
+
+// handleDrift returns the static entry watchdog statistics
+func handleDrift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, StaticDriftStats())
+}
+
+var _ = registerAdmin("drift", scopeOperator, handleDrift)
+
+// handleReconciler returns the reconciler statistics on GET and runs a
+// reconciliation pass on POST
+func handleReconciler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, GetReconcilerStats())
+	case http.MethodPost:
+		writeJSON(w, http.StatusOK, Reconcile())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+var _ = registerAdmin("reconciler", scopeOperator, handleReconciler)
+
+// handleTables returns the occupancy and capacity of the tables
+func handleTables(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, TableUsages())
+}
+
+var _ = registerAdmin("tables", scopeOperator, handleTables)
+
+// handleTableFlush flushes a table and programs it again
+func handleTableFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPrefix+"tables"), "/")
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "flush" {
+		http.Error(w, "expected tables/<name>/flush", http.StatusNotFound)
+		return
+	}
+	report, err := FlushTable(parts[0])
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrDeviceUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+var _ = registerAdmin("tables/", scopeOperator, handleTableFlush)
+
+// handleTcam returns the last tcam conflicts detected
+func handleTcam(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, TcamConflicts())
+}
+
+var _ = registerAdmin("tcam", scopeOperator, handleTcam)
+
+// handleTrie returns the trie index garbage collection statistics on GET and
+// reclaims the leaked trie indexes on POST
+func handleTrie(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, GetTrieGcStats())
+	case http.MethodPost:
+		writeJSON(w, http.StatusOK, CompactTrieIndexes())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+var _ = registerAdmin("trie", scopeOperator, handleTrie)
+
+// handleModPointers returns the mod pointer leak detection statistics on GET
+// and removes the orphaned mod entries on POST
+func handleModPointers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, GetModGcStats())
+	case http.MethodPost:
+		writeJSON(w, http.StatusOK, CleanModLeaks())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+var _ = registerAdmin("modptr", scopeOperator, handleModPointers)
+
+// handleAntiSpoof returns the mac anti-spoofing violations of the bridge ports
+func handleAntiSpoof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, SpoofViolations())
+}
+
+var _ = registerAdmin("antispoof", scopeOperator, handleAntiSpoof)
+
+// handleIPSourceGuard lists the ip source guard bindings on GET, adds one on
+// POST and removes one on DELETE
+func handleIPSourceGuard(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, IPSourceBindings())
+		return
+	}
+	var b IPSourceBinding
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = AddIPSourceBinding(b)
+	case http.MethodDelete:
+		err = DeleteIPSourceBinding(b)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+var _ = registerAdmin("ipsourceguard", scopeOperator, handleIPSourceGuard)
+
+// handleIPGuardViolations returns the ip source guard violations of the
+// bridge ports
+func handleIPGuardViolations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, IPGuardViolations())
+}
+
+var _ = registerAdmin("ipsourceguard/violations", scopeOperator, handleIPGuardViolations)
+
+// handleFailover returns the role of the instance in the failover pair
+func handleFailover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetFailoverState())
+}
+
+var _ = registerAdmin("failover", scopeOperator, handleFailover)
+
+// handleNexthopMtus returns the mtu of the egress devices of the nexthops
+func handleNexthopMtus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, scopedNexthopMtus(requestScope(r)))
+}
+
+var _ = registerAdmin("nexthops/mtu", scopeTenant, handleNexthopMtus)
+
+// handleTenant returns the scope of the request, null for the operator
+func handleTenant(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, requestScope(r))
+}
+
+var _ = registerAdmin("tenant", scopeTenant, handleTenant)
+
+// handleTenantFlush reprograms the routes of the vrfs in the scope of the
+// request
+func handleTenantFlush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"routes": FlushTenant(requestScope(r))})
+}
+
+var _ = registerAdmin("tenant/flush", scopeTenant, handleTenantFlush)
+
+// handleNexthopStatus returns the operational state of the nexthops
+func handleNexthopStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, scopedNexthopStatuses(requestScope(r)))
+}
+
+var _ = registerAdmin("nexthops/status", scopeTenant, handleNexthopStatus)
+
+// handleNeighborOffload returns the neighbors offloaded from the kernel events
+func handleNeighborOffload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, OffloadedNeighbors())
+}
+
+var _ = registerAdmin("neighbors/offload", scopeOperator, handleNeighborOffload)
+
+// handleIpfix returns the ipfix export statistics
+func handleIpfix(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetIpfixStats())
+}
+
+var _ = registerAdmin("ipfix", scopeOperator, handleIpfix)
+
+// handleChaos returns the injected failures, the failure injection is only
+// set from the config file
+func handleChaos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, GetChaosStats())
+}
+
+var _ = registerAdmin("chaos", scopeOperator, handleChaos)
+
+// handleIntents returns the intents not acknowledged yet
+func handleIntents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, PendingIntents())
+}
+
+var _ = registerAdmin("intents", scopeOperator, handleIntents)
+
+// handleSviCounters returns the routed traffic of the svis
+func handleSviCounters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, SviCounterStats())
+}
+
+var _ = registerAdmin("svicounters", scopeOperator, handleSviCounters)
+
+// handleOpenconfig returns the openconfig network-instances or interfaces
+// state tree, the network-instances config is set through gnmi
+func handleOpenconfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tree := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPrefix+"openconfig"), "/")
+	switch tree {
+	case "network-instances":
+		writeJSON(w, http.StatusOK, OcNetworkInstanceTree())
+	case "interfaces":
+		writeJSON(w, http.StatusOK, OcInterfaceTree())
+	default:
+		http.Error(w, "expected openconfig/network-instances or openconfig/interfaces", http.StatusNotFound)
+	}
+}
+
+var _ = registerAdmin("openconfig/", scopeOperator, handleOpenconfig)
+
+// AdminHandler returns the handler of the intel-e2000 admin api, every
+// endpoint registered behind the authentication of its scope
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, e := range adminEndpoints {
+		mux.Handle(AdminPrefix+e.path, scopeAdmin(e))
+	}
+	return mux
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// tablePending entries written or removed per table since the last usage read
+var tablePending = make(map[string]int)
+
+// entryCost counts the entries per table
+func entryCost(entries []interface{}) map[string]int {
+	cost := make(map[string]int)
+	for _, entry := range entries {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			cost[e.Tablename]++
+		}
+	}
+	return cost
+}
+
+// notePending records the entries written or removed until the next usage read
+func notePending(entries []interface{}, sign int) {
+	tableLock.Lock()
+	defer tableLock.Unlock()
+	for table, n := range entryCost(entries) {
+		tablePending[table] += sign * n
+	}
+}
+
+// admitEntries checks the tables have room for all the entries of an object
+// before any of them is written and reserves it, the tables with no known
+// capacity or usage are admitted
+func admitEntries(object string, entries []interface{}) error {
+	cost := entryCost(entries)
+	tableLock.Lock()
+	defer tableLock.Unlock()
+	var problems []string
+	for table, n := range cost {
+		capacity := tableCapacity[table]
+		usage, read := tableUsage[table]
+		if capacity <= 0 || !read {
+			continue
+		}
+		remaining := capacity - usage.Entries - tablePending[table]
+		if n > remaining {
+			problems = append(problems, fmt.Sprintf("%s needs %d entries, %d left of %d", table, n, remaining, capacity))
+		}
+	}
+	if len(problems) != 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("intel-e2000: %w, not enough room in the tables for %s: %s", ErrTableFull, object, strings.Join(problems, "; "))
+	}
+	for table, n := range cost {
+		tablePending[table] += n
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"net"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
+)
+
+// antiSpoofKey config key of the mac anti-spoofing section
+const antiSpoofKey = "antispoof"
+
+// AntiSpoofPolicy mac anti-spoofing policy, a violation is punted to the
+// slow path when punt is set and dropped from the bridge otherwise
+type AntiSpoofPolicy struct {
+	Enabled bool `yaml:"enabled"`
+	Punt    bool `yaml:"punt"`
+}
+
+// AntiSpoofConfig mac anti-spoofing config structure, the ports override the
+// default policy per bridge port
+type AntiSpoofConfig struct {
+	Enabled bool                       `yaml:"enabled"`
+	Punt    bool                       `yaml:"punt"`
+	Ports   map[string]AntiSpoofPolicy `yaml:"ports"`
+}
+
+// SpoofStats mac anti-spoofing violations of a bridge port
+type SpoofStats struct {
+	BridgePort string    `json:"bridgeport"`
+	Violations uint64    `json:"violations"`
+	Punted     uint64    `json:"punted"`
+	Dropped    uint64    `json:"dropped"`
+	LastMac    string    `json:"lastmac"`
+	LastTime   time.Time `json:"lasttime"`
+}
+
+var (
+	// antiSpoofCfg mac anti-spoofing configuration read from the config file
+	antiSpoofCfg AntiSpoofConfig
+
+	// spoofLock guards the anti-spoofing config, statistics and blocked entries
+	spoofLock sync.Mutex
+
+	// spoofStats violations keyed by bridge port
+	spoofStats = make(map[string]*SpoofStats)
+
+	// blockedFdbs fdb entries of spoofed macs kept off the device
+	blockedFdbs = make(map[nm.FdbKey]bool)
+)
+
+// loadAntiSpoofConfig reads the mac anti-spoofing config
+func loadAntiSpoofConfig() {
+	var cfg AntiSpoofConfig
+	if err := viper.UnmarshalKey(antiSpoofKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read anti-spoofing config: %v\n", err)
+	}
+	spoofLock.Lock()
+	antiSpoofCfg = cfg
+	spoofLock.Unlock()
+}
+
+// antiSpoofPolicy returns the policy of a bridge port
+func antiSpoofPolicy(bp *infradb.BridgePort) AntiSpoofPolicy {
+	spoofLock.Lock()
+	defer spoofLock.Unlock()
+	if policy, ok := antiSpoofCfg.Ports[path.Base(bp.Name)]; ok {
+		return policy
+	}
+	return AntiSpoofPolicy{Enabled: antiSpoofCfg.Enabled, Punt: antiSpoofCfg.Punt}
+}
+
+// bpOfVport returns the bridge port bound to a vport
+func bpOfVport(vport string) (*infradb.BridgePort, bool) {
+	bps, err := infradb.GetAllBPs()
+	if err != nil {
+		return nil, false
+	}
+	for _, bp := range bps {
+		if bp.Metadata != nil && bp.Metadata.VPort == vport {
+			return bp, true
+		}
+	}
+	return nil, false
+}
+
+// macAllowed checks if the mac is one of the allowed macs
+func macAllowed(mac string, allowed []net.HardwareAddr) bool {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a.String() == hw.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// dropFdb removes the fdb entry of a spoofed mac from the kernel bridge
+func dropFdb(fdb nm.FdbEntryStruct) error {
+	link, err := netlink.LinkByName(fdb.Nexthop.Dev)
+	if err != nil {
+		return err
+	}
+	mac, err := net.ParseMAC(fdb.Mac)
+	if err != nil {
+		return err
+	}
+	return netlink.NeighDel(&netlink.Neigh{
+		LinkIndex:    link.Attrs().Index,
+		Family:       syscall.AF_BRIDGE,
+		HardwareAddr: mac,
+		Vlan:         fdb.VlanID,
+		Flags:        netlink.NTF_MASTER,
+	})
+}
+
+// spoofedFdb checks the source mac of an fdb entry learnt on a bridge port
+// against its allowed macs, a violation is counted and kept off the device
+func spoofedFdb(fdb nm.FdbEntryStruct) bool {
+	if fdb.Type != nm.BRIDGEPORT || fdb.Nexthop == nil {
+		return false
+	}
+	vport, ok := fdb.Nexthop.Metadata["vport_id"].(string)
+	if !ok {
+		return false
+	}
+	bp, ok := bpOfVport(vport)
+	if !ok {
+		return false
+	}
+	policy := antiSpoofPolicy(bp)
+	if !policy.Enabled || macAllowed(fdb.Mac, bpMacs(bp)) {
+		return false
+	}
+
+	spoofLock.Lock()
+	stats, ok := spoofStats[bp.Name]
+	if !ok {
+		stats = &SpoofStats{BridgePort: bp.Name}
+		spoofStats[bp.Name] = stats
+	}
+	stats.Violations++
+	stats.LastMac = fdb.Mac
+	stats.LastTime = time.Now()
+	blockedFdbs[fdb.Key] = true
+	if policy.Punt {
+		stats.Punted++
+	} else {
+		stats.Dropped++
+	}
+	spoofLock.Unlock()
+
+	if policy.Punt {
+		log.Printf("intel-e2000: Bridge port %s sent from mac %s, punting it to the slow path\n", bp.Name, fdb.Mac)
+		return true
+	}
+	log.Printf("intel-e2000: Bridge port %s sent from mac %s, dropping it\n", bp.Name, fdb.Mac)
+	if err := dropFdb(fdb); err != nil {
+		log.Printf("intel-e2000: failed to drop fdb entry of spoofed mac %s: %v\n", fdb.Mac, err)
+	}
+	return true
+}
+
+// unblockFdb forgets a blocked fdb entry, it returns true if it was blocked
+func unblockFdb(key nm.FdbKey) bool {
+	spoofLock.Lock()
+	defer spoofLock.Unlock()
+	blocked := blockedFdbs[key]
+	delete(blockedFdbs, key)
+	return blocked
+}
+
+// fdbBlocked checks if the fdb entry is kept off the device
+func fdbBlocked(key nm.FdbKey) bool {
+	spoofLock.Lock()
+	defer spoofLock.Unlock()
+	return blockedFdbs[key]
+}
+
+// SpoofViolations returns the mac anti-spoofing violations of the bridge ports
+func SpoofViolations() []SpoofStats {
+	spoofLock.Lock()
+	defer spoofLock.Unlock()
+	var stats = make([]SpoofStats, 0, len(spoofStats))
+	for _, s := range spoofStats {
+		stats = append(stats, *s)
+	}
+	return stats
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/common"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/subscriberframework/eventbus"
+	"github.com/spf13/viper"
+)
+
+// backpressureKey config key of the back-pressure section
+const backpressureKey = "backpressure"
+
+// BackpressureConfig back-pressure config structure. Above the high
+// watermark of events and writes waiting, or while the device is down, the
+// infradb objects are handed back for a retry and the netlink events are
+// held in the event stream, whose bound in turn stalls the netlink poller.
+// The watermarks are the ones of the event stream config
+type BackpressureConfig struct {
+	Enabled  bool `yaml:"enabled" json:"enabled"`
+	RetrySec int  `yaml:"retrysec" json:"retrysec"`
+}
+
+// BackpressureStats back-pressure state and statistics
+type BackpressureStats struct {
+	BackpressureConfig
+	HighWatermark int       `json:"highwatermark"`
+	LowWatermark  int       `json:"lowwatermark"`
+	Paused        bool      `json:"paused"`
+	Reason        string    `json:"reason,omitempty"`
+	Since         time.Time `json:"since"`
+	Pauses        uint64    `json:"pauses"`
+	Deferred      uint64    `json:"deferred"`
+	HeldFor       string    `json:"heldfor"`
+	Depth         int       `json:"depth"`
+	heldTotal     time.Duration
+}
+
+var (
+	// backpressureLock guards the back-pressure state
+	backpressureLock sync.Mutex
+
+	// backpressureCfg back-pressure configuration read from the config file
+	backpressureCfg = BackpressureConfig{Enabled: true, RetrySec: 2}
+
+	// backpressureStats back-pressure state and statistics
+	backpressureStats BackpressureStats
+)
+
+// loadBackpressureConfig reads the back-pressure config and applies the
+// defaults
+func loadBackpressureConfig() {
+	cfg := BackpressureConfig{Enabled: true}
+	if err := viper.UnmarshalKey(backpressureKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read back-pressure config: %v\n", err)
+		cfg = BackpressureConfig{Enabled: true}
+	}
+	if cfg.RetrySec <= 0 {
+		cfg.RetrySec = 2
+	}
+	backpressureLock.Lock()
+	backpressureCfg = cfg
+	backpressureLock.Unlock()
+}
+
+// deviceDown checks the writes to the device can not succeed
+func deviceDown() bool {
+	return !GetReadiness().P4Connected || !p4Alive()
+}
+
+// waitingDepth returns the netlink events queued and the entries admitted
+// and not written yet
+func waitingDepth() int {
+	return StreamStats().Queued + pendingWrites()
+}
+
+// backpressured checks the producers have to be held back, the pause lasts
+// until the device is up and the depth falls to the low watermark
+func backpressured() (bool, string) {
+	down := deviceDown()
+	depth := waitingDepth()
+	high, low := streamWatermarks()
+	backpressureLock.Lock()
+	defer backpressureLock.Unlock()
+	cfg := backpressureCfg
+	backpressureStats.Depth = depth
+	if !cfg.Enabled {
+		return false, ""
+	}
+	var reason string
+	switch {
+	case down:
+		reason = "device unavailable"
+	case depth >= high:
+		reason = fmt.Sprintf("%d events and writes waiting", depth)
+	case backpressureStats.Paused && depth > low:
+		reason = backpressureStats.Reason
+	}
+	if reason != "" && !backpressureStats.Paused {
+		backpressureStats.Paused = true
+		backpressureStats.Since = time.Now()
+		backpressureStats.Pauses++
+		log.Printf("intel-e2000: Pausing the event producers, %s\n", reason)
+	}
+	if reason == "" && backpressureStats.Paused {
+		held := time.Since(backpressureStats.Since)
+		backpressureStats.Paused = false
+		backpressureStats.heldTotal += held
+		log.Printf("intel-e2000: Resuming the event producers after %v\n", held)
+	}
+	backpressureStats.Reason = reason
+	return reason != "", reason
+}
+
+// holdEventStream holds the netlink events while the device is down, the
+// event stream fills up and blocks the netlink poller instead of the events
+// failing their writes. A draining gateway only holds the add events, see
+// holdAddEvent
+func holdEventStream() {
+	for {
+		if paused, _ := backpressured(); !paused || !deviceDown() {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// deferObjectEvent hands an infradb object back for a retry without
+// translating it, false when the producers are not held back
+func deferObjectEvent(eventType string, objectData *eventbus.ObjectData) bool {
+	paused, reason := backpressured()
+	if !paused && draining() {
+		paused, reason = true, "gateway draining"
+	}
+	if !paused {
+		return false
+	}
+	backpressureLock.Lock()
+	backpressureStats.Deferred++
+	retry := time.Duration(backpressureCfg.RetrySec) * time.Second
+	backpressureLock.Unlock()
+
+	comp := common.Component{
+		Name:       intele2000Str,
+		CompStatus: common.ComponentStatusError,
+		Details:    fmt.Sprintf("intel-e2000: %s, retrying", reason),
+		Timer:      retry,
+	}
+	var err error
+	switch eventType {
+	case "vrf":
+		err = infradb.UpdateVrfStatus(objectData.Name, objectData.ResourceVersion, objectData.NotificationID, nil, comp)
+	case "logical-bridge":
+		err = infradb.UpdateLBStatus(objectData.Name, objectData.ResourceVersion, objectData.NotificationID, nil, comp)
+	case "bridge-port":
+		err = infradb.UpdateBPStatus(objectData.Name, objectData.ResourceVersion, objectData.NotificationID, nil, comp)
+	case "svi":
+		err = infradb.UpdateSviStatus(objectData.Name, objectData.ResourceVersion, objectData.NotificationID, nil, comp)
+	default:
+		return false
+	}
+	if err != nil {
+		log.Printf("intel-e2000: error in updating %s status: %s\n", eventType, err)
+	}
+	log.Printf("intel-e2000: Deferring %s %s, %s\n", eventType, objectData.Name, reason)
+	return true
+}
+
+// GetBackpressureStats returns the back-pressure state and statistics
+func GetBackpressureStats() BackpressureStats {
+	backpressured()
+	backpressureLock.Lock()
+	defer backpressureLock.Unlock()
+	stats := backpressureStats
+	stats.BackpressureConfig = backpressureCfg
+	stats.HighWatermark, stats.LowWatermark = streamWatermarks()
+	held := stats.heldTotal
+	if stats.Paused {
+		held += time.Since(stats.Since)
+	}
+	stats.HeldFor = held.String()
+	return stats
+}
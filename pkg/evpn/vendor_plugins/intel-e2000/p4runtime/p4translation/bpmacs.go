@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"net"
+	"path"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// bpMacsKey config key of the additional macs of the bridge ports
+const bpMacsKey = "bpmacs"
+
+var (
+	// bpMacLock guards the additional macs programmed
+	bpMacLock sync.Mutex
+
+	// programmedBpMacs additional macs programmed keyed by bridge port, the
+	// entries are removed with the macs they were added with
+	programmedBpMacs = make(map[string][]net.HardwareAddr)
+)
+
+// extraBpMacs returns the macs configured for a bridge port on top of the
+// mac of its spec, e.g. for vms running nested workloads
+func extraBpMacs(bp *infradb.BridgePort) []net.HardwareAddr {
+	var cfg map[string][]string
+	if err := viper.UnmarshalKey(bpMacsKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read bridge port macs: %v\n", err)
+		return nil
+	}
+	var macs []net.HardwareAddr
+	seen := make(map[string]bool)
+	if bp.Spec.MacAddress != nil {
+		seen[bp.Spec.MacAddress.String()] = true
+	}
+	for _, value := range cfg[path.Base(bp.Name)] {
+		mac, err := net.ParseMAC(value)
+		if err != nil {
+			log.Printf("intel-e2000: Ignoring invalid mac %q of bridge port %s\n", value, bp.Name)
+			continue
+		}
+		if seen[mac.String()] {
+			continue
+		}
+		seen[mac.String()] = true
+		macs = append(macs, mac)
+	}
+	return macs
+}
+
+// bpMacs returns all the macs of a bridge port, the mac of its spec first
+func bpMacs(bp *infradb.BridgePort) []net.HardwareAddr {
+	var macs []net.HardwareAddr
+	if bp.Spec.MacAddress != nil {
+		macs = append(macs, *bp.Spec.MacAddress)
+	}
+	return append(macs, extraBpMacs(bp)...)
+}
+
+// _extraMacEntries returns the l2 forwarding entries of the additional macs
+// of a bridge port, the action is only set when adding
+func _extraMacEntries(bp *infradb.BridgePort, vsiOut int, add bool) []interface{} {
+	var entries []interface{}
+	bpMacLock.Lock()
+	macs, programmed := programmedBpMacs[bp.Name]
+	if add {
+		macs = extraBpMacs(bp)
+		programmedBpMacs[bp.Name] = macs
+	} else {
+		delete(programmedBpMacs, bp.Name)
+		if !programmed {
+			macs = extraBpMacs(bp)
+		}
+	}
+	bpMacLock.Unlock()
+	for _, mac := range macs {
+		entry := p4client.TableEntry{
+			Tablename: l2FwdLoop,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"da": {mac, "exact"},
+				},
+				Priority: int32(0),
+			},
+		}
+		if add {
+			entry.Action = p4client.Action{
+				ActionName: "evpn_gw_control.l2_fwd",
+				Params:     []interface{}{uint32(vsiOut)},
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
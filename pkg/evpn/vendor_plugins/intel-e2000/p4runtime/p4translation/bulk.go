@@ -0,0 +1,277 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// bulkKey config key of the bulk trunk programming section
+const bulkKey = "bulk"
+
+// BulkConfig bulk trunk programming config structure. A trunk bridge port
+// with more logical bridges than the threshold is translated and written in
+// the background, chunk vlans at a time, and reports its progress in its
+// status until done
+type BulkConfig struct {
+	Threshold int `yaml:"threshold" json:"threshold"`
+	Chunk     int `yaml:"chunk" json:"chunk"`
+}
+
+// BulkJob progress of the background programming of a trunk bridge port
+type BulkJob struct {
+	Bp              string    `json:"bp"`
+	ResourceVersion string    `json:"resourceVersion"`
+	Vlans           int       `json:"vlans"`
+	VlansDone       int       `json:"vlansDone"`
+	Entries         int       `json:"entries"`
+	Failed          int       `json:"failed,omitempty"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Running         bool      `json:"running"`
+	cancel          bool
+	err             error
+	translated      []interface{}
+}
+
+// errBulkCancelled cancellation of a bulk job
+var errBulkCancelled = errors.New("intel-e2000: bulk programming cancelled")
+
+var (
+	// bulkLock guards the bulk jobs
+	bulkLock sync.Mutex
+
+	// bulkCfg bulk trunk programming config
+	bulkCfg = BulkConfig{Threshold: 64, Chunk: 32}
+
+	// bulkJobs bulk jobs keyed by bridge port name, a finished job is kept
+	// until its result is reported
+	bulkJobs = make(map[string]*BulkJob)
+)
+
+// loadBulkConfig reads the bulk trunk programming config and applies the
+// defaults
+func loadBulkConfig() {
+	cfg := BulkConfig{}
+	if err := viper.UnmarshalKey(bulkKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read bulk config: %v\n", err)
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 64
+	}
+	if cfg.Chunk <= 0 {
+		cfg.Chunk = 32
+	}
+	bulkLock.Lock()
+	bulkCfg = cfg
+	bulkLock.Unlock()
+}
+
+// bulkTrunk checks the bridge port is a trunk programmed in the background
+func bulkTrunk(bp *infradb.BridgePort) bool {
+	bulkLock.Lock()
+	defer bulkLock.Unlock()
+	return bp.Spec.Ptype == infradb.Trunk && len(bp.Spec.LogicalBridges) > bulkCfg.Threshold
+}
+
+// progress encodes the progress of a job as component details
+func (j *BulkJob) progress() string {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Sprintf("intel-e2000: programming %d/%d vlans", j.VlansDone, j.Vlans)
+	}
+	return string(data)
+}
+
+// setUpBulkBp starts the background programming of a trunk bridge port and
+// reports its progress, the bridge port is retried until the job is done
+func setUpBulkBp(bp *infradb.BridgePort) (string, bool) {
+	bulkLock.Lock()
+	job, ok := bulkJobs[bp.Name]
+	switch {
+	case ok && job.Running && job.ResourceVersion != bp.ResourceVersion:
+		job.cancel = true
+		bulkLock.Unlock()
+		return fmt.Sprintf("intel-e2000: cancelling the programming of version %s", job.ResourceVersion), false
+	case ok && job.Running:
+		details := job.progress()
+		bulkLock.Unlock()
+		return details, false
+	case ok && job.ResourceVersion == bp.ResourceVersion && !errors.Is(job.err, ErrDeviceUnavailable):
+		delete(bulkJobs, bp.Name)
+		bulkLock.Unlock()
+		if job.translated == nil {
+			return job.Error, false
+		}
+		if err := applyBpRateLimit(bp); err != nil {
+			log.Printf("%v\n", err)
+			return err.Error(), false
+		}
+		return bpDetails(bp, job.translated, job.Failed, job.err).String(), true
+	}
+	job = &BulkJob{
+		Bp:              bp.Name,
+		ResourceVersion: bp.ResourceVersion,
+		Vlans:           len(bp.Spec.LogicalBridges),
+		Started:         time.Now(),
+		Running:         true,
+	}
+	bulkJobs[bp.Name] = job
+	chunk := bulkCfg.Chunk
+	details := job.progress()
+	bulkLock.Unlock()
+
+	log.Printf("intel-e2000: Programming trunk bridge port %s with %d vlans in chunks of %d\n", bp.Name, job.Vlans, chunk)
+	go runBulkJob(job, bp, chunk)
+	return details, false
+}
+
+// runBulkJob translates and writes a trunk bridge port chunk by chunk, the
+// decoder lock is released between the chunks
+func runBulkJob(job *BulkJob, bp *infradb.BridgePort, chunk int) {
+	decoderLock.RLock()
+	defer decoderLock.RUnlock()
+
+	programmed := programmedEntries(bp.Name)
+	old := make(map[string]p4client.TableEntry)
+	for _, entry := range programmed {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			old[entryKey(e)] = e
+		}
+	}
+	seen := make(map[string]bool)
+	var result, translated []interface{}
+	var failed int
+	var first error
+
+	write := func(entries []interface{}) error {
+		bulkLock.Lock()
+		cancelled := job.cancel
+		bulkLock.Unlock()
+		if cancelled {
+			return errBulkCancelled
+		}
+		var current []interface{}
+		for _, entry := range entries {
+			if e, ok := entry.(p4client.TableEntry); ok {
+				key := entryKey(e)
+				if o, ok := old[key]; ok && !seen[key] {
+					current = append(current, o)
+				}
+				seen[key] = true
+			}
+		}
+		delta := entryDelta(current, entries)
+		if err := admitEntries(bp.Name, delta.Add); err != nil {
+			result = append(result, current...)
+			return err
+		}
+		n, written, err := programDelta(current, delta)
+		result = append(result, written...)
+		translated = append(translated, entries...)
+		failed += n
+		if first == nil {
+			first = err
+		}
+
+		bulkLock.Lock()
+		job.VlansDone += chunk
+		if job.VlansDone > job.Vlans {
+			job.VlansDone = job.Vlans
+		}
+		job.Entries = len(translated)
+		job.Failed = failed
+		bulkLock.Unlock()
+		if errors.Is(err, ErrDeviceUnavailable) {
+			return err
+		}
+		// Let the writers of the decoders in between the chunks
+		decoderLock.RUnlock()
+		decoderLock.RLock()
+		return nil
+	}
+
+	rest, err := Pod._translateAddedBp(bp, chunk, write)
+	if err == nil {
+		err = write(rest)
+	}
+	var stale []interface{}
+	for _, entry := range programmed {
+		if e, ok := entry.(p4client.TableEntry); ok && !seen[entryKey(e)] {
+			stale = append(stale, e)
+		}
+	}
+	if err == nil {
+		n, kept, derr := programDelta(stale, EntryDelta{Delete: stale})
+		result = append(result, kept...)
+		failed += n
+		if first == nil {
+			first = derr
+		}
+	} else {
+		// The entries not reached are left as they were
+		result = append(result, stale...)
+		translated = nil
+		first = err
+	}
+	recordObjectEntries(bp.Name, result)
+
+	bulkLock.Lock()
+	defer bulkLock.Unlock()
+	job.Running = false
+	job.Finished = time.Now()
+	job.Failed = failed
+	job.err = first
+	job.translated = translated
+	if first != nil {
+		job.Error = first.Error()
+	}
+	log.Printf("intel-e2000: Programmed trunk bridge port %s, %d entries %d failed in %v\n", bp.Name, job.Entries, failed, job.Finished.Sub(job.Started))
+}
+
+// cancelBulkJob cancels the background programming of a bridge port, true
+// while the job is still running
+func cancelBulkJob(bp *infradb.BridgePort) bool {
+	bulkLock.Lock()
+	defer bulkLock.Unlock()
+	job, ok := bulkJobs[bp.Name]
+	if !ok {
+		return false
+	}
+	if !job.Running {
+		delete(bulkJobs, bp.Name)
+		return false
+	}
+	job.cancel = true
+	return true
+}
+
+// BulkJobs returns the bulk jobs running or waiting to report their result
+func BulkJobs() []BulkJob {
+	bulkLock.Lock()
+	defer bulkLock.Unlock()
+	list := make([]BulkJob, 0, len(bulkJobs))
+	for _, job := range bulkJobs {
+		list = append(list, BulkJob{
+			Bp: job.Bp, ResourceVersion: job.ResourceVersion, Vlans: job.Vlans, VlansDone: job.VlansDone,
+			Entries: job.Entries, Failed: job.Failed, Started: job.Started, Finished: job.Finished,
+			Error: job.Error, Running: job.Running,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Bp < list[j].Bp })
+	return list
+}
@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// canaryKey config key of the canary section
+const canaryKey = "canary"
+
+// CanaryConfig canary config structure. A canary reload swaps the decoders
+// like a reload but only reprograms the routes of the tagged prefixes and
+// vnis with them, the other routes keep their entries until the canary
+// routes forwarded minpackets packets within window seconds
+type CanaryConfig struct {
+	Prefixes   []string `yaml:"prefixes"`
+	Vnis       []uint32 `yaml:"vnis"`
+	Window     int      `yaml:"window"`
+	MinPackets int64    `yaml:"minpackets"`
+	prefixes   []*net.IPNet
+}
+
+// results of a canary
+const (
+	canaryRunning    = "running"
+	canaryPromoted   = "promoted"
+	canaryRolledBack = "rolledback"
+)
+
+// CanaryState state of the last canary
+type CanaryState struct {
+	Result   string    `json:"result"`
+	Reason   string    `json:"reason,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+	Routes   []string  `json:"routes"`
+	Packets  int64     `json:"packets"`
+	Failed   int       `json:"failed"`
+}
+
+// canaryDecoders decoders in place before the canary reload
+type canaryDecoders struct {
+	l3    L3Decoder
+	pod   PodDecoder
+	vxlan VxlanDecoder
+}
+
+var (
+	// canaryLock guards the canary
+	canaryLock sync.Mutex
+
+	// canaryState state of the last canary
+	canaryState CanaryState
+
+	// canaryPrevious decoders to roll back to while the canary runs
+	canaryPrevious canaryDecoders
+
+	// canaryRoutes routes reprogrammed by the canary keyed by route key
+	canaryRoutes map[nm.RouteKey]bool
+
+	// canaryEntries entries of the canary routes
+	canaryEntries []interface{}
+
+	// canaryTimer ends the canary window
+	canaryTimer *time.Timer
+)
+
+// loadCanaryConfig reads the canary config, a canary needs a prefix or a vni
+func loadCanaryConfig() (CanaryConfig, error) {
+	cfg := CanaryConfig{}
+	if err := viper.UnmarshalKey(canaryKey, &cfg); err != nil {
+		return cfg, fmt.Errorf("intel-e2000: failed to read canary config: %v", err)
+	}
+	for _, p := range cfg.Prefixes {
+		_, prefix, err := net.ParseCIDR(p)
+		if err != nil {
+			return cfg, fmt.Errorf("intel-e2000: invalid canary prefix %q", p)
+		}
+		cfg.prefixes = append(cfg.prefixes, prefix)
+	}
+	if len(cfg.prefixes) == 0 && len(cfg.Vnis) == 0 {
+		return cfg, errors.New("intel-e2000: no canary prefixes or vnis configured")
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 60
+	}
+	if cfg.MinPackets <= 0 {
+		cfg.MinPackets = 1
+	}
+	return cfg, nil
+}
+
+// tagged checks the route is a canary route, one in a canary prefix or in the
+// vrf of a canary vni
+func (c CanaryConfig) tagged(route nm.RouteStruct) bool {
+	if route.Route0.Dst != nil {
+		for _, prefix := range c.prefixes {
+			ones, _ := prefix.Mask.Size()
+			routeOnes, _ := route.Route0.Dst.Mask.Size()
+			if prefix.Contains(route.Route0.Dst.IP) && routeOnes >= ones {
+				return true
+			}
+		}
+	}
+	if route.Vrf != nil && route.Vrf.Spec != nil && route.Vrf.Spec.Vni != nil {
+		for _, vni := range c.Vnis {
+			if *route.Vrf.Spec.Vni == vni {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// liveRoutes returns the live views of the cached routes the filter selects
+func liveRoutes(filter func(nm.RouteStruct) bool) []nm.RouteStruct {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	var routes []nm.RouteStruct
+	for _, route := range routeCache {
+		if !filter(route) {
+			continue
+		}
+		if live, ok := liveRoute(route); ok {
+			routes = append(routes, live)
+		}
+	}
+	return routes
+}
+
+// moveRoutes reprograms the routes from the entries of a decoder to the ones
+// of another, it returns the entries added and the routes failing to write
+func moveRoutes(routes []nm.RouteStruct, from L3Decoder, to L3Decoder) ([]interface{}, int) {
+	var added []interface{}
+	var failed int
+	for _, route := range routes {
+		delEntries(from.translateDeletedRoute(route))
+		entries := to.translateAddedRoute(route)
+		if err := addEntries(entries); err != nil {
+			log.Printf("intel-e2000: Failed to move route %s: %v\n", route.Key.Dst, err)
+			failed++
+		}
+		added = append(added, entries...)
+	}
+	return added, failed
+}
+
+// StartCanary reloads the config with the canary routes only reprogrammed by
+// the reloaded decoders, the others follow once the canary is validated
+func StartCanary() error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	canaryLock.Lock()
+	defer canaryLock.Unlock()
+	if canaryState.Result == canaryRunning {
+		return errors.New("intel-e2000: a canary is already running")
+	}
+	cfg, err := loadCanaryConfig()
+	if err != nil {
+		return err
+	}
+	previous := canaryDecoders{l3: L3, pod: Pod, vxlan: Vxlan}
+	if err := reload(); err != nil {
+		return err
+	}
+	routes := liveRoutes(cfg.tagged)
+	entries, failed := moveRoutes(routes, previous.l3, L3)
+	canaryPrevious = previous
+	canaryRoutes = make(map[nm.RouteKey]bool, len(routes))
+	names := make([]string, 0, len(routes))
+	for _, route := range routes {
+		canaryRoutes[route.Key] = true
+		var vrf string
+		if route.Vrf != nil {
+			vrf = path.Base(route.Vrf.Name) + " "
+		}
+		names = append(names, vrf+route.Key.Dst)
+	}
+	sort.Strings(names)
+	canaryEntries = entries
+	canaryState = CanaryState{Result: canaryRunning, Started: time.Now(), Routes: names, Failed: failed}
+	canaryTimer = time.AfterFunc(time.Duration(cfg.Window)*time.Second, func() {
+		finishCanary(cfg.MinPackets)
+	})
+	log.Printf("intel-e2000: Canary started on %d routes for %ds\n", len(routes), cfg.Window)
+	return nil
+}
+
+// finishCanary validates the canary by the counters of its routes, promoting
+// the reloaded decoders to all the routes or rolling the canary back
+func finishCanary(minPackets int64) {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	canaryLock.Lock()
+	defer canaryLock.Unlock()
+	if canaryState.Result != canaryRunning {
+		return
+	}
+	packets, _ := sumCounters(canaryEntries)
+	canaryState.Packets = packets
+	switch {
+	case canaryState.Failed > 0:
+		rollbackCanary(fmt.Sprintf("%d canary routes failed to write", canaryState.Failed))
+	case len(canaryRoutes) == 0:
+		rollbackCanary("no canary route programmed")
+	case packets < minPackets:
+		rollbackCanary(fmt.Sprintf("canary routes forwarded %d packets, expected %d", packets, minPackets))
+	default:
+		routes := liveRoutes(func(route nm.RouteStruct) bool { return !canaryRoutes[route.Key] })
+		_, failed := moveRoutes(routes, canaryPrevious.l3, L3)
+		canaryState.Result = canaryPromoted
+		canaryState.Finished = time.Now()
+		log.Printf("intel-e2000: Canary promoted, %d routes reprogrammed, %d failed\n", len(routes), failed)
+	}
+	canaryPrevious = canaryDecoders{}
+	canaryEntries = nil
+	canaryTimer = nil
+}
+
+// rollbackCanary moves the canary routes back and restores the previous
+// decoders with their static entries, the caller holds the decoder and
+// canary locks
+func rollbackCanary(reason string) {
+	routes := liveRoutes(func(route nm.RouteStruct) bool { return canaryRoutes[route.Key] })
+	moveRoutes(routes, L3, canaryPrevious.l3)
+	deletions, additions := staticDelta(append(L3.StaticAdditions(), Pod.StaticAdditions()...),
+		append(canaryPrevious.l3.StaticAdditions(), canaryPrevious.pod.StaticAdditions()...))
+	delEntries(deletions)
+	addStaticEntries(additions)
+	applyGrpcSteering(L3, canaryPrevious.l3)
+	L3 = canaryPrevious.l3
+	Pod = canaryPrevious.pod
+	Vxlan = canaryPrevious.vxlan
+	canaryState.Result = canaryRolledBack
+	canaryState.Reason = reason
+	canaryState.Finished = time.Now()
+	log.Printf("intel-e2000: Canary rolled back, %s\n", reason)
+}
+
+// AbortCanary rolls the running canary back
+func AbortCanary() error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	canaryLock.Lock()
+	defer canaryLock.Unlock()
+	if canaryState.Result != canaryRunning {
+		return errors.New("intel-e2000: no canary running")
+	}
+	canaryTimer.Stop()
+	rollbackCanary("aborted")
+	canaryPrevious = canaryDecoders{}
+	canaryEntries = nil
+	canaryTimer = nil
+	return nil
+}
+
+// GetCanaryState returns the state of the last canary
+func GetCanaryState() CanaryState {
+	canaryLock.Lock()
+	defer canaryLock.Unlock()
+	state := canaryState
+	if state.Result == canaryRunning {
+		state.Packets, _ = sumCounters(canaryEntries)
+	}
+	return state
+}
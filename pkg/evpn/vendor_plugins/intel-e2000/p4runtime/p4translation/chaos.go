@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// chaosKey config key of the failure injection section
+const chaosKey = "chaos"
+
+// ChaosConfig failure injection config structure, a test hook failing the
+// writes to the device and dropping the connection at random to exercise
+// the reconciler and the failover. It is only read from the config file, no
+// api turns it on at runtime. Never to be enabled in production
+type ChaosConfig struct {
+	Enabled       bool    `yaml:"enabled" json:"enabled"`
+	WriteFailure  float64 `yaml:"writefailure" json:"writefailure"`
+	Disconnect    float64 `yaml:"disconnect" json:"disconnect"`
+	DisconnectSec int     `yaml:"disconnectsec" json:"disconnectsec"`
+	Seed          int64   `yaml:"seed" json:"seed"`
+}
+
+// validate checks the probabilities and applies the defaults
+func (cfg *ChaosConfig) validate() error {
+	if cfg.WriteFailure < 0 || cfg.WriteFailure > 1 || cfg.Disconnect < 0 || cfg.Disconnect > 1 {
+		return fmt.Errorf("chaos probabilities must be between 0 and 1")
+	}
+	if cfg.DisconnectSec <= 0 {
+		cfg.DisconnectSec = 5
+	}
+	return nil
+}
+
+// setChaos enables or disables the failure injection of the p4runtime client
+func setChaos(cfg ChaosConfig) error {
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("intel-e2000: %v", err)
+	}
+	if !cfg.Enabled {
+		if p4client.GetChaosStats().Enabled {
+			log.Println("intel-e2000: Chaos mode disabled")
+		}
+		p4client.SetChaos(nil)
+		return nil
+	}
+	log.Printf("intel-e2000: Chaos mode enabled, failing %.1f%% of the writes and disconnecting for %ds on %.1f%%\n",
+		cfg.WriteFailure*100, cfg.DisconnectSec, cfg.Disconnect*100)
+	p4client.SetChaos(&p4client.Chaos{
+		WriteFailure:  cfg.WriteFailure,
+		Disconnect:    cfg.Disconnect,
+		DisconnectFor: time.Duration(cfg.DisconnectSec) * time.Second,
+		Seed:          cfg.Seed,
+	})
+	return nil
+}
+
+// loadChaosConfig reads the failure injection config and applies it
+func loadChaosConfig() {
+	cfg := ChaosConfig{}
+	if err := viper.UnmarshalKey(chaosKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read chaos config: %v\n", err)
+		cfg.Enabled = false
+	}
+	if err := setChaos(cfg); err != nil {
+		log.Printf("%v\n", err)
+	}
+}
+
+// GetChaosStats returns the failures injected in the p4runtime client
+func GetChaosStats() p4client.ChaosStats {
+	return p4client.GetChaosStats()
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// churnKey config key of the churn section
+const churnKey = "churn"
+
+// ChurnConfig churn config structure, the number of route and nexthop events
+// kept and the defaults of the report
+type ChurnConfig struct {
+	Size   int `yaml:"size"`
+	Window int `yaml:"window"`
+	Top    int `yaml:"top"`
+}
+
+// kinds and operations of the churn events
+const (
+	churnRoute   = "route"
+	churnNexthop = "nexthop"
+
+	churnAdd    = "add"
+	churnUpdate = "update"
+	churnDelete = "delete"
+)
+
+// churnEvent route or nexthop event received from netlink
+type churnEvent struct {
+	at   time.Time
+	kind string
+	key  string
+	op   string
+}
+
+// ChurnCount events of a prefix or a nexthop within the report window
+type ChurnCount struct {
+	Key     string    `json:"key"`
+	Adds    int       `json:"adds"`
+	Updates int       `json:"updates"`
+	Deletes int       `json:"deletes"`
+	Total   int       `json:"total"`
+	Last    time.Time `json:"last"`
+}
+
+// ChurnReport top flapping prefixes and nexthops of the last minutes
+type ChurnReport struct {
+	Since    time.Time    `json:"since"`
+	Events   int          `json:"events"`
+	Dropped  bool         `json:"dropped"`
+	Prefixes []ChurnCount `json:"prefixes"`
+	Nexthops []ChurnCount `json:"nexthops"`
+}
+
+var (
+	// churnLock guards the churn events
+	churnLock sync.Mutex
+
+	// churnCfg churn config
+	churnCfg = ChurnConfig{Size: 4096, Window: 10, Top: 10}
+
+	// churnEvents ring buffer of the events, churnNext the slot written next
+	churnEvents = make([]churnEvent, 4096)
+	churnNext   int
+	churnFull   bool
+)
+
+// loadChurnConfig reads the churn config, a new size clears the events
+func loadChurnConfig() {
+	cfg := ChurnConfig{}
+	if err := viper.UnmarshalKey(churnKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read churn config: %v\n", err)
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = 4096
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10
+	}
+	if cfg.Top <= 0 {
+		cfg.Top = 10
+	}
+	churnLock.Lock()
+	defer churnLock.Unlock()
+	if cfg.Size != len(churnEvents) {
+		churnEvents = make([]churnEvent, cfg.Size)
+		churnNext = 0
+		churnFull = false
+	}
+	churnCfg = cfg
+}
+
+// routeChurnKey returns the churn key of a route, its vrf and prefix
+func routeChurnKey(route nm.RouteStruct) string {
+	if route.Vrf != nil {
+		return path.Base(route.Vrf.Name) + " " + route.Key.Dst
+	}
+	return fmt.Sprintf("table %d %s", route.Key.Table, route.Key.Dst)
+}
+
+// nexthopChurnKey returns the churn key of a nexthop
+func nexthopChurnKey(nexthop nm.NexthopStruct) string {
+	return fmt.Sprintf("%s %s dev %d", path.Base(nexthop.Key.VrfName), nexthop.Key.Dst, nexthop.Key.Dev)
+}
+
+// recordChurn records a route or nexthop event in the ring buffer
+func recordChurn(kind, key, op string) {
+	churnLock.Lock()
+	defer churnLock.Unlock()
+	churnEvents[churnNext] = churnEvent{at: time.Now(), kind: kind, key: key, op: op}
+	churnNext++
+	if churnNext == len(churnEvents) {
+		churnNext = 0
+		churnFull = true
+	}
+}
+
+// topChurn returns the counts with the most events first, at most top of them
+func topChurn(counts map[string]*ChurnCount, top int) []ChurnCount {
+	list := make([]ChurnCount, 0, len(counts))
+	for _, c := range counts {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Key < list[j].Key
+	})
+	if len(list) > top {
+		list = list[:top]
+	}
+	return list
+}
+
+// Churn returns the top flapping prefixes and nexthops of the last minutes,
+// zero minutes or top take the configured defaults. Dropped tells the ring
+// buffer wrapped within the window, older events of it are lost
+func Churn(minutes int, top int) ChurnReport {
+	churnLock.Lock()
+	defer churnLock.Unlock()
+	if minutes <= 0 {
+		minutes = churnCfg.Window
+	}
+	if top <= 0 {
+		top = churnCfg.Top
+	}
+	report := ChurnReport{Since: time.Now().Add(-time.Duration(minutes) * time.Minute)}
+	counts := map[string]map[string]*ChurnCount{churnRoute: {}, churnNexthop: {}}
+	n := churnNext
+	if churnFull {
+		n = len(churnEvents)
+	}
+	for i := 0; i < n; i++ {
+		ev := churnEvents[(churnNext-1-i+len(churnEvents))%len(churnEvents)]
+		if ev.at.Before(report.Since) {
+			break
+		}
+		report.Events++
+		c, ok := counts[ev.kind][ev.key]
+		if !ok {
+			c = &ChurnCount{Key: ev.key, Last: ev.at}
+			counts[ev.kind][ev.key] = c
+		}
+		switch ev.op {
+		case churnAdd:
+			c.Adds++
+		case churnUpdate:
+			c.Updates++
+		case churnDelete:
+			c.Deletes++
+		}
+		c.Total++
+	}
+	report.Dropped = churnFull && report.Events == len(churnEvents)
+	report.Prefixes = topChurn(counts[churnRoute], top)
+	report.Nexthops = topChurn(counts[churnNexthop], top)
+	return report
+}
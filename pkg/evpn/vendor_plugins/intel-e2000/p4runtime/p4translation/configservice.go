@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// configServiceName name of the grpc service of the config of the intel e2000
+// translation
+const configServiceName = "opi_intel_bridge.intel_e2000.v1.ConfigService"
+
+// ConfigServiceServer server of the config service, a reload has the effect
+// of a SIGHUP
+type ConfigServiceServer interface {
+	Reload(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+}
+
+// configServer serves the config service
+type configServer struct{}
+
+// Reload reloads the config file, a reload refused leaves the running config
+// in place
+func (configServer) Reload(_ context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+	if err := Reload(); err != nil {
+		log.Printf("intel-e2000: grpc reload failed: %v\n", err)
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	log.Printf("intel-e2000: Config reloaded over grpc\n")
+	return &emptypb.Empty{}, nil
+}
+
+// configServiceReloadHandler decodes a reload request and runs it through
+// the interceptors of the server
+func configServiceReloadHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConfigServiceServer).Reload(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + configServiceName + "/Reload"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConfigServiceServer).Reload(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// configServiceDesc description of the config service, its messages are the
+// well known empty ones so no proto of its own is generated
+var configServiceDesc = grpc.ServiceDesc{
+	ServiceName: configServiceName,
+	HandlerType: (*ConfigServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Reload", Handler: configServiceReloadHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "intel_e2000_config.proto",
+}
+
+// RegisterConfigService registers the config service on a grpc server
+func RegisterConfigService(s *grpc.Server) {
+	s.RegisterService(&configServiceDesc, configServer{})
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// dampeningKey config key of the flap dampening section
+const dampeningKey = "dampening"
+
+// DampeningConfig flap dampening config structure
+type DampeningConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Penalty     float64 `yaml:"penalty"`
+	HalfLife    int     `yaml:"halflife"`
+	Suppress    float64 `yaml:"suppress"`
+	Reuse       float64 `yaml:"reuse"`
+	MaxSuppress int     `yaml:"maxsuppress"`
+}
+
+// DampeningState flap dampening state of a port
+type DampeningState struct {
+	Name       string  `json:"name"`
+	Penalty    float64 `json:"penalty"`
+	Suppressed bool    `json:"suppressed"`
+	LinkUp     bool    `json:"linkup"`
+}
+
+// portDampening flap dampening state of a port
+type portDampening struct {
+	penalty    float64
+	updated    time.Time
+	suppressed bool
+	linkUp     bool
+	timer      *time.Timer
+}
+
+var (
+	// dampeningCfg flap dampening configuration read from the config file
+	dampeningCfg DampeningConfig
+
+	// dampeningLock guards the flap dampening states
+	dampeningLock sync.Mutex
+
+	// dampening flap dampening states of the ports
+	dampening = make(map[string]*portDampening)
+)
+
+// loadDampeningConfig reads the flap dampening config and applies the defaults
+func loadDampeningConfig() {
+	cfg := DampeningConfig{}
+	if err := viper.UnmarshalKey(dampeningKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read dampening config: %v\n", err)
+		cfg.Enabled = false
+	}
+	if cfg.Penalty <= 0 {
+		cfg.Penalty = 1000
+	}
+	if cfg.HalfLife <= 0 {
+		cfg.HalfLife = 15
+	}
+	if cfg.Suppress <= 0 {
+		cfg.Suppress = 2000
+	}
+	if cfg.Reuse <= 0 {
+		cfg.Reuse = 750
+	}
+	if cfg.MaxSuppress <= 0 {
+		cfg.MaxSuppress = 60
+	}
+	dampeningLock.Lock()
+	dampeningCfg = cfg
+	dampeningLock.Unlock()
+}
+
+// decay decays the penalty of the port down to now
+func (d *portDampening) decay(now time.Time) {
+	elapsed := now.Sub(d.updated).Seconds()
+	d.penalty *= math.Pow(0.5, elapsed/float64(dampeningCfg.HalfLife))
+	d.updated = now
+}
+
+// reuseDelay time until the penalty decays below the reuse threshold
+func (d *portDampening) reuseDelay() time.Duration {
+	if d.penalty <= dampeningCfg.Reuse {
+		return 0
+	}
+	seconds := float64(dampeningCfg.HalfLife) * math.Log2(d.penalty/dampeningCfg.Reuse)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// scheduleReuse arms the timer releasing the suppression of the port
+func scheduleReuse(name string, d *portDampening) {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.reuseDelay(), func() { reusePort(name) })
+}
+
+// reusePort releases the suppression of the port once its penalty decayed
+func reusePort(name string) {
+	dampeningLock.Lock()
+	d, ok := dampening[name]
+	if !ok || !d.suppressed {
+		dampeningLock.Unlock()
+		return
+	}
+	d.decay(time.Now())
+	if d.penalty > dampeningCfg.Reuse {
+		scheduleReuse(name, d)
+		dampeningLock.Unlock()
+		return
+	}
+	d.suppressed = false
+	d.timer = nil
+	linkUp := d.linkUp
+	dampeningLock.Unlock()
+	log.Printf("intel-e2000: Port %s no longer suppressed, link %v\n", name, linkUp)
+	SetPortOperState(name, linkUp)
+}
+
+// dampenLinkState applies the flap dampening to a link state change, a port
+// flapping past the suppress threshold is held down until its penalty decays
+func dampenLinkState(name string, up bool) {
+	dampeningLock.Lock()
+	if !dampeningCfg.Enabled {
+		dampeningLock.Unlock()
+		SetPortOperState(name, up)
+		return
+	}
+	now := time.Now()
+	d, ok := dampening[name]
+	if !ok {
+		d = &portDampening{updated: now, linkUp: up}
+		dampening[name] = d
+		dampeningLock.Unlock()
+		SetPortOperState(name, up)
+		return
+	}
+	if d.linkUp == up {
+		dampeningLock.Unlock()
+		return
+	}
+	d.decay(now)
+	d.linkUp = up
+	if !up {
+		maxPenalty := dampeningCfg.Reuse * math.Pow(2, float64(dampeningCfg.MaxSuppress)/float64(dampeningCfg.HalfLife))
+		d.penalty = math.Min(d.penalty+dampeningCfg.Penalty, maxPenalty)
+	}
+	if d.suppressed {
+		dampeningLock.Unlock()
+		log.Printf("intel-e2000: Port %s suppressed, ignoring link %v (penalty %.0f)\n", name, up, d.penalty)
+		return
+	}
+	if d.penalty >= dampeningCfg.Suppress {
+		d.suppressed = true
+		scheduleReuse(name, d)
+		dampeningLock.Unlock()
+		log.Printf("intel-e2000: Port %s flapping, suppressed (penalty %.0f)\n", name, d.penalty)
+		SetPortOperState(name, false)
+		return
+	}
+	dampeningLock.Unlock()
+	SetPortOperState(name, up)
+}
+
+// DampeningStates returns the flap dampening state of the ports
+func DampeningStates() []DampeningState {
+	dampeningLock.Lock()
+	defer dampeningLock.Unlock()
+	now := time.Now()
+	var states = make([]DampeningState, 0, len(dampening))
+	for name, d := range dampening {
+		d.decay(now)
+		states = append(states, DampeningState{Name: name, Penalty: d.penalty, Suppressed: d.suppressed, LinkUp: d.linkUp})
+	}
+	return states
+}
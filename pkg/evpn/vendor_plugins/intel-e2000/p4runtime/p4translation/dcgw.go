@@ -13,10 +13,8 @@ import (
 	"log"
 	"math"
 	"net"
-	"path"
 	"reflect"
 	"strconv"
-	"strings"
 
 	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
 	netlink_polling "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
@@ -27,11 +25,12 @@ import (
 
 // TcamPrefix structure of tcam type
 var TcamPrefix = struct {
-	GRD, VRF, P2P uint32
+	GRD, VRF, P2P, P2PV6 uint32
 }{
-	GRD: 0,
-	VRF: 2, // taking const for now as not imported VRF
-	P2P: 0x78654312,
+	GRD:   0,
+	VRF:   2, // taking const for now as not imported VRF
+	P2P:   0x78654312,
+	P2PV6: 0x78654316,
 }
 
 // Direction structure of type rx, tx or rxtx
@@ -75,6 +74,34 @@ var EntryType = struct {
 	l2Nh: 3,
 }
 
+// nexthopPoolKey pool key of the mod pointer of a nexthop
+type nexthopPoolKey struct {
+	entryType uint32
+	vrfName   string
+	dst       string
+	dev       int
+	local     bool
+}
+
+// newNexthopPoolKey builds the pool key of a nexthop, the weight is left out
+func newNexthopPoolKey(entryType uint32, key netlink_polling.NexthopKey) nexthopPoolKey {
+	return nexthopPoolKey{entryType: entryType, vrfName: key.VrfName, dst: key.Dst, dev: key.Dev, local: key.Local}
+}
+
+// l2NexthopPoolKey pool key of the mod pointer of a l2 nexthop
+type l2NexthopPoolKey struct {
+	entryType uint32
+	key       netlink_polling.L2NexthopKey
+}
+
+// bpPoolKey pool key of the mod pointers of a bridge port, by vport or by mac
+type bpPoolKey struct {
+	entryType uint32
+	port      uint64
+	mac       string
+	native    bool
+}
+
 // ModPointer structure of  mod ptr definitions
 var ModPointer = struct {
 	ignorePtr, l2FloodingPtr, ptrMinRange, ptrMaxRange uint32
@@ -97,12 +124,12 @@ var TrieIndex = struct {
 var EcmpIndex = struct {
 	ecmpIdxMinRange, ecmpIdxMaxRange uint32
 }{
-	ecmpIdxMinRange: 1,
-	ecmpIdxMaxRange: uint32(math.Pow(2, 16)),
+	ecmpIdxMinRange: NeighborRange.ecmpMin,
+	ecmpIdxMaxRange: NeighborRange.ecmpMax,
 }
 
 // ptrPool initialized variable
-var ptrPool, _ = utils.IDPoolInit("mod_ptr", ModPointer.ptrMinRange, ModPointer.ptrMaxRange)
+var ptrPool = newTrackedPool("mod_ptr", ModPointer.ptrMinRange, ModPointer.ptrMaxRange)
 
 // trieIndexPool initialized variable
 var trieIndexPool, _ = utils.IDPoolInit("trie_index", TrieIndex.triIdxMinRange, TrieIndex.triIdxMaxRange)
@@ -159,6 +186,49 @@ const (
 	//                                set_p2p_neighbor(neighbor, ecmp_on)
 	//                            )
 
+	// l3P2PRtV6  evpn p4 table name
+	l3P2PRtV6 = "evpn_gw_control.l3_p2p_routing_table_v6" // GRD routing table for VXLAN packets of an ipv6 underlay
+	//                            TableKeys (
+	//                                ipv6_table_lpm_root2,  # Exact
+	//                                dst_ip,                # LPM
+	//                            )
+	//                            Actions (
+	//                                set_p2p_neighbor(neighbor, ecmp_on),
+	//                            )
+
+	// l3P2PRtHostV6  evpn p4 table name
+	l3P2PRtHostV6 = "evpn_gw_control.l3_p2p_lem_table_v6"
+	// LEM table for VXLAN packets of an ipv6 underlay
+	//                            TableKeys (
+	//                                vrf,                   # Exact
+	//                                direction,             # Exact
+	//                                dst_ip,                # Exact
+	//                            )
+	//                            Actions (
+	//                                set_p2p_neighbor(neighbor, ecmp_on)
+	//                            )
+
+	// l3RtV6  evpn p4 table name
+	l3RtV6 = "evpn_gw_control.l3_routing_table_v6" // VRFs ipv6 routing table in LPM
+	//                            TableKeys (
+	//                                ipv6_table_lpm_root1,  // Exact
+	//                                dst_ip,                // LPM
+	//                            )
+	//                            Actions (
+	//                                set_neighbor(neighbor, ecmp_on),
+	//                            )
+
+	// l3RtHostV6  evpn p4 table name
+	l3RtHostV6 = "evpn_gw_control.l3_lem_table_v6" // VRFs ipv6 host routes
+	//                            TableKeys (
+	//                                vrf,                   // Exact
+	//                                direction,             // Exact
+	//                                dst_ip,                // Exact
+	//                            )
+	//                            Actions (
+	//                                set_neighbor(neighbor, ecmp_on)
+	//                            )
+
 	// l3NHrx evpn p4 table name
 	l3NhRx = "evpn_gw_control.l3_nexthop_table_rx" // LEM next hop table in rx direction
 	//                            TableKeys (
@@ -246,6 +316,17 @@ const (
 	//                               pop_vxlan_set_vrf_id(mod_ptr, tcam_prefix, vport, vrf),
 	//                           )
 
+	// phyInVxlanV6  evpn p4 table name
+	phyInVxlanV6 = "evpn_gw_control.phy_ingress_vxlan_v6_table" // PHY ingress table - VXLAN traffic over ipv6
+	//                           TableKeys(
+	//                               dst_ip
+	//                               vni,
+	//                               da
+	//                           )
+	//                           Actions(
+	//                               pop_vxlan_set_vrf_id(mod_ptr, tcam_prefix, vport, vrf),
+	//                           )
+
 	// phyInVxlanL2  evpn p4 table name
 	phyInVxlanL2 = "evpn_gw_control.phy_ingress_vxlan_vlan_table"
 	//                           Keys {
@@ -324,6 +405,27 @@ const (
 	//                           pop_vlan_set_vrf_id(tcam_prefix, mod_ptr, vport, vrf)
 	//                       )
 
+	// portInSviAccessV6  evpn p4 table name
+	portInSviAccessV6 = "evpn_gw_control.vport_svi_ingress_v6_table" // ipv6 traffic of the svis
+	//                       Key {
+	//                           vsi,                        // Exact
+	//                           da                          // Exact
+	//                       }
+	//                       Actions(
+	//                           set_vrf_id_tx(tcam_prefix, vport, vrf)
+	//                       )
+
+	// portInSviTrunkV6  evpn p4 table name
+	portInSviTrunkV6 = "evpn_gw_control.tagged_vport_svi_ingress_v6_table" // ipv6 traffic of the svis
+	//                       Key {
+	//                           vsi,                        // Exact
+	//                           vid,                        // Exact
+	//                           da                          // Exact
+	//                       }
+	//                       Actions(
+	//                           pop_vlan_set_vrf_id(tcam_prefix, mod_ptr, vport, vrf)
+	//                       )
+
 	// portMuxIn  evpn p4 table name
 	portMuxIn = "evpn_gw_control.port_mux_ingress_table"
 	//                       Key {
@@ -386,6 +488,8 @@ const (
 	//                           push_vlan(mod_ptr, vport)
 	//                           fwd_to_port(port)
 	//                           push_outermac_vxlan(mod_ptr, vport)
+	//                           fwd_to_port_tc(port, queue)
+	//                           push_vlan_l2_tc(mod_ptr, vport, queue)
 	//                       )
 
 	// tcamEntries  evpn p4 table name
@@ -553,15 +657,31 @@ func _directionsOf(entry interface{}) []int {
 	return directions
 }
 
+// _tcamKey builds the tcam prefix of a vrf and direction, the decimal digits
+// of the direction appended to the vrf id, without formatting a string
+func _tcamKey(vrfID uint32, direction int) (uint64, error) {
+	var shift uint64 = 10
+	for d := direction; d >= 10; d /= 10 {
+		shift *= 10
+	}
+	tcam := uint64(vrfID)*shift + uint64(direction)
+	if direction < 0 || tcam > math.MaxUint32 {
+		return 0, fmt.Errorf("tcam prefix of vrf %d direction %d out of range", vrfID, direction)
+	}
+	return tcam, nil
+}
+
 // _addTcamEntry adds the tcam entry
-func _addTcamEntry(vrfID uint32, direction int, prefix interface{}) (p4client.TableEntry, uint32) {
-	tcamPrefix := fmt.Sprintf("%d%d", vrfID, direction)
+func _addTcamEntry(vrfID uint32, direction int, prefix *net.IPNet) (p4client.TableEntry, uint32) {
 	var tblentry p4client.TableEntry
-	var tcam, err = strconv.ParseUint(tcamPrefix, 10, 32)
+	var tcam, err = _tcamKey(vrfID, direction)
 	if err != nil {
 		panic(err)
 	}
-	tidx, refCount := trieIndexPool.GetIDWithRef(tcam, prefix)
+	// reference the prefix by value, the route of the delete event is a new object
+	ref := trieRef(prefix)
+	tidx, refCount := trieIndexPool.GetIDWithRef(tcam, ref)
+	noteTrieRef(tcam, ref, true)
 	if refCount == 1 {
 		tblentry = p4client.TableEntry{
 			Tablename: tcamEntries,
@@ -582,20 +702,23 @@ func _addTcamEntry(vrfID uint32, direction int, prefix interface{}) (p4client.Ta
 
 // _getTcamPrefix get the tcam prefix value
 func _getTcamPrefix(vrfID uint32, direction int) (int, error) {
-	tcamPrefix := fmt.Sprintf("%d%d", vrfID, direction)
-	val, err := strconv.ParseInt(tcamPrefix, 10, 32)
+	val, err := _tcamKey(vrfID, direction)
+	if err == nil && val > math.MaxInt32 {
+		err = fmt.Errorf("tcam prefix %d out of range", val)
+	}
 	return int(val), err
 }
 
 // _deleteTcamEntry deletes the tcam entry
-func _deleteTcamEntry(vrfID uint32, direction int, prefix interface{}) (p4client.TableEntry, uint32) {
-	tcamPrefix := fmt.Sprintf("%d%d", vrfID, direction)
+func _deleteTcamEntry(vrfID uint32, direction int, prefix *net.IPNet) (p4client.TableEntry, uint32) {
 	var tblentry p4client.TableEntry
-	var tcam, err = strconv.ParseUint(tcamPrefix, 10, 32)
+	var tcam, err = _tcamKey(vrfID, direction)
 	if err != nil {
 		panic(err)
 	}
-	tidx, refCount := trieIndexPool.ReleaseIDWithRef(tcam, prefix)
+	ref := trieRef(prefix)
+	tidx, refCount := trieIndexPool.ReleaseIDWithRef(tcam, ref)
+	noteTrieRef(tcam, ref, false)
 	if refCount == 0 {
 		tblentry = p4client.TableEntry{
 			Tablename: tcamEntries,
@@ -630,15 +753,30 @@ func (p PhyPort) PhyPortInit(id int, vsi string, mac string) PhyPort {
 	return p
 }
 
-// _p4NexthopID get the p4 nexthop id
-func _p4NexthopID(nh netlink_polling.NexthopStruct, direction int) int {
-	nhID := nh.ID << 1
+// _p4NexthopID get the p4 nexthop id, a nexthop without a neighbor slot has
+// none as slot 0 is the flood neighbor
+func _p4NexthopID(nh netlink_polling.NexthopStruct, direction int) (int, error) {
+	slot, err := _neighborSlot(nh.ID)
+	if err != nil {
+		return 0, err
+	}
+	nhID := int(slot) << 1
 
 	if direction == Direction.Rx && (nh.NhType == netlink_polling.PHY || nh.NhType == netlink_polling.VXLAN) {
 		nhID++
 	}
 
-	return nhID
+	return nhID, nil
+}
+
+// _p4NexthopIDs get the tx and rx p4 ids of a nexthop
+func _p4NexthopIDs(nh netlink_polling.NexthopStruct) (int, int, error) {
+	txID, err := _p4NexthopID(nh, Direction.Tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	rxID, err := _p4NexthopID(nh, Direction.Rx)
+	return txID, rxID, err
 }
 
 func (e *EcmpDispatcher) _p4NexthopID(direction int) int {
@@ -671,14 +809,21 @@ type EcmpDispatcher struct {
 	id       uint32
 	hashmap  map[int]netlink_polling.NexthopStruct
 	numslots int
+	members  []string
+	// mixed groups spread the tx direction over the tx members only
+	mixed     bool
+	txHashmap map[int]netlink_polling.NexthopStruct
+	// jumbo groups prefer the members reaching the jumbo mtu
+	jumbo int
+	mtus  map[int]int
 }
 
-// using pointer
-func (e *EcmpDispatcher) runWebsterAlg() {
+// websterSlots spreads the hash slots over the members by weight
+func (e *EcmpDispatcher) websterSlots(members []*netlink_polling.NexthopStruct, hashmap map[int]netlink_polling.NexthopStruct) {
 	for i := 0; i < e.numslots; i++ {
 		var maxNh *netlink_polling.NexthopStruct
 		maxValue := float64(-math.MaxInt32)
-		for _, nh := range e.Nexthop {
+		for _, nh := range members {
 			if nh.Value > maxValue {
 				maxValue = nh.Value
 				maxNh = nh
@@ -687,8 +832,40 @@ func (e *EcmpDispatcher) runWebsterAlg() {
 		maxNh.Hashes = append(maxNh.Hashes, i)
 		maxNh.Divisor += 2
 		maxNh.Value = float64(maxNh.Weight) / float64(maxNh.Divisor)
-		e.hashmap[i] = *maxNh
+		hashmap[i] = *maxNh
+	}
+}
+
+// using pointer
+func (e *EcmpDispatcher) runWebsterAlg() {
+	e.websterSlots(e.preferMtu(e.Nexthop), e.hashmap)
+	if e.mixed {
+		e.websterSlots(e.preferMtu(e.txMembers()), e.txHashmap)
+	}
+}
+
+// txMembers returns copies of the tx members of a mixed group so the slots
+// of the rx direction recorded on the members are kept
+func (e *EcmpDispatcher) txMembers() []*netlink_polling.NexthopStruct {
+	var members []*netlink_polling.NexthopStruct
+	for _, nh := range e.Nexthop {
+		if nh.Dir == Direction.Tx {
+			member := *nh
+			member.Hashes = nil
+			member.Divisor = 1
+			member.Value = float64(member.Weight)
+			members = append(members, &member)
+		}
+	}
+	return members
+}
+
+// slotTable returns the slot assignment programmed for a direction
+func (e *EcmpDispatcher) slotTable(dir int) map[int]netlink_polling.NexthopStruct {
+	if e.mixed && dir == Direction.Tx {
+		return e.txHashmap
 	}
+	return e.hashmap
 }
 func (e *EcmpDispatcher) getecmpnh(nexthop []*netlink_polling.NexthopStruct) {
 	if e.Nexthop == nil {
@@ -749,7 +926,11 @@ func (e *EcmpDispatcher) checkdir() bool {
 		e.dir = Direction.Tx
 		return true
 	}
-	return false
+	// the rx direction spreads over all members and the tx direction over
+	// the tx members, each direction gets its own group neighbor
+	e.dir = Direction.Tx
+	e.mixed = true
+	return true
 }
 
 // EcmpDispatcherInit function initializes the ecmp objects
@@ -762,11 +943,19 @@ func (e *EcmpDispatcher) EcmpDispatcherInit(nexthop []*netlink_polling.NexthopSt
 	}
 	e.getecmpnh(nexthop)
 	e.key = e.getkeys(nexthop)
+	e.members = make([]string, len(nexthop))
+	for i, nh := range nexthop {
+		e.members[i] = ecmpMember(nh)
+	}
+	if vrf != nil {
+		e.setMemberMtus(nexthop, vrf.Name)
+	}
 	if !e.checkdir() {
 		return false
 	}
 	e.numslots = int(16)
 	e.hashmap = make(map[int]netlink_polling.NexthopStruct, 0)
+	e.txHashmap = make(map[int]netlink_polling.NexthopStruct, 0)
 	return true
 }
 
@@ -802,6 +991,8 @@ type L3Decoder struct {
 	_defaultVsi int
 	_phyPorts   []PhyPort
 	_grpcPorts  []GrpcPairPort
+	// _grpcSteering steering policy of the grpc pair
+	_grpcSteering GrpcSteering
 	PhyPort
 	GrpcPairPort
 }
@@ -810,9 +1001,11 @@ type L3Decoder struct {
 func (l L3Decoder) L3DecoderInit(representors map[string][2]string) L3Decoder {
 	s := L3Decoder{
 		_muxVsi:     l.setMuxVsi(representors),
-		_defaultVsi: 0x6,
+		_defaultVsi: readDefaultVsis().L3,
 		_phyPorts:   l._getPhyInfo(representors),
 		_grpcPorts:  l._getGrpcInfo(representors),
+		// Read once so a reload compares the policies of both decoders
+		_grpcSteering: readGrpcSteering(),
 	}
 	return s
 }
@@ -827,24 +1020,17 @@ func (l L3Decoder) setMuxVsi(representors map[string][2]string) uint16 {
 	return uint16(muxVsi)
 }
 
-// _getPhyInfo get the phy port info
+// _getPhyInfo get the phy port info of the underlay uplinks
 func (l L3Decoder) _getPhyInfo(representors map[string][2]string) []PhyPort {
 	var enabledPorts []PhyPort
-	var vsi string
-	var mac string
-	var p = reflect.TypeOf(PortID)
-	for i := 0; i < p.NumField(); i++ {
-		var k = p.Field(i).Name
-		var key = strings.ToLower(k) + "_rep"
-		for k = range representors {
-			if key == k {
-				vsi = representors[key][0]
-				mac = representors[key][1]
-				enabledPorts = append(enabledPorts, l.PhyPortInit(i, vsi, mac))
-			}
+	for _, uplink := range uplinksOfRole(UplinkRole.Underlay) {
+		ids, ok := representors[uplinkKey(uplink.Name)]
+		if !ok {
+			continue
 		}
+		enabledPorts = append(enabledPorts, l.PhyPortInit(uplink.Port, ids[0], ids[1]))
 	}
-	return enabledPorts // should return tuple
+	return enabledPorts
 }
 
 // _getGrpcInfo get the grpc information
@@ -871,19 +1057,21 @@ func (l L3Decoder) _getGrpcInfo(representors map[string][2]string) []GrpcPairPor
 	return grpcPorts
 }
 
-// getVrfID get the vrf id from vni
+// getVrfID get the vrf id of the routing table holding the route
 func (l L3Decoder) getVrfID(route netlink_polling.RouteStruct) uint32 {
 	if route.Vrf.Spec.Vni == nil {
 		return 0
 	}
 
-	return *route.Vrf.Metadata.RoutingTable[0]
+	return _routeTable(route)
 }
 
 // _l3HostRoute gets the l3 host route
 func (l L3Decoder) _l3HostRoute(route netlink_polling.RouteStruct, delete string, ecmpFlag bool, entries []interface{}, e EcmpDispatcher) []interface{} {
+	if _isV6Route(route) {
+		return l._l3V6Route(route, delete == trueStr, ecmpFlag, entries, e)
+	}
 	var vrfID = l.getVrfID(route)
-	var directions = _directionsOf(route)
 	var host = route.Route0.Dst
 	var ec uint16
 	if ecmpFlag {
@@ -891,15 +1079,25 @@ func (l L3Decoder) _l3HostRoute(route netlink_polling.RouteStruct, delete string
 	} else {
 		ec = uint16(0)
 	}
+	paths, err := _routePaths(route, delete != trueStr, ecmpFlag, e)
+	if err != nil {
+		_logUnresolvedRoute(route, err)
+		return entries
+	}
+	p2p, err := _p2pPath(route, delete != trueStr, ecmpFlag, e)
+	if err != nil {
+		_logUnresolvedRoute(route, err)
+		return entries
+	}
 
 	if delete == trueStr {
-		for _, dir := range directions {
+		for _, path := range paths {
 			entries = append(entries, p4client.TableEntry{
 				Tablename: l3RtHost,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
 						"vrf":       {_bigEndian16(vrfID), "exact"},
-						"direction": {uint16(dir), "exact"},
+						"direction": {uint16(path.dir), "exact"},
 						"dst_ip":    {host, "exact"},
 					},
 					Priority: int32(0),
@@ -907,65 +1105,51 @@ func (l L3Decoder) _l3HostRoute(route netlink_polling.RouteStruct, delete string
 			})
 		}
 	} else {
-		for _, dir := range directions {
-			var neighbor int
-			if ecmpFlag {
-				neighbor = e._p4NexthopID(dir)
-			} else {
-				neighbor = _p4NexthopID(*route.Nexthops[0], dir)
-			}
-
+		for _, path := range paths {
 			entries = append(entries, p4client.TableEntry{
 				Tablename: l3RtHost,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
 						"vrf":       {bigEndian16(vrfID), "exact"},
-						"direction": {uint16(dir), "exact"},
+						"direction": {uint16(path.dir), "exact"},
 						"dst_ip":    {host, "exact"},
 					},
 					Priority: int32(0),
 				},
 				Action: p4client.Action{
 					ActionName: "evpn_gw_control.set_neighbor",
-					Params:     []interface{}{uint16(neighbor), ec},
+					Params:     []interface{}{uint16(path.neighbor), ec},
 				},
 			})
 		}
 	}
-	if path.Base(route.Vrf.Name) == grdStr && route.Nexthops[0].NhType == netlink_polling.PHY {
+	if _isP2PRoute(route) {
 		if delete == trueStr {
 			entries = append(entries, p4client.TableEntry{
 				Tablename: l3P2PRtHost,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
 						"vrf":       {_bigEndian16(vrfID), "exact"},
-						"direction": {uint16(Direction.Rx), "exact"},
+						"direction": {uint16(p2p.dir), "exact"},
 						"dst_ip":    {host, "exact"},
 					},
 					Priority: int32(0),
 				},
 			})
 		} else {
-			var neighbor int
-			if ecmpFlag {
-				neighbor = e._p4NexthopID(Direction.Rx)
-			} else {
-				neighbor = _p4NexthopID(*route.Nexthops[0], Direction.Rx)
-			}
-
 			entries = append(entries, p4client.TableEntry{
 				Tablename: l3P2PRtHost,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
 						"vrf":       {bigEndian16(vrfID), "exact"},
-						"direction": {uint16(Direction.Rx), "exact"},
+						"direction": {uint16(p2p.dir), "exact"},
 						"dst_ip":    {host, "exact"},
 					},
 					Priority: int32(0),
 				},
 				Action: p4client.Action{
 					ActionName: "evpn_gw_control.set_p2p_neighbor",
-					Params:     []interface{}{uint16(neighbor), ec},
+					Params:     []interface{}{uint16(p2p.neighbor), ec},
 				},
 			})
 		}
@@ -976,7 +1160,9 @@ func (l L3Decoder) _l3HostRoute(route netlink_polling.RouteStruct, delete string
 // _l3Route generate the l3 route entries
 func (l L3Decoder) _l3Route(route netlink_polling.RouteStruct, delete string, ecmpFlag bool, entries []interface{}, e EcmpDispatcher) []interface{} {
 	var vrfID = l.getVrfID(route)
-	var directions = _directionsOf(route)
+	if _isV6Route(route) {
+		return l._l3V6Route(route, delete == trueStr, ecmpFlag, entries, e)
+	}
 	var addr = route.Route0.Dst.IP.String()
 	var ec uint16
 	if ecmpFlag {
@@ -984,10 +1170,20 @@ func (l L3Decoder) _l3Route(route netlink_polling.RouteStruct, delete string, ec
 	} else {
 		ec = uint16(0)
 	}
+	paths, err := _routePaths(route, delete != trueStr, ecmpFlag, e)
+	if err != nil {
+		_logUnresolvedRoute(route, err)
+		return entries
+	}
+	p2p, err := _p2pPath(route, delete != trueStr, ecmpFlag, e)
+	if err != nil {
+		_logUnresolvedRoute(route, err)
+		return entries
+	}
 
-	for _, dir := range directions {
+	for _, path := range paths {
 		if delete == trueStr {
-			var tblEntry, tIdx = _deleteTcamEntry(vrfID, dir, route.Route0.Dst)
+			var tblEntry, tIdx = _deleteTcamEntry(vrfID, path.dir, route.Route0.Dst)
 			if !reflect.ValueOf(tblEntry).IsZero() {
 				entries = append(entries, tblEntry)
 			}
@@ -1002,14 +1198,7 @@ func (l L3Decoder) _l3Route(route netlink_polling.RouteStruct, delete string, ec
 				},
 			})
 		} else {
-			var neighbor int
-			if ecmpFlag {
-				neighbor = e._p4NexthopID(Direction.Rx)
-			} else {
-				neighbor = _p4NexthopID(*route.Nexthops[0], Direction.Rx)
-			}
-
-			var tblEntry, tIdx = _addTcamEntry(vrfID, dir, route.Route0.Dst)
+			var tblEntry, tIdx = _addTcamEntry(vrfID, path.dir, route.Route0.Dst)
 			if !reflect.ValueOf(tblEntry).IsZero() {
 				entries = append(entries, tblEntry)
 			}
@@ -1024,12 +1213,12 @@ func (l L3Decoder) _l3Route(route netlink_polling.RouteStruct, delete string, ec
 				},
 				Action: p4client.Action{
 					ActionName: "evpn_gw_control.set_neighbor",
-					Params:     []interface{}{uint16(neighbor), ec},
+					Params:     []interface{}{uint16(path.neighbor), ec},
 				},
 			})
 		}
 	}
-	if path.Base(route.Vrf.Name) == grdStr && route.Nexthops[0].NhType == netlink_polling.PHY {
+	if _isP2PRoute(route) {
 		tidx := trieIndexPool.GetID(TcamPrefix.P2P)
 		if delete == trueStr {
 			entries = append(entries, p4client.TableEntry{
@@ -1043,13 +1232,6 @@ func (l L3Decoder) _l3Route(route netlink_polling.RouteStruct, delete string, ec
 				},
 			})
 		} else {
-			var neighbor int
-			if ecmpFlag {
-				neighbor = e._p4NexthopID(Direction.Rx)
-			} else {
-				neighbor = _p4NexthopID(*route.Nexthops[0], Direction.Rx)
-			}
-
 			entries = append(entries, p4client.TableEntry{
 				Tablename: l3P2PRt,
 				TableField: p4client.TableField{
@@ -1061,7 +1243,7 @@ func (l L3Decoder) _l3Route(route netlink_polling.RouteStruct, delete string, ec
 				},
 				Action: p4client.Action{
 					ActionName: "evpn_gw_control.set_p2p_neighbor",
-					Params:     []interface{}{uint16(neighbor), ec},
+					Params:     []interface{}{uint16(p2p.neighbor), ec},
 				},
 			})
 		}
@@ -1069,17 +1251,15 @@ func (l L3Decoder) _l3Route(route netlink_polling.RouteStruct, delete string, ec
 	return entries
 }
 
-func (e EcmpDispatcher) addEcmpDispatcher(entries []interface{}) []interface{} {
-	var directions []int
-	if e.dir == Direction.Rx {
-		directions = append(directions, Direction.Rx)
-	} else {
-		directions = append(directions, Direction.Rx)
-		directions = append(directions, Direction.Tx)
-	}
-
-	for i, nh := range e.hashmap {
-		for dir := range directions {
+// addEcmpDispatcher adds the hash slots of the group, none when a member has
+// no neighbor
+func (e EcmpDispatcher) addEcmpDispatcher(entries []interface{}) ([]interface{}, error) {
+	for _, dir := range e.directions() {
+		for i, nh := range e.slotTable(dir) {
+			nhID, err := _p4NexthopID(nh, dir)
+			if err != nil {
+				return nil, err
+			}
 			entries = append(entries, p4client.TableEntry{
 				Tablename: l3EcmpSel,
 				TableField: p4client.TableField{
@@ -1092,25 +1272,17 @@ func (e EcmpDispatcher) addEcmpDispatcher(entries []interface{}) []interface{} {
 				},
 				Action: p4client.Action{
 					ActionName: "evpn_gw_control.set_neighbor_withoutrec",
-					Params:     []interface{}{uint16(_p4NexthopID(nh, dir))},
+					Params:     []interface{}{uint16(nhID)},
 				},
 			})
 		}
 	}
-	return entries
+	return entries, nil
 }
 
 func (e EcmpDispatcher) delEcmpDispatcher(entries []interface{}) []interface{} {
-	var directions []int
-	if e.dir == Direction.Rx {
-		directions = append(directions, Direction.Rx)
-	} else {
-		directions = append(directions, Direction.Rx)
-		directions = append(directions, Direction.Tx)
-	}
-
 	for i := 0; i < e.numslots; i++ {
-		for dir := range directions {
+		for _, dir := range e.directions() {
 			entries = append(entries, p4client.TableEntry{
 				Tablename: l3EcmpSel,
 				TableField: p4client.TableField{
@@ -1137,19 +1309,29 @@ func (l L3Decoder) translateAddedRoute(route netlink_polling.RouteStruct) []inte
 	var ecmp EcmpDispatcher
 	if len(route.Nexthops) > 1 {
 		if !ecmp.EcmpDispatcherInit(route.Nexthops, route.Vrf) {
+			log.Printf("intel-e2000: Route %s of vrf %s not offloaded, invalid ecmp group of %d nexthops\n", route.Route0.Dst, route.Vrf.Name, len(route.Nexthops))
 			return entries
 		}
 		ecmp.id, refCount = ecmpIndexPool.GetIDWithRef(ecmp.key, route.Key)
+		if !checkEcmpSlot(ecmp.key, ecmp.id) {
+			ecmpIndexPool.ReleaseIDWithRef(ecmp.key, route.Key)
+			return entries
+		}
 		if refCount == 1 {
-			ecmp.runWebsterAlg()
-			entries = ecmp.addEcmpDispatcher(entries)
+			ecmp.assignSlots()
+			var err error
+			if entries, err = ecmp.addEcmpDispatcher(entries); err != nil {
+				ecmp.forgetSlots()
+				ecmpIndexPool.ReleaseIDWithRef(ecmp.key, route.Key)
+				_logUnresolvedRoute(route, err)
+				return make([]interface{}, 0)
+			}
 		}
 		route.Nexthops = []*netlink_polling.NexthopStruct{}
 		route.Nexthops = ecmp.Nexthop
 		ecmpFlag = true
 	}
-	var ipv4Net = route.Route0.Dst
-	if net.IP(ipv4Net.Mask).String() == "255.255.255.255" {
+	if _isHostRoute(route) {
 		return l._l3HostRoute(route, "False", ecmpFlag, entries, ecmp)
 	}
 	return l._l3Route(route, "False", ecmpFlag, entries, ecmp)
@@ -1168,16 +1350,18 @@ func (l L3Decoder) translateDeletedRoute(route netlink_polling.RouteStruct) []in
 			return entries
 		}
 		ecmp.id, refCount = ecmpIndexPool.ReleaseIDWithRef(ecmp.key, route.Key)
+		if ecmp.id < NeighborRange.ecmpMin || ecmp.id > NeighborRange.ecmpMax {
+			return entries
+		}
 		if refCount == 0 {
-			ecmp.runWebsterAlg()
+			ecmp.forgetSlots()
 			entries = ecmp.delEcmpDispatcher(entries)
 		}
 		route.Nexthops = []*netlink_polling.NexthopStruct{}
 		route.Nexthops = ecmp.Nexthop
 		ecmpFlag = true
 	}
-	var ipv4Net = route.Route0.Dst
-	if net.IP(ipv4Net.Mask).String() == "255.255.255.255" {
+	if _isHostRoute(route) {
 		return l._l3HostRoute(route, "True", ecmpFlag, entries, ecmp)
 	}
 	return l._l3Route(route, "True", ecmpFlag, entries, ecmp)
@@ -1191,9 +1375,17 @@ func (l L3Decoder) translateAddedNexthop(nexthop netlink_polling.NexthopStruct)
 		var entries []interface{}
 		return entries
 	}
-	key := fmt.Sprintf("%d-%s-%s-%d-%v", EntryType.l3NH, nexthop.Key.VrfName, nexthop.Key.Dst, nexthop.Key.Dev, nexthop.Key.Local)
+	if _isV6Nexthop(nexthop) && !_ndResolved(nexthop) {
+		log.Printf("intel-e2000: Nexthop %s dev %d not offloaded, neighbor discovery has not resolved its mac\n", nexthop.Key.Dst, nexthop.Key.Dev)
+		return make([]interface{}, 0)
+	}
+	key := newNexthopPoolKey(EntryType.l3NH, nexthop.Key)
+	nhID, rxID, err := _p4NexthopIDs(nexthop)
+	if err != nil {
+		log.Printf("intel-e2000: Nexthop %d not offloaded: %v\n", nexthop.ID, err)
+		return make([]interface{}, 0)
+	}
 	var modPtr = ptrPool.GetID(key)
-	nhID := _p4NexthopID(nexthop, Direction.Tx)
 
 	var entries = make([]interface{}, 0)
 	switch nexthop.NhType {
@@ -1233,7 +1425,7 @@ func (l L3Decoder) translateAddedNexthop(nexthop netlink_polling.NexthopStruct)
 				Tablename: l3NhRx,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
-						"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+						"neighbor":    {uint16(rxID), "exact"},
 						"bit32_zeros": {uint32(0), "exact"},
 					},
 					Priority: int32(0),
@@ -1247,7 +1439,7 @@ func (l L3Decoder) translateAddedNexthop(nexthop netlink_polling.NexthopStruct)
 				Tablename: p2pIn,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
-						"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+						"neighbor":    {uint16(rxID), "exact"},
 						"bit32_zeros": {uint32(0), "exact"},
 					},
 					Priority: int32(0),
@@ -1415,9 +1607,17 @@ func (l L3Decoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStruct
 		var entries []interface{}
 		return entries
 	}
-	key := fmt.Sprintf("%d-%s-%s-%d-%v", EntryType.l3NH, nexthop.Key.VrfName, nexthop.Key.Dst, nexthop.Key.Dev, nexthop.Key.Local)
+	key := newNexthopPoolKey(EntryType.l3NH, nexthop.Key)
+	if _isV6Nexthop(nexthop) && !ptrPool.holds(key) {
+		// Never resolved by neighbor discovery, nothing was written
+		return make([]interface{}, 0)
+	}
+	nhID, rxID, err := _p4NexthopIDs(nexthop)
+	if err != nil {
+		// Never offloaded without a neighbor, nothing was written
+		return make([]interface{}, 0)
+	}
 	var modPtr = ptrPool.ReleaseID(key)
-	nhID := _p4NexthopID(nexthop, Direction.Tx)
 	var entries = make([]interface{}, 0)
 	switch nexthop.NhType {
 	case netlink_polling.PHY:
@@ -1445,7 +1645,7 @@ func (l L3Decoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStruct
 				Tablename: l3NhRx,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
-						"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+						"neighbor":    {uint16(rxID), "exact"},
 						"bit32_zeros": {uint32(0), "exact"},
 					},
 					Priority: int32(0),
@@ -1455,7 +1655,7 @@ func (l L3Decoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStruct
 				Tablename: p2pIn,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
-						"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+						"neighbor":    {uint16(rxID), "exact"},
 						"bit32_zeros": {uint32(0), "exact"},
 					},
 					Priority: int32(0),
@@ -1563,6 +1763,117 @@ func (l L3Decoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStruct
 	return entries
 }
 
+// phyPortAdditions static additions of a phy port
+func (l L3Decoder) phyPortAdditions(port PhyPort) []interface{} {
+	var tcamPrefix = TcamPrefix.GRD
+	var entries = make([]interface{}, 0)
+	var portDa, _ = net.ParseMAC(port.mac)
+	entries = append(entries, p4client.TableEntry{
+		Tablename: phyInIP,
+		TableField: p4client.TableField{
+			FieldValue: map[string][2]interface{}{
+				"port_id": {uint16(port.id), "exact"},
+				"da":      {portDa, "exact"},
+			},
+			Priority: int32(0),
+		},
+		Action: p4client.Action{
+			ActionName: "evpn_gw_control.set_vrf_id",
+			Params:     []interface{}{tcamPrefix, uint32(_toEgressVsi(l._defaultVsi)), uint32(0)},
+		},
+	},
+		p4client.TableEntry{
+			Tablename: phyInArp,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"port_id":     {uint16(port.id), "exact"},
+					"bit32_zeros": {uint32(0), "exact"},
+				},
+				Priority: int32(0),
+			},
+			Action: p4client.Action{
+				ActionName: "evpn_gw_control.fwd_to_port",
+				Params:     []interface{}{uint32(_toEgressVsi(port.vsi))},
+			},
+		},
+		p4client.TableEntry{
+			Tablename: podInIPAccess,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"vsi":         {uint16(port.vsi), "exact"},
+					"bit32_zeros": {uint32(0), "exact"},
+				},
+				Priority: int32(0),
+			},
+			Action: p4client.Action{
+				ActionName: "evpn_gw_control.fwd_to_port",
+				Params:     []interface{}{uint32(port.id)},
+			},
+		},
+		p4client.TableEntry{
+			Tablename: podInArpAccess,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"vsi":         {uint16(port.vsi), "exact"},
+					"bit32_zeros": {uint32(0), "exact"},
+				},
+				Priority: int32(0),
+			},
+			Action: p4client.Action{
+				ActionName: "evpn_gw_control.fwd_to_port",
+				Params:     []interface{}{uint32(port.id)},
+			},
+		})
+	return entries
+}
+
+// phyPortDeletions static deletions of a phy port
+func (l L3Decoder) phyPortDeletions(port PhyPort) []interface{} {
+	var entries = make([]interface{}, 0)
+	var portDa, _ = net.ParseMAC(port.mac)
+	entries = append(entries, p4client.TableEntry{
+		Tablename: phyInIP,
+		TableField: p4client.TableField{
+			FieldValue: map[string][2]interface{}{
+				"port_id": {uint16(port.id), "exact"},
+				"da":      {portDa, "exact"},
+			},
+			Priority: int32(0),
+		},
+	},
+		p4client.TableEntry{
+			Tablename: phyInArp,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"port_id":     {uint16(port.id), "exact"},
+					"bit32_zeros": {uint32(0), "exact"},
+				},
+				Priority: int32(0),
+			},
+		},
+		p4client.TableEntry{
+			Tablename: podInIPAccess,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"vsi":         {uint16(port.vsi), "exact"},
+					"bit32_zeros": {uint32(0), "exact"},
+				},
+				Priority: int32(0),
+			},
+		},
+		p4client.TableEntry{
+			Tablename: podInArpAccess,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"vsi":         {uint16(port.vsi), "exact"},
+					"bit32_zeros": {uint32(0), "exact"},
+				},
+				Priority: int32(0),
+			},
+		})
+	return entries
+}
+
 // StaticAdditions do the static additions for p4 tables
 //
 //nolint:funlen
@@ -1601,10 +1912,7 @@ func (l L3Decoder) StaticAdditions() []interface{} {
 				},
 				Priority: int32(0),
 			},
-			Action: p4client.Action{
-				ActionName: "evpn_gw_control.fwd_to_port",
-				Params:     []interface{}{uint32(_toEgressVsi(int(peerVsi)))},
-			},
+			Action: l._grpcIngressAction(int(peerVsi)),
 		},
 			p4client.TableEntry{
 				Tablename: l2FwdLoop,
@@ -1619,80 +1927,27 @@ func (l L3Decoder) StaticAdditions() []interface{} {
 					Params:     []interface{}{uint32(_toEgressVsi(port.vsi))},
 				},
 			})
+		entries = append(entries, l._grpcSteeringEntries(port, int(peerVsi), true)...)
 	}
 	for _, port := range l._phyPorts {
-		var portDa, _ = net.ParseMAC(port.mac)
+		entries = append(entries, l.phyPortAdditions(port)...)
+	}
+	for _, prefix := range []uint32{TcamPrefix.P2P, TcamPrefix.P2PV6} {
+		tidx := trieIndexPool.GetID(prefix)
 		entries = append(entries, p4client.TableEntry{
-			Tablename: phyInIP,
+			Tablename: tcamEntries2,
 			TableField: p4client.TableField{
 				FieldValue: map[string][2]interface{}{
-					"port_id": {uint16(port.id), "exact"},
-					"da":      {portDa, "exact"},
+					"user_meta.cmeta.tcam_prefix": {prefix, "ternary"},
 				},
-				Priority: int32(0),
+				Priority: int32(tidx),
 			},
 			Action: p4client.Action{
-				ActionName: "evpn_gw_control.set_vrf_id",
-				Params:     []interface{}{tcamPrefix, uint32(_toEgressVsi(l._defaultVsi)), uint32(0)},
-			},
-		},
-			p4client.TableEntry{
-				Tablename: phyInArp,
-				TableField: p4client.TableField{
-					FieldValue: map[string][2]interface{}{
-						"port_id":     {uint16(port.id), "exact"},
-						"bit32_zeros": {uint32(0), "exact"},
-					},
-					Priority: int32(0),
-				},
-				Action: p4client.Action{
-					ActionName: "evpn_gw_control.fwd_to_port",
-					Params:     []interface{}{uint32(_toEgressVsi(port.vsi))},
-				},
-			},
-			p4client.TableEntry{
-				Tablename: podInIPAccess,
-				TableField: p4client.TableField{
-					FieldValue: map[string][2]interface{}{
-						"vsi":         {uint16(port.vsi), "exact"},
-						"bit32_zeros": {uint32(0), "exact"},
-					},
-					Priority: int32(0),
-				},
-				Action: p4client.Action{
-					ActionName: "evpn_gw_control.fwd_to_port",
-					Params:     []interface{}{uint32(port.id)},
-				},
+				ActionName: "evpn_gw_control.ecmp_lpm_root_lut2_action",
+				Params:     []interface{}{tidx},
 			},
-			p4client.TableEntry{
-				Tablename: podInArpAccess,
-				TableField: p4client.TableField{
-					FieldValue: map[string][2]interface{}{
-						"vsi":         {uint16(port.vsi), "exact"},
-						"bit32_zeros": {uint32(0), "exact"},
-					},
-					Priority: int32(0),
-				},
-				Action: p4client.Action{
-					ActionName: "evpn_gw_control.fwd_to_port",
-					Params:     []interface{}{uint32(port.id)},
-				},
-			})
+		})
 	}
-	tidx := trieIndexPool.GetID(TcamPrefix.P2P)
-	entries = append(entries, p4client.TableEntry{
-		Tablename: tcamEntries2,
-		TableField: p4client.TableField{
-			FieldValue: map[string][2]interface{}{
-				"user_meta.cmeta.tcam_prefix": {TcamPrefix.P2P, "ternary"},
-			},
-			Priority: int32(tidx),
-		},
-		Action: p4client.Action{
-			ActionName: "evpn_gw_control.ecmp_lpm_root_lut2_action",
-			Params:     []interface{}{tidx},
-		},
-	})
 	return entries
 }
 
@@ -1700,47 +1955,7 @@ func (l L3Decoder) StaticAdditions() []interface{} {
 func (l L3Decoder) StaticDeletions() []interface{} {
 	var entries = make([]interface{}, 0)
 	for _, port := range l._phyPorts {
-		var portDa, _ = net.ParseMAC(port.mac)
-		entries = append(entries, p4client.TableEntry{
-			Tablename: phyInIP,
-			TableField: p4client.TableField{
-				FieldValue: map[string][2]interface{}{
-					"port_id": {uint16(port.id), "exact"},
-					"da":      {portDa, "exact"},
-				},
-				Priority: int32(0),
-			},
-		},
-			p4client.TableEntry{
-				Tablename: phyInArp,
-				TableField: p4client.TableField{
-					FieldValue: map[string][2]interface{}{
-						"port_id":     {uint16(port.id), "exact"},
-						"bit32_zeros": {uint32(0), "exact"},
-					},
-					Priority: int32(0),
-				},
-			},
-			p4client.TableEntry{
-				Tablename: podInIPAccess,
-				TableField: p4client.TableField{
-					FieldValue: map[string][2]interface{}{
-						"vsi":         {uint16(port.vsi), "exact"},
-						"bit32_zeros": {uint32(0), "exact"},
-					},
-					Priority: int32(0),
-				},
-			},
-			p4client.TableEntry{
-				Tablename: podInArpAccess,
-				TableField: p4client.TableField{
-					FieldValue: map[string][2]interface{}{
-						"vsi":         {uint16(port.vsi), "exact"},
-						"bit32_zeros": {uint32(0), "exact"},
-					},
-					Priority: int32(0),
-				},
-			})
+		entries = append(entries, l.phyPortDeletions(port)...)
 	}
 	for _, port := range l._grpcPorts {
 		var peerDa, _ = net.ParseMAC(port.peer["mac"])
@@ -1764,6 +1979,7 @@ func (l L3Decoder) StaticDeletions() []interface{} {
 					Priority: int32(0),
 				},
 			})
+		entries = append(entries, l._grpcSteeringEntries(port, 0, false)...)
 	}
 	entries = append(entries, p4client.TableEntry{
 		Tablename: podInIPTrunk,
@@ -1775,16 +1991,18 @@ func (l L3Decoder) StaticDeletions() []interface{} {
 			Priority: int32(0),
 		},
 	})
-	tidx := trieIndexPool.ReleaseID(TcamPrefix.P2P)
-	entries = append(entries, p4client.TableEntry{
-		Tablename: tcamEntries2,
-		TableField: p4client.TableField{
-			FieldValue: map[string][2]interface{}{
-				"user_meta.cmeta.tcam_prefix": {TcamPrefix.P2P, "ternary"},
+	for _, prefix := range []uint32{TcamPrefix.P2P, TcamPrefix.P2PV6} {
+		tidx := trieIndexPool.ReleaseID(prefix)
+		entries = append(entries, p4client.TableEntry{
+			Tablename: tcamEntries2,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"user_meta.cmeta.tcam_prefix": {prefix, "ternary"},
+				},
+				Priority: int32(tidx),
 			},
-			Priority: int32(tidx),
-		},
-	})
+		})
+	}
 	return entries
 }
 
@@ -1803,7 +2021,7 @@ func (v VxlanDecoder) VxlanDecoderInit(representors map[string][2]string) VxlanD
 	}
 	s := VxlanDecoder{
 		vxlanUDPPort: 4789,
-		_defaultVsi:  0xb,
+		_defaultVsi:  readDefaultVsis().Vxlan,
 		_muxVsi:      int(muxVsi),
 	}
 	return s
@@ -1814,19 +2032,18 @@ func _isL2vpnEnabled(lb *infradb.LogicalBridge) bool {
 	return lb.Spec.Vni != nil
 }
 
-// translateAddedVrf translates the added vrf
-func (v VxlanDecoder) translateAddedVrf(vrf *infradb.Vrf) []interface{} {
-	var entries = make([]interface{}, 0)
-	if !_isL3vpnEnabled(vrf) {
-		return entries
-	}
-	var tcamPrefix, err = _getTcamPrefix(*vrf.Metadata.RoutingTable[0], Direction.Rx)
-	if err != nil {
-		return entries
+// _vrfRmac reads the router mac frr reported for the vrf, the vrf handed in
+// is used when infradb does not hold it (anymore)
+func _vrfRmac(vrf *infradb.Vrf) net.HardwareAddr {
+	G, err := infradb.GetVrf(vrf.Name)
+	if err != nil || G.Status == nil {
+		G = vrf
 	}
-	G, _ := infradb.GetVrf(vrf.Name)
 	var detail map[string]interface{}
 	var Rmac net.HardwareAddr
+	if G.Status == nil {
+		return Rmac
+	}
 	for _, com := range G.Status.Components {
 		if com.Name == "frr" {
 			err := json.Unmarshal([]byte(com.Details), &detail)
@@ -1844,71 +2061,76 @@ func (v VxlanDecoder) translateAddedVrf(vrf *infradb.Vrf) []interface{} {
 			}
 		}
 	}
+	return Rmac
+}
+
+// translateAddedVrf translates the added vrf
+func (v VxlanDecoder) translateAddedVrf(vrf *infradb.Vrf) []interface{} {
+	// The urpf check applies to every vrf, the ingress ones only to l3vpn
+	var entries = _vrfUrpfEntries(vrf, false)
+	if !_isL3vpnEnabled(vrf) {
+		return entries
+	}
+	vrfTable, err := _vrfTable(vrf)
+	if err != nil {
+		return entries
+	}
+	tcamPrefix, err := _getTcamPrefix(vrfTable, Direction.Rx)
+	if err != nil {
+		return entries
+	}
+	var Rmac = _vrfRmac(vrf)
 	if reflect.ValueOf(Rmac).IsZero() {
 		log.Println("intel-e2000: Rmac not found for Vtep :", vrf.Spec.VtepIP.IP)
 
 		return entries
 	}
-	entries = append(entries, p4client.TableEntry{
-		Tablename: phyInVxlan,
-		TableField: p4client.TableField{
-			FieldValue: map[string][2]interface{}{
-				"dst_ip": {vrf.Spec.VtepIP.IP, "exact"},
-				"vni":    {*vrf.Spec.Vni, "exact"},
-				"da":     {Rmac, "exact"},
+	// A dual stack vrf gets the ingress entries of both families in one pass
+	for _, vtep := range _vrfVteps(vrf) {
+		entries = append(entries, p4client.TableEntry{
+			Tablename: _vxlanIngressTable(vtep),
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"dst_ip": {vtep, "exact"},
+					"vni":    {*vrf.Spec.Vni, "exact"},
+					"da":     {Rmac, "exact"},
+				},
+				Priority: int32(0),
 			},
-			Priority: int32(0),
-		},
-		Action: p4client.Action{
-			ActionName: "evpn_gw_control.pop_vxlan_set_vrf_id",
-			Params:     []interface{}{ModPointer.ignorePtr, uint32(tcamPrefix), uint32(_toEgressVsi(v._defaultVsi)), *vrf.Metadata.RoutingTable[0]},
-		},
-	})
+			Action: p4client.Action{
+				ActionName: "evpn_gw_control.pop_vxlan_set_vrf_id",
+				Params:     []interface{}{ModPointer.ignorePtr, uint32(tcamPrefix), uint32(_toEgressVsi(v._defaultVsi)), vrfTable},
+			},
+		})
+	}
 	return entries
 }
 
 // translateDeletedVrf translates the deleted vrf
 func (v VxlanDecoder) translateDeletedVrf(vrf *infradb.Vrf) []interface{} {
-	var entries = make([]interface{}, 0)
+	var entries = _vrfUrpfEntries(vrf, true)
 	if !_isL3vpnEnabled(vrf) {
 		return entries
 	}
-	G, _ := infradb.GetVrf(vrf.Name)
-	var detail map[string]interface{}
-	var Rmac net.HardwareAddr
-	for _, com := range G.Status.Components {
-		if com.Name == "frr" {
-			err := json.Unmarshal([]byte(com.Details), &detail)
-			if err != nil {
-				log.Println("intel-e2000: Error: ", err)
-			}
-			rmac, found := detail["rmac"].(string)
-			if !found {
-				log.Println("intel-e2000: Key 'rmac' not found")
-				break
-			}
-			Rmac, err = net.ParseMAC(rmac)
-			if err != nil {
-				log.Println("intel-e2000: Error parsing MAC address:", err)
-			}
-		}
-	}
+	var Rmac = _vrfRmac(vrf)
 	if reflect.ValueOf(Rmac).IsZero() {
 		log.Println("intel-e2000: Rmac not found for Vtep :", vrf.Spec.VtepIP.IP)
 
 		return entries
 	}
-	entries = append(entries, p4client.TableEntry{
-		Tablename: phyInVxlan,
-		TableField: p4client.TableField{
-			FieldValue: map[string][2]interface{}{
-				"dst_ip": {vrf.Spec.VtepIP.IP, "exact"},
-				"vni":    {*vrf.Spec.Vni, "exact"},
-				"da":     {Rmac, "exact"},
+	for _, vtep := range _vrfVteps(vrf) {
+		entries = append(entries, p4client.TableEntry{
+			Tablename: _vxlanIngressTable(vtep),
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"dst_ip": {vtep, "exact"},
+					"vni":    {*vrf.Spec.Vni, "exact"},
+					"da":     {Rmac, "exact"},
+				},
+				Priority: int32(0),
 			},
-			Priority: int32(0),
-		},
-	})
+		})
+	}
 	return entries
 }
 
@@ -1962,7 +2184,12 @@ func (v VxlanDecoder) translateAddedNexthop(nexthop netlink_polling.NexthopStruc
 	if nexthop.NhType != netlink_polling.VXLAN {
 		return entries
 	}
-	key := fmt.Sprintf("%d-%s-%s-%d-%v", EntryType.l3NH, nexthop.Key.VrfName, nexthop.Key.Dst, nexthop.Key.Dev, nexthop.Key.Local)
+	key := newNexthopPoolKey(EntryType.l3NH, nexthop.Key)
+	nhID, rxID, err := _p4NexthopIDs(nexthop)
+	if err != nil {
+		log.Printf("intel-e2000: Nexthop %d not offloaded: %v\n", nexthop.ID, err)
+		return make([]interface{}, 0)
+	}
 	var modPtr = ptrPool.GetID(key)
 	var vport = nexthop.Metadata["egress_vport"].(int)
 	var smac, _ = net.ParseMAC(nexthop.Metadata["phy_smac"].(string))
@@ -1989,7 +2216,7 @@ func (v VxlanDecoder) translateAddedNexthop(nexthop netlink_polling.NexthopStruc
 			Tablename: l3NhTx,
 			TableField: p4client.TableField{
 				FieldValue: map[string][2]interface{}{
-					"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Tx)), "exact"},
+					"neighbor":    {uint16(nhID), "exact"},
 					"bit32_zeros": {uint32(0), "exact"},
 				},
 				Priority: int32(0),
@@ -2003,7 +2230,7 @@ func (v VxlanDecoder) translateAddedNexthop(nexthop netlink_polling.NexthopStruc
 			Tablename: l3NhRx,
 			TableField: p4client.TableField{
 				FieldValue: map[string][2]interface{}{
-					"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+					"neighbor":    {uint16(rxID), "exact"},
 					"bit32_zeros": {uint32(0), "exact"},
 				},
 				Priority: int32(0),
@@ -2017,7 +2244,7 @@ func (v VxlanDecoder) translateAddedNexthop(nexthop netlink_polling.NexthopStruc
 			Tablename: p2pIn,
 			TableField: p4client.TableField{
 				FieldValue: map[string][2]interface{}{
-					"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+					"neighbor":    {uint16(rxID), "exact"},
 					"bit32_zeros": {uint32(0), "exact"},
 				},
 				Priority: int32(0),
@@ -2038,7 +2265,12 @@ func (v VxlanDecoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStr
 		return entries
 	}
 	// var key []interface{}
-	key := fmt.Sprintf("%d-%s-%s-%d-%v", EntryType.l2Nh, nexthop.Key.VrfName, nexthop.Key.Dst, nexthop.Key.Dev, nexthop.Key.Local)
+	key := newNexthopPoolKey(EntryType.l2Nh, nexthop.Key)
+	nhID, rxID, err := _p4NexthopIDs(nexthop)
+	if err != nil {
+		// Never offloaded without a neighbor, nothing was written
+		return make([]interface{}, 0)
+	}
 	var modPtr = ptrPool.ReleaseID(key)
 	entries = append(entries, p4client.TableEntry{
 		Tablename: pushVxlanHdr,
@@ -2053,7 +2285,7 @@ func (v VxlanDecoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStr
 			Tablename: l3NhTx,
 			TableField: p4client.TableField{
 				FieldValue: map[string][2]interface{}{
-					"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Tx)), "exact"},
+					"neighbor":    {uint16(nhID), "exact"},
 					"bit32_zeros": {uint32(0), "exact"},
 				},
 				Priority: int32(0),
@@ -2063,7 +2295,7 @@ func (v VxlanDecoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStr
 			Tablename: l3NhRx,
 			TableField: p4client.TableField{
 				FieldValue: map[string][2]interface{}{
-					"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+					"neighbor":    {uint16(rxID), "exact"},
 					"bit32_zeros": {uint32(0), "exact"},
 				},
 				Priority: int32(0),
@@ -2073,7 +2305,7 @@ func (v VxlanDecoder) translateDeletedNexthop(nexthop netlink_polling.NexthopStr
 			Tablename: p2pIn,
 			TableField: p4client.TableField{
 				FieldValue: map[string][2]interface{}{
-					"neighbor":    {uint16(_p4NexthopID(nexthop, Direction.Rx)), "exact"},
+					"neighbor":    {uint16(rxID), "exact"},
 					"bit32_zeros": {uint32(0), "exact"},
 				},
 				Priority: int32(0),
@@ -2089,7 +2321,7 @@ func (v VxlanDecoder) translateAddedL2Nexthop(nexthop netlink_polling.L2NexthopS
 	if nexthop.Type != netlink_polling.VXLAN {
 		return entries
 	}
-	key := fmt.Sprintf("%d-%s-%d-%s", EntryType.l2Nh, nexthop.Key.Dev, nexthop.Key.VlanID, nexthop.Key.Dst)
+	key := l2NexthopPoolKey{entryType: EntryType.l2Nh, key: nexthop.Key}
 	var modPtr = ptrPool.GetID(key)
 	var vport = nexthop.Metadata["egress_vport"].(int)
 	var srcMac, _ = net.ParseMAC(nexthop.Metadata["phy_smac"].(string))
@@ -2136,7 +2368,7 @@ func (v VxlanDecoder) translateDeletedL2Nexthop(nexthop netlink_polling.L2Nextho
 	if nexthop.Type != netlink_polling.VXLAN {
 		return entries
 	}
-	key := fmt.Sprintf("%d-%s-%d-%s", EntryType.l2Nh, nexthop.Key.Dev, nexthop.Key.VlanID, nexthop.Key.Dst)
+	key := l2NexthopPoolKey{entryType: EntryType.l2Nh, key: nexthop.Key}
 	var modPtr = ptrPool.ReleaseID(key)
 	var neighbor = nexthop.ID
 	entries = append(entries, p4client.TableEntry{
@@ -2163,58 +2395,18 @@ func (v VxlanDecoder) translateDeletedL2Nexthop(nexthop netlink_polling.L2Nextho
 
 // translateAddedFdb translates the added fdb entry
 func (v VxlanDecoder) translateAddedFdb(fdb netlink_polling.FdbEntryStruct) []interface{} {
-	var entries = make([]interface{}, 0)
-
 	if fdb.Type != netlink_polling.VXLAN {
-		return entries
+		return make([]interface{}, 0)
 	}
-	var mac, _ = net.ParseMAC(fdb.Mac)
-	var directions = _directionsOf(fdb)
-
-	for _, dir := range directions {
-		entries = append(entries, p4client.TableEntry{
-			Tablename: l2Fwd,
-			TableField: p4client.TableField{
-				FieldValue: map[string][2]interface{}{
-					"vlan_id":   {uint16(fdb.VlanID), "exact"},
-					"da":        {mac, "exact"},
-					"direction": {uint16(dir), "exact"},
-				},
-				Priority: int32(0),
-			},
-			Action: p4client.Action{
-				ActionName: "evpn_gw_control.set_neighbor",
-				Params:     []interface{}{uint16(fdb.Metadata["nh_id"].(int))},
-			},
-		})
-	}
-	return entries
+	return _fdbEntries(fdb, uint16(fdb.Metadata["nh_id"].(int)), true)
 }
 
 // translateDeletedFdb translates the deleted fdb entry
 func (v VxlanDecoder) translateDeletedFdb(fdb netlink_polling.FdbEntryStruct) []interface{} {
-	var entries = make([]interface{}, 0)
-
 	if fdb.Type != netlink_polling.VXLAN {
-		return entries
-	}
-	var mac, _ = net.ParseMAC(fdb.Mac)
-	var directions = _directionsOf(fdb)
-
-	for _, dir := range directions {
-		entries = append(entries, p4client.TableEntry{
-			Tablename: l2Fwd,
-			TableField: p4client.TableField{
-				FieldValue: map[string][2]interface{}{
-					"vlan_id":   {uint16(fdb.VlanID), "exact"},
-					"da":        {mac, "exact"},
-					"direction": {uint16(dir), "exact"},
-				},
-				Priority: int32(0),
-			},
-		})
+		return make([]interface{}, 0)
 	}
-	return entries
+	return _fdbEntries(fdb, 0, false)
 }
 
 // PodDecoder structure for pod decode
@@ -2247,14 +2439,21 @@ func (p PodDecoder) PodDecoderInit(representors map[string][2]string) PodDecoder
 	p._vrfMuxVsi = int(vrfMuxVsi)
 	p._vrfMuxMac = p.vrfMuxIDs[1]
 	p.floodModPtr = ModPointer.l2FloodingPtr
+	// the flood nexthop holds the neighbor slot 0
 	p.floodNhID = uint16(0)
 	return p
 }
 
 // translateAddedBp translate the added bp
+func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, error) {
+	return p._translateAddedBp(bp, 0, nil)
+}
+
+// _translateAddedBp translate the added bp, the entries of a trunk are handed
+// to emit every chunk vlans and the ones left are returned
 //
 //nolint:funlen,gocognit
-func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, error) {
+func (p PodDecoder) _translateAddedBp(bp *infradb.BridgePort, chunk int, emit func([]interface{}) error) ([]interface{}, error) {
 	var entries = make([]interface{}, 0)
 
 	var portMuxVsiOut = _toEgressVsi(p._portMuxVsi)
@@ -2262,18 +2461,24 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 	if err != nil {
 		return entries, err
 	}
-	key := fmt.Sprintf("%d-%d", EntryType.BP, port)
-	key1 := fmt.Sprintf("%d-%v", EntryType.BP, *bp.Spec.MacAddress)
+	key := bpPoolKey{entryType: EntryType.BP, port: port}
+	key1 := bpPoolKey{entryType: EntryType.BP, mac: bp.Spec.MacAddress.String()}
 	var vsi = port
 	var vsiOut = _toEgressVsi(int(vsi))
-	var modPtr = ptrPool.GetID(key)
+	modPtr, err := ptrPool.claimID(key)
+	if err != nil {
+		return nil, err
+	}
 	var ignorePtr = ModPointer.ignorePtr
 	var mac = *bp.Spec.MacAddress
 	if p._portMuxVsi < 0 || p._portMuxVsi > math.MaxUint16 {
 		return nil, errors.New("_portMuxVsi is not in range of uint16")
 	}
 	if bp.Spec.Ptype == infradb.Trunk {
-		var modPtrD = ptrPool.GetID(key1)
+		modPtrD, err := ptrPool.claimID(key1)
+		if err != nil {
+			return nil, err
+		}
 		entries = append(entries, p4client.TableEntry{
 			// From MUX
 			Tablename: portMuxIn,
@@ -2329,7 +2534,15 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 					Params:     []interface{}{uint16(0), uint16(0), uint32(vsi)},
 				},
 			})
-		for _, vlan := range bp.Spec.LogicalBridges {
+		var allowed = recordTrunkVlans(bp)
+		var vlanMap = recordVlanMap(bp)
+		for i, vlan := range bp.Spec.LogicalBridges {
+			if chunk > 0 && i > 0 && i%chunk == 0 {
+				if err := emit(_withSviV6Ingress(entries)); err != nil {
+					return nil, err
+				}
+				entries = make([]interface{}, 0)
+			}
 			BrObj, err := infradb.GetLB(vlan)
 			if err != nil {
 				log.Printf("intel-e2000: unable to find key %s and error is %v\n", vlan, err)
@@ -2339,15 +2552,20 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 				log.Printf("intel-e2000: VlanID %v value passed in Logical Bridge create is greater than 16 bit value\n", BrObj.Spec.VlanID)
 				return entries, errors.New("VlanID value passed in Logical Bridge create is greater than 16 bit value")
 			}
+			if !vlanAllowed(allowed, BrObj.Spec.VlanID) {
+				log.Printf("intel-e2000: vlan %d not allowed on trunk bridge port %s\n", BrObj.Spec.VlanID, bp.Name)
+				continue
+			}
 
 			vid := uint16(BrObj.Spec.VlanID)
+			cvid := uint16(customerVlan(vlanMap, BrObj.Spec.VlanID))
 			entries = append(entries, p4client.TableEntry{
 				// To MUX PORT
 				Tablename: podInArpTrunk,
 				TableField: p4client.TableField{
 					FieldValue: map[string][2]interface{}{
 						"vsi": {uint16(vsi), "exact"},
-						"vid": {vid, "exact"},
+						"vid": {cvid, "exact"},
 					},
 					Priority: int32(0),
 				},
@@ -2362,7 +2580,7 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 					TableField: p4client.TableField{
 						FieldValue: map[string][2]interface{}{
 							"vsi": {uint16(vsi), "exact"},
-							"vid": {vid, "exact"},
+							"vid": {cvid, "exact"},
 						},
 						Priority: int32(0),
 					},
@@ -2383,7 +2601,7 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 					log.Printf("intel-e2000: unable to find key %s and error is %v\n", SviObj.Spec.Vrf, err)
 					return entries, err
 				}
-				tcamPrefix, err := _getTcamPrefix(*VrfObj.Metadata.RoutingTable[0], Direction.Tx)
+				tcamPrefix, vrfID, err := _sviVrfParams(VrfObj)
 				if err != nil {
 					return entries, err
 				}
@@ -2395,20 +2613,25 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 					TableField: p4client.TableField{
 						FieldValue: map[string][2]interface{}{
 							"vsi": {uint16(vsi), "exact"},
-							"vid": {vid, "exact"},
+							"vid": {cvid, "exact"},
 							"da":  {sviMac, "exact"},
 						},
 						Priority: int32(0),
 					},
 					Action: p4client.Action{
 						ActionName: "evpn_gw_control.pop_vlan_set_vrf_id",
-						Params:     []interface{}{ignorePtr, uint32(tcamPrefix), uint32(0), uint16(*VrfObj.Metadata.RoutingTable[0])},
+						Params:     []interface{}{ignorePtr, tcamPrefix, uint32(0), vrfID},
 					},
 				})
 			} else {
-				log.Println("intel-e2000: no associated SVI object created")
+				_logL2Only(bp, BrObj)
 			}
 		}
+		native, err := p._nativeVlanEntries(bp, port, true)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, native...)
 	} else if bp.Spec.Ptype == infradb.Access {
 		BrObj, err := infradb.GetLB(bp.Spec.LogicalBridges[0])
 		if err != nil {
@@ -2420,7 +2643,10 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 			return entries, errors.New("VlanID value passed in Logical Bridge create is greater than 16 bit value")
 		}
 		var vid = uint16(BrObj.Spec.VlanID)
-		var modPtrD = ptrPool.GetID(key1)
+		modPtrD, err := ptrPool.claimID(key1)
+		if err != nil {
+			return nil, err
+		}
 		var dstMacAddr = *bp.Spec.MacAddress
 		entries = append(entries, p4client.TableEntry{
 			// From MUX
@@ -2518,7 +2744,7 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 				log.Printf("intel-e2000: unable to find key %s and error is %v\n", SviObj.Spec.Vrf, err)
 				return entries, err
 			}
-			tcamPrefix, err := _getTcamPrefix(*VrfObj.Metadata.RoutingTable[0], Direction.Tx)
+			tcamPrefix, vrfID, err := _sviVrfParams(VrfObj)
 			if err != nil {
 				return entries, err
 			}
@@ -2535,14 +2761,15 @@ func (p PodDecoder) translateAddedBp(bp *infradb.BridgePort) ([]interface{}, err
 				},
 				Action: p4client.Action{
 					ActionName: "evpn_gw_control.set_vrf_id_tx",
-					Params:     []interface{}{uint32(tcamPrefix), uint32(0), uint16(*VrfObj.Metadata.RoutingTable[0])},
+					Params:     []interface{}{tcamPrefix, uint32(0), vrfID},
 				},
 			})
 		} else {
-			log.Printf("no SVI for VLAN {vid} on BP {vsi}, skipping entry for SVI table")
+			_logL2Only(bp, BrObj)
 		}
 	}
-	return entries, nil
+	entries = append(entries, _extraMacEntries(bp, vsiOut, true)...)
+	return _withSviV6Ingress(entries), nil
 }
 
 // translateDeletedBp translate the deleted bp
@@ -2554,8 +2781,8 @@ func (p PodDecoder) translateDeletedBp(bp *infradb.BridgePort) ([]interface{}, e
 	if err != nil {
 		return entries, err
 	}
-	key := fmt.Sprintf("%d-%d", EntryType.BP, port)
-	key1 := fmt.Sprintf("%d-%v", EntryType.BP, *bp.Spec.MacAddress)
+	key := bpPoolKey{entryType: EntryType.BP, port: port}
+	key1 := bpPoolKey{entryType: EntryType.BP, mac: bp.Spec.MacAddress.String()}
 	var vsi = port
 	var modPtr = ptrPool.ReleaseID(key)
 	var mac = *bp.Spec.MacAddress
@@ -2603,6 +2830,8 @@ func (p PodDecoder) translateDeletedBp(bp *infradb.BridgePort) ([]interface{}, e
 					Priority: int32(0),
 				},
 			})
+		var allowed = releaseTrunkVlans(bp)
+		var vlanMap = releaseVlanMap(bp)
 		for _, vlan := range bp.Spec.LogicalBridges {
 			BrObj, err := infradb.GetLB(vlan)
 			if err != nil {
@@ -2613,7 +2842,10 @@ func (p PodDecoder) translateDeletedBp(bp *infradb.BridgePort) ([]interface{}, e
 				log.Printf("intel-e2000: VlanID %v value passed in Logical Bridge create is greater than 16 bit value\n", BrObj.Spec.VlanID)
 				return entries, errors.New("VlanID value passed in Logical Bridge create is greater than 16 bit value")
 			}
-			vid := uint16(BrObj.Spec.VlanID)
+			if !vlanAllowed(allowed, BrObj.Spec.VlanID) {
+				continue
+			}
+			vid := uint16(customerVlan(vlanMap, BrObj.Spec.VlanID))
 			entries = append(entries, p4client.TableEntry{
 				// To MUX PORT
 				Tablename: podInArpTrunk,
@@ -2658,9 +2890,14 @@ func (p PodDecoder) translateDeletedBp(bp *infradb.BridgePort) ([]interface{}, e
 					},
 				})
 			} else {
-				log.Printf("no SVI for VLAN {vid} on BP {vsi}, skipping entry for SVI table")
+				_logL2Only(bp, BrObj)
 			}
 		}
+		native, err := p._nativeVlanEntries(bp, port, false)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, native...)
 	} else if bp.Spec.Ptype == infradb.Access {
 		BrObj, err := infradb.GetLB(bp.Spec.LogicalBridges[0])
 		if err != nil {
@@ -2748,15 +2985,16 @@ func (p PodDecoder) translateDeletedBp(bp *infradb.BridgePort) ([]interface{}, e
 				},
 			})
 		} else {
-			log.Printf("no SVI for VLAN {vid} on BP {vsi}, skipping entry for SVI table")
+			_logL2Only(bp, BrObj)
 		}
 	}
-	return entries, nil
+	entries = append(entries, _extraMacEntries(bp, 0, false)...)
+	return _withSviV6Ingress(entries), nil
 }
 
 // translateAddedSvi translate the added svi
 func (p PodDecoder) translateAddedSvi(svi *infradb.Svi) ([]interface{}, error) {
-	var ignorePtr = int(ModPointer.ignorePtr)
+	var ignorePtr = ModPointer.ignorePtr
 	var mac = *svi.Spec.MacAddress
 	var entries = make([]interface{}, 0)
 
@@ -2781,7 +3019,7 @@ func (p PodDecoder) translateAddedSvi(svi *infradb.Svi) ([]interface{}, error) {
 				log.Printf("intel-e2000: unable to find key %s and error is %v", svi.Spec.Vrf, err)
 				return entries, err
 			}
-			tcamPrefix, err := _getTcamPrefix(*VrfObj.Metadata.RoutingTable[0], Direction.Tx)
+			tcamPrefix, vrfID, err := _sviVrfParams(VrfObj)
 			if err != nil {
 				return entries, err
 			}
@@ -2797,29 +3035,36 @@ func (p PodDecoder) translateAddedSvi(svi *infradb.Svi) ([]interface{}, error) {
 					},
 					Action: p4client.Action{
 						ActionName: "evpn_gw_control.set_vrf_id_tx",
-						Params:     []interface{}{uint32(tcamPrefix), uint32(0), uint16(*VrfObj.Metadata.RoutingTable[0])},
+						Params:     []interface{}{tcamPrefix, uint32(0), vrfID},
 					},
 				})
-			} else if PortObj.Spec.Ptype == infradb.Trunk {
+			} else if PortObj.Spec.Ptype == infradb.Trunk && vlanAllowed(trunkVlans(PortObj), BrObj.Spec.VlanID) {
 				entries = append(entries, p4client.TableEntry{
 					Tablename: portInSviTrunk,
 					TableField: p4client.TableField{
 						FieldValue: map[string][2]interface{}{
 							"vsi": {uint16(port), "exact"},
-							"vid": {uint16(BrObj.Spec.VlanID), "exact"},
+							"vid": {uint16(customerVlan(vlanMapOf(PortObj), BrObj.Spec.VlanID)), "exact"},
 							"da":  {mac, "exact"},
 						},
 						Priority: int32(0),
 					},
 					Action: p4client.Action{
 						ActionName: "evpn_gw_control.pop_vlan_set_vrf_id",
-						Params:     []interface{}{ignorePtr, uint32(tcamPrefix), uint32(0), uint16(*VrfObj.Spec.Vni)},
+						Params:     []interface{}{ignorePtr, tcamPrefix, uint32(0), vrfID},
 					},
 				})
 			}
+			if vid, ok := nativeVlan(PortObj); ok && vid == BrObj.Spec.VlanID {
+				entry, err := _nativeSviEntry(port, svi, true)
+				if err != nil {
+					return entries, err
+				}
+				entries = append(entries, entry)
+			}
 		}
 	}
-	return entries, nil
+	return _withSviV6Ingress(entries), nil
 }
 
 // translateDeletedSvi translate the deleted svi
@@ -2855,74 +3100,45 @@ func (p PodDecoder) translateDeletedSvi(svi *infradb.Svi) ([]interface{}, error)
 						Priority: int32(0),
 					},
 				})
-			} else if PortObj.Spec.Ptype == infradb.Trunk {
+			} else if PortObj.Spec.Ptype == infradb.Trunk && vlanAllowed(trunkVlans(PortObj), BrObj.Spec.VlanID) {
 				entries = append(entries, p4client.TableEntry{
 					Tablename: portInSviTrunk,
 					TableField: p4client.TableField{
 						FieldValue: map[string][2]interface{}{
 							"vsi": {uint16(port), "exact"},
-							"vid": {uint16(BrObj.Spec.VlanID), "exact"},
+							"vid": {uint16(customerVlan(vlanMapOf(PortObj), BrObj.Spec.VlanID)), "exact"},
 							"da":  {mac, "exact"},
 						},
 						Priority: int32(0),
 					},
 				})
 			}
+			if vid, ok := nativeVlan(PortObj); ok && vid == BrObj.Spec.VlanID {
+				entry, err := _nativeSviEntry(port, svi, false)
+				if err != nil {
+					return entries, err
+				}
+				entries = append(entries, entry)
+			}
 		}
 	}
-	return entries, nil
+	return _withSviV6Ingress(entries), nil
 }
 
 // translateAddedFdb translate the added fdb entry
 func (p PodDecoder) translateAddedFdb(fdb netlink_polling.FdbEntryStruct) []interface{} {
-	var entries = make([]interface{}, 0)
-
-	var fdbMac, _ = net.ParseMAC(fdb.Mac)
 	if fdb.Type != netlink_polling.BRIDGEPORT {
-		return entries
-	}
-	for dir := range _directionsOf(fdb) {
-		entries = append(entries, p4client.TableEntry{
-			Tablename: l2Fwd,
-			TableField: p4client.TableField{
-				FieldValue: map[string][2]interface{}{
-					"vlan_id":   {uint16(fdb.VlanID), "exact"},
-					"da":        {fdbMac, "exact"},
-					"direction": {uint16(dir), "exact"},
-				},
-				Priority: int32(0),
-			},
-			Action: p4client.Action{
-				ActionName: "evpn_gw_control.set_neighbor",
-				Params:     []interface{}{uint16(fdb.Nexthop.ID)},
-			},
-		})
+		return make([]interface{}, 0)
 	}
-	return entries
+	return _fdbEntries(fdb, uint16(fdb.Nexthop.ID), true)
 }
 
 // translateDeletedFdb translate the deleted fdb entry
 func (p PodDecoder) translateDeletedFdb(fdb netlink_polling.FdbEntryStruct) []interface{} {
-	var entries = make([]interface{}, 0)
-
-	var fdbMac, _ = net.ParseMAC(fdb.Mac)
 	if fdb.Type != netlink_polling.BRIDGEPORT {
-		return entries
+		return make([]interface{}, 0)
 	}
-	for dir := range _directionsOf(fdb) {
-		entries = append(entries, p4client.TableEntry{
-			Tablename: l2Fwd,
-			TableField: p4client.TableField{
-				FieldValue: map[string][2]interface{}{
-					"vlan_id":   {uint16(fdb.VlanID), "exact"},
-					"da":        {fdbMac, "exact"},
-					"direction": {uint16(dir), "exact"},
-				},
-				Priority: int32(0),
-			},
-		})
-	}
-	return entries
+	return _fdbEntries(fdb, 0, false)
 }
 
 // translateAddedL2Nexthop translate the added l2 nexthop entry
@@ -2938,7 +3154,8 @@ func (p PodDecoder) translateAddedL2Nexthop(nexthop netlink_polling.L2NexthopStr
 	if err != nil {
 		panic(err)
 	}
-	if portType == infradb.Access {
+	var class, classed = nexthopClass(nexthop)
+	if portType == infradb.Access || untaggedNexthop(nexthop, true) {
 		entries = append(entries, p4client.TableEntry{
 			Tablename: l2Nh,
 			TableField: p4client.TableField{
@@ -2948,13 +3165,10 @@ func (p PodDecoder) translateAddedL2Nexthop(nexthop netlink_polling.L2NexthopStr
 				},
 				Priority: int32(0),
 			},
-			Action: p4client.Action{
-				ActionName: "evpn_gw_control.fwd_to_port",
-				Params:     []interface{}{uint32(_toEgressVsi(portID))},
-			},
+			Action: _l2NhAction("evpn_gw_control.fwd_to_port", class, classed, uint32(_toEgressVsi(portID))),
 		})
 	} else if portType == infradb.Trunk {
-		key := fmt.Sprintf("%d-%s-%d-%s", EntryType.l2Nh, nexthop.Key.Dev, nexthop.Key.VlanID, nexthop.Key.Dst)
+		key := l2NexthopPoolKey{entryType: EntryType.l2Nh, key: nexthop.Key}
 		var modPtr = ptrPool.GetID(key)
 		entries = append(entries, p4client.TableEntry{
 			Tablename: pushVlan,
@@ -2966,7 +3180,7 @@ func (p PodDecoder) translateAddedL2Nexthop(nexthop netlink_polling.L2NexthopStr
 			},
 			Action: p4client.Action{
 				ActionName: "evpn_gw_control.vlan_push",
-				Params:     []interface{}{uint16(0), uint16(0), uint16(nexthop.VlanID)},
+				Params:     []interface{}{uint16(class.Pcp), uint16(0), uint16(nexthopCustomerVlan(nexthop))},
 			},
 		},
 			p4client.TableEntry{
@@ -2978,10 +3192,7 @@ func (p PodDecoder) translateAddedL2Nexthop(nexthop netlink_polling.L2NexthopStr
 					},
 					Priority: int32(0),
 				},
-				Action: p4client.Action{
-					ActionName: "evpn_gw_control.push_vlan_l2",
-					Params:     []interface{}{modPtr, uint32(_toEgressVsi(portID))},
-				},
+				Action: _l2NhAction("evpn_gw_control.push_vlan_l2", class, classed, modPtr, uint32(_toEgressVsi(portID))),
 			})
 	}
 	return entries
@@ -2998,7 +3209,7 @@ func (p PodDecoder) translateDeletedL2Nexthop(nexthop netlink_polling.L2NexthopS
 	var neighbor = nexthop.ID
 	var portType = nexthop.Metadata["portType"].(infradb.BridgePortType)
 
-	if portType == infradb.Access {
+	if portType == infradb.Access || untaggedNexthop(nexthop, false) {
 		entries = append(entries, p4client.TableEntry{
 			Tablename: l2Nh,
 			TableField: p4client.TableField{
@@ -3010,7 +3221,7 @@ func (p PodDecoder) translateDeletedL2Nexthop(nexthop netlink_polling.L2NexthopS
 			},
 		})
 	} else if portType == infradb.Trunk {
-		key := fmt.Sprintf("%d-%s-%d-%s", EntryType.l2Nh, nexthop.Key.Dev, nexthop.Key.VlanID, nexthop.Key.Dst)
+		key := l2NexthopPoolKey{entryType: EntryType.l2Nh, key: nexthop.Key}
 		modPtr = ptrPool.ReleaseID(key)
 		entries = append(entries, p4client.TableEntry{
 			Tablename: pushVlan,
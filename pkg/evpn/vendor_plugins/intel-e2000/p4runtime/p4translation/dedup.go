@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// eventGeneration generation of an object as last dispatched, the digest
+// covers the content the translation depends on
+type eventGeneration struct {
+	generation uint64
+	digest     string
+}
+
+var (
+	// dedupLock guards the event generations
+	dedupLock sync.Mutex
+
+	// dedupSeq last generation handed out
+	dedupSeq uint64
+
+	// objectGenerations generations of the live nexthops, l2 nexthops and
+	// fdb entries keyed by their netlink key
+	objectGenerations = make(map[interface{}]*eventGeneration)
+
+	// routeGenerations generations of the live routes keyed by route key,
+	// protocol and metric as the candidates of a prefix
+	routeGenerations = make(map[nm.RouteKey]map[candidateKey]*eventGeneration)
+
+	// dedupDuplicates events dropped as duplicates
+	dedupDuplicates uint64
+
+	// dedupRedelivered adds of live objects dispatched as updates
+	dedupRedelivered uint64
+)
+
+// nexthopDigest digest of the content of a route nexthop
+func nexthopDigest(nh *nm.NexthopStruct) string {
+	if nh == nil {
+		return "<nil>"
+	}
+	return fmt.Sprint(nh.Key, nh.ID, nh.NhType, nh.Weight, nh.Resolved, nh.Metadata)
+}
+
+// eventDigest returns the digest of the object of a netlink event, false for
+// the objects not tracked
+func eventDigest(event interface{}) (string, bool) {
+	switch obj := event.(type) {
+	case *nm.RouteStruct:
+		if obj == nil {
+			return "", false
+		}
+		var sb strings.Builder
+		fmt.Fprint(&sb, obj.Route0.Dst, obj.Route0.Table, obj.Metadata)
+		for _, nh := range obj.Nexthops {
+			sb.WriteString(nexthopDigest(nh))
+		}
+		return sb.String(), true
+	case *nm.NexthopStruct:
+		if obj == nil {
+			return "", false
+		}
+		return nexthopDigest(obj), true
+	case *nm.L2NexthopStruct:
+		if obj == nil {
+			return "", false
+		}
+		return fmt.Sprint(obj.ID, obj.Type, obj.Dst, obj.Resolved, obj.Metadata), true
+	case *nm.FdbEntryStruct:
+		if obj == nil {
+			return "", false
+		}
+		var nh string
+		if obj.Nexthop != nil {
+			nh = fmt.Sprint(obj.Nexthop.Key, obj.Nexthop.ID)
+		}
+		return fmt.Sprint(obj.Type, obj.State, obj.Metadata, nh), true
+	}
+	return "", false
+}
+
+// generationsOf returns the generations the object of an event is tracked in
+// and its key there, the caller holds the dedup lock
+func generationsOf(event interface{}) (map[interface{}]*eventGeneration, interface{}) {
+	switch obj := event.(type) {
+	case *nm.NexthopStruct:
+		return objectGenerations, obj.Key
+	case *nm.L2NexthopStruct:
+		return objectGenerations, obj.Key
+	case *nm.FdbEntryStruct:
+		return objectGenerations, obj.Key
+	}
+	return nil, nil
+}
+
+// dedupEvent checks a netlink event against the generation of its object and
+// returns the event type to dispatch, false when the event is a duplicate.
+// The poller redelivers adds and deletes after a resync, an add or update
+// carrying the content already dispatched and a delete of an object not live
+// are dropped so the pool references are taken and released once. An add of
+// a live object with a new content is dispatched as update, except for the
+// routes whose add replaces the route in place. The generation is recorded
+// before the dispatch, failDispatch clears it when the handler fails
+func dedupEvent(eventType string, event interface{}) (string, bool) {
+	digest, tracked := eventDigest(event)
+	if !tracked {
+		return eventType, true
+	}
+	deleted := strings.HasSuffix(eventType, "_deleted")
+	updated := strings.HasSuffix(eventType, "_updated")
+
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+	if route, ok := event.(*nm.RouteStruct); ok {
+		return dedupRoute(eventType, route, digest, deleted, updated)
+	}
+	generations, key := generationsOf(event)
+	gen, live := generations[key]
+	switch {
+	case deleted && !live:
+		dedupDuplicates++
+		log.Printf("intel-e2000: Dropping %s of %+v, not live\n", eventType, key)
+		return eventType, false
+	case deleted:
+		delete(generations, key)
+	case live && gen.digest == digest:
+		dedupDuplicates++
+		log.Printf("intel-e2000: Dropping duplicate %s of %+v generation %d\n", eventType, key, gen.generation)
+		return eventType, false
+	case live:
+		if !updated {
+			dedupRedelivered++
+			eventType = strings.TrimSuffix(eventType, "_added") + "_updated"
+		}
+		gen.digest = digest
+	default:
+		dedupSeq++
+		generations[key] = &eventGeneration{generation: dedupSeq, digest: digest}
+	}
+	return eventType, true
+}
+
+// dedupRoute checks a route event against the generation of its candidate,
+// an update replaces the candidates of the same protocol as the route
+// election does. The caller holds the dedup lock
+func dedupRoute(eventType string, route *nm.RouteStruct, digest string, deleted bool, updated bool) (string, bool) {
+	key := keyOf(*route)
+	candidates := routeGenerations[route.Key]
+	gen, live := candidates[key]
+	switch {
+	case deleted && !live:
+		dedupDuplicates++
+		log.Printf("intel-e2000: Dropping %s of %+v from %s, not live\n", eventType, route.Key, route.Route0.Protocol)
+		return eventType, false
+	case deleted:
+		delete(candidates, key)
+		if len(candidates) == 0 {
+			delete(routeGenerations, route.Key)
+		}
+		return eventType, true
+	case live && gen.digest == digest:
+		dedupDuplicates++
+		log.Printf("intel-e2000: Dropping duplicate %s of %+v from %s generation %d\n", eventType, route.Key, route.Route0.Protocol, gen.generation)
+		return eventType, false
+	}
+	if candidates == nil {
+		candidates = make(map[candidateKey]*eventGeneration)
+		routeGenerations[route.Key] = candidates
+	}
+	if updated {
+		for k := range candidates {
+			if k.Protocol == key.Protocol && k != key {
+				delete(candidates, k)
+			}
+		}
+	}
+	if live {
+		gen.digest = digest
+		return eventType, true
+	}
+	dedupSeq++
+	candidates[key] = &eventGeneration{generation: dedupSeq, digest: digest}
+	return eventType, true
+}
+
+// failDispatch clears the digest of an event whose handler failed so the
+// redelivered event is dispatched again rather than dropped as a duplicate.
+// A failed delete keeps its object live for the redelivered delete
+func failDispatch(eventType string, event interface{}) {
+	if _, tracked := eventDigest(event); !tracked {
+		return
+	}
+	deleted := strings.HasSuffix(eventType, "_deleted")
+
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+	if route, ok := event.(*nm.RouteStruct); ok {
+		candidate := keyOf(*route)
+		candidates := routeGenerations[route.Key]
+		if gen, live := candidates[candidate]; live {
+			gen.digest = ""
+			return
+		}
+		if !deleted {
+			return
+		}
+		if candidates == nil {
+			candidates = make(map[candidateKey]*eventGeneration)
+			routeGenerations[route.Key] = candidates
+		}
+		dedupSeq++
+		candidates[candidate] = &eventGeneration{generation: dedupSeq}
+		return
+	}
+	generations, key := generationsOf(event)
+	if gen, live := generations[key]; live {
+		gen.digest = ""
+		return
+	}
+	if deleted {
+		dedupSeq++
+		generations[key] = &eventGeneration{generation: dedupSeq}
+	}
+}
+
+// dedupCounters returns the duplicate events dropped and the adds
+// dispatched as updates
+func dedupCounters() (uint64, uint64) {
+	dedupLock.Lock()
+	defer dedupLock.Unlock()
+	return dedupDuplicates, dedupRedelivered
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/viper"
+)
+
+// defaultVsisKey config key of the default vsis
+const defaultVsisKey = "defaultvsis"
+
+// DefaultVsis default vsis config structure, the vsis the pipeline sends the
+// traffic to when no entry steers it elsewhere. L3 receives the routed
+// traffic without a nexthop and vxlan the decapsulated traffic of the evpn
+// vrfs and logical bridges
+type DefaultVsis struct {
+	L3    int `yaml:"l3" json:"l3"`
+	Vxlan int `yaml:"vxlan" json:"vxlan"`
+}
+
+// defaultDefaultVsis default vsis of the reference pipeline
+var defaultDefaultVsis = DefaultVsis{L3: 0x6, Vxlan: 0xb}
+
+// readDefaultVsis reads the default vsis, the ones of the reference pipeline
+// for those not set
+func readDefaultVsis() DefaultVsis {
+	vsis := defaultDefaultVsis
+	if !viper.IsSet(defaultVsisKey) {
+		return vsis
+	}
+	if err := viper.UnmarshalKey(defaultVsisKey, &vsis); err != nil {
+		log.Printf("intel-e2000: Failed to read default vsis config: %v\n", err)
+		return defaultDefaultVsis
+	}
+	return vsis
+}
+
+// problems returns the default vsis out of range
+func (d DefaultVsis) problems() []string {
+	var problems []string
+	if d.L3 < 0 || uint64(d.L3) > vsiMaxRange {
+		problems = append(problems, fmt.Sprintf("default vsi l3 %d is out of range 0-%d", d.L3, vsiMaxRange))
+	}
+	if d.Vxlan < 0 || uint64(d.Vxlan) > vsiMaxRange {
+		problems = append(problems, fmt.Sprintf("default vsi vxlan %d is out of range 0-%d", d.Vxlan, vsiMaxRange))
+	}
+	return problems
+}
@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/common"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/subscriberframework/eventbus"
+)
+
+// dependencyRetry retry timer of an object waiting for its prerequisites, the
+// object is handled again as soon as they are offloaded, the timer only
+// covers a missed release
+const dependencyRetry = 30 * time.Second
+
+// ObjectRef reference to an infradb object by event type and name
+type ObjectRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// String returns the reference as kind/name
+func (r ObjectRef) String() string {
+	return r.Kind + "/" + r.Name
+}
+
+// WaitingObject object deferred until its prerequisites are offloaded
+type WaitingObject struct {
+	Object  ObjectRef   `json:"object"`
+	Missing []ObjectRef `json:"missing"`
+	Since   time.Time   `json:"since"`
+}
+
+// waiting deferred object with the event to replay once released
+type waiting struct {
+	ref     ObjectRef
+	event   *eventbus.ObjectData
+	missing []ObjectRef
+	since   time.Time
+}
+
+var (
+	// dependencyLock guards the dependency graph
+	dependencyLock sync.Mutex
+
+	// waitingObjects objects deferred keyed by reference
+	waitingObjects = make(map[ObjectRef]*waiting)
+
+	// dependents objects deferred keyed by the prerequisite they wait for
+	dependents = make(map[ObjectRef]map[ObjectRef]bool)
+)
+
+// prerequisites returns the objects an object translates from: the logical
+// bridges of a bridge port with their svi and vrf, the logical bridge and the
+// vrf of a svi. Nil when the object is gone or being deleted
+func prerequisites(ref ObjectRef) []ObjectRef {
+	var refs []ObjectRef
+	switch ref.Kind {
+	case "bridge-port":
+		bp, err := infradb.GetBP(ref.Name)
+		if err != nil || bp.Status.BPOperStatus == infradb.BridgePortOperStatusToBeDeleted {
+			return nil
+		}
+		for _, name := range bp.Spec.LogicalBridges {
+			refs = append(refs, ObjectRef{Kind: "logical-bridge", Name: name})
+			lb, err := infradb.GetLB(name)
+			if err != nil || lb.Svi == "" {
+				continue
+			}
+			refs = append(refs, ObjectRef{Kind: "svi", Name: lb.Svi})
+			if svi, err := infradb.GetSvi(lb.Svi); err == nil {
+				refs = append(refs, ObjectRef{Kind: "vrf", Name: svi.Spec.Vrf})
+			}
+		}
+	case "svi":
+		svi, err := infradb.GetSvi(ref.Name)
+		if err != nil || svi.Status.SviOperStatus == infradb.SviOperStatusToBeDeleted {
+			return nil
+		}
+		refs = append(refs, ObjectRef{Kind: "logical-bridge", Name: svi.Spec.LogicalBridge},
+			ObjectRef{Kind: "vrf", Name: svi.Spec.Vrf})
+	}
+	return refs
+}
+
+// available checks an object exists and the intel-e2000 component offloaded
+// it
+func available(ref ObjectRef) bool {
+	switch ref.Kind {
+	case "vrf":
+		vrf, err := infradb.GetVrf(ref.Name)
+		return err == nil && vrf.Status != nil && vrf.Status.VrfOperStatus != infradb.VrfOperStatusToBeDeleted &&
+			(_isDefaultVrf(vrf) || offloaded(vrf.Status.Components))
+	case "logical-bridge":
+		lb, err := infradb.GetLB(ref.Name)
+		return err == nil && lb.Status != nil && lb.Status.LBOperStatus != infradb.LogicalBridgeOperStatusToBeDeleted &&
+			offloaded(lb.Status.Components)
+	case "svi":
+		svi, err := infradb.GetSvi(ref.Name)
+		return err == nil && svi.Status != nil && svi.Status.SviOperStatus != infradb.SviOperStatusToBeDeleted &&
+			offloaded(svi.Status.Components)
+	}
+	return false
+}
+
+// missingDependencies returns the prerequisites of an object not offloaded
+func missingDependencies(ref ObjectRef) []ObjectRef {
+	var missing []ObjectRef
+	seen := make(map[ObjectRef]bool)
+	for _, dep := range prerequisites(ref) {
+		if seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		if !available(dep) {
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+// unlinkLocked drops an object from the dependency graph
+func unlinkLocked(ref ObjectRef) {
+	w, ok := waitingObjects[ref]
+	if !ok {
+		return
+	}
+	for _, dep := range w.missing {
+		delete(dependents[dep], ref)
+		if len(dependents[dep]) == 0 {
+			delete(dependents, dep)
+		}
+	}
+	delete(waitingObjects, ref)
+}
+
+// deferForDependencies defers an object whose prerequisites are not
+// offloaded yet, it is recorded in the dependency graph and handed back to
+// infradb with a retry. False when the object can be translated
+func deferForDependencies(eventType string, objectData *eventbus.ObjectData) bool {
+	ref := ObjectRef{Kind: eventType, Name: objectData.Name}
+	missing := missingDependencies(ref)
+
+	dependencyLock.Lock()
+	since := time.Now()
+	if w, ok := waitingObjects[ref]; ok {
+		since = w.since
+	}
+	unlinkLocked(ref)
+	if len(missing) == 0 {
+		dependencyLock.Unlock()
+		return false
+	}
+	waitingObjects[ref] = &waiting{ref: ref, event: objectData, missing: missing, since: since}
+	for _, dep := range missing {
+		if dependents[dep] == nil {
+			dependents[dep] = make(map[ObjectRef]bool)
+		}
+		dependents[dep][ref] = true
+	}
+	dependencyLock.Unlock()
+
+	names := make([]string, 0, len(missing))
+	for _, dep := range missing {
+		names = append(names, dep.String())
+	}
+	comp := common.Component{
+		Name:       intele2000Str,
+		CompStatus: common.ComponentStatusError,
+		Details:    fmt.Sprintf("intel-e2000: waiting for %s", strings.Join(names, ", ")),
+		Timer:      dependencyRetry,
+	}
+	var err error
+	switch eventType {
+	case "bridge-port":
+		err = infradb.UpdateBPStatus(objectData.Name, objectData.ResourceVersion, objectData.NotificationID, nil, comp)
+	case "svi":
+		err = infradb.UpdateSviStatus(objectData.Name, objectData.ResourceVersion, objectData.NotificationID, nil, comp)
+	}
+	if err != nil {
+		log.Printf("intel-e2000: error in updating %s status: %s\n", eventType, err)
+	}
+	log.Printf("intel-e2000: Deferring %s %s until %s are offloaded\n", eventType, objectData.Name, strings.Join(names, ", "))
+	return true
+}
+
+// releaseDependents hands again the objects waiting for a prerequisite once
+// it is offloaded, they are handled in the order they were deferred
+func releaseDependents(eventType string, name string) {
+	prereq := ObjectRef{Kind: eventType, Name: name}
+	dependencyLock.Lock()
+	if len(dependents[prereq]) == 0 {
+		dependencyLock.Unlock()
+		return
+	}
+	dependencyLock.Unlock()
+	if !available(prereq) {
+		return
+	}
+
+	dependencyLock.Lock()
+	var released []*waiting
+	for ref := range dependents[prereq] {
+		w := waitingObjects[ref]
+		var missing []ObjectRef
+		for _, dep := range w.missing {
+			if dep != prereq {
+				missing = append(missing, dep)
+			}
+		}
+		w.missing = missing
+		if len(missing) == 0 {
+			released = append(released, w)
+			delete(waitingObjects, ref)
+		}
+	}
+	delete(dependents, prereq)
+	dependencyLock.Unlock()
+	if len(released) == 0 {
+		return
+	}
+
+	sort.Slice(released, func(i, j int) bool { return released[i].since.Before(released[j].since) })
+	// The handler runs under the decoder read lock, the dependents are handled
+	// once it returns
+	go func() {
+		h := &ModuleipuHandler{}
+		for _, w := range released {
+			log.Printf("intel-e2000: %s offloaded, handling %s\n", prereq, w.ref)
+			h.HandleEvent(w.ref.Kind, w.event)
+		}
+	}()
+}
+
+// WaitingObjects returns the objects deferred until their prerequisites are
+// offloaded
+func WaitingObjects() []WaitingObject {
+	dependencyLock.Lock()
+	defer dependencyLock.Unlock()
+	list := make([]WaitingObject, 0, len(waitingObjects))
+	for ref, w := range waitingObjects {
+		list = append(list, WaitingObject{Object: ref, Missing: w.missing, Since: w.since})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Object.String() < list[j].Object.String() })
+	return list
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// modPtrField field of the mod tables holding the mod pointer
+const modPtrField = "meta.common.mod_blob_ptr"
+
+// ComponentDetails details published in the intel_e2000 component status of
+// an object once it is programmed
+type ComponentDetails struct {
+	Tables       map[string]int `json:"tables"`
+	Entries      int            `json:"entries"`
+	Failed       int            `json:"failed,omitempty"`
+	TcamPrefixes []uint32       `json:"tcamPrefixes,omitempty"`
+	TrieIndexes  []uint32       `json:"trieIndexes,omitempty"`
+	ModPointers  []uint32       `json:"modPointers,omitempty"`
+	NotOffloaded []string       `json:"notOffloaded,omitempty"`
+	L2Only       bool           `json:"l2only,omitempty"`
+	Installed    int            `json:"installed,omitempty"`
+	Vlans        []uint32       `json:"vlans,omitempty"`
+	PortDown     bool           `json:"portDown,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// uniqueSorted sorts the ids dropping the duplicates
+func uniqueSorted(ids []uint32) []uint32 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var out []uint32
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// fieldID returns the id held by a field of an entry
+func fieldID(e p4client.TableEntry, field string) (uint32, bool) {
+	value, ok := e.TableField.FieldValue[field]
+	if !ok {
+		return 0, false
+	}
+	switch v := value[0].(type) {
+	case uint32:
+		return v, true
+	case uint16:
+		return uint32(v), true
+	case uint64:
+		return uint32(v), true
+	}
+	return 0, false
+}
+
+// newComponentDetails builds the component status details of the entries of
+// an object, the tcam rows are prioritized by their trie index
+func newComponentDetails(entries []interface{}, failed int, err error, tcamPrefixes ...uint32) ComponentDetails {
+	details := ComponentDetails{Tables: make(map[string]int), Failed: failed, TcamPrefixes: tcamPrefixes}
+	if kind := ErrorKind(err); kind != nil {
+		details.Error = kind.Error()
+	}
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			continue
+		}
+		details.Tables[e.Tablename]++
+		details.Entries++
+		if row, ok := tcamRowOf(e); ok {
+			details.TcamPrefixes = append(details.TcamPrefixes, row.prefix)
+			if e.TableField.Priority > 0 {
+				details.TrieIndexes = append(details.TrieIndexes, uint32(e.TableField.Priority))
+			}
+		}
+		if tidx, ok := lpmRootOf(e); ok {
+			details.TrieIndexes = append(details.TrieIndexes, tidx)
+		}
+		if ptr, ok := fieldID(e, modPtrField); ok {
+			details.ModPointers = append(details.ModPointers, ptr)
+		}
+	}
+	details.TcamPrefixes = uniqueSorted(details.TcamPrefixes)
+	details.TrieIndexes = uniqueSorted(details.TrieIndexes)
+	details.ModPointers = uniqueSorted(details.ModPointers)
+	return details
+}
+
+// String encodes the details as json
+func (d ComponentDetails) String() string {
+	data, err := json.Marshal(d)
+	if err != nil {
+		log.Printf("intel-e2000: failed to encode component details: %v\n", err)
+		return ""
+	}
+	return string(data)
+}
+
+// componentDetails returns the encoded component status details of the
+// entries of an object, err the first failure writing them
+func componentDetails(entries []interface{}, failed int, err error, tcamPrefixes ...uint32) string {
+	return newComponentDetails(entries, failed, err, tcamPrefixes...).String()
+}
+
+// installedVlans returns the vlans the ingress entries of a bridge port set,
+// the vlans it actually carries
+func installedVlans(entries []interface{}) []uint32 {
+	var vlans []uint32
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			continue
+		}
+		var param int
+		switch e.Action.ActionName {
+		case "evpn_gw_control.set_vlan":
+			param = 0
+		case "evpn_gw_control.set_vlan_and_pop_vlan":
+			param = 1
+		default:
+			continue
+		}
+		if len(e.Action.Params) <= param {
+			continue
+		}
+		switch vid := e.Action.Params[param].(type) {
+		case uint16:
+			vlans = append(vlans, uint32(vid))
+		case uint32:
+			vlans = append(vlans, vid)
+		}
+	}
+	return uniqueSorted(vlans)
+}
+
+// bpDetails builds the component status details of a bridge port, with the
+// entries and the vlans installed once the entries translated were written,
+// so the orchestration can verify the offload before admitting workloads
+func bpDetails(bp *infradb.BridgePort, entries []interface{}, failed int, err error) ComponentDetails {
+	details := newComponentDetails(entries, failed, err)
+	details.L2Only = _bpL2Only(bp)
+	installed := programmedEntries(bp.Name)
+	details.Installed = len(installed)
+	details.Vlans = installedVlans(installed)
+	return details
+}
+
+// vrfTcamPrefixes returns the tcam prefixes of the routing tables of the vrf
+// in both directions
+func vrfTcamPrefixes(vrf *infradb.Vrf) []uint32 {
+	var prefixes []uint32
+	for _, table := range _vrfTables(vrf) {
+		for _, dir := range []int{Direction.Rx, Direction.Tx} {
+			if prefix, err := _getTcamPrefix(table, dir); err == nil {
+				prefixes = append(prefixes, uint32(prefix))
+			}
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+
+	netlink_polling "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// A route is programmed once per direction it is reported in, each direction
+// with its own tcam prefix and the neighbor of that direction: the rx
+// neighbor of a phy, vxlan or mixed ecmp nexthop is the odd one. The p2p
+// tables only know the rx direction
+
+// routePath direction a route is programmed in with its neighbor
+type routePath struct {
+	dir      int
+	neighbor int
+}
+
+// _routeNeighbor returns the neighbor of a route in a direction
+func _routeNeighbor(route netlink_polling.RouteStruct, ecmpFlag bool, e EcmpDispatcher, dir int) (int, error) {
+	if ecmpFlag {
+		return e._p4NexthopID(dir), nil
+	}
+	return _p4NexthopID(*route.Nexthops[0], dir)
+}
+
+// _routePaths returns the paths of a route, one per direction, the neighbors
+// are only resolved for an added route
+func _routePaths(route netlink_polling.RouteStruct, add bool, ecmpFlag bool, e EcmpDispatcher) ([]routePath, error) {
+	var paths []routePath
+	for _, dir := range _directionsOf(route) {
+		path := routePath{dir: dir}
+		if add {
+			neighbor, err := _routeNeighbor(route, ecmpFlag, e, dir)
+			if err != nil {
+				return nil, err
+			}
+			path.neighbor = neighbor
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// _p2pPath returns the path of a route in the p2p tables
+func _p2pPath(route netlink_polling.RouteStruct, add bool, ecmpFlag bool, e EcmpDispatcher) (routePath, error) {
+	path := routePath{dir: Direction.Rx}
+	if add {
+		neighbor, err := _routeNeighbor(route, ecmpFlag, e, Direction.Rx)
+		if err != nil {
+			return path, err
+		}
+		path.neighbor = neighbor
+	}
+	return path, nil
+}
+
+// _logUnresolvedRoute logs a route left out as its nexthop has no neighbor,
+// the reconciler adds it once the nexthop gets one
+func _logUnresolvedRoute(route netlink_polling.RouteStruct, err error) {
+	log.Printf("intel-e2000: Route %s of vrf %s not offloaded: %v\n", route.Route0.Dst, route.Vrf.Name, err)
+}
+
+// directions returns the directions of the group neighbors of an ecmp group,
+// rx for a group of rx members, rx and tx otherwise
+func (e EcmpDispatcher) directions() []int {
+	if e.dir == Direction.Rx {
+		return []int{Direction.Rx}
+	}
+	return []int{Direction.Rx, Direction.Tx}
+}
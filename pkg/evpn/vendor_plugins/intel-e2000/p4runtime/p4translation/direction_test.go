@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/vishvananda/netlink"
+)
+
+// directionRoute builds a route of a vrf with a vni through a phy nexthop,
+// whose rx and tx neighbors differ, reported in the given direction
+func directionRoute(dst string, direction int, nhID int) nm.RouteStruct {
+	table := uint32(1500)
+	vni := uint32(1500)
+	vrf := &infradb.Vrf{
+		Name:     vrfPrefix + "direction",
+		Spec:     &infradb.VrfSpec{Vni: &vni},
+		Status:   &infradb.VrfStatus{},
+		Metadata: &infradb.VrfMetadata{RoutingTable: []*uint32{&table}},
+	}
+	_, prefix, _ := net.ParseCIDR(dst)
+	nh := &nm.NexthopStruct{
+		ID:       nhID,
+		NhType:   nm.PHY,
+		Metadata: map[interface{}]interface{}{"direction": direction},
+	}
+	return nm.RouteStruct{
+		Route0:   netlink.Route{Dst: prefix},
+		Vrf:      vrf,
+		Nexthops: []*nm.NexthopStruct{nh},
+		Metadata: map[interface{}]interface{}{"direction": direction},
+		Key:      nm.RouteKey{Table: int(table), Dst: prefix.String()},
+	}
+}
+
+// routeNeighbors returns the neighbors the route entries of a table set
+func routeNeighbors(t *testing.T, entries []interface{}, table string) []int {
+	t.Helper()
+	var neighbors []int
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok || e.Tablename != table {
+			continue
+		}
+		neighbor, ok := e.Action.Params[0].(uint16)
+		if !ok {
+			t.Fatalf("%s entry without a neighbor: %+v", table, e.Action)
+		}
+		neighbors = append(neighbors, int(neighbor))
+	}
+	sort.Ints(neighbors)
+	return neighbors
+}
+
+// nexthopID returns the neighbor of a nexthop in a direction
+func nexthopID(t *testing.T, nh *nm.NexthopStruct, dir int) int {
+	t.Helper()
+	id, err := _p4NexthopID(*nh, dir)
+	if err != nil {
+		t.Fatalf("nexthop %d: %v", nh.ID, err)
+	}
+	return id
+}
+
+// checkRouteDirections checks a prefix and a host route of both families get
+// one entry per direction, each with the neighbor of its direction, and their deletion
+// removes as many entries
+func checkRouteDirections(t *testing.T, direction int, dirs []int) {
+	fuzzDecoders(t)
+	nh := directionRoute("10.1.0.0/24", direction, 40).Nexthops[0]
+	if _, err := claimNeighborSlot(nh.ID); err != nil {
+		t.Fatalf("nexthop %d: %v", nh.ID, err)
+	}
+	var want []int
+	for _, dir := range dirs {
+		want = append(want, nexthopID(t, nh, dir))
+	}
+	sort.Ints(want)
+	if nexthopID(t, nh, Direction.Rx) == nexthopID(t, nh, Direction.Tx) {
+		t.Fatalf("rx and tx neighbors of a phy nexthop are the same")
+	}
+
+	for _, tc := range []struct {
+		dst   string
+		table string
+	}{
+		{"10.1.0.0/24", l3Rt}, {"10.1.0.7/32", l3RtHost},
+		{"2001:db8:1::/64", l3RtV6}, {"2001:db8:1::7/128", l3RtHostV6},
+	} {
+		route := directionRoute(tc.dst, direction, 40)
+		added := L3.translateAddedRoute(route)
+		got := routeNeighbors(t, added, tc.table)
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d %s entries, expected %d", tc.dst, len(got), tc.table, len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: neighbors %v, expected %v", tc.dst, got, want)
+				break
+			}
+		}
+		for _, entry := range added {
+			e, ok := entry.(p4client.TableEntry)
+			if !ok || e.Tablename != l3RtHost && e.Tablename != l3RtHostV6 {
+				continue
+			}
+			dir := int(e.FieldValue["direction"][0].(uint16))
+			if int(e.Action.Params[0].(uint16)) != nexthopID(t, nh, dir) {
+				t.Errorf("%s: direction %d entry with neighbor %v", tc.dst, dir, e.Action.Params[0])
+			}
+		}
+		deleted := L3.translateDeletedRoute(route)
+		var n int
+		for _, entry := range deleted {
+			if e, ok := entry.(p4client.TableEntry); ok && e.Tablename == tc.table {
+				n++
+			}
+		}
+		if n != len(want) {
+			t.Errorf("%s: deletion removes %d %s entries, expected %d", tc.dst, n, tc.table, len(want))
+		}
+	}
+}
+
+func TestRouteDirectionRx(t *testing.T) {
+	checkRouteDirections(t, nm.RX, []int{Direction.Rx})
+}
+
+func TestRouteDirectionTx(t *testing.T) {
+	checkRouteDirections(t, nm.TX, []int{Direction.Tx})
+}
+
+func TestRouteDirectionRxTx(t *testing.T) {
+	checkRouteDirections(t, nm.RXTX, []int{Direction.Rx, Direction.Tx})
+}
+
+func TestRouteWithoutNeighbor(t *testing.T) {
+	fuzzDecoders(t)
+	neighborSlotLock.Lock()
+	next, free := neighborNext, neighborFree
+	neighborNext, neighborFree = NeighborRange.nexthopMax+1, nil
+	neighborSlotLock.Unlock()
+	t.Cleanup(func() {
+		neighborSlotLock.Lock()
+		neighborNext, neighborFree = next, free
+		neighborSlotLock.Unlock()
+	})
+
+	// No slot left, the nexthop and its routes must not fall back to slot 0
+	route := directionRoute("10.2.0.0/24", nm.RXTX, 41)
+	if _, err := claimNeighborSlot(41); !errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("claim without a slot left: got %v, want %v", err, ErrPoolExhausted)
+	}
+	if entries := L3.translateAddedNexthop(*route.Nexthops[0]); len(entries) != 0 {
+		t.Errorf("nexthop without a neighbor gives %d entries", len(entries))
+	}
+	for _, dst := range []string{"10.2.0.0/24", "10.2.0.7/32"} {
+		if entries := L3.translateAddedRoute(directionRoute(dst, nm.RXTX, 41)); len(entries) != 0 {
+			t.Errorf("%s: route without a neighbor gives %d entries", dst, len(entries))
+		}
+	}
+}
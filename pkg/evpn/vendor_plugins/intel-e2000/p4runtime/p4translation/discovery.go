@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// discoveryKey config key enabling the representor discovery. Only the
+// physical ports carry their role in the kernel, the grpc pair and the mux
+// representors stay configured
+const discoveryKey = "interfaces.discovery"
+
+// sysClassNet sysfs directory of the network devices
+var sysClassNet = "/sys/class/net"
+
+// phyPortName phys_port_name of a physical port representor
+var phyPortName = regexp.MustCompile(`^p(\d+)$`)
+
+// devlinkPort devlink port as reported by devlink -j port show
+type devlinkPort struct {
+	Netdev  string `json:"netdev"`
+	Flavour string `json:"flavour"`
+	Port    *int   `json:"port"`
+}
+
+// discoverPhyPorts returns the physical port representors keyed by port number
+// using devlink and falling back to sysfs
+func discoverPhyPorts() map[int]string {
+	phyPorts, err := discoverDevlinkPhyPorts()
+	if err != nil || len(phyPorts) == 0 {
+		log.Printf("intel-e2000: devlink discovery found no representors (%v), falling back to sysfs\n", err)
+		phyPorts = discoverSysfsPhyPorts()
+	}
+	return phyPorts
+}
+
+// discoverDevlinkPhyPorts enumerates the devlink ports of physical flavour
+func discoverDevlinkPhyPorts() (map[int]string, error) {
+	out, err := exec.Command("devlink", "-j", "port", "show").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("devlink port show failed: %v", err)
+	}
+	var ports struct {
+		Port map[string]devlinkPort `json:"port"`
+	}
+	if err := json.Unmarshal(out, &ports); err != nil {
+		return nil, fmt.Errorf("failed to parse devlink output: %v", err)
+	}
+	phyPorts := make(map[int]string)
+	for _, port := range ports.Port {
+		if port.Flavour != "physical" || port.Netdev == "" || port.Port == nil {
+			continue
+		}
+		phyPorts[*port.Port] = port.Netdev
+	}
+	return phyPorts, nil
+}
+
+// discoverSysfsPhyPorts enumerates the netdevs whose phys_port_name is p<N>
+func discoverSysfsPhyPorts() map[int]string {
+	phyPorts := make(map[int]string)
+	devs, err := os.ReadDir(sysClassNet)
+	if err != nil {
+		log.Printf("intel-e2000: failed to read %s: %v\n", sysClassNet, err)
+		return phyPorts
+	}
+	for _, dev := range devs {
+		name, err := os.ReadFile(filepath.Join(sysClassNet, dev.Name(), "phys_port_name"))
+		if err != nil {
+			continue
+		}
+		match := phyPortName.FindStringSubmatch(strings.TrimSpace(string(name)))
+		if match == nil {
+			continue
+		}
+		id, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		phyPorts[id] = dev.Name()
+	}
+	return phyPorts
+}
+
+// discoverUplinks completes the uplink profiles with the physical ports found
+// in the kernel when the discovery is enabled, the configured uplinks take precedence
+func discoverUplinks(profiles []UplinkConfig) []UplinkConfig {
+	if !viper.GetBool(discoveryKey) {
+		return profiles
+	}
+	configured := make(map[int]bool)
+	for _, uplink := range profiles {
+		configured[uplink.Port] = true
+	}
+	for id, dev := range discoverPhyPorts() {
+		if configured[id] {
+			continue
+		}
+		log.Printf("intel-e2000: Discovered uplink phy%d on %s\n", id, dev)
+		profiles = append(profiles, UplinkConfig{
+			Name: fmt.Sprintf("phy%d", id),
+			Rep:  dev,
+			Port: id,
+			Role: UplinkRole.Underlay,
+		})
+	}
+	return profiles
+}
+
+// configuredRoles returns the interfaces configured for the representor
+// roles the discovery can not fill
+func configuredRoles() map[string]string {
+	interfaces := GlobalConfig().Interfaces
+	return map[string]string{
+		"grpc_acc":  interfaces.GrpcAcc,
+		"grpc_host": interfaces.GrpcHost,
+		"vrf_mux":   interfaces.VrfMux,
+		"port_mux":  interfaces.PortMux,
+	}
+}
+
+// roleConflicts returns the problems of the representor roles: a role left
+// unset while the discovery is enabled, an interface holding two roles or
+// the role of an uplink, and two representors sharing a vsi
+func roleConflicts(roles map[string]string, representors map[string][2]string) []string {
+	var problems []string
+	owners := make(map[string]string)
+	for _, uplink := range uplinks {
+		owners[uplink.Rep] = "uplink " + uplink.Name
+	}
+	for _, role := range requiredRepresentors {
+		dev := roles[role]
+		if dev == "" {
+			if viper.GetBool(discoveryKey) {
+				problems = append(problems, fmt.Sprintf("%s is not configured, the discovery only finds the phy ports", role))
+			}
+			continue
+		}
+		if owner, ok := owners[dev]; ok {
+			problems = append(problems, fmt.Sprintf("%s interface %s is already the one of %s", role, dev, owner))
+			continue
+		}
+		owners[dev] = role
+	}
+	keys := make([]string, 0, len(representors))
+	for key := range representors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	vsis := make(map[string]string)
+	for _, key := range keys {
+		vsi := representors[key][0]
+		if owner, ok := vsis[vsi]; ok {
+			problems = append(problems, fmt.Sprintf("representors %s and %s share the vsi %s", owner, key, vsi))
+			continue
+		}
+		vsis[vsi] = key
+	}
+	return problems
+}
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRoleConflicts checks an interface holding two roles or the one of an
+// uplink and a vsi shared by two representors are reported
+func TestRoleConflicts(t *testing.T) {
+	saved := uplinks
+	uplinks = []UplinkConfig{{Name: "phy0", Rep: "enp0s1f0d1", Port: 0, Role: UplinkRole.Underlay}}
+	t.Cleanup(func() { uplinks = saved })
+
+	roles := map[string]string{"grpc_acc": "enp0s1f0d2", "grpc_host": "enp0s1f0d3", "vrf_mux": "enp0s1f0d4", "port_mux": "enp0s1f0d5"}
+	representors := map[string][2]string{
+		uplinkKey("phy0"): {"10", "00:00:00:00:00:0a"},
+		"grpc_acc":        {"11", "00:00:00:00:00:0b"},
+		"grpc_host":       {"12", "00:00:00:00:00:0c"},
+		"vrf_mux":         {"13", "00:00:00:00:00:0d"},
+		"port_mux":        {"14", "00:00:00:00:00:0e"},
+	}
+	if problems := roleConflicts(roles, representors); len(problems) != 0 {
+		t.Fatalf("distinct roles: got %v", problems)
+	}
+
+	roles["port_mux"] = "enp0s1f0d4"
+	roles["grpc_acc"] = "enp0s1f0d1"
+	representors["port_mux"] = representors["vrf_mux"]
+	problems := strings.Join(roleConflicts(roles, representors), "\n")
+	for _, want := range []string{
+		"grpc_acc interface enp0s1f0d1 is already the one of uplink phy0",
+		"port_mux interface enp0s1f0d4 is already the one of vrf_mux",
+		"representors port_mux and vrf_mux share the vsi 13",
+	} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("problem %q not reported in:\n%s", want, problems)
+		}
+	}
+}
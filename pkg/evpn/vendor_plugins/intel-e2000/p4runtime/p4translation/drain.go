@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// DrainState maintenance state of the gateway. While draining the ecmp
+// members egressing on the costed out ports lose their hash slots to the
+// other members, the netlink add events are held and the infradb objects
+// handed back for a retry, so nothing new is programmed and the entries in
+// place keep forwarding the existing flows until the gateway is resumed. The
+// deletes and the updates still go through
+type DrainState struct {
+	Draining  bool      `json:"draining"`
+	Since     time.Time `json:"since,omitempty"`
+	CostedOut []string  `json:"costedout"`
+	Moved     int       `json:"moved"`
+}
+
+var (
+	// drainLock guards the drain state
+	drainLock sync.Mutex
+
+	// drainState current drain state
+	drainState = DrainState{CostedOut: make([]string, 0)}
+
+	// portDrained ports whose ecmp members are costed out, guarded by the
+	// state lock
+	portDrained = make(map[string]bool)
+)
+
+// draining reports if the gateway is draining
+func draining() bool {
+	drainLock.Lock()
+	defer drainLock.Unlock()
+	return drainState.Draining
+}
+
+// costOutMembers returns the ecmp members not on a drained port, all of them
+// when every member is, the caller holds the state lock
+func costOutMembers(nexthops []*nm.NexthopStruct) []*nm.NexthopStruct {
+	if len(nexthops) < 2 || len(portDrained) == 0 {
+		return nexthops
+	}
+	var kept = make([]*nm.NexthopStruct, 0, len(nexthops))
+	for _, nexthop := range nexthops {
+		if nexthop != nil && portDrained[nexthopPort(*nexthop)] {
+			continue
+		}
+		kept = append(kept, nexthop)
+	}
+	if len(kept) == 0 {
+		return nexthops
+	}
+	return kept
+}
+
+// applyCostOut costs the ecmp members of the ports out or back in and moves
+// the routes whose members changed, the caller holds the decoder and state
+// locks
+func applyCostOut(names []string, drained bool) int {
+	type view struct {
+		old   nm.RouteStruct
+		oldOk bool
+	}
+	affected := make(map[nm.RouteKey]view)
+	for key, route := range routeCache {
+		if len(route.Nexthops) < 2 {
+			continue
+		}
+		for _, name := range names {
+			if routeOnPort(route, name) {
+				old, ok := liveRoute(route)
+				affected[key] = view{old: old, oldOk: ok}
+				break
+			}
+		}
+	}
+	for _, name := range names {
+		if drained {
+			portDrained[name] = true
+		} else {
+			delete(portDrained, name)
+		}
+	}
+	var moved int
+	for key, v := range affected {
+		live, ok := liveRoute(routeCache[key])
+		if !v.oldOk || !ok || sameForwarding(v.old, live) {
+			continue
+		}
+		delEntries(L3.translateDeletedRoute(v.old))
+		addEntries(L3.translateAddedRoute(live))
+		moved++
+	}
+	return moved
+}
+
+// Drain puts the gateway in maintenance, the ecmp members on the ports given
+// are costed out and the programming of new entries stops
+func Drain(ports []string) error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	drainLock.Lock()
+	defer drainLock.Unlock()
+	if drainState.Draining {
+		return errors.New("intel-e2000: gateway already draining")
+	}
+	for _, name := range ports {
+		if name == "" {
+			return errors.New("intel-e2000: empty port name")
+		}
+	}
+	stateLock.Lock()
+	moved := applyCostOut(ports, true)
+	stateLock.Unlock()
+	costedOut := append(make([]string, 0, len(ports)), ports...)
+	sort.Strings(costedOut)
+	drainState = DrainState{Draining: true, Since: time.Now(), CostedOut: costedOut, Moved: moved}
+	log.Printf("intel-e2000: Gateway draining, %d routes moved off %v, new entries held\n", moved, costedOut)
+	return nil
+}
+
+// Resume ends the maintenance, the costed out members get their hash slots
+// back and the events held are programmed
+func Resume() error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	drainLock.Lock()
+	defer drainLock.Unlock()
+	if !drainState.Draining {
+		return errors.New("intel-e2000: gateway not draining")
+	}
+	stateLock.Lock()
+	moved := applyCostOut(drainState.CostedOut, false)
+	stateLock.Unlock()
+	log.Printf("intel-e2000: Gateway resumed after %v, %d routes moved back\n", time.Since(drainState.Since).Round(time.Second), moved)
+	drainState = DrainState{CostedOut: make([]string, 0)}
+	wakeHeldAdds()
+	return nil
+}
+
+// GetDrainState returns the drain state of the gateway
+func GetDrainState() DrainState {
+	drainLock.Lock()
+	defer drainLock.Unlock()
+	state := drainState
+	state.CostedOut = append(make([]string, 0, len(drainState.CostedOut)), drainState.CostedOut...)
+	return state
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// driftKey config key of the static entry watchdog section
+const driftKey = "staticwatchdog"
+
+// DriftConfig static entry watchdog config structure
+type DriftConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Interval int  `yaml:"interval"`
+}
+
+// DriftStats static entry watchdog statistics
+type DriftStats struct {
+	Checks      uint64    `json:"checks"`
+	Repairs     uint64    `json:"repairs"`
+	LastCheck   time.Time `json:"lastcheck"`
+	LastMissing int       `json:"lastmissing"`
+}
+
+var (
+	// driftLock guards the watchdog statistics
+	driftLock sync.Mutex
+
+	// driftStats static entry watchdog statistics
+	driftStats DriftStats
+
+	// driftDone stops the static entry watchdog
+	driftDone chan struct{}
+)
+
+// expectedStaticEntries returns the static additions and the operator static
+// entries which have to be on the device, the ones of the uplinks shut
+// administratively are left out, the caller holds the decoder lock
+func expectedStaticEntries() []interface{} {
+	var entries []interface{}
+	entries = append(entries, L3.StaticAdditions()...)
+	entries = append(entries, Pod.StaticAdditions()...)
+	entries = append(entries, operatorStaticEntries()...)
+	entries = append(entries, dropRuleEntries()...)
+
+	stateLock.Lock()
+	excluded := make(map[string]bool)
+	for name := range portAdminDown {
+		if strings.HasPrefix(name, vportPrefix) {
+			continue
+		}
+		portEntries, err := portStaticEntries(name, true)
+		if err != nil {
+			continue
+		}
+		for _, entry := range portEntries {
+			if e, ok := entry.(p4client.TableEntry); ok {
+				excluded[entryKey(e)] = true
+			}
+		}
+	}
+	stateLock.Unlock()
+
+	var expected = make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		if e, ok := entry.(p4client.TableEntry); ok && excluded[entryKey(e)] {
+			continue
+		}
+		expected = append(expected, entry)
+	}
+	return expected
+}
+
+// checkStaticDrift reinstalls the static entries wiped from the device
+func checkStaticDrift() {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	missing, err := missingEntries(expectedStaticEntries())
+	if err != nil {
+		log.Printf("intel-e2000: Static entry watchdog failed to read the device: %v\n", err)
+		return
+	}
+	driftLock.Lock()
+	driftStats.Checks++
+	driftStats.LastCheck = time.Now()
+	driftStats.LastMissing = len(missing)
+	if len(missing) != 0 {
+		driftStats.Repairs++
+	}
+	driftLock.Unlock()
+	if len(missing) == 0 {
+		setStaticVerified(0)
+		return
+	}
+	log.Printf("intel-e2000: Static entry watchdog found %d entries wiped, reinstalling\n", len(missing))
+	var entries = make([]interface{}, 0, len(missing))
+	for _, e := range missing {
+		log.Printf("intel-e2000: Reinstalling static entry in %s: %+v\n", e.Tablename, e.TableField.FieldValue)
+		entries = append(entries, e)
+	}
+	addEntries(entries)
+	verifyStaticAdditions()
+}
+
+// startDriftWatchdog starts the periodic verification of the static entries
+func startDriftWatchdog() {
+	cfg := DriftConfig{}
+	if err := viper.UnmarshalKey(driftKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read static watchdog config: %v\n", err)
+		return
+	}
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30
+	}
+	driftDone = make(chan struct{})
+	done := driftDone
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				checkStaticDrift()
+			case <-done:
+				return
+			}
+		}
+	}()
+	log.Printf("intel-e2000: Static entry watchdog started, interval %ds\n", cfg.Interval)
+}
+
+// stopDriftWatchdog stops the static entry watchdog
+func stopDriftWatchdog() {
+	if driftDone != nil {
+		close(driftDone)
+		driftDone = nil
+	}
+}
+
+// StaticDriftStats returns the static entry watchdog statistics
+func StaticDriftStats() DriftStats {
+	driftLock.Lock()
+	defer driftLock.Unlock()
+	return driftStats
+}
@@ -0,0 +1,251 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// drop rule evpn p4 table names
+const (
+	dropPrefix = "evpn_gw_control.drop_prefix_table"
+	//                       Key {
+	//                           vrf,                        // Exact
+	//                           addr_type,                  // Exact, 0 source 1 destination
+	//                           ipv4_addr                   // LPM
+	//                       }
+	//                       Actions(
+	//                           drop_count(),
+	//                           NoAction                    // default
+	//                       )
+	dropMac = "evpn_gw_control.drop_mac_table"
+	//                       Key {
+	//                           src_mac                     // Exact
+	//                       }
+	//                       Actions(
+	//                           drop_count(),
+	//                           NoAction                    // default
+	//                       )
+	dropSpi = "evpn_gw_control.drop_spi_table"
+	//                       Key {
+	//                           spi                         // Exact
+	//                       }
+	//                       Actions(
+	//                           drop_count(),
+	//                           NoAction                    // default
+	//                       )
+)
+
+// kinds of drop rules
+const (
+	dropByPrefix = "prefix"
+	dropByMac    = "mac"
+	dropBySpi    = "spi"
+)
+
+// DropRule targeted drop rule installed during an incident, the traffic
+// matching it is dropped and counted before the routing tables. A prefix rule
+// matches the source address unless match is dst, in the vrf or the default
+// vrf without one, a mac rule the source mac and a spi rule the esp spi
+type DropRule struct {
+	Name    string    `json:"name"`
+	Kind    string    `json:"kind"`
+	Vrf     string    `json:"vrf,omitempty"`
+	Prefix  string    `json:"prefix,omitempty"`
+	Match   string    `json:"match,omitempty"`
+	Mac     string    `json:"mac,omitempty"`
+	Spi     uint32    `json:"spi,omitempty"`
+	Created time.Time `json:"created"`
+	Packets int64     `json:"packets"`
+	Bytes   int64     `json:"bytes"`
+	Error   string    `json:"error,omitempty"`
+	entry   p4client.TableEntry
+}
+
+var (
+	// dropRuleLock guards the drop rules
+	dropRuleLock sync.Mutex
+
+	// dropRules drop rules keyed by name
+	dropRules = make(map[string]*DropRule)
+)
+
+// dropVrfID returns the vrf id a prefix rule matches, zero for the default vrf
+func dropVrfID(name string) (uint32, error) {
+	if name == "" {
+		return 0, nil
+	}
+	if !strings.HasPrefix(name, "//") {
+		name = vrfPrefix + name
+	}
+	vrf, err := infradb.GetVrf(name)
+	if err != nil {
+		return 0, fmt.Errorf("vrf %s not found: %v", name, err)
+	}
+	if vrf.Spec == nil || vrf.Spec.Vni == nil {
+		return 0, nil
+	}
+	return _vrfTable(vrf)
+}
+
+// build validates the drop rule and builds its table entry
+func (d *DropRule) build() error {
+	if d.Name == "" {
+		return errors.New("drop rule needs a name")
+	}
+	e := p4client.TableEntry{
+		TableField: p4client.TableField{
+			FieldValue: make(map[string][2]interface{}),
+			Priority:   int32(0),
+		},
+		Action: p4client.Action{ActionName: "evpn_gw_control.drop_count"},
+	}
+	d.Kind = strings.ToLower(d.Kind)
+	switch d.Kind {
+	case dropByPrefix:
+		ip, prefix, err := net.ParseCIDR(d.Prefix)
+		if err != nil || ip.To4() == nil {
+			return fmt.Errorf("invalid ipv4 prefix %q", d.Prefix)
+		}
+		var addrType uint16
+		switch strings.ToLower(d.Match) {
+		case "", "src":
+			d.Match = "src"
+		case "dst":
+			d.Match = "dst"
+			addrType = 1
+		default:
+			return fmt.Errorf("invalid match %q, use src or dst", d.Match)
+		}
+		vrfID, err := dropVrfID(d.Vrf)
+		if err != nil {
+			return err
+		}
+		d.Prefix = prefix.String()
+		e.Tablename = dropPrefix
+		e.FieldValue["vrf"] = [2]interface{}{_bigEndian16(vrfID), "exact"}
+		e.FieldValue["addr_type"] = [2]interface{}{addrType, "exact"}
+		e.FieldValue["ipv4_addr"] = [2]interface{}{prefix, "lpm"}
+	case dropByMac:
+		mac, err := net.ParseMAC(d.Mac)
+		if err != nil {
+			return fmt.Errorf("invalid mac %q", d.Mac)
+		}
+		d.Mac = mac.String()
+		e.Tablename = dropMac
+		e.FieldValue["src_mac"] = [2]interface{}{mac, "exact"}
+	case dropBySpi:
+		if d.Spi == 0 {
+			return errors.New("drop rule needs a non zero spi")
+		}
+		e.Tablename = dropSpi
+		e.FieldValue["spi"] = [2]interface{}{d.Spi, "exact"}
+	default:
+		return fmt.Errorf("invalid kind %q, use prefix, mac or spi", d.Kind)
+	}
+	d.entry = e
+	return nil
+}
+
+// setDropRule installs a drop rule, replacing the rule of the same name, the
+// caller holds the decoder lock
+func setDropRule(d DropRule) error {
+	if err := d.build(); err != nil {
+		return fmt.Errorf("intel-e2000: invalid drop rule %s: %v", d.Name, err)
+	}
+	key := entryKey(d.entry)
+	dropRuleLock.Lock()
+	old, ok := dropRules[d.Name]
+	for name, other := range dropRules {
+		if name != d.Name && entryKey(other.entry) == key {
+			dropRuleLock.Unlock()
+			return fmt.Errorf("intel-e2000: drop rule %s matches the traffic of drop rule %s", d.Name, name)
+		}
+	}
+	dropRuleLock.Unlock()
+	if ok {
+		if err := delEntries([]interface{}{old.entry}); err != nil {
+			return fmt.Errorf("intel-e2000: failed to remove the previous drop rule %s: %v", d.Name, err)
+		}
+	}
+	d.Created = time.Now()
+	d.Error = ""
+	if err := addEntries([]interface{}{d.entry}); err != nil {
+		d.Error = err.Error()
+		log.Printf("intel-e2000: Failed to install drop rule %s: %v\n", d.Name, err)
+	} else {
+		log.Printf("intel-e2000: Drop rule %s installed in %s\n", d.Name, d.entry.Tablename)
+	}
+	dropRuleLock.Lock()
+	dropRules[d.Name] = &d
+	dropRuleLock.Unlock()
+	return nil
+}
+
+// dropRuleEntries returns the entries of the drop rules
+func dropRuleEntries() []interface{} {
+	dropRuleLock.Lock()
+	defer dropRuleLock.Unlock()
+	entries := make([]interface{}, 0, len(dropRules))
+	for _, d := range dropRules {
+		entries = append(entries, d.entry)
+	}
+	return entries
+}
+
+// SetDropRule installs or replaces a drop rule
+func SetDropRule(d DropRule) error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	return setDropRule(d)
+}
+
+// DeleteDropRule removes a drop rule
+func DeleteDropRule(name string) error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	dropRuleLock.Lock()
+	d, ok := dropRules[name]
+	dropRuleLock.Unlock()
+	if !ok {
+		return fmt.Errorf("intel-e2000: no drop rule %s", name)
+	}
+	if err := delEntries([]interface{}{d.entry}); err != nil {
+		return fmt.Errorf("intel-e2000: failed to remove drop rule %s: %v", name, err)
+	}
+	dropRuleLock.Lock()
+	delete(dropRules, name)
+	dropRuleLock.Unlock()
+	log.Printf("intel-e2000: Drop rule %s removed from %s\n", name, d.entry.Tablename)
+	return nil
+}
+
+// DropRules returns the drop rules with the traffic they dropped
+func DropRules() []DropRule {
+	dropRuleLock.Lock()
+	list := make([]DropRule, 0, len(dropRules))
+	for _, d := range dropRules {
+		list = append(list, *d)
+	}
+	dropRuleLock.Unlock()
+	for i := range list {
+		if list[i].Error == "" {
+			list[i].Packets, list[i].Bytes = sumCounters([]interface{}{list[i].entry})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
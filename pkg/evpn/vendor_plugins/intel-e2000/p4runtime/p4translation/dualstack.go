@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// dualStackKey config key of the dual stack section
+const dualStackKey = "dualstack"
+
+// DualStackConfig dual stack config structure. The vrf spec carries one vtep
+// ip, the vteps map gives the vrfs terminating vxlan on both families the
+// vtep ip of the other family keyed by vrf name
+type DualStackConfig struct {
+	Vteps map[string]string `yaml:"vteps"`
+}
+
+var (
+	// dualStackLock guards the dual stack vteps
+	dualStackLock sync.RWMutex
+
+	// dualStackVteps second vtep ip of the dual stack vrfs keyed by vrf name
+	dualStackVteps = make(map[string]net.IP)
+)
+
+// loadDualStackConfig reads the dual stack vteps, the invalid ones are dropped
+func loadDualStackConfig() {
+	cfg := DualStackConfig{}
+	if err := viper.UnmarshalKey(dualStackKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read dual stack config: %v\n", err)
+	}
+	vteps := make(map[string]net.IP, len(cfg.Vteps))
+	for vrf, addr := range cfg.Vteps {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			log.Printf("intel-e2000: Ignoring invalid dual stack vtep %q of vrf %s\n", addr, vrf)
+			continue
+		}
+		vteps[path.Base(vrf)] = ip
+	}
+	dualStackLock.Lock()
+	dualStackVteps = vteps
+	dualStackLock.Unlock()
+}
+
+// _vrfVteps returns the vtep ips of a vrf, the one of its spec first and the
+// configured one of the other family of a dual stack vrf
+func _vrfVteps(vrf *infradb.Vrf) []net.IP {
+	var vteps []net.IP
+	if vrf.Spec.VtepIP != nil {
+		vteps = append(vteps, vrf.Spec.VtepIP.IP)
+	}
+	dualStackLock.RLock()
+	second, ok := dualStackVteps[path.Base(vrf.Name)]
+	dualStackLock.RUnlock()
+	if !ok {
+		return vteps
+	}
+	if len(vteps) != 0 && (vteps[0].To4() == nil) == (second.To4() == nil) {
+		log.Printf("intel-e2000: Dual stack vtep %s of vrf %s has the family of its vtep %s, ignored\n", second, vrf.Name, vteps[0])
+		return vteps
+	}
+	return append(vteps, second)
+}
+
+// _vxlanIngressTable returns the vxlan ingress table of the family of a vtep
+func _vxlanIngressTable(vtep net.IP) string {
+	if vtep.To4() == nil {
+		return phyInVxlanV6
+	}
+	return phyInVxlan
+}
+
+// _dualStack checks the vrf terminates vxlan on both families
+func _dualStack(vrf *infradb.Vrf) bool {
+	return len(_vrfVteps(vrf)) > 1
+}
+
+// rollbackVrfFamilies removes the entries added for a dual stack vrf when the
+// entries of a family failed, so the vrf is never offloaded on one family
+// only. It returns the entries left programmed
+func rollbackVrfFamilies(vrf *infradb.Vrf, delta EntryDelta, programmed []interface{}) ([]interface{}, error) {
+	added := make(map[string]bool)
+	for _, entry := range delta.Add {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			added[entryKey(e)] = true
+		}
+	}
+	var kept []interface{}
+	var first error
+	for _, entry := range programmed {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok || !added[entryKey(e)] {
+			kept = append(kept, entry)
+			continue
+		}
+		if err := writeError(e.Tablename, p4client.DelEntry(e)); err != nil {
+			log.Printf("intel-e2000: Failed to roll back %s entry of vrf %s: %v\n", e.Tablename, vrf.Name, err)
+			kept = append(kept, entry)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	if first != nil {
+		return kept, fmt.Errorf("intel-e2000: rollback of dual stack vrf %s incomplete: %w", vrf.Name, first)
+	}
+	return kept, errors.New("intel-e2000: dual stack vrf " + vrf.Name + " rolled back, a family failed to program")
+}
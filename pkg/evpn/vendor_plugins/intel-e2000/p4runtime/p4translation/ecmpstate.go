@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	netlink_polling "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// ecmpStateKey config key of the ecmp slot assignments file
+const ecmpStateKey = "ecmpstate.path"
+
+// EcmpSlots hash slot assignments of an ecmp group, the members are named by
+// their nexthop key as the nexthop ids are reassigned on restart. The tx
+// slots are only set for groups mixing rx and tx members
+type EcmpSlots struct {
+	ID      uint32   `json:"id"`
+	Members []string `json:"members"`
+	Slots   []string `json:"slots"`
+	TxSlots []string `json:"txslots,omitempty"`
+}
+
+var (
+	// ecmpSlotLock guards the ecmp slot assignments
+	ecmpSlotLock sync.Mutex
+
+	// ecmpSlots slot assignments of the ecmp groups keyed by member set
+	ecmpSlots = make(map[string]EcmpSlots)
+)
+
+// ecmpMember names an ecmp member by its nexthop key
+func ecmpMember(nh *netlink_polling.NexthopStruct) string {
+	return fmt.Sprintf("%s/%s/%d/%t/%d", nh.Key.VrfName, nh.Key.Dst, nh.Key.Dev, nh.Key.Local, nh.Key.Weight)
+}
+
+// ecmpGroup names an ecmp group by its sorted member set
+func ecmpGroup(members []string) string {
+	sorted := append([]string(nil), members...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// writeStateFile persists a state as json, the file is replaced atomically so
+// a crash keeps the previous state
+func writeStateFile(path string, state interface{}) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	_ = file.Close()
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	return err
+}
+
+// writeEcmpSlots persists the slot assignments
+func writeEcmpSlots() {
+	path := viper.GetString(ecmpStateKey)
+	if path == "" {
+		return
+	}
+	if err := writeStateFile(path, ecmpSlots); err != nil {
+		log.Printf("intel-e2000: Failed to write ecmp slots %s: %v\n", path, err)
+	}
+}
+
+// loadEcmpSlots reads the slot assignments of the previous run, they are
+// reused when a group with the same members is programmed again
+func loadEcmpSlots() {
+	path := viper.GetString(ecmpStateKey)
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		log.Printf("intel-e2000: Failed to create ecmp slots directory: %v\n", err)
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("intel-e2000: Failed to read ecmp slots %s: %v\n", path, err)
+		}
+		return
+	}
+	slots := make(map[string]EcmpSlots)
+	if err := json.Unmarshal(data, &slots); err != nil {
+		log.Printf("intel-e2000: Ignoring corrupt ecmp slots %s: %v\n", path, err)
+		return
+	}
+	ecmpSlotLock.Lock()
+	ecmpSlots = slots
+	ecmpSlotLock.Unlock()
+	log.Printf("intel-e2000: Restored slot assignments of %d ecmp groups\n", len(slots))
+}
+
+// restoreTable fills a slot table from the persisted member names, only the
+// members eligible for the table are taken
+func (e *EcmpDispatcher) restoreTable(names []string, hashmap map[int]netlink_polling.NexthopStruct, eligible []*netlink_polling.NexthopStruct, txOnly bool) bool {
+	if len(names) != e.numslots {
+		return false
+	}
+	ids := make(map[int]bool, len(eligible))
+	for _, nh := range eligible {
+		ids[nh.ID] = true
+	}
+	index := make(map[string]int, len(e.members))
+	for i, member := range e.members {
+		if ids[e.Nexthop[i].ID] {
+			index[member] = i
+		}
+	}
+	for _, member := range names {
+		if _, ok := index[member]; !ok {
+			return false
+		}
+	}
+	for slot, member := range names {
+		nh := *e.Nexthop[index[member]]
+		if !txOnly {
+			e.Nexthop[index[member]].Hashes = append(e.Nexthop[index[member]].Hashes, slot)
+		}
+		hashmap[slot] = nh
+	}
+	return true
+}
+
+// restoreSlots assigns the hash slots as persisted for the members of the
+// group, it returns false when the group has no valid assignment
+func (e *EcmpDispatcher) restoreSlots() bool {
+	ecmpSlotLock.Lock()
+	state, ok := ecmpSlots[ecmpGroup(e.members)]
+	ecmpSlotLock.Unlock()
+	if !ok || !e.restoreTable(state.Slots, e.hashmap, e.preferMtu(e.Nexthop), false) {
+		return false
+	}
+	if e.mixed && !e.restoreTable(state.TxSlots, e.txHashmap, e.preferMtu(e.txMembers()), true) {
+		e.websterSlots(e.preferMtu(e.txMembers()), e.txHashmap)
+	}
+	return true
+}
+
+// slotNames names the members of the slots of a slot table
+func (e *EcmpDispatcher) slotNames(hashmap map[int]netlink_polling.NexthopStruct) []string {
+	names := make([]string, e.numslots)
+	for slot := 0; slot < e.numslots; slot++ {
+		for i, nh := range e.Nexthop {
+			if nh.ID == hashmap[slot].ID {
+				names[slot] = e.members[i]
+				break
+			}
+		}
+	}
+	return names
+}
+
+// assignSlots assigns the hash slots of a newly programmed group, the
+// persisted assignment is kept so the live flows are not remapped
+func (e *EcmpDispatcher) assignSlots() {
+	if !e.restoreSlots() {
+		e.runWebsterAlg()
+	}
+	state := EcmpSlots{ID: e.id, Members: e.members, Slots: e.slotNames(e.hashmap)}
+	if e.mixed {
+		state.TxSlots = e.slotNames(e.txHashmap)
+	}
+	ecmpSlotLock.Lock()
+	defer ecmpSlotLock.Unlock()
+	ecmpSlots[ecmpGroup(e.members)] = state
+	writeEcmpSlots()
+}
+
+// forgetSlots drops the slot assignment of a removed group
+func (e *EcmpDispatcher) forgetSlots() {
+	ecmpSlotLock.Lock()
+	defer ecmpSlotLock.Unlock()
+	delete(ecmpSlots, ecmpGroup(e.members))
+	writeEcmpSlots()
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrTableFull the table has no room left for the entry
+	ErrTableFull = errors.New("table full")
+
+	// ErrUnsupportedNexthopType the decoders do not translate the nexthop type
+	ErrUnsupportedNexthopType = errors.New("unsupported nexthop type")
+
+	// ErrMissingMetadata the object lacks metadata the decoders read
+	ErrMissingMetadata = errors.New("missing metadata")
+
+	// ErrPoolExhausted the id pool has no id left
+	ErrPoolExhausted = errors.New("pool exhausted")
+
+	// ErrDeviceUnavailable the p4runtime server cannot be reached
+	ErrDeviceUnavailable = errors.New("device unavailable")
+)
+
+// errorKinds the translation errors in the order they are reported
+var errorKinds = []error{ErrTableFull, ErrUnsupportedNexthopType, ErrMissingMetadata, ErrPoolExhausted, ErrDeviceUnavailable}
+
+// ErrorKind returns the translation error wrapped by err, nil when err is
+// not a translation error
+func ErrorKind(err error) error {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// writeError classifies the error of a write to a table by its grpc status
+func writeError(table string, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.ResourceExhausted:
+		return fmt.Errorf("intel-e2000: writing %s: %w: %v", table, ErrTableFull, err)
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return fmt.Errorf("intel-e2000: writing %s: %w: %v", table, ErrDeviceUnavailable, err)
+	}
+	return fmt.Errorf("intel-e2000: writing %s: %v", table, err)
+}
+
+// programEntries adds the entries of an infradb object, it returns the count
+// of the entries failed and the first failure
+func programEntries(entries []interface{}) (int, error) {
+	var failed int
+	var first error
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			log.Println("intel-e2000: Entry is not of type p4client.TableEntry:-", entry)
+			failed++
+			continue
+		}
+		if err := writeError(e.Tablename, p4client.AddEntry(e)); err != nil {
+			log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, err)
+			failed++
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return failed, first
+}
+
+// nexthopMetadata metadata the decoders read per l3 nexthop type with a
+// value of the type they assert
+var nexthopMetadata = map[int]map[string]interface{}{
+	nm.PHY: {"smac": "", "dmac": "", "egress_vport": 0},
+	nm.ACC: {"dmac": "", "vlanID": uint32(0), "egress_vport": 0},
+	nm.SVI: {"smac": "", "dmac": "", "vlanID": uint32(0), "egress_vport": "", "portType": infradb.BridgePortType(0)},
+	nm.VXLAN: {"egress_vport": 0, "phy_smac": "", "phy_dmac": "", "local_vtep_ip": "", "remote_vtep_ip": "",
+		"inner_smac": "", "inner_dmac": "", "vni": uint32(0)},
+}
+
+// l2NexthopMetadata metadata the decoders read per l2 nexthop type
+var l2NexthopMetadata = map[int]map[string]interface{}{
+	nm.VXLAN:      {"egress_vport": 0, "phy_smac": "", "phy_dmac": "", "local_vtep_ip": "", "remote_vtep_ip": "", "vni": uint32(0)},
+	nm.BRIDGEPORT: {"portType": infradb.BridgePortType(0), "vport_id": ""},
+}
+
+// checkMetadata checks the metadata holds the keys with values of the
+// expected types
+func checkMetadata(object interface{}, metadata map[interface{}]interface{}, want map[string]interface{}) error {
+	for key, sample := range want {
+		value, ok := metadata[key]
+		if !ok || reflect.TypeOf(value) != reflect.TypeOf(sample) {
+			return fmt.Errorf("intel-e2000: %+v: %w %s of type %T", object, ErrMissingMetadata, key, sample)
+		}
+	}
+	return nil
+}
+
+// checkNexthop checks the decoders can translate the l3 nexthop
+func checkNexthop(nexthop nm.NexthopStruct) error {
+	want, ok := nexthopMetadata[nexthop.NhType]
+	if !ok {
+		return fmt.Errorf("intel-e2000: %+v: %w %d", nexthop.Key, ErrUnsupportedNexthopType, nexthop.NhType)
+	}
+	return checkMetadata(nexthop.Key, nexthop.Metadata, want)
+}
+
+// checkRoute checks the decoders can translate the route and its nexthops
+func checkRoute(route nm.RouteStruct) error {
+	if route.Vrf == nil || route.Vrf.Spec == nil || route.Vrf.Metadata == nil {
+		return fmt.Errorf("intel-e2000: %+v: %w vrf", route.Key, ErrMissingMetadata)
+	}
+	if route.Vrf.Spec.Vni != nil && len(_vrfTables(route.Vrf)) == 0 {
+		return fmt.Errorf("intel-e2000: %+v: %w routing table", route.Key, ErrMissingMetadata)
+	}
+	if len(route.Nexthops) == 0 {
+		return fmt.Errorf("intel-e2000: %+v: %w nexthops", route.Key, ErrMissingMetadata)
+	}
+	for _, nexthop := range route.Nexthops {
+		if nexthop == nil {
+			return fmt.Errorf("intel-e2000: %+v: %w nexthop", route.Key, ErrMissingMetadata)
+		}
+		if err := checkNexthop(*nexthop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkL2Nexthop checks the decoders can translate the l2 nexthop
+func checkL2Nexthop(nexthop nm.L2NexthopStruct) error {
+	want, ok := l2NexthopMetadata[nexthop.Type]
+	if !ok {
+		return fmt.Errorf("intel-e2000: %+v: %w %d", nexthop.Key, ErrUnsupportedNexthopType, nexthop.Type)
+	}
+	return checkMetadata(nexthop.Key, nexthop.Metadata, want)
+}
+
+// checkFdb checks the decoders can translate the fdb entry
+func checkFdb(fdb nm.FdbEntryStruct) error {
+	switch fdb.Type {
+	case nm.VXLAN:
+		return checkMetadata(fdb.Key, fdb.Metadata, map[string]interface{}{"nh_id": 0})
+	case nm.BRIDGEPORT:
+		if fdb.Nexthop == nil {
+			return fmt.Errorf("intel-e2000: %+v: %w nexthop", fdb.Key, ErrMissingMetadata)
+		}
+	}
+	return nil
+}
+
+// claimID gets the id of the key from a tracked pool, failing once the pool
+// has no id left
+func (p *trackedPool) claimID(key interface{}) (uint32, error) {
+	id := p.GetID(key)
+	if id == 0 && len(p.inUse) >= p.size {
+		return 0, fmt.Errorf("intel-e2000: %w: %d ids of %s in use", ErrPoolExhausted, len(p.inUse), p.name)
+	}
+	return id, nil
+}
@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// eventStreamKey config key of the event stream section
+const eventStreamKey = "eventstream"
+
+// EventStreamConfig event stream config structure, the watermarks are
+// fractions of the queue size and bound the back-pressure too
+type EventStreamConfig struct {
+	QueueSize     int     `yaml:"queuesize"`
+	HighWatermark float64 `yaml:"highwatermark"`
+	LowWatermark  float64 `yaml:"lowwatermark"`
+}
+
+// EventStreamStats event stream statistics
+type EventStreamStats struct {
+	Queued         int       `json:"queued"`
+	Capacity       int       `json:"capacity"`
+	Received       uint64    `json:"received"`
+	Processed      uint64    `json:"processed"`
+	Congested      bool      `json:"congested"`
+	CongestedSince time.Time `json:"congestedsince"`
+	Congestions    uint64    `json:"congestions"`
+	Duplicates     uint64    `json:"duplicates"`
+	Redelivered    uint64    `json:"redelivered"`
+	Held           int       `json:"held"`
+}
+
+// streamEvent netlink event queued in the event stream, the key identifies
+// the object of a held add
+type streamEvent struct {
+	eventType string
+	data      interface{}
+	received  time.Time
+	key       string
+}
+
+var (
+	// eventStreamCfg event stream configuration read from the config file,
+	// guarded by the stream lock
+	eventStreamCfg = EventStreamConfig{QueueSize: 1024, HighWatermark: 0.8, LowWatermark: 0.4}
+
+	// eventStream ordered stream of the netlink events of all the types
+	eventStream chan streamEvent
+
+	// streamLock guards the event stream statistics
+	streamLock sync.Mutex
+
+	// streamStats event stream statistics
+	streamStats EventStreamStats
+
+	// heldAdds add events held while the gateway drains in arrival order,
+	// guarded by the stream lock
+	heldAdds []streamEvent
+
+	// heldRelease wakes the stream worker up to dispatch the held adds
+	heldRelease = make(chan struct{}, 1)
+)
+
+// loadEventStreamConfig reads the event stream config and applies the
+// defaults, the queue size only applies when the stream starts
+func loadEventStreamConfig() {
+	cfg := EventStreamConfig{}
+	if err := viper.UnmarshalKey(eventStreamKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read event stream config: %v\n", err)
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.HighWatermark <= 0 || cfg.HighWatermark > 1 {
+		cfg.HighWatermark = 0.8
+	}
+	if cfg.LowWatermark <= 0 || cfg.LowWatermark >= cfg.HighWatermark {
+		cfg.LowWatermark = cfg.HighWatermark / 2
+	}
+	streamLock.Lock()
+	if eventStream != nil && cfg.QueueSize != cap(eventStream) {
+		log.Printf("intel-e2000: Event stream queue size %d applies after a restart, keeping %d\n", cfg.QueueSize, cap(eventStream))
+	}
+	eventStreamCfg = cfg
+	streamLock.Unlock()
+}
+
+// _streamWatermarks returns the high and low watermarks of the stream depth,
+// the configured fractions of its capacity. The caller holds the stream lock
+func _streamWatermarks() (int, int) {
+	capacity := cap(eventStream)
+	if eventStream == nil {
+		capacity = eventStreamCfg.QueueSize
+	}
+	return int(float64(capacity) * eventStreamCfg.HighWatermark), int(float64(capacity) * eventStreamCfg.LowWatermark)
+}
+
+// streamWatermarks returns the high and low watermarks of the stream depth
+func streamWatermarks() (int, int) {
+	streamLock.Lock()
+	defer streamLock.Unlock()
+	return _streamWatermarks()
+}
+
+// startEventStream starts the worker draining the event stream in order
+func startEventStream() {
+	loadEventStreamConfig()
+	streamLock.Lock()
+	eventStream = make(chan streamEvent, eventStreamCfg.QueueSize)
+	streamStats = EventStreamStats{Capacity: eventStreamCfg.QueueSize}
+	streamLock.Unlock()
+	go func() {
+		for {
+			select {
+			case event, ok := <-eventStream:
+				if !ok {
+					return
+				}
+				releaseHeldAdds()
+				if !holdAddEvent(event) {
+					processStreamEvent(event)
+				}
+			case <-heldRelease:
+				releaseHeldAdds()
+			}
+		}
+	}()
+}
+
+// processStreamEvent dispatches an event of the stream
+func processStreamEvent(event streamEvent) {
+	holdEventStream()
+	started := time.Now()
+	dispatchEvent(event.eventType, event.data)
+	observeLatency(eventObject(event.eventType), started.Sub(event.received), time.Since(event.received))
+	streamLock.Lock()
+	streamStats.Processed++
+	if _, low := _streamWatermarks(); streamStats.Congested && len(eventStream) <= low {
+		streamStats.Congested = false
+		log.Printf("intel-e2000: Event stream drained after %v, releasing backpressure\n", time.Since(streamStats.CongestedSince))
+	}
+	streamLock.Unlock()
+}
+
+// heldKey returns the key of the object of an event, the routes are told
+// apart by their protocol as the candidates of a prefix
+func heldKey(eventType string, data interface{}) string {
+	if route, ok := data.(*nm.RouteStruct); ok && route != nil {
+		return fmt.Sprint(eventObject(eventType), route.Key, route.Route0.Protocol)
+	}
+	_, key := generationsOf(data)
+	return fmt.Sprint(eventObject(eventType), key)
+}
+
+// holdAddEvent holds an add event while the gateway drains so nothing new is
+// programmed, the deletes and the updates, such as the ones of the costed out
+// routes, go through. A later add or update of an object held replaces the
+// event held, a delete drops it and goes through for the version programmed
+// before if any. Once as many adds as the stream holds are held the stream is
+// held until the gateway resumes
+func holdAddEvent(event streamEvent) bool {
+	if !draining() {
+		return false
+	}
+	event.key = heldKey(event.eventType, event.data)
+	streamLock.Lock()
+	for i, held := range heldAdds {
+		if held.key != event.key {
+			continue
+		}
+		if strings.HasSuffix(event.eventType, "_deleted") {
+			heldAdds = append(heldAdds[:i], heldAdds[i+1:]...)
+			streamLock.Unlock()
+			return false
+		}
+		heldAdds[i].data = event.data
+		streamLock.Unlock()
+		return true
+	}
+	if !strings.HasSuffix(event.eventType, "_added") {
+		streamLock.Unlock()
+		return false
+	}
+	full := len(heldAdds) >= cap(eventStream)
+	if !full {
+		heldAdds = append(heldAdds, event)
+	}
+	streamLock.Unlock()
+	if !full {
+		return true
+	}
+	for draining() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	releaseHeldAdds()
+	return false
+}
+
+// releaseHeldAdds dispatches the add events held once the gateway resumed
+func releaseHeldAdds() {
+	if draining() {
+		return
+	}
+	streamLock.Lock()
+	held := heldAdds
+	heldAdds = nil
+	streamLock.Unlock()
+	if len(held) != 0 {
+		log.Printf("intel-e2000: Dispatching %d add events held while draining\n", len(held))
+	}
+	for _, event := range held {
+		processStreamEvent(event)
+	}
+}
+
+// wakeHeldAdds wakes the stream worker up to dispatch the held adds
+func wakeHeldAdds() {
+	select {
+	case heldRelease <- struct{}{}:
+	default:
+	}
+}
+
+// publishToStream queues an event, once the stream is full the netlink
+// subscriber blocks which in turn holds the netlink publisher back
+func publishToStream(eventType string, data interface{}) {
+	streamLock.Lock()
+	streamStats.Received++
+	if high, _ := _streamWatermarks(); !streamStats.Congested && len(eventStream) >= high {
+		streamStats.Congested = true
+		streamStats.CongestedSince = time.Now()
+		streamStats.Congestions++
+		log.Printf("intel-e2000: Event stream above high watermark (%d/%d), applying backpressure\n", len(eventStream), cap(eventStream))
+	}
+	streamLock.Unlock()
+	eventStream <- streamEvent{eventType: eventType, data: data, received: time.Now()}
+}
+
+// StreamStats returns the event stream statistics
+func StreamStats() EventStreamStats {
+	streamLock.Lock()
+	defer streamLock.Unlock()
+	stats := streamStats
+	stats.Queued = len(eventStream)
+	stats.Held = len(heldAdds)
+	stats.Duplicates, stats.Redelivered = dedupCounters()
+	return stats
+}
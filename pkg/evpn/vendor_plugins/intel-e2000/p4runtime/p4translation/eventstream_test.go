@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"testing"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// TestHoldAddEvent checks a draining gateway holds the add events only, a
+// later update replaces the add held and a delete drops it
+func TestHoldAddEvent(t *testing.T) {
+	stream := eventStream
+	eventStream = make(chan streamEvent, 4)
+	drainLock.Lock()
+	drainState.Draining = true
+	drainLock.Unlock()
+	t.Cleanup(func() {
+		drainLock.Lock()
+		drainState.Draining = false
+		drainLock.Unlock()
+		streamLock.Lock()
+		heldAdds = nil
+		streamLock.Unlock()
+		eventStream = stream
+	})
+
+	nh := &nm.NexthopStruct{ID: 70, Key: nm.NexthopKey{VrfName: "blue", Dst: "10.7.0.1", Dev: 7}}
+	updated := &nm.NexthopStruct{ID: 70, Key: nh.Key, Weight: 2}
+	other := &nm.NexthopStruct{ID: 71, Key: nm.NexthopKey{VrfName: "blue", Dst: "10.7.0.2", Dev: 7}}
+	for _, tc := range []struct {
+		eventType string
+		data      interface{}
+		held      bool
+		count     int
+	}{
+		{"nexthop_added", nh, true, 1},
+		{"nexthop_updated", updated, true, 1},
+		{"nexthop_updated", other, false, 1},
+		{"nexthop_deleted", other, false, 1},
+		{"nexthop_deleted", nh, false, 0},
+	} {
+		if got := holdAddEvent(streamEvent{eventType: tc.eventType, data: tc.data}); got != tc.held {
+			t.Errorf("%s of %d: held %v, want %v", tc.eventType, tc.data.(*nm.NexthopStruct).ID, got, tc.held)
+		}
+		if got := StreamStats().Held; got != tc.count {
+			t.Errorf("%s of %d: %d adds held, want %d", tc.eventType, tc.data.(*nm.NexthopStruct).ID, got, tc.count)
+		}
+		if tc.eventType == "nexthop_updated" && tc.held && heldAdds[0].data != updated {
+			t.Errorf("update did not replace the add held")
+		}
+	}
+}
+
+// TestBackpressureWatermarks checks the back-pressure pauses at the high
+// watermark of the event stream capacity and resumes under the low one
+func TestBackpressureWatermarks(t *testing.T) {
+	stream := eventStream
+	eventStream = make(chan streamEvent, 10)
+	t.Cleanup(func() {
+		for len(eventStream) > 0 {
+			<-eventStream
+		}
+		eventStream = stream
+	})
+
+	high, low := streamWatermarks()
+	if high != 8 || low != 4 {
+		t.Fatalf("watermarks of a stream of 10: got %d/%d, want 8/4", high, low)
+	}
+	stats := GetBackpressureStats()
+	if stats.HighWatermark != high || stats.LowWatermark != low {
+		t.Errorf("back-pressure watermarks: got %d/%d, want %d/%d", stats.HighWatermark, stats.LowWatermark, high, low)
+	}
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+// failoverKey config key of the failover section
+const failoverKey = "failover"
+
+// failover modes
+const (
+	failoverActive  = "active"
+	failoverStandby = "standby"
+)
+
+// maxTakeoverPasses bounds the reconciliation passes run on takeover
+const maxTakeoverPasses = 100
+
+// FailoverConfig failover config structure, the election id defaults to 2
+// for the active and 1 for the standby so the active wins the arbitration
+type FailoverConfig struct {
+	Mode       string `yaml:"mode"`
+	ElectionID uint64 `yaml:"electionid"`
+}
+
+// FailoverState role of the instance in the failover pair
+type FailoverState struct {
+	Mode       string    `json:"mode"`
+	Standby    bool      `json:"standby"`
+	ElectionID uint64    `json:"electionid"`
+	PromotedAt time.Time `json:"promotedat,omitempty"`
+	Takeover   uint64    `json:"takeoverwrites"`
+}
+
+var (
+	// failoverLock guards the failover state
+	failoverLock sync.Mutex
+
+	// failoverState role of the instance
+	failoverState FailoverState
+
+	// initialized closed once the decoders and static entries are set up
+	initialized = make(chan struct{})
+)
+
+// loadFailoverConfig reads the failover config and applies the defaults,
+// no failover section keeps the single instance election id
+func loadFailoverConfig() FailoverConfig {
+	cfg := FailoverConfig{}
+	if err := viper.UnmarshalKey(failoverKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read failover config: %v\n", err)
+	}
+	switch cfg.Mode {
+	case "":
+		cfg.ElectionID = 1
+	case failoverStandby:
+		if cfg.ElectionID == 0 {
+			cfg.ElectionID = 1
+		}
+	default:
+		if cfg.Mode != failoverActive {
+			log.Printf("intel-e2000: Unknown failover mode %s, running active\n", cfg.Mode)
+			cfg.Mode = failoverActive
+		}
+		if cfg.ElectionID == 0 {
+			cfg.ElectionID = 2
+		}
+	}
+	return cfg
+}
+
+// connectP4Runtime opens the p4runtime client in the configured role, a
+// standby mirrors the desired state without writing until it takes over
+func connectP4Runtime(conn *grpc.ClientConn) error {
+	cfg := loadFailoverConfig()
+	failoverLock.Lock()
+	failoverState = FailoverState{Mode: cfg.Mode, Standby: cfg.Mode == failoverStandby, ElectionID: cfg.ElectionID}
+	failoverLock.Unlock()
+	p4cfg := GlobalConfig().P4.Config
+	return p4client.NewP4RuntimeClientWithRole(p4cfg.BinFile, p4cfg.P4infoFile,
+		conn, cfg.ElectionID, cfg.Mode == failoverStandby, takeOver)
+}
+
+// takeOver runs once the standby is elected primary, the tables left by the
+// previous primary are kept and only the difference to the mirrored desired
+// state is written
+func takeOver() {
+	<-initialized
+	log.Printf("intel-e2000: Elected primary, taking over the device\n")
+	start := GetReconcilerStats()
+	last := start
+	for i := 0; i < maxTakeoverPasses; i++ {
+		stats := Reconcile()
+		deferred := stats.Deferred - last.Deferred
+		last = stats
+		if deferred == 0 {
+			break
+		}
+	}
+	failoverLock.Lock()
+	failoverState.Standby = false
+	failoverState.PromotedAt = time.Now()
+	failoverState.Takeover = last.Added + last.Removed - start.Added - start.Removed
+	failoverLock.Unlock()
+	log.Printf("intel-e2000: Took over the device, %d entries missing, %d extra\n", last.Missing, last.Extra)
+}
+
+// setInitialized records the decoders and static entries are set up
+func setInitialized() {
+	select {
+	case <-initialized:
+	default:
+		close(initialized)
+	}
+}
+
+// GetFailoverState returns the role of the instance in the failover pair
+func GetFailoverState() FailoverState {
+	failoverLock.Lock()
+	defer failoverLock.Unlock()
+	state := failoverState
+	state.Standby = p4client.IsStandby()
+	return state
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	netlink_polling "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// fdbDirectionKey config key of the fdb direction mode
+const fdbDirectionKey = "fdbdirection"
+
+// fdb direction modes, both programs the directions the netlink module
+// reports, rx and tx keep only that direction for the bridges deployed in a
+// single direction
+const (
+	fdbBoth = "both"
+	fdbRx   = "rx"
+	fdbTx   = "tx"
+)
+
+var (
+	// fdbDirectionLock guards the fdb direction mode
+	fdbDirectionLock sync.Mutex
+
+	// fdbDirection fdb direction mode read from the config file
+	fdbDirection = fdbBoth
+)
+
+// loadFdbDirection reads the fdb direction mode
+func loadFdbDirection() {
+	mode := strings.ToLower(viper.GetString(fdbDirectionKey))
+	switch mode {
+	case "":
+		mode = fdbBoth
+	case fdbBoth, fdbRx, fdbTx:
+	default:
+		log.Printf("intel-e2000: Unknown fdb direction %q, programming both directions\n", mode)
+		mode = fdbBoth
+	}
+	fdbDirectionLock.Lock()
+	fdbDirection = mode
+	fdbDirectionLock.Unlock()
+}
+
+// _fdbDirections returns the l2 forwarding directions of an fdb entry, the
+// directions it is reported in restricted to the configured one
+func _fdbDirections(fdb netlink_polling.FdbEntryStruct) []int {
+	fdbDirectionLock.Lock()
+	mode := fdbDirection
+	fdbDirectionLock.Unlock()
+	var directions []int
+	for _, dir := range _directionsOf(fdb) {
+		if (mode == fdbRx && dir != Direction.Rx) || (mode == fdbTx && dir != Direction.Tx) {
+			continue
+		}
+		directions = append(directions, dir)
+	}
+	return directions
+}
+
+// _fdbEntries builds the l2 forwarding entries of an fdb entry, one per
+// direction, with the neighbor as action when added
+func _fdbEntries(fdb netlink_polling.FdbEntryStruct, neighbor uint16, add bool) []interface{} {
+	var entries = make([]interface{}, 0)
+	var mac, _ = net.ParseMAC(fdb.Mac)
+	for _, dir := range _fdbDirections(fdb) {
+		entry := p4client.TableEntry{
+			Tablename: l2Fwd,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"vlan_id":   {uint16(fdb.VlanID), "exact"},
+					"da":        {mac, "exact"},
+					"direction": {uint16(dir), "exact"},
+				},
+				Priority: int32(0),
+			},
+		}
+		if add {
+			entry.Action = p4client.Action{
+				ActionName: "evpn_gw_control.set_neighbor",
+				Params:     []interface{}{neighbor},
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
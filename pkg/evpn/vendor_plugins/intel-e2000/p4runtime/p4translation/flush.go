@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// FlushReport result of the flush of a table
+type FlushReport struct {
+	Table    string        `json:"table"`
+	Removed  int           `json:"removed"`
+	Restored int           `json:"restored"`
+	Failed   int           `json:"failed"`
+	Duration time.Duration `json:"duration"`
+}
+
+// FlushTable removes all the entries of a table written by the plugin and
+// programs it again from the translation of the objects, to recover from a
+// suspected corruption of one table without a restart. The decoders are held
+// so the events wait until the table is restored
+func FlushTable(table string) (FlushReport, error) {
+	report := FlushReport{Table: table}
+	if p4client.IsStandby() || !GetReadiness().P4Connected {
+		return report, fmt.Errorf("intel-e2000: %w, flushing %s needs a connected primary", ErrDeviceUnavailable, table)
+	}
+	reconcilerLock.Lock()
+	managed := managedTables[table]
+	reconcilerLock.Unlock()
+	if !managed {
+		return report, fmt.Errorf("intel-e2000: table %s is not written by the plugin", table)
+	}
+
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	start := time.Now()
+
+	var desired []interface{}
+	desired = append(desired, expectedStaticEntries()...)
+	desired = append(desired, desiredObjectEntries()...)
+	desired = append(desired, desiredNetlinkEntries()...)
+
+	programmed, err := p4client.GetEntry(table)
+	if err != nil {
+		return report, writeError(table, err)
+	}
+	log.Printf("intel-e2000: Flushing %d entries of %s\n", len(programmed), table)
+	for _, p := range programmed {
+		if err := p4client.DelProgrammedEntry(p); err != nil {
+			log.Printf("intel-e2000: Failed to flush entry of %s: %v\n", table, err)
+			report.Failed++
+			continue
+		}
+		report.Removed++
+	}
+
+	// the tcam rows and lpm counts of the entries are still held, the
+	// entries are written again as they are
+	restored := make(map[string]bool)
+	for _, entry := range desired {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok || e.Tablename != table {
+			continue
+		}
+		key, err := p4client.EntryMatchKey(e)
+		if err != nil || restored[key] {
+			continue
+		}
+		restored[key] = true
+		if err := writeError(table, p4client.AddEntry(e)); err != nil {
+			log.Printf("intel-e2000: Failed to restore entry of %s: %v\n", table, err)
+			report.Failed++
+			continue
+		}
+		report.Restored++
+	}
+	report.Duration = time.Since(start)
+	log.Printf("intel-e2000: Flushed %s, removed %d and restored %d entries, %d failed\n", table, report.Removed, report.Restored, report.Failed)
+	return report, nil
+}
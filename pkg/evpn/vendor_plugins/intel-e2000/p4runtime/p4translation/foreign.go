@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// foreignKey config key of the foreign entries section
+const foreignKey = "foreignentries"
+
+// policies applied to the foreign entries, entries of the tables of the
+// plugin it did not translate
+const (
+	foreignIgnore = "ignore"
+	foreignWarn   = "warn"
+	foreignDelete = "delete"
+	foreignAdopt  = "adopt"
+)
+
+// ForeignConfig foreign entries config structure. The scan runs once, delay
+// seconds after the start so the objects and the netlink events are replayed
+// first. The policy applies to all the tables but the ones overridden
+type ForeignConfig struct {
+	Policy string            `yaml:"policy"`
+	Delay  int               `yaml:"delay"`
+	Tables map[string]string `yaml:"tables"`
+}
+
+// ForeignTable foreign entries found in a table by the startup scan
+type ForeignTable struct {
+	Table   string `json:"table"`
+	Policy  string `json:"policy"`
+	Entries int    `json:"entries"`
+	Deleted int    `json:"deleted,omitempty"`
+	Adopted int    `json:"adopted,omitempty"`
+}
+
+// ForeignReport result of the startup scan
+type ForeignReport struct {
+	Scanned time.Time      `json:"scanned"`
+	Tables  []ForeignTable `json:"tables"`
+}
+
+var (
+	// foreignLock guards the scan report and the adopted entries
+	foreignLock sync.Mutex
+
+	// foreignReport result of the last scan
+	foreignReport ForeignReport
+
+	// adoptedEntries match keys of the foreign entries adopted, left alone by
+	// the reconciler
+	adoptedEntries = make(map[string]bool)
+
+	// foreignTimer delays the startup scan
+	foreignTimer *time.Timer
+)
+
+// validForeignPolicy checks the policy is one of the foreign entry policies
+func validForeignPolicy(policy string) bool {
+	switch policy {
+	case foreignIgnore, foreignWarn, foreignDelete, foreignAdopt:
+		return true
+	}
+	return false
+}
+
+// loadForeignConfig reads the foreign entries config and applies the defaults
+func loadForeignConfig() ForeignConfig {
+	cfg := ForeignConfig{}
+	if err := viper.UnmarshalKey(foreignKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read foreign entries config: %v\n", err)
+	}
+	cfg.Policy = strings.ToLower(cfg.Policy)
+	if !validForeignPolicy(cfg.Policy) {
+		if cfg.Policy != "" {
+			log.Printf("intel-e2000: Unknown foreign entries policy %q, warning only\n", cfg.Policy)
+		}
+		cfg.Policy = foreignWarn
+	}
+	if cfg.Delay <= 0 {
+		cfg.Delay = 60
+	}
+	return cfg
+}
+
+// policyOf returns the foreign entries policy of a table
+func (c ForeignConfig) policyOf(table string) string {
+	if policy, ok := c.Tables[table]; ok && validForeignPolicy(strings.ToLower(policy)) {
+		return strings.ToLower(policy)
+	}
+	return c.Policy
+}
+
+// ownedTables returns the tables of the pipeline of the plugin, the ones of
+// the p4info and the ones it writes
+func ownedTables() []string {
+	tables := make(map[string]bool)
+	sizes, err := readP4InfoSizes(GlobalConfig().P4.Config.P4infoFile)
+	if err != nil {
+		log.Printf("intel-e2000: Failed to read the tables of the p4info: %v\n", err)
+	}
+	for table := range sizes {
+		tables[table] = true
+	}
+	reconcilerLock.Lock()
+	for table := range managedTables {
+		tables[table] = true
+	}
+	reconcilerLock.Unlock()
+	list := make([]string, 0, len(tables))
+	for table := range tables {
+		list = append(list, table)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// scanForeignEntries reads the tables of the plugin and applies the policy to
+// the entries it did not translate
+func scanForeignEntries(cfg ForeignConfig) {
+	if p4client.IsStandby() {
+		return
+	}
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+
+	var desired []interface{}
+	desired = append(desired, expectedStaticEntries()...)
+	desired = append(desired, desiredObjectEntries()...)
+	desired = append(desired, desiredNetlinkEntries()...)
+	desiredKeys := make(map[string]bool)
+	for _, entry := range desired {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			if key, err := p4client.EntryMatchKey(e); err == nil {
+				desiredKeys[key] = true
+			}
+		}
+	}
+
+	report := ForeignReport{Scanned: time.Now(), Tables: make([]ForeignTable, 0)}
+	adopted := make(map[string]bool)
+	for _, table := range ownedTables() {
+		policy := cfg.policyOf(table)
+		if policy == foreignIgnore {
+			continue
+		}
+		programmed, err := p4client.GetEntry(table)
+		if err != nil {
+			log.Printf("intel-e2000: Foreign entry scan failed to read %s: %v\n", table, err)
+			continue
+		}
+		found := ForeignTable{Table: table, Policy: policy}
+		for _, p := range programmed {
+			key := p4client.MatchKey(p)
+			if desiredKeys[key] {
+				continue
+			}
+			found.Entries++
+			switch policy {
+			case foreignDelete:
+				if err := p4client.DelProgrammedEntry(p); err != nil {
+					log.Printf("intel-e2000: Failed to delete foreign entry of %s: %v\n", table, err)
+					continue
+				}
+				found.Deleted++
+			case foreignAdopt:
+				adopted[key] = true
+				found.Adopted++
+			}
+		}
+		if found.Entries == 0 {
+			continue
+		}
+		log.Printf("intel-e2000: Found %d foreign entries in %s, policy %s\n", found.Entries, table, policy)
+		report.Tables = append(report.Tables, found)
+	}
+
+	foreignLock.Lock()
+	foreignReport = report
+	adoptedEntries = adopted
+	foreignLock.Unlock()
+}
+
+// foreignAdopted checks the match key is the one of an adopted foreign entry
+func foreignAdopted(key string) bool {
+	foreignLock.Lock()
+	defer foreignLock.Unlock()
+	return adoptedEntries[key]
+}
+
+// startForeignScan schedules the startup scan of the foreign entries
+func startForeignScan() {
+	cfg := loadForeignConfig()
+	if cfg.Policy == foreignIgnore && len(cfg.Tables) == 0 {
+		return
+	}
+	foreignLock.Lock()
+	foreignTimer = time.AfterFunc(time.Duration(cfg.Delay)*time.Second, func() {
+		scanForeignEntries(cfg)
+	})
+	foreignLock.Unlock()
+}
+
+// stopForeignScan cancels the startup scan not run yet
+func stopForeignScan() {
+	foreignLock.Lock()
+	defer foreignLock.Unlock()
+	if foreignTimer != nil {
+		foreignTimer.Stop()
+		foreignTimer = nil
+	}
+}
+
+// ForeignEntries returns the result of the startup scan of the foreign entries
+func ForeignEntries() ForeignReport {
+	foreignLock.Lock()
+	defer foreignLock.Unlock()
+	return foreignReport
+}
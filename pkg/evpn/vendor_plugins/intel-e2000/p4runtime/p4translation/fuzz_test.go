@@ -0,0 +1,311 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/common"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/vishvananda/netlink"
+)
+
+// The fuzz targets build the objects from the fuzz input keeping the
+// invariants the netlink module and infradb guarantee (metadata keys and
+// their types, a vrf on every route, at least one nexthop), every value is
+// random. A target fails on a panic of a decoder or an invalid entry.
+//
+//	go test -run '^$' -fuzz FuzzRouteDecoder ./pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4translation
+
+var fuzzOnce sync.Once
+
+// fuzzDecoders sets up the decoders and an in memory infradb
+func fuzzDecoders(t testing.TB) {
+	fuzzOnce.Do(func() {
+		if err := infradb.NewInfraDB("", "gomap"); err != nil {
+			t.Fatalf("failed to create infradb: %v", err)
+		}
+		representors := map[string][2]string{
+			"vrf_mux":   {"42", "00:00:00:00:00:2a"},
+			"port_mux":  {"43", "00:00:00:00:00:2b"},
+			"grpc_acc":  {"44", "00:00:00:00:00:2c"},
+			"grpc_host": {"45", "00:00:00:00:00:2d"},
+		}
+		L3 = L3.L3DecoderInit(representors)
+		Pod = Pod.PodDecoderInit(representors)
+		Vxlan = Vxlan.VxlanDecoderInit(representors)
+	})
+}
+
+// fuzzReader hands out the fuzz input as typed values, zeros once drained
+type fuzzReader struct {
+	data []byte
+}
+
+func (r *fuzzReader) byte() byte {
+	if len(r.data) == 0 {
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *fuzzReader) bool() bool {
+	return r.byte()&1 == 1
+}
+
+func (r *fuzzReader) intn(n int) int {
+	return int(r.byte()) % n
+}
+
+func (r *fuzzReader) uint32() uint32 {
+	return uint32(r.byte())<<24 | uint32(r.byte())<<16 | uint32(r.byte())<<8 | uint32(r.byte())
+}
+
+func (r *fuzzReader) ip() net.IP {
+	return net.IPv4(r.byte(), r.byte(), r.byte(), r.byte()).To4()
+}
+
+func (r *fuzzReader) mac() string {
+	return net.HardwareAddr{r.byte(), r.byte(), r.byte(), r.byte(), r.byte(), r.byte()}.String()
+}
+
+func (r *fuzzReader) direction() int {
+	return []int{nm.None, nm.RX, nm.TX, nm.RXTX}[r.intn(4)]
+}
+
+func (r *fuzzReader) vrf() *infradb.Vrf {
+	vrf := &infradb.Vrf{
+		Name:     []string{vrfPrefix + grdStr, vrfPrefix + "blue", vrfPrefix + "red"}[r.intn(3)],
+		Spec:     &infradb.VrfSpec{},
+		Status:   &infradb.VrfStatus{},
+		Metadata: &infradb.VrfMetadata{},
+	}
+	// the general module takes the tables from its pool, the vni is 24 bits
+	table := 1000 + r.uint32()%3001
+	vrf.Metadata.RoutingTable = []*uint32{&table}
+	if r.bool() {
+		vni := r.uint32() & 0xffffff
+		vrf.Spec.Vni = &vni
+		vrf.Spec.VtepIP = &net.IPNet{IP: r.ip(), Mask: net.CIDRMask(32, 32)}
+		details, _ := json.Marshal(map[string]string{"rmac": r.mac()})
+		vrf.Status.Components = []common.Component{{Name: "frr", Details: string(details)}}
+	}
+	return vrf
+}
+
+func (r *fuzzReader) nexthop(vrf *infradb.Vrf) nm.NexthopStruct {
+	nh := nm.NexthopStruct{
+		ID:     r.intn(256) + 16,
+		NhType: []int{nm.PHY, nm.ACC, nm.SVI, nm.VXLAN}[r.intn(4)],
+		Key:    nm.NexthopKey{VrfName: vrf.Name, Dst: r.ip().String(), Dev: r.intn(64)},
+		Weight: r.intn(8) + 1,
+		Metadata: map[interface{}]interface{}{
+			"direction": r.direction(),
+		},
+	}
+	switch nh.NhType {
+	case nm.PHY:
+		nh.Metadata["smac"] = r.mac()
+		nh.Metadata["dmac"] = r.mac()
+		nh.Metadata["egress_vport"] = r.intn(4)
+	case nm.ACC:
+		nh.Metadata["dmac"] = r.mac()
+		nh.Metadata["vlanID"] = uint32(r.intn(4096))
+		nh.Metadata["egress_vport"] = int(r.uint32() & 0xffff)
+	case nm.SVI:
+		nh.Metadata["smac"] = r.mac()
+		nh.Metadata["dmac"] = r.mac()
+		nh.Metadata["vlanID"] = uint32(r.intn(4096))
+		nh.Metadata["egress_vport"] = fmt.Sprint(r.uint32() & 0xffff)
+		nh.Metadata["portType"] = []infradb.BridgePortType{infradb.Access, infradb.Trunk}[r.intn(2)]
+	case nm.VXLAN:
+		nh.Metadata["egress_vport"] = r.intn(4)
+		nh.Metadata["phy_smac"] = r.mac()
+		nh.Metadata["phy_dmac"] = r.mac()
+		nh.Metadata["local_vtep_ip"] = r.ip().String()
+		nh.Metadata["remote_vtep_ip"] = r.ip().String()
+		nh.Metadata["vni"] = r.uint32() & 0xffffff
+		nh.Metadata["inner_smac"] = r.mac()
+		nh.Metadata["inner_dmac"] = r.mac()
+	}
+	// The nexthop added event claims the neighbor slot the decoders look up
+	_, _ = claimNeighborSlot(nh.ID)
+	return nh
+}
+
+func (r *fuzzReader) route() nm.RouteStruct {
+	vrf := r.vrf()
+	dst := &net.IPNet{IP: r.ip(), Mask: net.CIDRMask(r.intn(33), 32)}
+	dst.IP = dst.IP.Mask(dst.Mask)
+	route := nm.RouteStruct{
+		Route0:   netlink.Route{Dst: dst, Priority: r.intn(256)},
+		Vrf:      vrf,
+		Metadata: map[interface{}]interface{}{"direction": r.direction()},
+		Key:      nm.RouteKey{Table: int(*vrf.Metadata.RoutingTable[0]), Dst: dst.String()},
+	}
+	for i := r.intn(4); i >= 0; i-- {
+		nh := r.nexthop(vrf)
+		route.Nexthops = append(route.Nexthops, &nh)
+	}
+	return route
+}
+
+func (r *fuzzReader) l2Nexthop() nm.L2NexthopStruct {
+	nh := nm.L2NexthopStruct{
+		Dev:      fmt.Sprintf("vxlan-%d", r.intn(8)),
+		VlanID:   r.intn(4096),
+		Dst:      r.ip(),
+		ID:       r.intn(256) + 16,
+		Type:     []int{nm.VXLAN, nm.BRIDGEPORT}[r.intn(2)],
+		Metadata: make(map[interface{}]interface{}),
+	}
+	nh.Key = nm.L2NexthopKey{Dev: nh.Dev, VlanID: nh.VlanID, Dst: nh.Dst.String()}
+	if nh.Type == nm.VXLAN {
+		nh.Metadata["egress_vport"] = r.intn(4)
+		nh.Metadata["phy_smac"] = r.mac()
+		nh.Metadata["phy_dmac"] = r.mac()
+		nh.Metadata["local_vtep_ip"] = r.ip().String()
+		nh.Metadata["remote_vtep_ip"] = r.ip().String()
+		nh.Metadata["vni"] = r.uint32() & 0xffffff
+	} else {
+		nh.Metadata["portType"] = []infradb.BridgePortType{infradb.Access, infradb.Trunk}[r.intn(2)]
+		nh.Metadata["vport_id"] = fmt.Sprint(r.uint32() & 0xffff)
+	}
+	return nh
+}
+
+func (r *fuzzReader) fdb() nm.FdbEntryStruct {
+	nh := r.l2Nexthop()
+	fdb := nm.FdbEntryStruct{
+		VlanID:  nh.VlanID,
+		Mac:     r.mac(),
+		Type:    nh.Type,
+		Nexthop: &nh,
+		Metadata: map[interface{}]interface{}{
+			"direction": r.direction(),
+			"nh_id":     nh.ID,
+		},
+	}
+	fdb.Key = nm.FdbKey{VlanID: fdb.VlanID, Mac: fdb.Mac}
+	return fdb
+}
+
+// checkEntries fails on entries the p4runtime client cannot encode
+func checkEntries(t *testing.T, what string, entries []interface{}) {
+	t.Helper()
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			t.Fatalf("%s generated %T instead of a table entry", what, entry)
+		}
+		if e.Tablename == "" || len(e.TableField.FieldValue) == 0 {
+			t.Fatalf("%s generated an entry without table or match: %+v", what, e)
+		}
+		for field, value := range e.TableField.FieldValue {
+			switch value[1] {
+			case "exact", "lpm", "ternary":
+			default:
+				t.Fatalf("%s generated match %q of %s.%s", what, value[1], e.Tablename, field)
+			}
+			if nilValue(value[0]) {
+				t.Fatalf("%s generated an empty %s.%s", what, e.Tablename, field)
+			}
+		}
+		for i, param := range e.Action.Params {
+			if nilValue(param) {
+				t.Fatalf("%s generated an empty param %d of %s", what, i, e.Action.ActionName)
+			}
+		}
+	}
+}
+
+// nilValue checks for the values encoding to nothing
+func nilValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case net.HardwareAddr:
+		return len(v) == 0
+	case net.IP:
+		return len(v) == 0
+	}
+	return false
+}
+
+func FuzzRouteDecoder(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0, 0, 1, 1, 0, 0, 0, 100, 10, 1, 2, 0, 24, 3, 2})
+	f.Add([]byte{1, 0, 0, 0, 7, 1, 0, 0, 0, 200, 172, 16, 0, 0, 32, 3, 3, 1, 2, 3, 4, 5, 6})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzDecoders(t)
+		r := &fuzzReader{data: data}
+		route := r.route()
+		checkEntries(t, "added route", L3.translateAddedRoute(route))
+		checkEntries(t, "deleted route", L3.translateDeletedRoute(route))
+	})
+}
+
+func FuzzNexthopDecoder(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 0, 0, 9, 0, 5, 1, 10, 0, 0, 1, 3, 0, 2})
+	f.Add([]byte{2, 0, 0, 0, 9, 1, 0, 0, 0, 1, 10, 0, 0, 1, 20, 3, 3, 1})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzDecoders(t)
+		r := &fuzzReader{data: data}
+		nh := r.nexthop(r.vrf())
+		checkEntries(t, "added l3 nexthop", L3.translateAddedNexthop(nh))
+		checkEntries(t, "deleted l3 nexthop", L3.translateDeletedNexthop(nh))
+		checkEntries(t, "added vxlan nexthop", Vxlan.translateAddedNexthop(nh))
+		checkEntries(t, "deleted vxlan nexthop", Vxlan.translateDeletedNexthop(nh))
+		releaseNeighborSlot(nh.ID)
+	})
+}
+
+func FuzzFdbDecoder(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{1, 10, 0, 0, 10, 0, 0, 0, 2, 4, 0, 0, 4, 3, 1, 2, 3, 4, 5, 6})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzDecoders(t)
+		r := &fuzzReader{data: data}
+		fdb := r.fdb()
+		nh := *fdb.Nexthop
+		checkEntries(t, "added vxlan l2 nexthop", Vxlan.translateAddedL2Nexthop(nh))
+		checkEntries(t, "added pod l2 nexthop", Pod.translateAddedL2Nexthop(nh))
+		checkEntries(t, "added vxlan fdb", Vxlan.translateAddedFdb(fdb))
+		checkEntries(t, "added pod fdb", Pod.translateAddedFdb(fdb))
+		checkEntries(t, "deleted vxlan fdb", Vxlan.translateDeletedFdb(fdb))
+		checkEntries(t, "deleted pod fdb", Pod.translateDeletedFdb(fdb))
+		checkEntries(t, "deleted vxlan l2 nexthop", Vxlan.translateDeletedL2Nexthop(nh))
+		checkEntries(t, "deleted pod l2 nexthop", Pod.translateDeletedL2Nexthop(nh))
+	})
+}
+
+func FuzzVrfDecoder(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{1, 0, 0, 0, 9, 1, 0, 0, 0, 10, 10, 0, 0, 1, 3, 1, 2, 3, 4, 5, 6})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzDecoders(t)
+		r := &fuzzReader{data: data}
+		vrf := r.vrf()
+		checkEntries(t, "added vrf", Vxlan.translateAddedVrf(vrf))
+		checkEntries(t, "deleted vrf", Vxlan.translateDeletedVrf(vrf))
+		lb := &infradb.LogicalBridge{Name: "//network.opiproject.org/bridges/lb", Spec: &infradb.LogicalBridgeSpec{
+			VlanID: uint32(r.intn(4096)),
+			Vni:    vrf.Spec.Vni,
+			VtepIP: vrf.Spec.VtepIP,
+		}}
+		checkEntries(t, "added logical bridge", Vxlan.translateAddedLb(lb))
+		checkEntries(t, "deleted logical bridge", Vxlan.translateDeletedLb(lb))
+	})
+}
@@ -0,0 +1,409 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"time"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// gnmiVersion version of the gnmi specification implemented
+const gnmiVersion = "0.7.0"
+
+// gnmiSampleInterval interval a stream subscription is sampled at when the
+// subscription does not set one, on change subscriptions are sampled at it
+// and only the changes are sent
+const gnmiSampleInterval = 10 * time.Second
+
+// gnmiServer serves the openconfig network-instances and interfaces trees
+// and sets the network-instances config
+type gnmiServer struct{}
+
+// RegisterGnmi registers the gnmi service on a grpc server
+func RegisterGnmi(s *grpc.Server) {
+	gnmi.RegisterGNMIServer(s, &gnmiServer{})
+}
+
+// ocRoot both openconfig trees, the value of the root path
+type ocRoot struct {
+	NetworkInstances OcNetworkInstances `json:"openconfig-network-instance:network-instances"`
+	Interfaces       OcInterfaces       `json:"openconfig-interfaces:interfaces"`
+}
+
+// gnmiElems joins the elements of the prefix and the path of a request
+func gnmiElems(prefix *gnmi.Path, p *gnmi.Path) []*gnmi.PathElem {
+	var elems []*gnmi.PathElem
+	if prefix != nil {
+		elems = append(elems, prefix.Elem...)
+	}
+	if p != nil {
+		elems = append(elems, p.Elem...)
+	}
+	return elems
+}
+
+// ocValue returns the openconfig node at a path, the root, the
+// network-instances and the interfaces containers and their list entries are
+// addressable
+func ocValue(elems []*gnmi.PathElem) (interface{}, error) {
+	if len(elems) == 0 {
+		return ocRoot{
+			NetworkInstances: OcNetworkInstanceTree().NetworkInstances,
+			Interfaces:       OcInterfaceTree().Interfaces,
+		}, nil
+	}
+	if len(elems) > 2 {
+		return nil, status.Errorf(codes.Unimplemented, "paths deeper than a list entry are not supported")
+	}
+	switch ocType(elems[0].Name) {
+	case "network-instances":
+		tree := OcNetworkInstanceTree().NetworkInstances
+		if len(elems) == 1 {
+			return tree, nil
+		}
+		if elems[1].Name != "network-instance" {
+			break
+		}
+		name, found := elems[1].Key["name"]
+		if !found {
+			return tree.NetworkInstance, nil
+		}
+		for _, ni := range tree.NetworkInstance {
+			if ni.Name == name {
+				return ni, nil
+			}
+		}
+		return nil, status.Errorf(codes.NotFound, "network-instance %s not found", name)
+	case "interfaces":
+		tree := OcInterfaceTree().Interfaces
+		if len(elems) == 1 {
+			return tree, nil
+		}
+		if elems[1].Name != "interface" {
+			break
+		}
+		name, found := elems[1].Key["name"]
+		if !found {
+			return tree.Interface, nil
+		}
+		for _, intf := range tree.Interface {
+			if intf.Name == name {
+				return intf, nil
+			}
+		}
+		return nil, status.Errorf(codes.NotFound, "interface %s not found", name)
+	}
+	return nil, status.Errorf(codes.NotFound, "path %v not found", elems)
+}
+
+// checkEncoding rejects the encodings other than json and json_ietf
+func checkEncoding(encoding gnmi.Encoding) error {
+	if encoding != gnmi.Encoding_JSON && encoding != gnmi.Encoding_JSON_IETF {
+		return status.Errorf(codes.Unimplemented, "encoding %s not supported", encoding)
+	}
+	return nil
+}
+
+// gnmiUpdate encodes the node at a path as an update
+func gnmiUpdate(prefix *gnmi.Path, p *gnmi.Path, encoding gnmi.Encoding) (*gnmi.Update, error) {
+	value, err := ocValue(gnmiElems(prefix, p))
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "encoding %v: %v", p, err)
+	}
+	update := &gnmi.Update{Path: p}
+	if encoding == gnmi.Encoding_JSON {
+		update.Val = &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonVal{JsonVal: data}}
+	} else {
+		update.Val = &gnmi.TypedValue{Value: &gnmi.TypedValue_JsonIetfVal{JsonIetfVal: data}}
+	}
+	return update, nil
+}
+
+// Capabilities returns the models and the encodings supported
+func (s *gnmiServer) Capabilities(_ context.Context, _ *gnmi.CapabilityRequest) (*gnmi.CapabilityResponse, error) {
+	return &gnmi.CapabilityResponse{
+		SupportedModels: []*gnmi.ModelData{
+			{Name: "openconfig-network-instance", Organization: "OpenConfig working group"},
+			{Name: "openconfig-interfaces", Organization: "OpenConfig working group"},
+		},
+		SupportedEncodings: []gnmi.Encoding{gnmi.Encoding_JSON_IETF, gnmi.Encoding_JSON},
+		GNMIVersion:        gnmiVersion,
+	}, nil
+}
+
+// Get returns a snapshot of the paths requested
+func (s *gnmiServer) Get(_ context.Context, req *gnmi.GetRequest) (*gnmi.GetResponse, error) {
+	if err := checkEncoding(req.Encoding); err != nil {
+		return nil, err
+	}
+	var notifications []*gnmi.Notification
+	for _, p := range req.Path {
+		update, err := gnmiUpdate(req.Prefix, p, req.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, &gnmi.Notification{
+			Timestamp: time.Now().UnixNano(),
+			Prefix:    req.Prefix,
+			Update:    []*gnmi.Update{update},
+		})
+	}
+	return &gnmi.GetResponse{Notification: notifications}, nil
+}
+
+// ocSetConfig decodes the value set at a path of the network-instances tree,
+// the root, the network-instances container, a network-instance and a
+// static route are settable, a nil value selects the node for a delete
+func ocSetConfig(elems []*gnmi.PathElem, data []byte) (OcNetworkInstancesConfig, error) {
+	var cfg OcNetworkInstancesConfig
+	var err error
+	switch {
+	case len(elems) == 0:
+		if data == nil {
+			return cfg, status.Errorf(codes.InvalidArgument, "delete the network-instances one by one")
+		}
+		err = json.Unmarshal(data, &cfg)
+	case ocType(elems[0].Name) != "network-instances":
+		return cfg, status.Errorf(codes.Unimplemented, "only the network-instances are settable")
+	case len(elems) == 1:
+		if data == nil {
+			return cfg, status.Errorf(codes.InvalidArgument, "delete the network-instances one by one")
+		}
+		err = json.Unmarshal(data, &cfg.NetworkInstances)
+	case len(elems) == 2 && elems[1].Name == "network-instance" && elems[1].Key["name"] != "":
+		var ni OcNetworkInstanceConfig
+		if data != nil {
+			err = json.Unmarshal(data, &ni)
+		}
+		ni.Name = elems[1].Key["name"]
+		cfg.NetworkInstances.NetworkInstance = append(cfg.NetworkInstances.NetworkInstance, ni)
+	case len(elems) == 6 && elems[1].Name == "network-instance" && elems[1].Key["name"] != "" &&
+		elems[2].Name == "protocols" && elems[3].Name == "protocol" && ocType(elems[3].Key["identifier"]) == "STATIC" &&
+		elems[4].Name == "static-routes" && elems[5].Name == "static" && elems[5].Key["prefix"] != "":
+		var static OcStaticConfig
+		if data != nil {
+			err = json.Unmarshal(data, &static)
+		}
+		static.Prefix = elems[5].Key["prefix"]
+		ni := OcNetworkInstanceConfig{Name: elems[1].Key["name"]}
+		protocol := OcProtocolConfig{Identifier: "STATIC", Name: elems[3].Key["name"]}
+		protocol.StaticRoutes.Static = append(protocol.StaticRoutes.Static, static)
+		ni.Protocols.Protocol = append(ni.Protocols.Protocol, protocol)
+		cfg.NetworkInstances.NetworkInstance = append(cfg.NetworkInstances.NetworkInstance, ni)
+	default:
+		return cfg, status.Errorf(codes.Unimplemented, "path %v is not settable", elems)
+	}
+	if err != nil {
+		return cfg, status.Errorf(codes.InvalidArgument, "decoding %v: %v", elems, err)
+	}
+	return cfg, nil
+}
+
+// gnmiSetValue returns the json encoded value of an update
+func gnmiSetValue(update *gnmi.Update) ([]byte, error) {
+	if data := update.GetVal().GetJsonIetfVal(); data != nil {
+		return data, nil
+	}
+	if data := update.GetVal().GetJsonVal(); data != nil {
+		return data, nil
+	}
+	return nil, status.Errorf(codes.InvalidArgument, "only json and json_ietf values are supported")
+}
+
+// Set applies the network-instances config, the deletes, the replaces and the
+// updates are processed in this order, a failing operation stops the request
+// leaving the ones before applied
+func (s *gnmiServer) Set(_ context.Context, req *gnmi.SetRequest) (*gnmi.SetResponse, error) {
+	var results []*gnmi.UpdateResult
+	for _, p := range req.Delete {
+		elems := gnmiElems(req.Prefix, p)
+		cfg, err := ocSetConfig(elems, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := DeleteOcNetworkInstances(cfg); err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		results = append(results, &gnmi.UpdateResult{Path: p, Op: gnmi.UpdateResult_DELETE})
+	}
+	for _, update := range req.Replace {
+		elems := gnmiElems(req.Prefix, update.Path)
+		data, err := gnmiSetValue(update)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := ocSetConfig(elems, data)
+		if err != nil {
+			return nil, err
+		}
+		if err := ReplaceOcNetworkInstances(cfg, len(elems) < 2); err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		results = append(results, &gnmi.UpdateResult{Path: update.Path, Op: gnmi.UpdateResult_REPLACE})
+	}
+	for _, update := range req.Update {
+		data, err := gnmiSetValue(update)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := ocSetConfig(gnmiElems(req.Prefix, update.Path), data)
+		if err != nil {
+			return nil, err
+		}
+		if err := ApplyOcNetworkInstances(cfg); err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
+		results = append(results, &gnmi.UpdateResult{Path: update.Path, Op: gnmi.UpdateResult_UPDATE})
+	}
+	log.Printf("intel-e2000: gnmi set of %d deletes, %d replaces and %d updates applied\n", len(req.Delete), len(req.Replace), len(req.Update))
+	return &gnmi.SetResponse{Prefix: req.Prefix, Response: results, Timestamp: time.Now().UnixNano()}, nil
+}
+
+// gnmiSubscription state of a subscription of a stream
+type gnmiSubscription struct {
+	sub      *gnmi.Subscription
+	interval time.Duration
+	next     time.Time
+	last     []byte
+}
+
+// sendSubscriptions sends the updates of the subscriptions due, the
+// subscriptions on change or suppressing redundant updates skip the values
+// not changed since the last update sent
+func sendSubscriptions(stream gnmi.GNMI_SubscribeServer, list *gnmi.SubscriptionList, subs []*gnmiSubscription, now time.Time, all bool) error {
+	var updates []*gnmi.Update
+	for _, sub := range subs {
+		if !all && now.Before(sub.next) {
+			continue
+		}
+		sub.next = now.Add(sub.interval)
+		update, err := gnmiUpdate(list.Prefix, sub.sub.Path, list.Encoding)
+		if err != nil {
+			return err
+		}
+		data := update.Val.GetJsonIetfVal()
+		if data == nil {
+			data = update.Val.GetJsonVal()
+		}
+		changeOnly := sub.sub.Mode == gnmi.SubscriptionMode_ON_CHANGE || sub.sub.SuppressRedundant
+		if !all && changeOnly && bytes.Equal(data, sub.last) {
+			continue
+		}
+		sub.last = data
+		updates = append(updates, update)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return stream.Send(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_Update{Update: &gnmi.Notification{
+		Timestamp: time.Now().UnixNano(),
+		Prefix:    list.Prefix,
+		Update:    updates,
+	}}})
+}
+
+// sendSync sends the sync response marking the end of the initial updates
+func sendSync(stream gnmi.GNMI_SubscribeServer) error {
+	return stream.Send(&gnmi.SubscribeResponse{Response: &gnmi.SubscribeResponse_SyncResponse{SyncResponse: true}})
+}
+
+// Subscribe serves once, poll and stream subscriptions, the stream
+// subscriptions are sampled
+func (s *gnmiServer) Subscribe(stream gnmi.GNMI_SubscribeServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	list := req.GetSubscribe()
+	if list == nil {
+		return status.Errorf(codes.InvalidArgument, "first request must be a subscription list")
+	}
+	if err := checkEncoding(list.Encoding); err != nil {
+		return err
+	}
+	var subs []*gnmiSubscription
+	for _, sub := range list.Subscription {
+		interval := time.Duration(sub.SampleInterval)
+		if interval == 0 || sub.Mode != gnmi.SubscriptionMode_SAMPLE {
+			interval = gnmiSampleInterval
+		}
+		subs = append(subs, &gnmiSubscription{sub: sub, interval: interval})
+	}
+	if len(subs) == 0 {
+		subs = append(subs, &gnmiSubscription{sub: &gnmi.Subscription{}, interval: gnmiSampleInterval})
+	}
+
+	if !list.UpdatesOnly {
+		if err := sendSubscriptions(stream, list, subs, time.Now(), true); err != nil {
+			return err
+		}
+	} else {
+		for _, sub := range subs {
+			sub.next = time.Now().Add(sub.interval)
+		}
+	}
+	if err := sendSync(stream); err != nil {
+		return err
+	}
+
+	switch list.Mode {
+	case gnmi.SubscriptionList_ONCE:
+		return nil
+	case gnmi.SubscriptionList_POLL:
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if req.GetPoll() == nil {
+				return status.Errorf(codes.InvalidArgument, "expected a poll request")
+			}
+			if err := sendSubscriptions(stream, list, subs, time.Now(), true); err != nil {
+				return err
+			}
+			if err := sendSync(stream); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("intel-e2000: gnmi stream subscription of %d paths started\n", len(subs))
+	tick := subs[0].interval
+	for _, sub := range subs {
+		if sub.interval < tick {
+			tick = sub.interval
+		}
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			log.Printf("intel-e2000: gnmi stream subscription ended: %v\n", stream.Context().Err())
+			return nil
+		case now := <-ticker.C:
+			if err := sendSubscriptions(stream, list, subs, now, false); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestOcSetConfig checks the gnmi set paths decode into the network-instances
+// config and the unsupported ones are rejected
+func TestOcSetConfig(t *testing.T) {
+	ni := &gnmi.PathElem{Name: "network-instance", Key: map[string]string{"name": "blue"}}
+	static := []*gnmi.PathElem{
+		{Name: "openconfig-network-instance:network-instances"}, ni,
+		{Name: "protocols"},
+		{Name: "protocol", Key: map[string]string{"identifier": "openconfig-policy-types:STATIC", "name": "static"}},
+		{Name: "static-routes"},
+		{Name: "static", Key: map[string]string{"prefix": "10.1.0.0/16"}},
+	}
+
+	cfg, err := ocSetConfig(static, []byte(`{"prefix":"10.1.0.0/16","next-hops":{"next-hop":[{"index":"1","config":{"next-hop":"192.168.1.1"}}]}}`))
+	if err != nil {
+		t.Fatalf("static route not settable: %v", err)
+	}
+	want := []StaticRoute{{Vrf: "blue", Prefix: "10.1.0.0/16", Nexthops: []string{"192.168.1.1"}}}
+	if got := cfg.NetworkInstances.NetworkInstance[0].staticRoutes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("static routes: got %+v, want %+v", got, want)
+	}
+
+	cfg, err = ocSetConfig(static, nil)
+	if err != nil {
+		t.Fatalf("static route not deletable: %v", err)
+	}
+	if got := cfg.NetworkInstances.NetworkInstance[0].staticRoutes(); len(got) != 1 || got[0].Prefix != "10.1.0.0/16" {
+		t.Errorf("deleted static routes: got %+v", got)
+	}
+
+	cfg, err = ocSetConfig(static[:2], []byte(`{"config":{"type":"openconfig-network-instance-types:L3VRF","opi-intel-e2000:vni":100}}`))
+	if err != nil {
+		t.Fatalf("network-instance not settable: %v", err)
+	}
+	if got := cfg.NetworkInstances.NetworkInstance[0]; got.Name != "blue" || got.Config.Vni == nil || *got.Config.Vni != 100 {
+		t.Errorf("network-instance: got %+v", got)
+	}
+
+	for _, elems := range [][]*gnmi.PathElem{nil, static[:1]} {
+		if _, err := ocSetConfig(elems, nil); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("delete of %v: got %v, want invalid argument", elems, err)
+		}
+	}
+	if _, err := ocSetConfig([]*gnmi.PathElem{{Name: "interfaces"}}, []byte(`{}`)); status.Code(err) != codes.Unimplemented {
+		t.Errorf("set of the interfaces: got %v, want unimplemented", err)
+	}
+	if _, err := ocSetConfig(static[:3], []byte(`{}`)); status.Code(err) != codes.Unimplemented {
+		t.Errorf("set of the protocols: got %v, want unimplemented", err)
+	}
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// grpcSteeringKey config key of the steering policy of the grpc pair
+const grpcSteeringKey = "grpcsteering"
+
+// hostPathSteer evpn p4 table name
+const hostPathSteer = "evpn_gw_control.host_path_steering_table"
+
+//                       Key {
+//                           vsi,                        // Exact
+//                           ip_proto                    // Exact
+//                       }
+//                       Actions(
+//                           fwd_to_port(port),
+//                           fwd_to_port_dscp(port, dscp),
+//                           drop()                      // default
+//                       )
+
+// GrpcSteering steering policy of the channel between the grpc_acc and the
+// grpc_host ports. With protocols the ip frames of the pair are steered
+// through the host path steering table and only the protocols listed reach
+// the peer, marked with the dscp when not zero. The rate in kbit/s shapes
+// each port of the pair on the meter indexed by its vsi, zero leaves it
+// unlimited, the burst is in bytes
+type GrpcSteering struct {
+	Protocols []string `yaml:"protocols" json:"protocols"`
+	Dscp      uint32   `yaml:"dscp" json:"dscp"`
+	Meter     string   `yaml:"meter" json:"meter"`
+	Rate      int64    `yaml:"rate" json:"rate"`
+	Burst     int64    `yaml:"burst" json:"burst"`
+	protos    []uint16
+}
+
+// ipProtocols ip protocol numbers by name
+var ipProtocols = map[string]uint16{
+	"icmp":   1,
+	"tcp":    6,
+	"udp":    17,
+	"icmpv6": 58,
+	"sctp":   132,
+}
+
+// readGrpcSteering reads the steering policy of the grpc pair, the invalid
+// protocols and dscp are ignored
+func readGrpcSteering() GrpcSteering {
+	var cfg GrpcSteering
+	if err := viper.UnmarshalKey(grpcSteeringKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read grpc steering config: %v\n", err)
+		return GrpcSteering{}
+	}
+	seen := make(map[uint16]bool)
+	for _, name := range cfg.Protocols {
+		proto, ok := ipProtocols[strings.ToLower(name)]
+		if !ok {
+			n, err := strconv.ParseUint(name, 10, 8)
+			if err != nil {
+				log.Printf("intel-e2000: Ignoring unknown grpc steering protocol %q\n", name)
+				continue
+			}
+			proto = uint16(n)
+		}
+		if !seen[proto] {
+			seen[proto] = true
+			cfg.protos = append(cfg.protos, proto)
+		}
+	}
+	if cfg.Dscp > 63 {
+		log.Printf("intel-e2000: Ignoring invalid grpc steering dscp %d\n", cfg.Dscp)
+		cfg.Dscp = 0
+	}
+	return cfg
+}
+
+// steered checks the ip frames of the pair go through the steering table
+func (g GrpcSteering) steered() bool {
+	return len(g.protos) != 0
+}
+
+// _grpcIngressAction returns the action of the svi ingress entry of a grpc
+// port, the frames are handed over to the steering table when steered
+func (l L3Decoder) _grpcIngressAction(peerVsi int) p4client.Action {
+	if l._grpcSteering.steered() {
+		return p4client.Action{ActionName: "evpn_gw_control.host_path_steer"}
+	}
+	return p4client.Action{
+		ActionName: "evpn_gw_control.fwd_to_port",
+		Params:     []interface{}{uint32(_toEgressVsi(peerVsi))},
+	}
+}
+
+// _grpcSteeringEntries returns the steering entries of a grpc port, one per
+// protocol allowed
+func (l L3Decoder) _grpcSteeringEntries(port GrpcPairPort, peerVsi int, add bool) []interface{} {
+	var entries = make([]interface{}, 0)
+	for _, proto := range l._grpcSteering.protos {
+		entry := p4client.TableEntry{
+			Tablename: hostPathSteer,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"vsi":      {uint16(port.vsi), "exact"},
+					"ip_proto": {proto, "exact"},
+				},
+				Priority: int32(0),
+			},
+		}
+		if add {
+			entry.Action = p4client.Action{
+				ActionName: "evpn_gw_control.fwd_to_port",
+				Params:     []interface{}{uint32(_toEgressVsi(peerVsi))},
+			}
+			if l._grpcSteering.Dscp != 0 {
+				entry.Action = p4client.Action{
+					ActionName: "evpn_gw_control.fwd_to_port_dscp",
+					Params:     []interface{}{uint32(_toEgressVsi(peerVsi)), uint16(l._grpcSteering.Dscp)},
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// applyGrpcSteering programs the shapers of the grpc pair, the shapers the
+// previous policy set and the current one drops are reset
+func applyGrpcSteering(previous L3Decoder, current L3Decoder) {
+	for _, port := range previous._grpcPorts {
+		g := previous._grpcSteering
+		if g.Rate == 0 || g.Meter == "" || (current._grpcSteering.Rate != 0 && current._grpcSteering.Meter == g.Meter) {
+			continue
+		}
+		if err := p4client.SetMeter(g.Meter, int64(port.vsi), nil); err != nil {
+			log.Printf("intel-e2000: failed to reset %s of grpc port %d: %v\n", g.Meter, port.vsi, err)
+		}
+	}
+	g := current._grpcSteering
+	if g.Rate == 0 {
+		return
+	}
+	if g.Meter == "" {
+		log.Println("intel-e2000: no meter configured to rate limit the grpc pair")
+		return
+	}
+	for _, port := range current._grpcPorts {
+		if err := p4client.SetMeter(g.Meter, int64(port.vsi), meterConfig(g.Rate, g.Burst)); err != nil {
+			log.Printf("intel-e2000: failed to rate limit grpc port %d on %s: %v\n", port.vsi, g.Meter, err)
+			continue
+		}
+		log.Printf("intel-e2000: Rate limited grpc port %d to %d kbit/s\n", port.vsi, g.Rate)
+	}
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Readiness readiness of the intel-e2000 dataplane
+type Readiness struct {
+	Ready          bool   `json:"ready"`
+	P4Connected    bool   `json:"p4connected"`
+	StaticVerified bool   `json:"staticverified"`
+	StaticMissing  int    `json:"staticmissing"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+var (
+	// healthLock guards the readiness
+	healthLock sync.Mutex
+
+	// readiness readiness of the dataplane
+	readiness = Readiness{Reason: "p4runtime connection not established"}
+)
+
+// setP4Connected records the p4runtime connection was established
+func setP4Connected(connected bool) {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	readiness.P4Connected = connected
+	readiness.updateReason()
+}
+
+// setStaticVerified records the outcome of the static entries verification
+func setStaticVerified(missing int) {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	readiness.StaticVerified = missing == 0
+	readiness.StaticMissing = missing
+	readiness.updateReason()
+}
+
+// updateReason derives the readiness and its reason
+func (r *Readiness) updateReason() {
+	r.Ready = r.P4Connected && r.StaticVerified
+	switch {
+	case !r.P4Connected:
+		r.Reason = "p4runtime connection not established"
+	case !r.StaticVerified:
+		r.Reason = "static entries not verified on the device"
+	default:
+		r.Reason = ""
+	}
+}
+
+// missingEntries reads the tables of the entries back from the device and
+// returns the entries not programmed, each table is read once
+func missingEntries(entries []interface{}) ([]p4client.TableEntry, error) {
+	var missing []p4client.TableEntry
+	programmed := make(map[string][]*p4_v1.TableEntry)
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			continue
+		}
+		exists, err := entryProgrammed(e, programmed)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			missing = append(missing, e)
+		}
+	}
+	return missing, nil
+}
+
+// verifyStaticAdditions checks the static entries are programmed on the device
+// and updates the readiness, the caller holds the decoder lock
+func verifyStaticAdditions() {
+	var entries []interface{}
+	entries = append(entries, L3.StaticAdditions()...)
+	entries = append(entries, Pod.StaticAdditions()...)
+	missing, err := missingEntries(entries)
+	if err != nil {
+		log.Printf("intel-e2000: Failed to verify static entries: %v\n", err)
+		setStaticVerified(len(entries))
+		return
+	}
+	for _, e := range missing {
+		log.Printf("intel-e2000: Static entry missing in %s: %+v\n", e.Tablename, e.TableField.FieldValue)
+	}
+	setStaticVerified(len(missing))
+}
+
+// p4Alive checks the p4runtime connection is not broken
+func p4Alive() bool {
+	if Conn == nil || p4client.ChaosDisconnected() {
+		return false
+	}
+	state := Conn.GetState()
+	return state != connectivity.TransientFailure && state != connectivity.Shutdown
+}
+
+// GetReadiness returns the readiness of the dataplane
+func GetReadiness() Readiness {
+	healthLock.Lock()
+	defer healthLock.Unlock()
+	return readiness
+}
+
+// Readyz reports ready once the p4runtime connection is established and the
+// static entries are verified on the device
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	ready := GetReadiness()
+	if ready.Ready && !p4Alive() {
+		ready.Ready = false
+		ready.Reason = "p4runtime connection lost"
+	}
+	code := http.StatusOK
+	if !ready.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, ready)
+}
+
+// Healthz reports healthy unless the p4runtime connection once established
+// was lost
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	if GetReadiness().P4Connected && !p4Alive() {
+		http.Error(w, "p4runtime connection lost", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
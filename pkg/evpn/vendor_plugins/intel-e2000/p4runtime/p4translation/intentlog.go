@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/subscriberframework/eventbus"
+	"github.com/spf13/viper"
+)
+
+// intentLogKey config key of the write-ahead intent log path
+const intentLogKey = "intentlog.path"
+
+// intent operations
+const (
+	intentAdd    = "add"
+	intentDelete = "delete"
+)
+
+// Intent object event persisted before its device writes are issued
+type Intent struct {
+	Seq             uint64    `json:"seq"`
+	Kind            string    `json:"kind"`
+	Name            string    `json:"name"`
+	Op              string    `json:"op"`
+	ResourceVersion string    `json:"resourceversion"`
+	NotificationID  string    `json:"notificationid"`
+	Time            time.Time `json:"time"`
+}
+
+// intentRecord line of the intent log, an intent or the ack of one
+type intentRecord struct {
+	Intent *Intent `json:"intent,omitempty"`
+	Ack    uint64  `json:"ack,omitempty"`
+}
+
+var (
+	// intentLock guards the intent log
+	intentLock sync.Mutex
+
+	// intentFile intent log opened for append, nil when disabled
+	intentFile *os.File
+
+	// intentSeq sequence number of the last intent
+	intentSeq uint64
+
+	// pendingIntents intents not acknowledged yet keyed by sequence number
+	pendingIntents = make(map[uint64]Intent)
+)
+
+// intentOp returns the operation the event carries for the object
+func intentOp(kind string, name string) string {
+	deleted := false
+	switch kind {
+	case "vrf":
+		if vrf, err := infradb.GetVrf(name); err == nil {
+			deleted = vrf.Status.VrfOperStatus == infradb.VrfOperStatusToBeDeleted
+		}
+	case "logical-bridge":
+		if lb, err := infradb.GetLB(name); err == nil {
+			deleted = lb.Status.LBOperStatus == infradb.LogicalBridgeOperStatusToBeDeleted
+		}
+	case "bridge-port":
+		if bp, err := infradb.GetBP(name); err == nil {
+			deleted = bp.Status.BPOperStatus == infradb.BridgePortOperStatusToBeDeleted
+		}
+	case "svi":
+		if svi, err := infradb.GetSvi(name); err == nil {
+			deleted = svi.Status.SviOperStatus == infradb.SviOperStatusToBeDeleted
+		}
+	}
+	if deleted {
+		return intentDelete
+	}
+	return intentAdd
+}
+
+// appendIntentRecord writes a record to the intent log and syncs it to disk
+func appendIntentRecord(record intentRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := intentFile.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return intentFile.Sync()
+}
+
+// logIntent persists the intent of an object event, it returns the sequence
+// number to acknowledge once the event is handled, zero when the log is off
+func logIntent(kind string, objectData *eventbus.ObjectData) uint64 {
+	intentLock.Lock()
+	defer intentLock.Unlock()
+	if intentFile == nil {
+		return 0
+	}
+	intentSeq++
+	intent := Intent{
+		Seq:             intentSeq,
+		Kind:            kind,
+		Name:            objectData.Name,
+		Op:              intentOp(kind, objectData.Name),
+		ResourceVersion: objectData.ResourceVersion,
+		NotificationID:  objectData.NotificationID,
+		Time:            time.Now(),
+	}
+	if err := appendIntentRecord(intentRecord{Intent: &intent}); err != nil {
+		log.Printf("intel-e2000: Failed to log intent %s %s %s: %v\n", intent.Op, kind, intent.Name, err)
+		return 0
+	}
+	pendingIntents[intent.Seq] = intent
+	return intent.Seq
+}
+
+// ackIntent acknowledges a handled intent, the log is truncated once no
+// intent is pending anymore
+func ackIntent(seq uint64) {
+	if seq == 0 {
+		return
+	}
+	intentLock.Lock()
+	defer intentLock.Unlock()
+	if intentFile == nil {
+		return
+	}
+	delete(pendingIntents, seq)
+	if len(pendingIntents) == 0 && intentFile.Truncate(0) == nil {
+		return
+	}
+	if err := appendIntentRecord(intentRecord{Ack: seq}); err != nil {
+		log.Printf("intel-e2000: Failed to acknowledge intent %d: %v\n", seq, err)
+	}
+}
+
+// readIntents reads the intents of the log not acknowledged
+func readIntents(file *os.File) []Intent {
+	pending := make(map[uint64]Intent)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record intentRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// the last record may be torn by the crash
+			log.Printf("intel-e2000: Skipping corrupt intent record: %v\n", err)
+			continue
+		}
+		if record.Intent != nil {
+			pending[record.Intent.Seq] = *record.Intent
+		} else {
+			delete(pending, record.Ack)
+		}
+	}
+	var intents = make([]Intent, 0, len(pending))
+	for _, intent := range pending {
+		intents = append(intents, intent)
+	}
+	sort.Slice(intents, func(i, j int) bool { return intents[i].Seq < intents[j].Seq })
+	return intents
+}
+
+// openIntentLog opens the intent log and returns the intents left
+// unacknowledged by the previous run, they stay pending until replayed
+func openIntentLog() []Intent {
+	path := viper.GetString(intentLogKey)
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		log.Printf("intel-e2000: Failed to create intent log directory: %v\n", err)
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		log.Printf("intel-e2000: Failed to open intent log %s: %v\n", path, err)
+		return nil
+	}
+	intents := readIntents(file)
+	intentLock.Lock()
+	intentFile = file
+	for _, intent := range intents {
+		pendingIntents[intent.Seq] = intent
+		if intent.Seq > intentSeq {
+			intentSeq = intent.Seq
+		}
+	}
+	intentLock.Unlock()
+	return intents
+}
+
+// replayIntents handles again the intents interrupted by a crash, the
+// handlers read the object back from infradb so the current state is applied
+func replayIntents(intents []Intent) {
+	for _, intent := range intents {
+		log.Printf("intel-e2000: Replaying %s %s %s interrupted at %v\n", intent.Op, intent.Kind, intent.Name, intent.Time)
+		objectData := &eventbus.ObjectData{
+			Name:            intent.Name,
+			ResourceVersion: intent.ResourceVersion,
+			NotificationID:  intent.NotificationID,
+		}
+		decoderLock.RLock()
+		handleObjectEvent(intent.Kind, objectData)
+		decoderLock.RUnlock()
+		ackIntent(intent.Seq)
+	}
+}
+
+// closeIntentLog closes the intent log, the intents pending are kept
+func closeIntentLog() {
+	intentLock.Lock()
+	defer intentLock.Unlock()
+	if intentFile != nil {
+		_ = intentFile.Close()
+		intentFile = nil
+	}
+}
+
+// PendingIntents returns the intents not acknowledged yet
+func PendingIntents() []Intent {
+	intentLock.Lock()
+	defer intentLock.Unlock()
+	var intents = make([]Intent, 0, len(pendingIntents))
+	for _, intent := range pendingIntents {
+		intents = append(intents, intent)
+	}
+	sort.Slice(intents, func(i, j int) bool { return intents[i].Seq < intents[j].Seq })
+	return intents
+}
@@ -0,0 +1,375 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// ipfixKey config key of the ipfix section
+const ipfixKey = "ipfix"
+
+// IpfixConfig ipfix export config structure. The routes within the prefixes
+// have their counters enabled, every interval seconds their byte and packet
+// deltas are sent to the collector as ipfix option records of the domain
+type IpfixConfig struct {
+	Collector string   `yaml:"collector"`
+	Interval  int      `yaml:"interval"`
+	Domain    uint32   `yaml:"domain"`
+	Prefixes  []string `yaml:"prefixes"`
+	prefixes  []*net.IPNet
+}
+
+// IpfixStats ipfix export statistics
+type IpfixStats struct {
+	Collector  string    `json:"collector"`
+	Routes     int       `json:"routes"`
+	Messages   uint64    `json:"messages"`
+	Records    uint64    `json:"records"`
+	Errors     uint64    `json:"errors"`
+	LastExport time.Time `json:"lastexport,omitempty"`
+	LastError  string    `json:"lasterror,omitempty"`
+}
+
+// ipfix protocol constants, the option templates scope the counters by vrf
+// and destination prefix
+const (
+	ipfixVersion        = 10
+	ipfixHeaderLen      = 16
+	ipfixOptionsSetID   = 3
+	ipfixTemplateV4     = 256
+	ipfixTemplateV6     = 257
+	ipfixMaxMessage     = 1400
+	ieOctetDeltaCount   = 1
+	iePacketDeltaCount  = 2
+	ieDstV4PrefixLen    = 29
+	ieDstV6PrefixLen    = 30
+	ieDstV4Prefix       = 44
+	ieDstV6Prefix       = 45
+	ieIngressVrfID      = 234
+	ieFlowStartMillisec = 152
+	ieFlowEndMillisec   = 153
+)
+
+// meteredRoute route whose counters are exported with the counters read at
+// the previous export
+type meteredRoute struct {
+	vrfID   uint32
+	prefix  *net.IPNet
+	entries []interface{}
+	packets int64
+	bytes   int64
+	read    time.Time
+}
+
+// ipfixRecord counter deltas of a route over an export interval
+type ipfixRecord struct {
+	vrfID   uint32
+	prefix  *net.IPNet
+	packets int64
+	bytes   int64
+	start   time.Time
+	end     time.Time
+}
+
+var (
+	// ipfixLock guards the metered routes and the export state
+	ipfixLock sync.Mutex
+
+	// ipfixCfg ipfix export config
+	ipfixCfg IpfixConfig
+
+	// meteredRoutes routes with their counters enabled keyed by route key
+	meteredRoutes = make(map[nm.RouteKey]*meteredRoute)
+
+	// ipfixStats ipfix export statistics
+	ipfixStats IpfixStats
+
+	// ipfixSequence sequence number of the data records exported
+	ipfixSequence uint32
+
+	// ipfixDone stops the ipfix export
+	ipfixDone chan struct{}
+)
+
+// loadIpfixConfig reads the ipfix export config
+func loadIpfixConfig() IpfixConfig {
+	cfg := IpfixConfig{}
+	if err := viper.UnmarshalKey(ipfixKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read ipfix config: %v\n", err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 60
+	}
+	for _, p := range cfg.Prefixes {
+		_, prefix, err := net.ParseCIDR(p)
+		if err != nil {
+			log.Printf("intel-e2000: Ignoring invalid ipfix prefix %q\n", p)
+			continue
+		}
+		cfg.prefixes = append(cfg.prefixes, prefix)
+	}
+	return cfg
+}
+
+// counted checks the prefix lies within a prefix with counters enabled
+func (c IpfixConfig) counted(dst *net.IPNet) bool {
+	if dst == nil {
+		return false
+	}
+	ones, bits := dst.Mask.Size()
+	for _, prefix := range c.prefixes {
+		pOnes, pBits := prefix.Mask.Size()
+		if pBits == bits && ones >= pOnes && prefix.Contains(dst.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// meterRoute enables the counters of a route programmed with the entries
+func meterRoute(route nm.RouteStruct, entries []interface{}) {
+	ipfixLock.Lock()
+	defer ipfixLock.Unlock()
+	if ipfixCfg.Collector == "" || !ipfixCfg.counted(route.Route0.Dst) {
+		return
+	}
+	metered := _probeEntries(entries)
+	if len(metered) == 0 {
+		delete(meteredRoutes, route.Key)
+		return
+	}
+	m := &meteredRoute{prefix: route.Route0.Dst, entries: metered, read: time.Now()}
+	if route.Vrf != nil {
+		m.vrfID = _routeTable(route)
+	}
+	if old, found := meteredRoutes[route.Key]; found {
+		// Keep counting from the previous read, the deltas span the update
+		m.packets, m.bytes, m.read = old.packets, old.bytes, old.read
+	}
+	meteredRoutes[route.Key] = m
+}
+
+// unmeterRoute drops the counters of a route withdrawn
+func unmeterRoute(key nm.RouteKey) {
+	ipfixLock.Lock()
+	defer ipfixLock.Unlock()
+	delete(meteredRoutes, key)
+}
+
+// readMeteredRoutes reads the counters of the metered routes and returns the
+// deltas since the previous read, a counter found lower than at the previous
+// read was reset by a rewrite of its entry and counts from zero
+func readMeteredRoutes() []ipfixRecord {
+	ipfixLock.Lock()
+	metered := make(map[nm.RouteKey]*meteredRoute, len(meteredRoutes))
+	for key, m := range meteredRoutes {
+		metered[key] = m
+	}
+	ipfixLock.Unlock()
+
+	var records []ipfixRecord
+	for key, m := range metered {
+		packets, bytes := sumCounters(m.entries)
+		now := time.Now()
+		ipfixLock.Lock()
+		if meteredRoutes[key] != m {
+			// Withdrawn while read
+			ipfixLock.Unlock()
+			continue
+		}
+		r := ipfixRecord{vrfID: m.vrfID, prefix: m.prefix, packets: packets - m.packets, bytes: bytes - m.bytes, start: m.read, end: now}
+		if packets < m.packets || bytes < m.bytes {
+			r.packets, r.bytes = packets, bytes
+		}
+		m.packets, m.bytes, m.read = packets, bytes, now
+		ipfixLock.Unlock()
+		if r.packets > 0 || r.bytes > 0 {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// ipfixOptionsTemplates encodes the options template set of the v4 and v6
+// records
+func ipfixOptionsTemplates() []byte {
+	template := func(id uint16, prefix uint16, prefixLen uint16, size uint16) []byte {
+		fields := [][2]uint16{
+			{ieIngressVrfID, 4}, {prefix, size}, {prefixLen, 1},
+			{ieOctetDeltaCount, 8}, {iePacketDeltaCount, 8},
+			{ieFlowStartMillisec, 8}, {ieFlowEndMillisec, 8},
+		}
+		b := binary.BigEndian.AppendUint16(nil, id)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(fields)))
+		b = binary.BigEndian.AppendUint16(b, 3)
+		for _, f := range fields {
+			b = binary.BigEndian.AppendUint16(b, f[0])
+			b = binary.BigEndian.AppendUint16(b, f[1])
+		}
+		return b
+	}
+	body := append(template(ipfixTemplateV4, ieDstV4Prefix, ieDstV4PrefixLen, 4),
+		template(ipfixTemplateV6, ieDstV6Prefix, ieDstV6PrefixLen, 16)...)
+	set := binary.BigEndian.AppendUint16(nil, ipfixOptionsSetID)
+	set = binary.BigEndian.AppendUint16(set, uint16(4+len(body)))
+	return append(set, body...)
+}
+
+// encode encodes the record in the layout of its template
+func (r ipfixRecord) encode() (uint16, []byte) {
+	id := uint16(ipfixTemplateV6)
+	ip := r.prefix.IP.To16()
+	if v4 := r.prefix.IP.To4(); v4 != nil {
+		id, ip = ipfixTemplateV4, v4
+	}
+	ones, _ := r.prefix.Mask.Size()
+	b := binary.BigEndian.AppendUint32(nil, r.vrfID)
+	b = append(b, ip...)
+	b = append(b, uint8(ones))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.bytes))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.packets))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.start.UnixMilli()))
+	b = binary.BigEndian.AppendUint64(b, uint64(r.end.UnixMilli()))
+	return id, b
+}
+
+// encodeIpfix encodes the records in messages fitting a datagram, each
+// message carries the templates so a collector restarted decodes the next one
+func encodeIpfix(records []ipfixRecord, domain uint32, sequence uint32, now time.Time) ([][]byte, uint32) {
+	templates := ipfixOptionsTemplates()
+	var messages [][]byte
+	var sets = make(map[uint16][]byte)
+	var order []uint16
+	var size = ipfixHeaderLen + len(templates)
+	var count uint32
+	flush := func() {
+		msg := make([]byte, ipfixHeaderLen, size)
+		msg = append(msg, templates...)
+		for _, id := range order {
+			msg = binary.BigEndian.AppendUint16(msg, id)
+			msg = binary.BigEndian.AppendUint16(msg, uint16(4+len(sets[id])))
+			msg = append(msg, sets[id]...)
+		}
+		binary.BigEndian.PutUint16(msg[0:], ipfixVersion)
+		binary.BigEndian.PutUint16(msg[2:], uint16(len(msg)))
+		binary.BigEndian.PutUint32(msg[4:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(msg[8:], sequence)
+		binary.BigEndian.PutUint32(msg[12:], domain)
+		messages = append(messages, msg)
+		sequence += count
+		sets, order, size, count = make(map[uint16][]byte), nil, ipfixHeaderLen+len(templates), 0
+	}
+	for _, r := range records {
+		id, b := r.encode()
+		grow := len(b)
+		if _, found := sets[id]; !found {
+			grow += 4
+		}
+		if count > 0 && size+grow > ipfixMaxMessage {
+			flush()
+			grow = len(b) + 4
+		}
+		if _, found := sets[id]; !found {
+			order = append(order, id)
+		}
+		sets[id] = append(sets[id], b...)
+		size += grow
+		count++
+	}
+	if count > 0 {
+		flush()
+	}
+	return messages, sequence
+}
+
+// exportIpfix sends the counter deltas of the metered routes to the collector
+func exportIpfix(conn net.Conn, domain uint32) {
+	records := readMeteredRoutes()
+	ipfixLock.Lock()
+	messages, sequence := encodeIpfix(records, domain, ipfixSequence, time.Now())
+	ipfixSequence = sequence
+	ipfixLock.Unlock()
+	var sent uint64
+	var err error
+	for _, msg := range messages {
+		if _, err = conn.Write(msg); err != nil {
+			break
+		}
+		sent++
+	}
+	ipfixLock.Lock()
+	defer ipfixLock.Unlock()
+	ipfixStats.Messages += sent
+	ipfixStats.LastExport = time.Now()
+	if err != nil {
+		ipfixStats.Errors++
+		ipfixStats.LastError = err.Error()
+		log.Printf("intel-e2000: Failed to export ipfix records to %s: %v\n", ipfixCfg.Collector, err)
+		return
+	}
+	ipfixStats.Records += uint64(len(records))
+}
+
+// startIpfixExport starts the periodic export of the route counters
+func startIpfixExport() {
+	cfg := loadIpfixConfig()
+	ipfixLock.Lock()
+	ipfixCfg = cfg
+	ipfixStats = IpfixStats{Collector: cfg.Collector}
+	ipfixLock.Unlock()
+	if cfg.Collector == "" || len(cfg.prefixes) == 0 {
+		return
+	}
+	conn, err := net.Dial("udp", cfg.Collector)
+	if err != nil {
+		log.Printf("intel-e2000: Failed to reach ipfix collector %s: %v\n", cfg.Collector, err)
+		ipfixLock.Lock()
+		ipfixCfg.Collector = ""
+		ipfixLock.Unlock()
+		return
+	}
+	ipfixDone = make(chan struct{})
+	done := ipfixDone
+	go func() {
+		defer conn.Close()
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				exportIpfix(conn, cfg.Domain)
+			case <-done:
+				return
+			}
+		}
+	}()
+	log.Printf("intel-e2000: Ipfix export to %s started, every %ds\n", cfg.Collector, cfg.Interval)
+}
+
+// stopIpfixExport stops the export of the route counters
+func stopIpfixExport() {
+	if ipfixDone != nil {
+		close(ipfixDone)
+		ipfixDone = nil
+	}
+}
+
+// GetIpfixStats returns the ipfix export statistics
+func GetIpfixStats() IpfixStats {
+	ipfixLock.Lock()
+	defer ipfixLock.Unlock()
+	stats := ipfixStats
+	stats.Routes = len(meteredRoutes)
+	return stats
+}
@@ -0,0 +1,255 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
+)
+
+// ipSourceGuardKey config key of the ip source guard bindings
+const ipSourceGuardKey = "ipsourceguard"
+
+// IPSourceBinding ip and mac a bridge port is allowed to claim, a bridge port
+// with bindings only gets the neighbors matching one of them offloaded
+type IPSourceBinding struct {
+	BridgePort string `yaml:"bridgeport" json:"bridgeport"`
+	IP         string `yaml:"ip" json:"ip"`
+	Mac        string `yaml:"mac" json:"mac"`
+}
+
+// IPGuardStats ip source guard violations of a bridge port
+type IPGuardStats struct {
+	BridgePort string    `json:"bridgeport"`
+	Violations uint64    `json:"violations"`
+	LastIP     string    `json:"lastip"`
+	LastMac    string    `json:"lastmac"`
+	LastTime   time.Time `json:"lasttime"`
+}
+
+var (
+	// ipGuardLock guards the bindings, statistics and blocked nexthops
+	ipGuardLock sync.Mutex
+
+	// configuredBindings bindings of the config file keyed by bridge port and ip
+	configuredBindings = make(map[string]map[string]string)
+
+	// apiBindings bindings added through the api keyed by bridge port and ip
+	apiBindings = make(map[string]map[string]string)
+
+	// ipGuardStats violations keyed by bridge port
+	ipGuardStats = make(map[string]*IPGuardStats)
+
+	// blockedNexthops nexthops of spoofed neighbors kept off the device
+	blockedNexthops = make(map[nm.NexthopKey]bool)
+)
+
+// normalize validates the binding and returns it in canonical notation
+func (b IPSourceBinding) normalize() (IPSourceBinding, error) {
+	ip := net.ParseIP(b.IP)
+	if ip == nil {
+		return b, fmt.Errorf("invalid binding ip %q", b.IP)
+	}
+	mac, err := net.ParseMAC(b.Mac)
+	if err != nil {
+		return b, fmt.Errorf("invalid binding mac %q", b.Mac)
+	}
+	if b.BridgePort == "" {
+		return b, fmt.Errorf("binding of %s needs a bridge port", b.IP)
+	}
+	return IPSourceBinding{BridgePort: path.Base(b.BridgePort), IP: ip.String(), Mac: mac.String()}, nil
+}
+
+// addBinding stores the binding in the bindings map
+func addBinding(bindings map[string]map[string]string, b IPSourceBinding) {
+	if bindings[b.BridgePort] == nil {
+		bindings[b.BridgePort] = make(map[string]string)
+	}
+	bindings[b.BridgePort][b.IP] = b.Mac
+}
+
+// loadIPSourceGuardConfig reads the ip source guard bindings of the config file
+func loadIPSourceGuardConfig() {
+	var cfg []IPSourceBinding
+	if err := viper.UnmarshalKey(ipSourceGuardKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read ip source guard config: %v\n", err)
+		return
+	}
+	bindings := make(map[string]map[string]string)
+	for _, b := range cfg {
+		binding, err := b.normalize()
+		if err != nil {
+			log.Printf("intel-e2000: Ignoring ip source guard binding: %v\n", err)
+			continue
+		}
+		addBinding(bindings, binding)
+	}
+	ipGuardLock.Lock()
+	configuredBindings = bindings
+	ipGuardLock.Unlock()
+}
+
+// AddIPSourceBinding allows a bridge port to claim an ip with a mac, it applies
+// to the neighbors learnt from now on
+func AddIPSourceBinding(b IPSourceBinding) error {
+	binding, err := b.normalize()
+	if err != nil {
+		return fmt.Errorf("intel-e2000: %v", err)
+	}
+	ipGuardLock.Lock()
+	addBinding(apiBindings, binding)
+	ipGuardLock.Unlock()
+	log.Printf("intel-e2000: Bound ip %s mac %s to bridge port %s\n", binding.IP, binding.Mac, binding.BridgePort)
+	return nil
+}
+
+// DeleteIPSourceBinding removes a binding added through the api
+func DeleteIPSourceBinding(b IPSourceBinding) error {
+	binding, err := b.normalize()
+	if err != nil {
+		return fmt.Errorf("intel-e2000: %v", err)
+	}
+	ipGuardLock.Lock()
+	defer ipGuardLock.Unlock()
+	if _, ok := apiBindings[binding.BridgePort][binding.IP]; !ok {
+		return fmt.Errorf("intel-e2000: no binding of ip %s on bridge port %s", binding.IP, binding.BridgePort)
+	}
+	delete(apiBindings[binding.BridgePort], binding.IP)
+	if len(apiBindings[binding.BridgePort]) == 0 {
+		delete(apiBindings, binding.BridgePort)
+	}
+	log.Printf("intel-e2000: Unbound ip %s from bridge port %s\n", binding.IP, binding.BridgePort)
+	return nil
+}
+
+// IPSourceBindings returns the bindings of the config file and of the api
+func IPSourceBindings() []IPSourceBinding {
+	ipGuardLock.Lock()
+	defer ipGuardLock.Unlock()
+	var bindings = make([]IPSourceBinding, 0)
+	for _, source := range []map[string]map[string]string{configuredBindings, apiBindings} {
+		for bp, ips := range source {
+			for ip, mac := range ips {
+				bindings = append(bindings, IPSourceBinding{BridgePort: bp, IP: ip, Mac: mac})
+			}
+		}
+	}
+	return bindings
+}
+
+// ipBound checks the ip and mac against the bindings of a bridge port, a
+// bridge port without bindings is not guarded
+func ipBound(bp, ip, mac string) bool {
+	ipGuardLock.Lock()
+	defer ipGuardLock.Unlock()
+	configured, api := configuredBindings[bp], apiBindings[bp]
+	if len(configured) == 0 && len(api) == 0 {
+		return true
+	}
+	if bound, ok := configured[ip]; ok && bound == mac {
+		return true
+	}
+	if bound, ok := api[ip]; ok && bound == mac {
+		return true
+	}
+	return false
+}
+
+// dropNeighbor removes the kernel neighbor of a spoofed ip
+func dropNeighbor(nexthop nm.NexthopStruct) error {
+	if nexthop.Neighbor == nil {
+		return nil
+	}
+	neigh := nexthop.Neighbor.Neigh0
+	family := netlink.FAMILY_V4
+	if neigh.IP.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+	return netlink.NeighDel(&netlink.Neigh{
+		LinkIndex: neigh.LinkIndex,
+		IP:        neigh.IP,
+		Family:    family,
+	})
+}
+
+// spoofedNexthop checks the neighbor of an svi nexthop against the bindings
+// of the bridge port it was learnt on, a violation is counted, dropped from
+// the kernel and kept off the device
+func spoofedNexthop(nexthop nm.NexthopStruct) bool {
+	if nexthop.NhType != nm.SVI {
+		return false
+	}
+	vport, ok := nexthop.Metadata["egress_vport"].(string)
+	if !ok {
+		return false
+	}
+	mac, ok := nexthop.Metadata["dmac"].(string)
+	if !ok {
+		return false
+	}
+	bp, ok := bpOfVport(vport)
+	if !ok {
+		return false
+	}
+	ip := net.ParseIP(nexthop.Key.Dst)
+	if ip == nil || ipBound(path.Base(bp.Name), ip.String(), mac) {
+		return false
+	}
+
+	ipGuardLock.Lock()
+	stats, ok := ipGuardStats[bp.Name]
+	if !ok {
+		stats = &IPGuardStats{BridgePort: bp.Name}
+		ipGuardStats[bp.Name] = stats
+	}
+	stats.Violations++
+	stats.LastIP = ip.String()
+	stats.LastMac = mac
+	stats.LastTime = time.Now()
+	blockedNexthops[nexthop.Key] = true
+	ipGuardLock.Unlock()
+
+	log.Printf("intel-e2000: Bridge port %s claimed ip %s with mac %s, dropping it\n", bp.Name, ip, mac)
+	if err := dropNeighbor(nexthop); err != nil {
+		log.Printf("intel-e2000: failed to drop neighbor of spoofed ip %s: %v\n", ip, err)
+	}
+	return true
+}
+
+// unblockNexthop forgets a blocked nexthop, it returns true if it was blocked
+func unblockNexthop(key nm.NexthopKey) bool {
+	ipGuardLock.Lock()
+	defer ipGuardLock.Unlock()
+	blocked := blockedNexthops[key]
+	delete(blockedNexthops, key)
+	return blocked
+}
+
+// nexthopBlocked checks if the nexthop is kept off the device
+func nexthopBlocked(key nm.NexthopKey) bool {
+	ipGuardLock.Lock()
+	defer ipGuardLock.Unlock()
+	return blockedNexthops[key]
+}
+
+// IPGuardViolations returns the ip source guard violations of the bridge ports
+func IPGuardViolations() []IPGuardStats {
+	ipGuardLock.Lock()
+	defer ipGuardLock.Unlock()
+	var stats = make([]IPGuardStats, 0, len(ipGuardStats))
+	for _, s := range ipGuardStats {
+		stats = append(stats, *s)
+	}
+	return stats
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// sviV6Tables v6 svi ingress table of each svi ingress table
+var sviV6Tables = map[string]string{
+	portInSviAccess: portInSviAccessV6,
+	portInSviTrunk:  portInSviTrunkV6,
+}
+
+// _withSviV6Ingress adds the v6 svi ingress entries of the svi ingress
+// entries, the ipv6 traffic of a svi gets the vrf id of the ipv4 one. The v6
+// entries mirror the v4 ones whatever the gateways of the svi so the deletes
+// match the adds when the gateways change in between
+func _withSviV6Ingress(entries []interface{}) []interface{} {
+	var out = make([]interface{}, 0, len(entries))
+	out = append(out, entries...)
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			continue
+		}
+		if table, found := sviV6Tables[e.Tablename]; found {
+			e.Tablename = table
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// _l3V6Route returns the vrf entries of an ipv6 route, the host routes of the
+// neighbors go to the v6 lem table and the prefixes, the connected subnets of
+// the svis among them, to the v6 routing table under the root lut of the vrf
+func (l L3Decoder) _l3V6Route(route nm.RouteStruct, del bool, ecmpFlag bool, entries []interface{}, e EcmpDispatcher) []interface{} {
+	var ec uint16
+	if ecmpFlag {
+		ec = uint16(1)
+	}
+	paths, err := _routePaths(route, !del, ecmpFlag, e)
+	if err != nil {
+		_logUnresolvedRoute(route, err)
+		return entries
+	}
+	var vrfID = l.getVrfID(route)
+	for _, path := range paths {
+		var entry p4client.TableEntry
+		if _isHostRoute(route) {
+			entry = p4client.TableEntry{
+				Tablename: l3RtHostV6,
+				TableField: p4client.TableField{
+					FieldValue: map[string][2]interface{}{
+						"vrf":       {bigEndian16(vrfID), "exact"},
+						"direction": {uint16(path.dir), "exact"},
+						"dst_ip":    {route.Route0.Dst, "exact"},
+					},
+					Priority: int32(0),
+				},
+			}
+		} else {
+			var tcamEntry p4client.TableEntry
+			var tIdx uint32
+			if del {
+				tcamEntry, tIdx = _deleteTcamEntry(vrfID, path.dir, route.Route0.Dst)
+			} else {
+				tcamEntry, tIdx = _addTcamEntry(vrfID, path.dir, route.Route0.Dst)
+			}
+			if !reflect.ValueOf(tcamEntry).IsZero() {
+				entries = append(entries, tcamEntry)
+			}
+			entry = p4client.TableEntry{
+				Tablename: l3RtV6,
+				TableField: p4client.TableField{
+					FieldValue: map[string][2]interface{}{
+						"ipv6_table_lpm_root1": {tIdx, "exact"},
+						"dst_ip":               {route.Route0.Dst, "lpm"},
+					},
+					Priority: int32(1),
+				},
+			}
+		}
+		if !del {
+			entry.Action = p4client.Action{
+				ActionName: "evpn_gw_control.set_neighbor",
+				Params:     []interface{}{uint16(path.neighbor), ec},
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if _isP2PRoute(route) {
+		entries = l._p2pV6Route(route, del, ecmpFlag, entries, e)
+	}
+	return entries
+}
+
+// _isV6Nexthop checks the gateway of the nexthop is an ipv6 address, a
+// neighbor resolved by neighbor discovery rather than arp
+func _isV6Nexthop(nexthop nm.NexthopStruct) bool {
+	ip := net.ParseIP(nexthop.Key.Dst)
+	return ip != nil && ip.To4() == nil
+}
+
+// _ndResolved checks neighbor discovery resolved the mac the nexthop rewrites
+// with. The link local gateways of the routers are kept apart by the device
+// in the nexthop key, so they need no special handling
+func _ndResolved(nexthop nm.NexthopStruct) bool {
+	if !nexthop.Resolved {
+		return false
+	}
+	switch nexthop.NhType {
+	case nm.PHY, nm.SVI, nm.ACC:
+		dmac, _ := nexthop.Metadata["dmac"].(string)
+		_, err := net.ParseMAC(dmac)
+		return err == nil
+	}
+	return true
+}
+
+// _isHostRoute checks the route is a host route of its family, its mask
+// covers all the bits of the address. The /128 gateways resolved by neighbor
+// discovery are host routes like the /32 ones
+func _isHostRoute(route nm.RouteStruct) bool {
+	if route.Route0.Dst == nil {
+		return false
+	}
+	mask := route.Route0.Dst.Mask
+	return len(mask) != 0 && bytes.Equal(mask, p4client.FullMask(len(mask)))
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"path"
+	"strconv"
+	"sync"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// l2ClassKey config key of the traffic classes of the bridged traffic
+const l2ClassKey = "l2class"
+
+// maxL2Class highest queue and pcp of a traffic class
+const maxL2Class = 7
+
+// L2Class traffic class of the frames bridged to a port, the queue they are
+// sent on and the pcp of the vlan pushed on a trunk
+type L2Class struct {
+	Queue uint32 `yaml:"queue" json:"queue"`
+	Pcp   uint32 `yaml:"pcp" json:"pcp"`
+}
+
+// L2ClassConfig traffic classes by bridge port name and by vlan, the class of
+// the bridge port wins over the class of the vlan
+type L2ClassConfig struct {
+	Ports map[string]L2Class `yaml:"ports"`
+	Vlans map[string]L2Class `yaml:"vlans"`
+}
+
+var (
+	// l2ClassLock guards the traffic classes
+	l2ClassLock sync.Mutex
+
+	// l2ClassPorts traffic classes keyed by bridge port name
+	l2ClassPorts = make(map[string]L2Class)
+
+	// l2ClassVlans traffic classes keyed by vlan
+	l2ClassVlans = make(map[uint32]L2Class)
+)
+
+// validL2Class checks the queue and the pcp of a traffic class
+func validL2Class(class L2Class) bool {
+	return class.Queue <= maxL2Class && class.Pcp <= maxL2Class
+}
+
+// loadL2ClassConfig reads the traffic classes, the invalid ones are ignored.
+// The l2 nexthops programmed keep their class until translated again
+func loadL2ClassConfig() {
+	var cfg L2ClassConfig
+	if err := viper.UnmarshalKey(l2ClassKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read l2 traffic classes: %v\n", err)
+	}
+	ports := make(map[string]L2Class)
+	for name, class := range cfg.Ports {
+		if !validL2Class(class) {
+			log.Printf("intel-e2000: Ignoring invalid traffic class %+v of bridge port %s\n", class, name)
+			continue
+		}
+		ports[name] = class
+	}
+	vlans := make(map[uint32]L2Class)
+	for vlan, class := range cfg.Vlans {
+		vid, err := strconv.ParseUint(vlan, 10, 16)
+		if err != nil || vid == 0 || vid > 4094 || !validL2Class(class) {
+			log.Printf("intel-e2000: Ignoring invalid traffic class %+v of vlan %s\n", class, vlan)
+			continue
+		}
+		vlans[uint32(vid)] = class
+	}
+	l2ClassLock.Lock()
+	l2ClassPorts = ports
+	l2ClassVlans = vlans
+	l2ClassLock.Unlock()
+}
+
+// nexthopClass returns the traffic class of an l2 nexthop, from its bridge
+// port or else from its vlan, false for the default queue
+func nexthopClass(nexthop nm.L2NexthopStruct) (L2Class, bool) {
+	l2ClassLock.Lock()
+	defer l2ClassLock.Unlock()
+	if vport, ok := nexthop.Metadata["vport_id"].(string); ok && len(l2ClassPorts) != 0 {
+		if bp, ok := bpOfVport(vport); ok {
+			if class, ok := l2ClassPorts[path.Base(bp.Name)]; ok {
+				return class, true
+			}
+		}
+	}
+	class, ok := l2ClassVlans[uint32(nexthop.VlanID)]
+	return class, ok
+}
+
+// _l2NhAction returns the l2 nexthop action, the variant taking the queue
+// when the nexthop has a traffic class
+func _l2NhAction(action string, class L2Class, classed bool, params ...interface{}) p4client.Action {
+	if !classed {
+		return p4client.Action{ActionName: action, Params: params}
+	}
+	return p4client.Action{
+		ActionName: action + "_tc",
+		Params:     append(params, class.Queue),
+	}
+}
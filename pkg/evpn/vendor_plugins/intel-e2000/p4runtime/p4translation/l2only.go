@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// A logical bridge without svi is l2 only: its bridge ports switch within the
+// vlan, and over the vxlan tunnel when the bridge has a vni, with no
+// vport_svi_ingress entries so frames to a gateway mac are bridged and never
+// routed. The intel-e2000 component status of the bridge and of its ports
+// carries the l2only flag. Attaching a svi later only adds the svi entries of
+// the ports already programmed, detaching it only removes them
+
+// _isL2Only checks the logical bridge has no svi
+func _isL2Only(lb *infradb.LogicalBridge) bool {
+	return lb.Svi == ""
+}
+
+// _bpL2Only checks none of the logical bridges of the bridge port has a svi
+func _bpL2Only(bp *infradb.BridgePort) bool {
+	for _, name := range bp.Spec.LogicalBridges {
+		if lb, err := infradb.GetLB(name); err == nil && !_isL2Only(lb) {
+			return false
+		}
+	}
+	return true
+}
+
+// _logL2Only logs the svi entries skipped for a bridge port on an l2 only
+// logical bridge
+func _logL2Only(bp *infradb.BridgePort, lb *infradb.LogicalBridge) {
+	log.Printf("intel-e2000: logical bridge %s vlan %d is l2 only, no svi entries for bridge port %s\n", lb.Name, lb.Spec.VlanID, bp.Name)
+}
+
+// _isSviEntry checks the entry steers the frames of a port to a svi
+func _isSviEntry(e p4client.TableEntry) bool {
+	return e.Tablename == portInSviAccess || e.Tablename == portInSviTrunk ||
+		e.Tablename == portInSviAccessV6 || e.Tablename == portInSviTrunkV6
+}
+
+// _lbPorts returns the bridge ports of a logical bridge with their entries
+// programmed
+func _lbPorts(lb *infradb.LogicalBridge) []*infradb.BridgePort {
+	var bps []*infradb.BridgePort
+	for name := range lb.BridgePorts {
+		if programmedEntries(name) == nil {
+			continue
+		}
+		if bp, err := infradb.GetBP(name); err == nil {
+			bps = append(bps, bp)
+		}
+	}
+	return bps
+}
+
+// attachSvi hands the svi entries a svi wrote for the ports of its logical
+// bridge over to the entries programmed of the ports, so a later update of a
+// port does not write them again
+func attachSvi(svi *infradb.Svi, written []interface{}) {
+	lb, err := infradb.GetLB(svi.Spec.LogicalBridge)
+	if err != nil {
+		return
+	}
+	keys := make(map[string]bool)
+	for _, entry := range written {
+		if e, ok := entry.(p4client.TableEntry); ok && _isSviEntry(e) {
+			keys[entryKey(e)] = true
+		}
+	}
+	for _, bp := range _lbPorts(lb) {
+		entries, err := Pod.translateAddedBp(bp)
+		if err != nil {
+			continue
+		}
+		programmed := programmedEntries(bp.Name)
+		have := make(map[string]bool)
+		for _, entry := range programmed {
+			if e, ok := entry.(p4client.TableEntry); ok {
+				have[entryKey(e)] = true
+			}
+		}
+		adopted := append([]interface{}{}, programmed...)
+		for _, entry := range entries {
+			e, ok := entry.(p4client.TableEntry)
+			if !ok || !keys[entryKey(e)] || have[entryKey(e)] {
+				continue
+			}
+			adopted = append(adopted, e)
+		}
+		if len(adopted) != len(programmed) {
+			log.Printf("intel-e2000: svi %s attached to bridge port %s\n", svi.Name, bp.Name)
+			recordObjectEntries(bp.Name, adopted)
+		}
+	}
+}
+
+// detachSvi drops the svi entries a svi removed from the entries programmed
+// of the ports of its logical bridge
+func detachSvi(svi *infradb.Svi, removed []interface{}) {
+	lb, err := infradb.GetLB(svi.Spec.LogicalBridge)
+	if err != nil {
+		return
+	}
+	keys := make(map[string]bool)
+	for _, entry := range removed {
+		if e, ok := entry.(p4client.TableEntry); ok && _isSviEntry(e) {
+			keys[entryKey(e)] = true
+		}
+	}
+	for _, bp := range _lbPorts(lb) {
+		programmed := programmedEntries(bp.Name)
+		var kept []interface{}
+		for _, entry := range programmed {
+			if e, ok := entry.(p4client.TableEntry); ok && keys[entryKey(e)] {
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		if len(kept) != len(programmed) {
+			log.Printf("intel-e2000: svi %s detached from bridge port %s\n", svi.Name, bp.Name)
+			recordObjectEntries(bp.Name, kept)
+		}
+	}
+}
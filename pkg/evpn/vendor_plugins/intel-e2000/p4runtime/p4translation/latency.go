@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBounds upper bounds of the latency histogram buckets
+var latencyBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	30 * time.Second,
+}
+
+// LatencyBucket count of the samples up to a bound, the last bucket has no
+// bound
+type LatencyBucket struct {
+	Le    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// LatencyHistogram cumulative latency histogram
+type LatencyHistogram struct {
+	Count   uint64          `json:"count"`
+	Sum     time.Duration   `json:"sum"`
+	Max     time.Duration   `json:"max"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// ObjectLatency latencies of the events of an object type, queued from the
+// receipt of the event to the start of its translation and total from the
+// receipt to the acknowledgment of the last device write
+type ObjectLatency struct {
+	Object string           `json:"object"`
+	Queued LatencyHistogram `json:"queued"`
+	Total  LatencyHistogram `json:"total"`
+}
+
+// QueueDepths events and writes waiting
+type QueueDepths struct {
+	EventStream   int `json:"eventstream"`
+	ObjectEvents  int `json:"objectevents"`
+	PendingWrites int `json:"pendingwrites"`
+}
+
+// LatencyStats latencies per object type and the queue depths
+type LatencyStats struct {
+	Objects []ObjectLatency `json:"objects"`
+	Queues  QueueDepths     `json:"queues"`
+}
+
+// histogram latency samples counted per bucket
+type histogram struct {
+	count   uint64
+	sum     time.Duration
+	max     time.Duration
+	buckets []uint64
+}
+
+// objectHistograms latency histograms of an object type
+type objectHistograms struct {
+	queued histogram
+	total  histogram
+}
+
+var (
+	// latencyLock guards the latency histograms and the object events in flight
+	latencyLock sync.Mutex
+
+	// latencies latency histograms keyed by object type
+	latencies = make(map[string]*objectHistograms)
+
+	// objectEventsInFlight infradb events received and not handled yet
+	objectEventsInFlight int
+)
+
+// observe counts a latency sample
+func (h *histogram) observe(d time.Duration) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(latencyBounds)+1)
+	}
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+	i := sort.Search(len(latencyBounds), func(i int) bool { return d <= latencyBounds[i] })
+	h.buckets[i]++
+}
+
+// export returns the cumulative histogram
+func (h *histogram) export() LatencyHistogram {
+	out := LatencyHistogram{Count: h.count, Sum: h.sum, Max: h.max}
+	var cumulative uint64
+	for i := 0; i <= len(latencyBounds); i++ {
+		if h.buckets != nil {
+			cumulative += h.buckets[i]
+		}
+		le := "+Inf"
+		if i < len(latencyBounds) {
+			le = latencyBounds[i].String()
+		}
+		out.Buckets = append(out.Buckets, LatencyBucket{Le: le, Count: cumulative})
+	}
+	return out
+}
+
+// eventObject returns the object type of a netlink event type
+func eventObject(eventType string) string {
+	for _, suffix := range []string{"_added", "_updated", "_deleted"} {
+		if strings.HasSuffix(eventType, suffix) {
+			return strings.TrimSuffix(eventType, suffix)
+		}
+	}
+	return eventType
+}
+
+// observeLatency records the latencies of an event of an object type
+func observeLatency(object string, queued time.Duration, total time.Duration) {
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+	h, ok := latencies[object]
+	if !ok {
+		h = &objectHistograms{}
+		latencies[object] = h
+	}
+	h.queued.observe(queued)
+	h.total.observe(total)
+}
+
+// objectEventReceived counts an infradb event in flight, the returned
+// function records its latencies once handled
+func objectEventReceived(object string) func(started time.Time) {
+	received := time.Now()
+	latencyLock.Lock()
+	objectEventsInFlight++
+	latencyLock.Unlock()
+	return func(started time.Time) {
+		latencyLock.Lock()
+		objectEventsInFlight--
+		latencyLock.Unlock()
+		observeLatency(object, started.Sub(received), time.Since(received))
+	}
+}
+
+// pendingWrites returns the entries admitted and not written yet
+func pendingWrites() int {
+	tableLock.Lock()
+	defer tableLock.Unlock()
+	var n int
+	for _, pending := range tablePending {
+		n += pending
+	}
+	return n
+}
+
+// GetLatencyStats returns the latencies per object type and the queue depths
+func GetLatencyStats() LatencyStats {
+	stats := LatencyStats{Objects: []ObjectLatency{}}
+	stats.Queues.EventStream = StreamStats().Queued
+	stats.Queues.PendingWrites = pendingWrites()
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+	stats.Queues.ObjectEvents = objectEventsInFlight
+	for object, h := range latencies {
+		stats.Objects = append(stats.Objects, ObjectLatency{Object: object, Queued: h.queued.export(), Total: h.total.export()})
+	}
+	sort.Slice(stats.Objects, func(i, j int) bool { return stats.Objects[i].Object < stats.Objects[j].Object })
+	return stats
+}
+
+// ResetLatencyStats clears the latency histograms
+func ResetLatencyStats() {
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+	latencies = make(map[string]*objectHistograms)
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LinkState negotiated link state of an uplink
+type LinkState struct {
+	Name      string `json:"name"`
+	Rep       string `json:"rep"`
+	Port      int    `json:"port"`
+	Role      string `json:"role"`
+	OperState string `json:"operstate"`
+	Carrier   bool   `json:"carrier"`
+	Speed     int    `json:"speed"`
+	Duplex    string `json:"duplex"`
+	Autoneg   string `json:"autoneg"`
+	Fec       string `json:"fec"`
+	PtpClock  string `json:"ptpclock"`
+}
+
+// readSysfs reads a sysfs attribute of a network device
+func readSysfs(dev string, attr string) string {
+	out, err := os.ReadFile(filepath.Join(sysClassNet, dev, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// ethtoolField returns the value of a "field: value" line of an ethtool output
+func ethtoolField(args []string, field string) string {
+	out, err := exec.Command("ethtool", args...).CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, field+":") {
+			return strings.TrimSpace(strings.TrimPrefix(line, field+":"))
+		}
+	}
+	return ""
+}
+
+// hwtstampFilterPtpV2Event rx filter timestamping the ptp v2 event messages
+const hwtstampFilterPtpV2Event = 12
+
+// configurePtp enables the hardware timestamping of the ptp event messages on
+// an uplink, the ptp daemon of the host then runs the clock on top of it
+func configurePtp(uplink UplinkConfig) {
+	args := []string{"-i", uplink.Rep, "-t", "1", "-r", strconv.Itoa(hwtstampFilterPtpV2Event)}
+	if out, err := exec.Command("hwstamp_ctl", args...).CombinedOutput(); err != nil {
+		log.Printf("intel-e2000: Failed to enable ptp timestamping of uplink %s: %v %s\n", uplink.Name, err, out)
+		return
+	}
+	log.Printf("intel-e2000: Executed hwstamp_ctl %s\n", strings.Join(args, " "))
+}
+
+// configureUplink programs the speed, fec, autoneg and ptp settings of an uplink
+func configureUplink(uplink UplinkConfig) {
+	args := []string{"-s", uplink.Rep}
+	if uplink.Speed != 0 {
+		args = append(args, "speed", strconv.Itoa(uplink.Speed), "duplex", "full")
+	}
+	if uplink.Autoneg != "" {
+		args = append(args, "autoneg", uplink.Autoneg)
+	}
+	if len(args) > 2 {
+		if out, err := exec.Command("ethtool", args...).CombinedOutput(); err != nil {
+			log.Printf("intel-e2000: Failed to set link of uplink %s: %v %s\n", uplink.Name, err, out)
+		} else {
+			log.Printf("intel-e2000: Executed ethtool %s\n", strings.Join(args, " "))
+		}
+	}
+	if uplink.Fec != "" {
+		if out, err := exec.Command("ethtool", "--set-fec", uplink.Rep, "encoding", uplink.Fec).CombinedOutput(); err != nil {
+			log.Printf("intel-e2000: Failed to set fec of uplink %s: %v %s\n", uplink.Name, err, out)
+		} else {
+			log.Printf("intel-e2000: Executed ethtool --set-fec %s encoding %s\n", uplink.Rep, uplink.Fec)
+		}
+	}
+	if uplink.Ptp {
+		configurePtp(uplink)
+	}
+}
+
+// configureUplinks programs the link settings of all the uplinks
+func configureUplinks() {
+	for _, uplink := range uplinks {
+		configureUplink(uplink)
+	}
+}
+
+// uplinkLinkState reads the negotiated link state of an uplink
+func uplinkLinkState(uplink UplinkConfig) LinkState {
+	state := LinkState{
+		Name:      uplink.Name,
+		Rep:       uplink.Rep,
+		Port:      uplink.Port,
+		Role:      uplink.Role,
+		OperState: readSysfs(uplink.Rep, "operstate"),
+		Carrier:   readSysfs(uplink.Rep, "carrier") == "1",
+		Duplex:    readSysfs(uplink.Rep, "duplex"),
+		Autoneg:   ethtoolField([]string{uplink.Rep}, "Auto-negotiation"),
+		Fec:       ethtoolField([]string{"--show-fec", uplink.Rep}, "Active FEC encoding"),
+		PtpClock:  ethtoolField([]string{"-T", uplink.Rep}, "PTP Hardware Clock"),
+	}
+	if speed, err := strconv.Atoi(readSysfs(uplink.Rep, "speed")); err == nil {
+		state.Speed = speed
+	}
+	return state
+}
+
+// UplinkLinkStates returns the negotiated link state of all the uplinks
+func UplinkLinkStates() []LinkState {
+	decoderLock.RLock()
+	defer decoderLock.RUnlock()
+	var states = make([]LinkState, 0, len(uplinks))
+	for _, uplink := range uplinks {
+		states = append(states, uplinkLinkState(uplink))
+	}
+	return states
+}
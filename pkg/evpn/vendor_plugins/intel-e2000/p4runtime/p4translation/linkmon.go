@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// linkMonitorDone stops the link monitor
+var linkMonitorDone chan struct{}
+
+// linkIsUp reports if the carrier of a link is up
+func linkIsUp(attrs *netlink.LinkAttrs) bool {
+	if attrs.OperState == netlink.OperUp {
+		return true
+	}
+	return attrs.OperState == netlink.OperUnknown && attrs.RawFlags&uint32(net.FlagRunning) != 0
+}
+
+// uplinkOfRep returns the uplink using the representor
+func uplinkOfRep(rep string) (UplinkConfig, bool) {
+	for _, uplink := range uplinks {
+		if uplink.Rep == rep {
+			return uplink, true
+		}
+	}
+	return UplinkConfig{}, false
+}
+
+// handleLinkUpdate moves the nexthops of an uplink on a carrier change
+func handleLinkUpdate(attrs *netlink.LinkAttrs) {
+	decoderLock.RLock()
+	uplink, found := uplinkOfRep(attrs.Name)
+	decoderLock.RUnlock()
+	if !found {
+		return
+	}
+	dampenLinkState(uplink.Name, linkIsUp(attrs))
+}
+
+// startLinkMonitor subscribes to the link events of the uplinks
+func startLinkMonitor() {
+	loadDampeningConfig()
+	updates := make(chan netlink.LinkUpdate)
+	linkMonitorDone = make(chan struct{})
+	if err := netlink.LinkSubscribeWithOptions(updates, linkMonitorDone, netlink.LinkSubscribeOptions{
+		ListExisting: true,
+		ErrorCallback: func(err error) {
+			log.Printf("intel-e2000: link monitor error: %v\n", err)
+		},
+	}); err != nil {
+		log.Printf("intel-e2000: Failed to subscribe to link events: %v\n", err)
+		return
+	}
+	go func() {
+		for update := range updates {
+			handleLinkUpdate(update.Link.Attrs())
+		}
+	}()
+}
+
+// stopLinkMonitor stops the link monitor
+func stopLinkMonitor() {
+	if linkMonitorDone != nil {
+		close(linkMonitorDone)
+		linkMonitorDone = nil
+	}
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// modGcKey config key of the mod pointer leak detection section
+const modGcKey = "modgc"
+
+// modTables tables keyed by the mod pointer
+var modTables = []string{
+	pushVlan, pushMacVlan, pushDmacVlan, macMod, pushVxlanHdr, podOutAccess,
+	podOutTrunk, popCtagStag, popStag, pushQnQFlood, pushVxlanOutHdr,
+}
+
+// ModGcConfig mod pointer leak detection config structure, the orphaned mod
+// entries are removed when clean is set and only reported otherwise
+type ModGcConfig struct {
+	Interval int  `yaml:"interval"`
+	Clean    bool `yaml:"clean"`
+}
+
+// ModOrphan mod entry programmed with a pointer the pool does not hold
+type ModOrphan struct {
+	Table string `json:"table"`
+	Ptr   uint32 `json:"ptr"`
+}
+
+// ModLeak mod pointer held by the pool without any mod entry programmed
+type ModLeak struct {
+	Ptr uint32 `json:"ptr"`
+	Key string `json:"key"`
+}
+
+// ModGcStats mod pointer leak detection statistics
+type ModGcStats struct {
+	Entries  int         `json:"entries"`
+	InUse    int         `json:"inuse"`
+	Orphans  []ModOrphan `json:"orphans"`
+	Leaks    []ModLeak   `json:"leaks"`
+	Runs     uint64      `json:"runs"`
+	Removed  uint64      `json:"removed"`
+	LastRun  time.Time   `json:"lastrun"`
+	LastFail string      `json:"lastfail,omitempty"`
+}
+
+var (
+	// modGcLock guards the mod pointer leak detection statistics
+	modGcLock sync.Mutex
+
+	// modGcStats mod pointer leak detection statistics
+	modGcStats ModGcStats
+
+	// modGcDone stops the periodic leak detection
+	modGcDone chan struct{}
+)
+
+// detectModLeaks reads the mod tables back from the device and cross-checks
+// their pointers against the pointers held by the pool. The entries whose
+// pointer the pool released are orphans and removed when clean is set, the
+// pointers held without any entry are reported as leaks
+func detectModLeaks(clean bool) ModGcStats {
+	if p4client.IsStandby() {
+		return GetModGcStats()
+	}
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+
+	inUse := ptrPool.idsInUse()
+	programmed := make(map[uint32]bool)
+	var orphans []ModOrphan
+	var entries, removed int
+	var fail string
+	for _, table := range modTables {
+		tableEntries, err := p4client.GetEntry(table)
+		if err != nil {
+			fail = fmt.Sprintf("failed to read %s: %v", table, err)
+			log.Printf("intel-e2000: Mod pointer leak detection %s\n", fail)
+			continue
+		}
+		for _, e := range tableEntries {
+			ptr, ok := p4client.ExactKey(e)
+			if !ok {
+				continue
+			}
+			entries++
+			programmed[ptr] = true
+			if ptr < ModPointer.ptrMinRange {
+				continue
+			}
+			if _, ok := inUse[ptr]; ok {
+				continue
+			}
+			orphans = append(orphans, ModOrphan{Table: table, Ptr: ptr})
+			if !clean {
+				continue
+			}
+			if err := p4client.DelProgrammedEntry(e); err != nil {
+				log.Printf("intel-e2000: Failed to remove orphaned mod entry %d of %s: %v\n", ptr, table, err)
+				continue
+			}
+			removed++
+		}
+	}
+	var leaks []ModLeak
+	if fail == "" {
+		for ptr, key := range inUse {
+			if !programmed[ptr] {
+				leaks = append(leaks, ModLeak{Ptr: ptr, Key: fmt.Sprintf("%+v", key)})
+			}
+		}
+	}
+	sort.Slice(leaks, func(i, j int) bool { return leaks[i].Ptr < leaks[j].Ptr })
+	if len(orphans) != 0 || len(leaks) != 0 {
+		log.Printf("intel-e2000: Found %d orphaned mod entries (%d removed) and %d mod pointers without entry\n", len(orphans), removed, len(leaks))
+	}
+
+	modGcLock.Lock()
+	defer modGcLock.Unlock()
+	modGcStats.Entries = entries
+	modGcStats.InUse = len(inUse)
+	modGcStats.Orphans = orphans
+	modGcStats.Leaks = leaks
+	modGcStats.Runs++
+	modGcStats.Removed += uint64(removed)
+	modGcStats.LastRun = time.Now()
+	modGcStats.LastFail = fail
+	return modGcStats
+}
+
+// startModGc starts the periodic mod pointer leak detection
+func startModGc() {
+	cfg := ModGcConfig{}
+	if err := viper.UnmarshalKey(modGcKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read mod gc config: %v\n", err)
+		return
+	}
+	if cfg.Interval <= 0 {
+		return
+	}
+	modGcDone = make(chan struct{})
+	done := modGcDone
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				detectModLeaks(cfg.Clean)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// stopModGc stops the periodic mod pointer leak detection
+func stopModGc() {
+	if modGcDone != nil {
+		close(modGcDone)
+		modGcDone = nil
+	}
+}
+
+// CleanModLeaks runs a mod pointer leak detection on demand and removes the
+// orphaned mod entries
+func CleanModLeaks() ModGcStats {
+	return detectModLeaks(true)
+}
+
+// GetModGcStats returns the mod pointer leak detection statistics
+func GetModGcStats() ModGcStats {
+	modGcLock.Lock()
+	defer modGcLock.Unlock()
+	return modGcStats
+}
@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"path"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// nativeVlansKey config key of the native vlans of the trunk bridge ports
+const nativeVlansKey = "nativevlans"
+
+var (
+	// nativeVlanLock guards the native vlans programmed
+	nativeVlanLock sync.Mutex
+
+	// programmedNativeVlans native vlans the trunk bridge ports were
+	// programmed with
+	programmedNativeVlans = make(map[string]uint32)
+
+	// untaggedNexthops l2 nexthops of trunk bridge ports leaving untagged
+	untaggedNexthops = make(map[nm.L2NexthopKey]bool)
+)
+
+// configuredNativeVlan returns the native vlan of a trunk bridge port, it has
+// to be the vlan of one of its logical bridges allowed on the trunk
+func configuredNativeVlan(bp *infradb.BridgePort) (*infradb.LogicalBridge, bool) {
+	if bp.Spec.Ptype != infradb.Trunk {
+		return nil, false
+	}
+	var cfg map[string]uint32
+	if err := viper.UnmarshalKey(nativeVlansKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read native vlans: %v\n", err)
+		return nil, false
+	}
+	vid, ok := cfg[path.Base(bp.Name)]
+	if !ok {
+		return nil, false
+	}
+	if !vlanAllowed(trunkVlans(bp), vid) {
+		log.Printf("intel-e2000: native vlan %d not allowed on trunk bridge port %s\n", vid, bp.Name)
+		return nil, false
+	}
+	for _, name := range bp.Spec.LogicalBridges {
+		if lb, err := infradb.GetLB(name); err == nil && lb.Spec.VlanID == vid {
+			return lb, true
+		}
+	}
+	log.Printf("intel-e2000: native vlan %d of bridge port %s is not one of its logical bridges\n", vid, bp.Name)
+	return nil, false
+}
+
+// nativeVlan returns the native vlan a trunk bridge port was programmed with
+func nativeVlan(bp *infradb.BridgePort) (uint32, bool) {
+	nativeVlanLock.Lock()
+	defer nativeVlanLock.Unlock()
+	vid, ok := programmedNativeVlans[bp.Name]
+	return vid, ok
+}
+
+// nativeLb returns the logical bridge of the native vlan of a trunk bridge
+// port, a bare one when it is gone already
+func nativeLb(bp *infradb.BridgePort, vid uint32) *infradb.LogicalBridge {
+	for _, name := range bp.Spec.LogicalBridges {
+		if lb, err := infradb.GetLB(name); err == nil && lb.Spec.VlanID == vid {
+			return lb
+		}
+	}
+	return &infradb.LogicalBridge{Spec: &infradb.LogicalBridgeSpec{VlanID: vid}}
+}
+
+// _nativeSviEntry returns the entry routing the untagged traffic of a trunk
+// bridge port sent to the svi of its native vlan
+func _nativeSviEntry(port uint64, svi *infradb.Svi, add bool) (p4client.TableEntry, error) {
+	entry := p4client.TableEntry{
+		Tablename: portInSviAccess,
+		TableField: p4client.TableField{
+			FieldValue: map[string][2]interface{}{
+				"vsi": {uint16(port), "exact"},
+				"da":  {*svi.Spec.MacAddress, "exact"},
+			},
+			Priority: int32(0),
+		},
+	}
+	if !add {
+		return entry, nil
+	}
+	vrf, err := infradb.GetVrf(svi.Spec.Vrf)
+	if err != nil {
+		return entry, err
+	}
+	tcamPrefix, vrfID, err := _sviVrfParams(vrf)
+	if err != nil {
+		return entry, err
+	}
+	entry.Action = p4client.Action{
+		ActionName: "evpn_gw_control.set_vrf_id_tx",
+		Params:     []interface{}{tcamPrefix, uint32(0), vrfID},
+	}
+	return entry, nil
+}
+
+// _nativeVlanEntries returns the untagged ingress entries of a trunk bridge
+// port mapping its untagged traffic to the native vlan, like an access port
+func (p PodDecoder) _nativeVlanEntries(bp *infradb.BridgePort, port uint64, add bool) ([]interface{}, error) {
+	var entries []interface{}
+	var lb *infradb.LogicalBridge
+	var ok bool
+	if add {
+		if lb, ok = configuredNativeVlan(bp); !ok {
+			return entries, nil
+		}
+		nativeVlanLock.Lock()
+		programmedNativeVlans[bp.Name] = lb.Spec.VlanID
+		nativeVlanLock.Unlock()
+	} else {
+		var vid uint32
+		nativeVlanLock.Lock()
+		vid, ok = programmedNativeVlans[bp.Name]
+		delete(programmedNativeVlans, bp.Name)
+		nativeVlanLock.Unlock()
+		if !ok {
+			return entries, nil
+		}
+		lb = nativeLb(bp, vid)
+	}
+	key := bpPoolKey{entryType: EntryType.BP, port: port, native: true}
+	var vid = uint16(lb.Spec.VlanID)
+	var modPtr uint32
+	if add {
+		modPtr = ptrPool.GetID(key)
+	} else {
+		modPtr = ptrPool.ReleaseID(key)
+	}
+	var actions = []p4client.Action{
+		{ActionName: "evpn_gw_control.vlan_push_access", Params: []interface{}{uint16(0), uint16(0), vid, uint16(0), uint16(0), uint16(port)}},
+		{ActionName: "evpn_gw_control.send_to_port_mux_access", Params: []interface{}{modPtr, uint32(_toEgressVsi(p._portMuxVsi))}},
+		{ActionName: "evpn_gw_control.set_vlan", Params: []interface{}{vid, uint32(0)}},
+	}
+	for i, entry := range []p4client.TableEntry{{
+		// To MUX PORT
+		Tablename: podOutAccess,
+		TableField: p4client.TableField{
+			FieldValue: map[string][2]interface{}{
+				"meta.common.mod_blob_ptr": {modPtr, "exact"},
+			},
+			Priority: int32(0),
+		},
+	}, {
+		Tablename: podInArpAccess,
+		TableField: p4client.TableField{
+			FieldValue: map[string][2]interface{}{
+				"vsi":         {uint16(port), "exact"},
+				"bit32_zeros": {uint32(0), "exact"},
+			},
+			Priority: int32(0),
+		},
+	}, {
+		// To L2 FWD
+		Tablename: podInIPAccess,
+		TableField: p4client.TableField{
+			FieldValue: map[string][2]interface{}{
+				"vsi":         {uint16(port), "exact"},
+				"bit32_zeros": {uint32(0), "exact"},
+			},
+			Priority: int32(0),
+		},
+	}} {
+		if add {
+			entry.Action = actions[i]
+		}
+		entries = append(entries, entry)
+	}
+	if lb.Svi != "" {
+		svi, err := infradb.GetSvi(lb.Svi)
+		if err != nil {
+			return entries, err
+		}
+		entry, err := _nativeSviEntry(port, svi, add)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// untaggedNexthop checks if an l2 nexthop of a trunk bridge port is in its
+// native vlan, the decision taken when adding is kept for the deletion
+func untaggedNexthop(nexthop nm.L2NexthopStruct, add bool) bool {
+	nativeVlanLock.Lock()
+	defer nativeVlanLock.Unlock()
+	if !add {
+		untagged := untaggedNexthops[nexthop.Key]
+		delete(untaggedNexthops, nexthop.Key)
+		return untagged
+	}
+	vport, ok := nexthop.Metadata["vport_id"].(string)
+	if !ok {
+		return false
+	}
+	bps, err := infradb.GetAllBPs()
+	if err != nil {
+		return false
+	}
+	for _, bp := range bps {
+		if bp.Metadata == nil || bp.Metadata.VPort != vport {
+			continue
+		}
+		if vid, ok := programmedNativeVlans[bp.Name]; ok && vid == uint32(nexthop.VlanID) {
+			untaggedNexthops[nexthop.Key] = true
+			return true
+		}
+	}
+	return false
+}
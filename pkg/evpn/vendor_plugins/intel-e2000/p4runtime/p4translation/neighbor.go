@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
+)
+
+// staticNeighborsKey config key of the static neighbors
+const staticNeighborsKey = "staticneighbors"
+
+// StaticNeighbor static neighbor structure
+type StaticNeighbor struct {
+	IP  string `yaml:"ip" json:"ip"`
+	Mac string `yaml:"mac" json:"mac"`
+	Dev string `yaml:"dev" json:"dev"`
+}
+
+var (
+	// neighborLock guards the static neighbors
+	neighborLock sync.Mutex
+
+	// staticNeighbors static neighbors installed keyed by dev and ip
+	staticNeighbors = make(map[string]StaticNeighbor)
+)
+
+// key returns the key of a static neighbor
+func (n StaticNeighbor) key() string {
+	return fmt.Sprintf("%s/%s", n.Dev, n.IP)
+}
+
+// toNeigh converts the static neighbor to a permanent kernel neighbor, the
+// netlink module then resolves the nexthops using it like any other neighbor
+func (n StaticNeighbor) toNeigh() (*netlink.Neigh, error) {
+	ip := net.ParseIP(n.IP)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid neighbor ip %q", n.IP)
+	}
+	link, err := netlink.LinkByName(n.Dev)
+	if err != nil {
+		return nil, fmt.Errorf("neighbor dev %s not found: %v", n.Dev, err)
+	}
+	neigh := &netlink.Neigh{
+		LinkIndex: link.Attrs().Index,
+		IP:        ip,
+		State:     netlink.NUD_PERMANENT,
+		Family:    netlink.FAMILY_V4,
+	}
+	if ip.To4() == nil {
+		neigh.Family = netlink.FAMILY_V6
+	}
+	if n.Mac != "" {
+		mac, err := net.ParseMAC(n.Mac)
+		if err != nil {
+			return nil, fmt.Errorf("invalid neighbor mac %q", n.Mac)
+		}
+		neigh.HardwareAddr = mac
+	}
+	return neigh, nil
+}
+
+// AddStaticNeighbor installs a static neighbor
+func AddStaticNeighbor(n StaticNeighbor) error {
+	if n.Mac == "" {
+		return fmt.Errorf("intel-e2000: static neighbor %s needs a mac", n.key())
+	}
+	neigh, err := n.toNeigh()
+	if err != nil {
+		return fmt.Errorf("intel-e2000: %v", err)
+	}
+	if err := netlink.NeighSet(neigh); err != nil {
+		return fmt.Errorf("intel-e2000: failed to install static neighbor %s: %v", n.key(), err)
+	}
+	neighborLock.Lock()
+	staticNeighbors[n.key()] = n
+	neighborLock.Unlock()
+	log.Printf("intel-e2000: Installed static neighbor %s lladdr %s\n", n.key(), n.Mac)
+	return nil
+}
+
+// DeleteStaticNeighbor removes a static neighbor
+func DeleteStaticNeighbor(n StaticNeighbor) error {
+	neigh, err := n.toNeigh()
+	if err != nil {
+		return fmt.Errorf("intel-e2000: %v", err)
+	}
+	if err := netlink.NeighDel(neigh); err != nil {
+		return fmt.Errorf("intel-e2000: failed to remove static neighbor %s: %v", n.key(), err)
+	}
+	neighborLock.Lock()
+	delete(staticNeighbors, n.key())
+	neighborLock.Unlock()
+	log.Printf("intel-e2000: Removed static neighbor %s\n", n.key())
+	return nil
+}
+
+// StaticNeighbors returns the static neighbors installed
+func StaticNeighbors() []StaticNeighbor {
+	neighborLock.Lock()
+	defer neighborLock.Unlock()
+	var neighbors = make([]StaticNeighbor, 0, len(staticNeighbors))
+	for _, n := range staticNeighbors {
+		neighbors = append(neighbors, n)
+	}
+	return neighbors
+}
+
+// installConfiguredNeighbors installs the static neighbors of the config file
+func installConfiguredNeighbors() {
+	var neighbors []StaticNeighbor
+	if err := viper.UnmarshalKey(staticNeighborsKey, &neighbors); err != nil {
+		log.Printf("intel-e2000: Failed to read static neighbors: %v\n", err)
+		return
+	}
+	for _, n := range neighbors {
+		if err := AddStaticNeighbor(n); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// NeighborRange layout of the 16 bits neighbor ids. A neighbor slot holds the
+// tx neighbor (slot << 1) and the rx neighbor (slot << 1 + 1) of a nexthop or
+// an ecmp group, the flood slot holds the flood nexthop
+var NeighborRange = struct {
+	flood, nexthopMin, nexthopMax, ecmpMin, ecmpMax uint32
+}{
+	flood:      0,
+	nexthopMin: 1,
+	nexthopMax: 0x5fff,
+	ecmpMin:    0x6000,
+	ecmpMax:    0x7fff,
+}
+
+// NeighborStats neighbor slots in use and the collisions detected
+type NeighborStats struct {
+	Nexthops    int    `json:"nexthops"`
+	Free        int    `json:"free"`
+	Quarantined int    `json:"quarantined"`
+	Collisions  uint64 `json:"collisions"`
+}
+
+var (
+	// neighborSlotLock guards the neighbor slots, it is taken after the state
+	// lock
+	neighborSlotLock sync.Mutex
+
+	// neighborSlots neighbor slots of the nexthops keyed by netlink id
+	neighborSlots = make(map[int]uint32)
+
+	// neighborOwners netlink ids of the nexthops keyed by neighbor slot
+	neighborOwners = make(map[uint32]int)
+
+	// neighborQuarantine slots of the deleted nexthops keyed by slot with the
+	// netlink id they were released by, a slot is reused once no route
+	// references the nexthop anymore
+	neighborQuarantine = make(map[uint32]int)
+
+	// neighborFree slots no route references anymore
+	neighborFree []uint32
+
+	// neighborNext lowest slot never handed out
+	neighborNext = NeighborRange.nexthopMin
+
+	// neighborCollisions neighbor slots found on the flood or the ecmp ids
+	neighborCollisions uint64
+)
+
+// _neighborSlotConflict checks a nexthop slot against the flood slot and the
+// ecmp range, the neighbors of both would be overwritten by the nexthop
+func _neighborSlotConflict(slot uint32) error {
+	if slot == NeighborRange.flood {
+		return fmt.Errorf("neighbor slot %d is the flood one", slot)
+	}
+	if slot >= NeighborRange.ecmpMin && slot <= NeighborRange.ecmpMax {
+		return fmt.Errorf("neighbor slot %d lies in the ecmp range %d-%d", slot, NeighborRange.ecmpMin, NeighborRange.ecmpMax)
+	}
+	return nil
+}
+
+// _takeNeighborSlot takes a free slot, the never used ones last, the caller
+// holds the neighbor slot lock
+func _takeNeighborSlot() (uint32, bool) {
+	switch {
+	case len(neighborFree) != 0:
+		slot := neighborFree[len(neighborFree)-1]
+		neighborFree = neighborFree[:len(neighborFree)-1]
+		return slot, true
+	case neighborNext <= NeighborRange.nexthopMax:
+		slot := neighborNext
+		neighborNext++
+		return slot, true
+	}
+	return 0, false
+}
+
+// sweepNeighborQuarantine frees the quarantined slots whose nexthop no
+// cached route references anymore
+func sweepNeighborQuarantine() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	neighborSlotLock.Lock()
+	defer neighborSlotLock.Unlock()
+	if len(neighborQuarantine) == 0 {
+		return
+	}
+	referenced := make(map[int]bool)
+	for _, route := range routeCache {
+		for _, nexthop := range route.Nexthops {
+			if nexthop != nil {
+				referenced[nexthop.ID] = true
+			}
+		}
+	}
+	for slot, id := range neighborQuarantine {
+		if !referenced[id] {
+			delete(neighborQuarantine, slot)
+			neighborFree = append(neighborFree, slot)
+		}
+	}
+}
+
+// neighborSlotAvailable checks a slot is free without sweeping the
+// quarantined ones
+func neighborSlotAvailable() bool {
+	neighborSlotLock.Lock()
+	defer neighborSlotLock.Unlock()
+	return len(neighborFree) != 0 || neighborNext <= NeighborRange.nexthopMax
+}
+
+// claimNeighborSlot claims the neighbor slot of an added nexthop, the
+// quarantined slots are swept when no slot is free. The netlink ids grow
+// without bound so they are not used as neighbor ids directly
+func claimNeighborSlot(id int) (uint32, error) {
+	if !neighborSlotAvailable() {
+		sweepNeighborQuarantine()
+	}
+	neighborSlotLock.Lock()
+	defer neighborSlotLock.Unlock()
+	if slot, ok := neighborSlots[id]; ok {
+		return slot, nil
+	}
+	slot, ok := _takeNeighborSlot()
+	if !ok {
+		return 0, fmt.Errorf("intel-e2000: nexthop %d: %w: %d neighbor slots in use, %d quarantined", id, ErrPoolExhausted, len(neighborSlots), len(neighborQuarantine))
+	}
+	if err := _neighborSlotConflict(slot); err != nil {
+		neighborCollisions++
+		return 0, fmt.Errorf("intel-e2000: nexthop %d: %v", id, err)
+	}
+	if owner, held := neighborOwners[slot]; held {
+		neighborCollisions++
+		return 0, fmt.Errorf("intel-e2000: nexthop %d: neighbor slot %d held by nexthop %d", id, slot, owner)
+	}
+	neighborSlots[id] = slot
+	neighborOwners[slot] = id
+	return slot, nil
+}
+
+// _neighborSlot returns the neighbor slot claimed by a nexthop, a nexthop
+// never added has none
+func _neighborSlot(id int) (uint32, error) {
+	neighborSlotLock.Lock()
+	defer neighborSlotLock.Unlock()
+	slot, ok := neighborSlots[id]
+	if !ok {
+		return 0, fmt.Errorf("intel-e2000: nexthop %d has no neighbor slot", id)
+	}
+	return slot, nil
+}
+
+// releaseNeighborSlot releases the neighbor slot of a deleted nexthop, the
+// slot is quarantined until no route references the nexthop
+func releaseNeighborSlot(id int) {
+	neighborSlotLock.Lock()
+	defer neighborSlotLock.Unlock()
+	slot, ok := neighborSlots[id]
+	if !ok {
+		return
+	}
+	delete(neighborSlots, id)
+	delete(neighborOwners, slot)
+	neighborQuarantine[slot] = id
+}
+
+// checkEcmpSlot checks the id of an ecmp group lies in the ecmp range, out
+// of it the group neighbor would collide with a nexthop or the flood nexthop
+func checkEcmpSlot(key string, id uint32) bool {
+	if id >= NeighborRange.ecmpMin && id <= NeighborRange.ecmpMax {
+		return true
+	}
+	neighborSlotLock.Lock()
+	neighborCollisions++
+	neighborSlotLock.Unlock()
+	log.Printf("intel-e2000: Ecmp group %s id %d out of the neighbor range %d-%d\n", key, id, NeighborRange.ecmpMin, NeighborRange.ecmpMax)
+	return false
+}
+
+// GetNeighborStats returns the neighbor slots in use and the collisions
+func GetNeighborStats() NeighborStats {
+	neighborSlotLock.Lock()
+	defer neighborSlotLock.Unlock()
+	return NeighborStats{
+		Nexthops:    len(neighborSlots),
+		Free:        int(NeighborRange.nexthopMax-neighborNext+1) + len(neighborFree),
+		Quarantined: len(neighborQuarantine),
+		Collisions:  neighborCollisions,
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"testing"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// TestNeighborSlotQuarantine checks the slot of a deleted nexthop is not
+// handed out again while a route references the nexthop
+func TestNeighborSlotQuarantine(t *testing.T) {
+	neighborSlotLock.Lock()
+	next, free := neighborNext, neighborFree
+	neighborSlotLock.Unlock()
+	t.Cleanup(func() {
+		neighborSlotLock.Lock()
+		neighborNext, neighborFree = next, free
+		neighborSlotLock.Unlock()
+	})
+
+	slot, err := claimNeighborSlot(60)
+	if err != nil {
+		t.Fatalf("nexthop 60: %v", err)
+	}
+	key := nm.RouteKey{Table: 1600, Dst: "10.6.0.0/24"}
+	stateLock.Lock()
+	routeCache[key] = nm.RouteStruct{Key: key, Nexthops: []*nm.NexthopStruct{{ID: 60}}}
+	stateLock.Unlock()
+	releaseNeighborSlot(60)
+	if _, err := _neighborSlot(60); err == nil {
+		t.Errorf("released nexthop still has a slot")
+	}
+
+	// Only the released slot would be left
+	neighborSlotLock.Lock()
+	neighborNext, neighborFree = NeighborRange.nexthopMax+1, nil
+	neighborSlotLock.Unlock()
+	if got, err := claimNeighborSlot(61); err == nil {
+		t.Fatalf("slot %d handed out while a route references its nexthop", got)
+	}
+
+	stateLock.Lock()
+	delete(routeCache, key)
+	stateLock.Unlock()
+	got, err := claimNeighborSlot(61)
+	if err != nil || got != slot {
+		t.Fatalf("after the route is gone: got slot %d %v, want %d", got, err, slot)
+	}
+	releaseNeighborSlot(61)
+	sweepNeighborQuarantine()
+}
+
+// TestNeighborSlotConflict checks the flood slot and the ecmp range are
+// never held by a nexthop
+func TestNeighborSlotConflict(t *testing.T) {
+	for _, slot := range []uint32{NeighborRange.flood, NeighborRange.ecmpMin, NeighborRange.ecmpMax} {
+		if err := _neighborSlotConflict(slot); err == nil {
+			t.Errorf("slot %d: no conflict detected", slot)
+		}
+	}
+	for _, slot := range []uint32{NeighborRange.nexthopMin, NeighborRange.nexthopMax} {
+		if err := _neighborSlotConflict(slot); err != nil {
+			t.Errorf("slot %d: %v", slot, err)
+		}
+	}
+}
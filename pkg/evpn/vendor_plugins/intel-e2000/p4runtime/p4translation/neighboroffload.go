@@ -0,0 +1,366 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
+)
+
+// neighborOffloadKey config key of the neighbor offload section
+const neighborOffloadKey = "neighboroffload"
+
+// NeighborOffloadConfig neighbor offload config structure. With the offload
+// enabled the neighbors resolved on the svis of the tenant vrfs are written
+// to the l3 lem table from the kernel neighbor events, before the netlink
+// module polls them as neighbor routes, so the first packets to an on-link
+// host skip the slow path. The kernel route and nexthop take the entries over
+// once they are learnt
+type NeighborOffloadConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// OffloadedNeighbor neighbor programmed from a kernel neighbor event
+type OffloadedNeighbor struct {
+	Vrf       string    `json:"vrf"`
+	IP        string    `json:"ip"`
+	Mac       string    `json:"mac"`
+	Dev       string    `json:"dev"`
+	Vport     string    `json:"vport"`
+	Offloaded time.Time `json:"offloaded"`
+	nexthop   nm.NexthopStruct
+	route     nm.RouteStruct
+	entries   []interface{}
+}
+
+var (
+	// neighborOffloadLock guards the offloaded neighbors and the nexthop ids
+	neighborOffloadLock sync.Mutex
+
+	// offloadedNeighbors neighbors offloaded keyed by dev index and ip
+	offloadedNeighbors = make(map[string]*OffloadedNeighbor)
+
+	// offloadNextID id of the next offloaded nexthop, negative so it never
+	// meets the ids of the netlink nexthops
+	offloadNextID = -1
+
+	// neighborOffloadDone stops the neighbor monitor
+	neighborOffloadDone chan struct{}
+)
+
+// neighborKey returns the key of a neighbor
+func neighborKey(dev int, ip net.IP) string {
+	return fmt.Sprintf("%d/%s", dev, ip)
+}
+
+// neighborResolved checks the neighbor is an ipv4 neighbor with a mac the
+// kernel considers usable
+func neighborResolved(n netlink.Neigh) bool {
+	if n.IP.To4() == nil || len(n.HardwareAddr) == 0 {
+		return false
+	}
+	return n.State&(netlink.NUD_REACHABLE|netlink.NUD_STALE|netlink.NUD_DELAY|netlink.NUD_PROBE|netlink.NUD_PERMANENT) != 0
+}
+
+// sviNeighbor builds the nexthop and the host route of a neighbor on a svi,
+// annotated the way the netlink module annotates the svi nexthops
+func sviNeighbor(n netlink.Neigh) (nm.NexthopStruct, nm.RouteStruct, error) {
+	var nexthop nm.NexthopStruct
+	var route nm.RouteStruct
+	link, err := netlink.LinkByIndex(n.LinkIndex)
+	if err != nil {
+		return nexthop, route, fmt.Errorf("dev %d not found: %v", n.LinkIndex, err)
+	}
+	master, err := netlink.LinkByIndex(link.Attrs().MasterIndex)
+	if err != nil {
+		return nexthop, route, fmt.Errorf("dev %s not enslaved to a vrf", link.Attrs().Name)
+	}
+	vrf, err := infradb.GetVrf(vrfPrefix + master.Attrs().Name)
+	if err != nil {
+		return nexthop, route, fmt.Errorf("vrf %s not found: %v", master.Attrs().Name, err)
+	}
+	if vrf.Spec == nil || vrf.Spec.Vni == nil {
+		return nexthop, route, fmt.Errorf("vrf %s is not a tenant vrf", master.Attrs().Name)
+	}
+	name := link.Attrs().Name
+	if !strings.HasPrefix(name, master.Attrs().Name+"-") {
+		return nexthop, route, fmt.Errorf("dev %s is not a svi", name)
+	}
+	vlanID, err := strconv.ParseUint(strings.TrimPrefix(name, master.Attrs().Name+"-"), 10, 32)
+	if err != nil {
+		return nexthop, route, fmt.Errorf("dev %s is not a svi", name)
+	}
+	lbs, err := infradb.GetAllLBs()
+	if err != nil {
+		return nexthop, route, fmt.Errorf("failed to read the logical bridges: %v", err)
+	}
+	var bp *infradb.BridgePort
+	for _, lb := range lbs {
+		if lb.Spec == nil || lb.Spec.VlanID != uint32(vlanID) {
+			continue
+		}
+		if bpName := lb.MacTable[n.HardwareAddr.String()]; bpName != "" {
+			bp, _ = infradb.GetBP(bpName)
+		}
+		break
+	}
+	if bp == nil || bp.Spec == nil || bp.Metadata == nil {
+		return nexthop, route, fmt.Errorf("mac %s not learnt on a bridge port of vlan %d", n.HardwareAddr, vlanID)
+	}
+	table, err := _vrfTable(vrf)
+	if err != nil {
+		return nexthop, route, err
+	}
+	nexthop = nm.NexthopStruct{
+		Vrf:      vrf,
+		Key:      nm.NexthopKey{VrfName: vrf.Name, Dst: n.IP.String(), Dev: n.LinkIndex},
+		Resolved: true,
+		NhType:   nm.SVI,
+		Metadata: map[interface{}]interface{}{
+			"direction":    nm.RX,
+			"smac":         link.Attrs().HardwareAddr.String(),
+			"dmac":         n.HardwareAddr.String(),
+			"egress_vport": bp.Metadata.VPort,
+			"vlanID":       uint32(vlanID),
+			"portType":     bp.Spec.Ptype,
+		},
+	}
+	dst := &net.IPNet{IP: n.IP.To4(), Mask: net.CIDRMask(32, 32)}
+	route = nm.RouteStruct{
+		Route0:   netlink.Route{Dst: dst, LinkIndex: n.LinkIndex, Table: int(table)},
+		Vrf:      vrf,
+		Metadata: map[interface{}]interface{}{"direction": nm.RXTX},
+		Key:      nm.RouteKey{Table: int(table), Dst: dst.String()},
+	}
+	return nexthop, route, nil
+}
+
+// kernelOwned checks the kernel route or nexthop of the neighbor is already
+// programmed, the neighbor is then left to them
+func kernelOwned(nexthop nm.NexthopStruct, route nm.RouteStruct) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if _, found := routeCache[route.Key]; found {
+		return true
+	}
+	for key := range nexthopCache {
+		if key.VrfName == nexthop.Key.VrfName && key.Dst == nexthop.Key.Dst && key.Dev == nexthop.Key.Dev {
+			return true
+		}
+	}
+	return false
+}
+
+// offloadNeighbor writes the entries of a resolved neighbor, the caller holds
+// the decoder lock
+func offloadNeighbor(n netlink.Neigh) error {
+	nexthop, route, err := sviNeighbor(n)
+	if err != nil {
+		return err
+	}
+	if kernelOwned(nexthop, route) {
+		return nil
+	}
+	if !portUp(nexthopPort(nexthop)) {
+		return errors.New("port is down")
+	}
+	key := neighborKey(n.LinkIndex, n.IP)
+	neighborOffloadLock.Lock()
+	if o, found := offloadedNeighbors[key]; found {
+		if o.Mac == n.HardwareAddr.String() && o.Vport == nexthop.Metadata["egress_vport"] {
+			neighborOffloadLock.Unlock()
+			return nil
+		}
+		delete(offloadedNeighbors, key)
+		neighborOffloadLock.Unlock()
+		withdrawNeighbor(o)
+		neighborOffloadLock.Lock()
+	}
+	nexthop.ID = offloadNextID
+	offloadNextID--
+	neighborOffloadLock.Unlock()
+
+	if _, err := claimNeighborSlot(nexthop.ID); err != nil {
+		return err
+	}
+	route.Nexthops = []*nm.NexthopStruct{&nexthop}
+	entries := L3.translateAddedNexthop(nexthop)
+	entries = append(entries, L3.translateAddedRoute(route)...)
+	if err := addEntries(entries); err != nil {
+		delEntries(L3.translateDeletedRoute(route))
+		delEntries(L3.translateDeletedNexthop(nexthop))
+		releaseNeighborSlot(nexthop.ID)
+		return err
+	}
+	dev := strconv.Itoa(n.LinkIndex)
+	if link, err := netlink.LinkByIndex(n.LinkIndex); err == nil {
+		dev = link.Attrs().Name
+	}
+	neighborOffloadLock.Lock()
+	offloadedNeighbors[key] = &OffloadedNeighbor{
+		Vrf:       path.Base(nexthop.Key.VrfName),
+		IP:        n.IP.String(),
+		Mac:       n.HardwareAddr.String(),
+		Dev:       dev,
+		Vport:     nexthop.Metadata["egress_vport"].(string),
+		Offloaded: time.Now(),
+		nexthop:   nexthop,
+		route:     route,
+		entries:   entries,
+	}
+	neighborOffloadLock.Unlock()
+	return nil
+}
+
+// withdrawNeighbor removes the entries of an offloaded neighbor, the caller
+// holds the decoder lock
+func withdrawNeighbor(o *OffloadedNeighbor) {
+	delEntries(L3.translateDeletedRoute(o.route))
+	delEntries(L3.translateDeletedNexthop(o.nexthop))
+	releaseNeighborSlot(o.nexthop.ID)
+}
+
+// handleNeighborUpdate offloads or withdraws a neighbor on a kernel event
+func handleNeighborUpdate(update netlink.NeighUpdate) {
+	n := update.Neigh
+	if n.IP.To4() == nil {
+		return
+	}
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	key := neighborKey(n.LinkIndex, n.IP)
+	if update.Type == syscall.RTM_DELNEIGH || !neighborResolved(n) {
+		neighborOffloadLock.Lock()
+		o, found := offloadedNeighbors[key]
+		delete(offloadedNeighbors, key)
+		neighborOffloadLock.Unlock()
+		if found {
+			withdrawNeighbor(o)
+		}
+		return
+	}
+	if err := offloadNeighbor(n); err != nil {
+		log.Printf("intel-e2000: Neighbor %s not offloaded: %v\n", n.IP, err)
+	}
+}
+
+// yieldNeighbor withdraws the offloaded neighbor matching the selector, the
+// kernel route or nexthop taking its entries over, the caller holds the
+// decoder lock
+func yieldNeighbor(match func(o *OffloadedNeighbor) bool) {
+	neighborOffloadLock.Lock()
+	var yielded []*OffloadedNeighbor
+	for key, o := range offloadedNeighbors {
+		if match(o) {
+			yielded = append(yielded, o)
+			delete(offloadedNeighbors, key)
+		}
+	}
+	neighborOffloadLock.Unlock()
+	for _, o := range yielded {
+		log.Printf("intel-e2000: Offloaded neighbor %s of vrf %s handed over to the kernel entries\n", o.IP, o.Vrf)
+		withdrawNeighbor(o)
+	}
+}
+
+// yieldNeighborRoute hands the offloaded neighbor of the host route over
+func yieldNeighborRoute(key nm.RouteKey) {
+	yieldNeighbor(func(o *OffloadedNeighbor) bool { return o.route.Key == key })
+}
+
+// yieldNeighborNexthop hands the offloaded neighbor of the nexthop over
+func yieldNeighborNexthop(key nm.NexthopKey) {
+	yieldNeighbor(func(o *OffloadedNeighbor) bool {
+		return o.nexthop.Key.VrfName == key.VrfName && o.nexthop.Key.Dst == key.Dst && o.nexthop.Key.Dev == key.Dev
+	})
+}
+
+// offloadedNeighborEntries returns the entries of the offloaded neighbors
+func offloadedNeighborEntries() []interface{} {
+	neighborOffloadLock.Lock()
+	defer neighborOffloadLock.Unlock()
+	var entries []interface{}
+	for _, o := range offloadedNeighbors {
+		entries = append(entries, o.entries...)
+	}
+	return entries
+}
+
+// startNeighborOffload subscribes to the kernel neighbor events
+func startNeighborOffload() {
+	cfg := NeighborOffloadConfig{}
+	if err := viper.UnmarshalKey(neighborOffloadKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read neighbor offload config: %v\n", err)
+	}
+	if !cfg.Enabled {
+		return
+	}
+	updates := make(chan netlink.NeighUpdate)
+	neighborOffloadDone = make(chan struct{})
+	if err := netlink.NeighSubscribeWithOptions(updates, neighborOffloadDone, netlink.NeighSubscribeOptions{
+		ListExisting: true,
+		ErrorCallback: func(err error) {
+			log.Printf("intel-e2000: neighbor monitor error: %v\n", err)
+		},
+	}); err != nil {
+		log.Printf("intel-e2000: Failed to subscribe to neighbor events: %v\n", err)
+		return
+	}
+	go func() {
+		for update := range updates {
+			handleNeighborUpdate(update)
+		}
+	}()
+}
+
+// stopNeighborOffload stops the neighbor monitor and withdraws the neighbors
+// offloaded
+func stopNeighborOffload() {
+	if neighborOffloadDone != nil {
+		close(neighborOffloadDone)
+		neighborOffloadDone = nil
+	}
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	neighborOffloadLock.Lock()
+	withdrawn := offloadedNeighbors
+	offloadedNeighbors = make(map[string]*OffloadedNeighbor)
+	neighborOffloadLock.Unlock()
+	for _, o := range withdrawn {
+		withdrawNeighbor(o)
+	}
+}
+
+// OffloadedNeighbors returns the neighbors offloaded from the kernel events
+func OffloadedNeighbors() []OffloadedNeighbor {
+	neighborOffloadLock.Lock()
+	defer neighborOffloadLock.Unlock()
+	list := make([]OffloadedNeighbor, 0, len(offloadedNeighbors))
+	for _, o := range offloadedNeighbors {
+		list = append(list, *o)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Vrf != list[j].Vrf {
+			return list[i].Vrf < list[j].Vrf
+		}
+		return list[i].IP < list[j].IP
+	})
+	return list
+}
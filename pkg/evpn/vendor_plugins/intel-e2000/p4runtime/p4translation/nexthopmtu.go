@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"path"
+	"sort"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
+)
+
+// nexthopMtuKey config key of the mtu aware ecmp section
+const nexthopMtuKey = "nexthopmtu"
+
+// defaultJumboMtu mtu a member needs to carry jumbo traffic
+const defaultJumboMtu = 9000
+
+// NexthopMtuConfig mtu aware ecmp config structure, the ecmp groups of the
+// vrfs carrying jumbo traffic only hash over the members reaching the jumbo
+// mtu as long as one of them does
+type NexthopMtuConfig struct {
+	Jumbo int      `yaml:"jumbo"`
+	Vrfs  []string `yaml:"vrfs"`
+}
+
+// NexthopMtu mtu of the egress device of a nexthop
+type NexthopMtu struct {
+	Vrf string `json:"vrf"`
+	Dst string `json:"dst"`
+	Dev string `json:"dev"`
+	ID  int    `json:"id"`
+	Mtu int    `json:"mtu"`
+}
+
+// loadNexthopMtuConfig reads the mtu aware ecmp config and applies the defaults
+func loadNexthopMtuConfig() NexthopMtuConfig {
+	cfg := NexthopMtuConfig{}
+	if err := viper.UnmarshalKey(nexthopMtuKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read nexthop mtu config: %v\n", err)
+	}
+	if cfg.Jumbo <= 0 {
+		cfg.Jumbo = defaultJumboMtu
+	}
+	return cfg
+}
+
+// jumboVrf checks if the vrf carries jumbo traffic
+func (cfg NexthopMtuConfig) jumboVrf(vrf string) bool {
+	for _, name := range cfg.Vrfs {
+		if path.Base(name) == path.Base(vrf) {
+			return true
+		}
+	}
+	return false
+}
+
+// nexthopMtu returns the mtu of the egress device of a nexthop, zero when
+// the device is unknown
+func nexthopMtu(nh *nm.NexthopStruct) (int, string) {
+	if nh.Key.Dev == 0 {
+		return 0, ""
+	}
+	link, err := netlink.LinkByIndex(nh.Key.Dev)
+	if err != nil {
+		return 0, ""
+	}
+	return link.Attrs().MTU, link.Attrs().Name
+}
+
+// setMemberMtus records the mtu of the members of a jumbo vrf ecmp group
+func (e *EcmpDispatcher) setMemberMtus(nexthop []*nm.NexthopStruct, vrf string) {
+	cfg := loadNexthopMtuConfig()
+	if !cfg.jumboVrf(vrf) {
+		return
+	}
+	e.jumbo = cfg.Jumbo
+	e.mtus = make(map[int]int, len(nexthop))
+	for _, nh := range nexthop {
+		e.mtus[nh.ID], _ = nexthopMtu(nh)
+	}
+}
+
+// preferMtu returns the members reaching the jumbo mtu, all the members when
+// none does or the group does not carry jumbo traffic
+func (e *EcmpDispatcher) preferMtu(members []*nm.NexthopStruct) []*nm.NexthopStruct {
+	if e.jumbo == 0 {
+		return members
+	}
+	var jumbo []*nm.NexthopStruct
+	for _, nh := range members {
+		if e.mtus[nh.ID] >= e.jumbo {
+			jumbo = append(jumbo, nh)
+		}
+	}
+	if len(jumbo) == 0 {
+		return members
+	}
+	if len(jumbo) != len(members) {
+		log.Printf("intel-e2000: Ecmp group %d hashing over %d of %d members reaching mtu %d\n", e.id, len(jumbo), len(members), e.jumbo)
+	}
+	return jumbo
+}
+
+// NexthopMtus returns the mtu of the egress devices of the nexthops
+func NexthopMtus() []NexthopMtu {
+	stateLock.Lock()
+	nexthops := make([]nm.NexthopStruct, 0, len(nexthopCache))
+	for _, nh := range nexthopCache {
+		nexthops = append(nexthops, nh)
+	}
+	stateLock.Unlock()
+	var mtus = make([]NexthopMtu, 0, len(nexthops))
+	for i := range nexthops {
+		mtu, dev := nexthopMtu(&nexthops[i])
+		mtus = append(mtus, NexthopMtu{
+			Vrf: path.Base(nexthops[i].Key.VrfName),
+			Dst: nexthops[i].Key.Dst,
+			Dev: dev,
+			ID:  nexthops[i].ID,
+			Mtu: mtu,
+		})
+	}
+	sort.Slice(mtus, func(i, j int) bool { return mtus[i].ID < mtus[j].ID })
+	return mtus
+}
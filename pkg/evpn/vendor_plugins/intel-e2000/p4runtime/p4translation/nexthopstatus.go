@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// operational states of a nexthop, a route of the kernel whose nexthop is
+// not programmed forwards without a hardware rewrite
+const (
+	nhProgrammed = "programmed"
+	nhUnresolved = "unresolved"
+	nhNoRewrite  = "norewrite"
+	nhFailed     = "failed"
+	nhPortDown   = "portdown"
+	nhBlocked    = "blocked"
+)
+
+// NexthopStatus operational state of a nexthop, resolved when the kernel
+// resolved its neighbor, with the tables its entries were written to
+type NexthopStatus struct {
+	Vrf      string    `json:"vrf"`
+	Dst      string    `json:"dst"`
+	Dev      int       `json:"dev"`
+	ID       int       `json:"id"`
+	Type     int       `json:"type"`
+	Resolved bool      `json:"resolved"`
+	Dmac     string    `json:"dmac,omitempty"`
+	State    string    `json:"state"`
+	Tables   []string  `json:"tables"`
+	Error    string    `json:"error,omitempty"`
+	Updated  time.Time `json:"updated"`
+	port     string
+}
+
+var (
+	// nexthopStatusLock guards the nexthop states
+	nexthopStatusLock sync.Mutex
+
+	// nexthopStatuses states of the nexthops keyed by nexthop key
+	nexthopStatuses = make(map[nm.NexthopKey]*NexthopStatus)
+)
+
+// nexthopResolved checks the kernel resolved the neighbor of the nexthop,
+// the nexthops rewriting the destination mac need it
+func nexthopResolved(nexthop nm.NexthopStruct) (bool, string) {
+	dmac, _ := nexthop.Metadata["dmac"].(string)
+	switch nexthop.NhType {
+	case nm.PHY, nm.SVI, nm.ACC:
+		return nexthop.Resolved && dmac != "", dmac
+	}
+	return nexthop.Resolved, dmac
+}
+
+// recordNexthopStatus records the entries written for a nexthop and the
+// error of the writes
+func recordNexthopStatus(nexthop nm.NexthopStruct, err error, written ...[]interface{}) {
+	resolved, dmac := nexthopResolved(nexthop)
+	status := &NexthopStatus{
+		Vrf:      path.Base(nexthop.Key.VrfName),
+		Dst:      nexthop.Key.Dst,
+		Dev:      nexthop.Key.Dev,
+		ID:       nexthop.ID,
+		Type:     nexthop.NhType,
+		Resolved: resolved,
+		Dmac:     dmac,
+		Tables:   make([]string, 0),
+		Updated:  time.Now(),
+		port:     nexthopPort(nexthop),
+	}
+	tables := make(map[string]bool)
+	for _, entries := range written {
+		for _, entry := range entries {
+			if e, ok := entry.(p4client.TableEntry); ok && !tables[e.Tablename] {
+				tables[e.Tablename] = true
+				status.Tables = append(status.Tables, e.Tablename)
+			}
+		}
+	}
+	sort.Strings(status.Tables)
+	switch {
+	case err != nil:
+		status.State = nhFailed
+		status.Error = err.Error()
+	case !resolved:
+		status.State = nhUnresolved
+	case len(status.Tables) == 0:
+		status.State = nhNoRewrite
+	default:
+		status.State = nhProgrammed
+	}
+	nexthopStatusLock.Lock()
+	nexthopStatuses[nexthop.Key] = status
+	nexthopStatusLock.Unlock()
+}
+
+// dropNexthopStatus drops the state of a deleted nexthop
+func dropNexthopStatus(key nm.NexthopKey) {
+	nexthopStatusLock.Lock()
+	defer nexthopStatusLock.Unlock()
+	delete(nexthopStatuses, key)
+}
+
+// NexthopStatuses returns the operational state of the nexthops, a nexthop
+// on a port down or kept off the device has its entries withdrawn
+func NexthopStatuses() []NexthopStatus {
+	nexthopStatusLock.Lock()
+	keys := make([]nm.NexthopKey, 0, len(nexthopStatuses))
+	list := make([]NexthopStatus, 0, len(nexthopStatuses))
+	for key, status := range nexthopStatuses {
+		keys = append(keys, key)
+		list = append(list, *status)
+	}
+	nexthopStatusLock.Unlock()
+	for i := range list {
+		switch {
+		case list[i].port != "" && !portUp(list[i].port):
+			list[i].State = nhPortDown
+			list[i].Tables = make([]string, 0)
+		case nexthopBlocked(keys[i]):
+			list[i].State = nhBlocked
+			list[i].Tables = make([]string, 0)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
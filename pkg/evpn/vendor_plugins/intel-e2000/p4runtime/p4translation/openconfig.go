@@ -0,0 +1,405 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// OcNetworkInstancesRoot openconfig-network-instance state tree, encoded as
+// RFC 7951 json, served by the gnmi service and the admin api
+type OcNetworkInstancesRoot struct {
+	NetworkInstances OcNetworkInstances `json:"openconfig-network-instance:network-instances"`
+}
+
+// OcNetworkInstances network-instances container
+type OcNetworkInstances struct {
+	NetworkInstance []OcNetworkInstance `json:"network-instance"`
+}
+
+// OcNetworkInstance network-instance list entry
+type OcNetworkInstance struct {
+	Name      string                 `json:"name"`
+	State     OcNetworkInstanceState `json:"state"`
+	Afts      OcAfts                 `json:"afts"`
+	Protocols OcProtocols            `json:"protocols"`
+}
+
+// OcNetworkInstanceState network-instance state container
+type OcNetworkInstanceState struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Enabled bool    `json:"enabled"`
+	Vni     *uint32 `json:"opi-intel-e2000:vni,omitempty"`
+	Table   *uint32 `json:"opi-intel-e2000:routing-table,omitempty"`
+}
+
+// OcAfts abstract forwarding tables of a network-instance
+type OcAfts struct {
+	Ipv4Unicast   OcIpv4Unicast   `json:"ipv4-unicast"`
+	NextHopGroups OcNextHopGroups `json:"next-hop-groups"`
+	NextHops      OcNextHops      `json:"next-hops"`
+}
+
+// OcIpv4Unicast ipv4-unicast aft
+type OcIpv4Unicast struct {
+	Ipv4Entry []OcIpv4Entry `json:"ipv4-entry"`
+}
+
+// OcIpv4Entry ipv4-entry list entry
+type OcIpv4Entry struct {
+	Prefix string           `json:"prefix"`
+	State  OcIpv4EntryState `json:"state"`
+}
+
+// OcIpv4EntryState ipv4-entry state container
+type OcIpv4EntryState struct {
+	Prefix       string `json:"prefix"`
+	NextHopGroup uint64 `json:"next-hop-group,string"`
+}
+
+// OcNextHopGroups next-hop-groups container
+type OcNextHopGroups struct {
+	NextHopGroup []OcNextHopGroup `json:"next-hop-group"`
+}
+
+// OcNextHopGroup next-hop-group list entry
+type OcNextHopGroup struct {
+	ID       uint64     `json:"id,string"`
+	NextHops OcGroupNhs `json:"next-hops"`
+}
+
+// OcGroupNhs next-hops of a next-hop-group
+type OcGroupNhs struct {
+	NextHop []OcGroupNh `json:"next-hop"`
+}
+
+// OcGroupNh next-hop reference of a next-hop-group
+type OcGroupNh struct {
+	Index uint64 `json:"index,string"`
+}
+
+// OcNextHops next-hops container
+type OcNextHops struct {
+	NextHop []OcNextHop `json:"next-hop"`
+}
+
+// OcNextHop next-hop list entry
+type OcNextHop struct {
+	Index uint64         `json:"index,string"`
+	State OcNextHopState `json:"state"`
+}
+
+// OcNextHopState next-hop state container
+type OcNextHopState struct {
+	Index     uint64 `json:"index,string"`
+	IPAddress string `json:"ip-address,omitempty"`
+	Interface string `json:"opi-intel-e2000:port,omitempty"`
+	Active    bool   `json:"opi-intel-e2000:active"`
+}
+
+// OcProtocols protocols container, only the static protocol of the injected
+// routes is reported
+type OcProtocols struct {
+	Protocol []OcProtocol `json:"protocol"`
+}
+
+// OcProtocol protocol list entry
+type OcProtocol struct {
+	Identifier   string         `json:"identifier"`
+	Name         string         `json:"name"`
+	StaticRoutes OcStaticRoutes `json:"static-routes"`
+}
+
+// OcStaticRoutes static-routes container
+type OcStaticRoutes struct {
+	Static []OcStatic `json:"static"`
+}
+
+// OcStatic static route list entry
+type OcStatic struct {
+	Prefix   string           `json:"prefix"`
+	State    OcStaticState    `json:"state"`
+	NextHops OcStaticNextHops `json:"next-hops"`
+}
+
+// OcStaticState static route state container
+type OcStaticState struct {
+	Prefix     string `json:"prefix"`
+	Direction  string `json:"opi-intel-e2000:direction,omitempty"`
+	Table      uint32 `json:"opi-intel-e2000:routing-table,omitempty"`
+	Programmed bool   `json:"opi-intel-e2000:programmed"`
+}
+
+// OcStaticNextHops next-hops of a static route
+type OcStaticNextHops struct {
+	NextHop []OcStaticNextHop `json:"next-hop"`
+}
+
+// OcStaticNextHop next-hop list entry of a static route
+type OcStaticNextHop struct {
+	Index string `json:"index"`
+	State struct {
+		Index   string `json:"index"`
+		NextHop string `json:"next-hop"`
+	} `json:"state"`
+}
+
+// OcInterfacesRoot openconfig-interfaces state tree
+type OcInterfacesRoot struct {
+	Interfaces OcInterfaces `json:"openconfig-interfaces:interfaces"`
+}
+
+// OcInterfaces interfaces container
+type OcInterfaces struct {
+	Interface []OcInterface `json:"interface"`
+}
+
+// OcInterface interface list entry
+type OcInterface struct {
+	Name  string           `json:"name"`
+	State OcInterfaceState `json:"state"`
+}
+
+// OcInterfaceState interface state container
+type OcInterfaceState struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	AdminStatus string      `json:"admin-status"`
+	OperStatus  string      `json:"oper-status"`
+	Counters    *OcCounters `json:"counters,omitempty"`
+}
+
+// OcCounters interface counters container
+type OcCounters struct {
+	InOctets   uint64 `json:"in-octets,string"`
+	InPkts     uint64 `json:"in-pkts,string"`
+	InErrors   uint64 `json:"in-errors,string"`
+	InDiscards uint64 `json:"in-discards,string"`
+	OutOctets  uint64 `json:"out-octets,string"`
+	OutPkts    uint64 `json:"out-pkts,string"`
+	OutErrors  uint64 `json:"out-errors,string"`
+	OutDiscard uint64 `json:"out-discards,string"`
+}
+
+// ocStatus converts a boolean state to an openconfig status
+func ocStatus(up bool) string {
+	if up {
+		return "UP"
+	}
+	return "DOWN"
+}
+
+// readCounter reads a statistics counter of a network device
+func readCounter(dev string, counter string) uint64 {
+	value, _ := strconv.ParseUint(readSysfs(dev, path.Join("statistics", counter)), 10, 64)
+	return value
+}
+
+// ocCounters reads the counters of a network device
+func ocCounters(dev string) *OcCounters {
+	return &OcCounters{
+		InOctets:   readCounter(dev, "rx_bytes"),
+		InPkts:     readCounter(dev, "rx_packets"),
+		InErrors:   readCounter(dev, "rx_errors"),
+		InDiscards: readCounter(dev, "rx_dropped"),
+		OutOctets:  readCounter(dev, "tx_bytes"),
+		OutPkts:    readCounter(dev, "tx_packets"),
+		OutErrors:  readCounter(dev, "tx_errors"),
+		OutDiscard: readCounter(dev, "tx_dropped"),
+	}
+}
+
+// ocAfts builds the forwarding tables of a vrf from the routes programmed,
+// the next-hop-groups are numbered per distinct set of nexthops
+func ocAfts(vrf *infradb.Vrf) OcAfts {
+	afts := OcAfts{}
+	groups := make(map[string]uint64)
+	nexthops := make(map[uint64]bool)
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	var keys = make([]nm.RouteKey, 0)
+	for key, route := range routeCache {
+		if route.Vrf != nil && route.Vrf.Name == vrf.Name || route.Vrf == nil && key.Table > 0 && _isVrfTable(vrf, uint32(key.Table)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Dst < keys[j].Dst })
+	for _, key := range keys {
+		route := routeCache[key]
+		var indexes = make([]string, 0, len(route.Nexthops))
+		for _, nexthop := range route.Nexthops {
+			indexes = append(indexes, strconv.Itoa(nexthop.ID))
+		}
+		sort.Strings(indexes)
+		groupKey := strings.Join(indexes, ",")
+		id, found := groups[groupKey]
+		if !found {
+			id = uint64(len(groups) + 1)
+			groups[groupKey] = id
+			group := OcNextHopGroup{ID: id}
+			for _, nexthop := range route.Nexthops {
+				group.NextHops.NextHop = append(group.NextHops.NextHop, OcGroupNh{Index: uint64(nexthop.ID)})
+				if nexthops[uint64(nexthop.ID)] {
+					continue
+				}
+				nexthops[uint64(nexthop.ID)] = true
+				port := nexthopPort(*nexthop)
+				afts.NextHops.NextHop = append(afts.NextHops.NextHop, OcNextHop{
+					Index: uint64(nexthop.ID),
+					State: OcNextHopState{
+						Index:     uint64(nexthop.ID),
+						IPAddress: nexthop.Key.Dst,
+						Interface: port,
+						Active:    portIsUp(port),
+					},
+				})
+			}
+			afts.NextHopGroups.NextHopGroup = append(afts.NextHopGroups.NextHopGroup, group)
+		}
+		afts.Ipv4Unicast.Ipv4Entry = append(afts.Ipv4Unicast.Ipv4Entry, OcIpv4Entry{
+			Prefix: key.Dst,
+			State:  OcIpv4EntryState{Prefix: key.Dst, NextHopGroup: id},
+		})
+	}
+	return afts
+}
+
+// ocProtocols reports the routes injected in a network-instance as static
+// routes
+func ocProtocols(name string) OcProtocols {
+	protocols := OcProtocols{Protocol: make([]OcProtocol, 0)}
+	static := OcProtocol{Identifier: "openconfig-policy-types:STATIC", Name: "static"}
+	for _, route := range InjectedRoutes() {
+		if staticRouteVrf(route) != name {
+			continue
+		}
+		entry := OcStatic{Prefix: route.Prefix, State: OcStaticState{
+			Prefix:     route.Prefix,
+			Direction:  route.Direction,
+			Table:      route.Table,
+			Programmed: injectedRouteProgrammed(route),
+		}}
+		for i, gw := range route.Nexthops {
+			nexthop := OcStaticNextHop{Index: strconv.Itoa(i)}
+			nexthop.State.Index = nexthop.Index
+			nexthop.State.NextHop = gw
+			entry.NextHops.NextHop = append(entry.NextHops.NextHop, nexthop)
+		}
+		static.StaticRoutes.Static = append(static.StaticRoutes.Static, entry)
+	}
+	if len(static.StaticRoutes.Static) != 0 {
+		protocols.Protocol = append(protocols.Protocol, static)
+	}
+	return protocols
+}
+
+// OcNetworkInstanceTree returns the vrfs and their forwarding tables as
+// openconfig network-instances
+func OcNetworkInstanceTree() OcNetworkInstancesRoot {
+	root := OcNetworkInstancesRoot{}
+	root.NetworkInstances.NetworkInstance = make([]OcNetworkInstance, 0)
+	vrfs, err := infradb.GetAllVrfs()
+	if err != nil {
+		return root
+	}
+	sort.Slice(vrfs, func(i, j int) bool { return vrfs[i].Name < vrfs[j].Name })
+	for _, vrf := range vrfs {
+		name := path.Base(vrf.Name)
+		ni := OcNetworkInstance{
+			Name: name,
+			State: OcNetworkInstanceState{
+				Name:    name,
+				Type:    "openconfig-network-instance-types:L3VRF",
+				Enabled: vrf.Status != nil && offloaded(vrf.Status.Components),
+			},
+			Afts:      ocAfts(vrf),
+			Protocols: ocProtocols(name),
+		}
+		if _isDefaultVrfName(name) {
+			ni.State.Type = "openconfig-network-instance-types:DEFAULT_INSTANCE"
+		}
+		if vrf.Spec != nil {
+			ni.State.Vni = vrf.Spec.Vni
+		}
+		if vrf.Metadata != nil && len(vrf.Metadata.RoutingTable) != 0 {
+			ni.State.Table = vrf.Metadata.RoutingTable[0]
+		}
+		root.NetworkInstances.NetworkInstance = append(root.NetworkInstances.NetworkInstance, ni)
+	}
+	return root
+}
+
+// OcInterfaceTree returns the uplinks and the vports as openconfig interfaces
+// with their administrative and operational status
+func OcInterfaceTree() OcInterfacesRoot {
+	root := OcInterfacesRoot{}
+	root.Interfaces.Interface = make([]OcInterface, 0)
+
+	decoderLock.RLock()
+	var profiles = append([]UplinkConfig{}, uplinks...)
+	decoderLock.RUnlock()
+	var sviStats = SviCounterStats()
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	for _, uplink := range profiles {
+		root.Interfaces.Interface = append(root.Interfaces.Interface, OcInterface{
+			Name: uplink.Name,
+			State: OcInterfaceState{
+				Name:        uplink.Name,
+				Type:        "iana-if-type:ethernetCsmacd",
+				AdminStatus: ocStatus(!portAdminDown[uplink.Name]),
+				OperStatus:  ocStatus(readSysfs(uplink.Rep, "operstate") == "up" && portIsUp(uplink.Name)),
+				Counters:    ocCounters(uplink.Rep),
+			},
+		})
+	}
+	if bps, err := infradb.GetAllBPs(); err == nil {
+		sort.Slice(bps, func(i, j int) bool { return bps[i].Name < bps[j].Name })
+		for _, bp := range bps {
+			if bp.Metadata == nil || bp.Metadata.VPort == "" {
+				continue
+			}
+			name := vportName(bp.Metadata.VPort)
+			root.Interfaces.Interface = append(root.Interfaces.Interface, OcInterface{
+				Name: name,
+				State: OcInterfaceState{
+					Name:        name,
+					Type:        "iana-if-type:ethernetCsmacd",
+					AdminStatus: ocStatus(!portAdminDown[name]),
+					OperStatus:  ocStatus(portIsUp(name)),
+				},
+			})
+		}
+	}
+	for _, svi := range sviStats {
+		name := path.Base(svi.Name)
+		root.Interfaces.Interface = append(root.Interfaces.Interface, OcInterface{
+			Name: name,
+			State: OcInterfaceState{
+				Name:        name,
+				Type:        "iana-if-type:l3ipvlan",
+				AdminStatus: ocStatus(true),
+				OperStatus:  ocStatus(true),
+				Counters: &OcCounters{
+					InOctets:  uint64(svi.RoutedInBytes),
+					InPkts:    uint64(svi.RoutedInPackets),
+					OutOctets: uint64(svi.RoutedOutBytes),
+					OutPkts:   uint64(svi.RoutedOutPackets),
+				},
+			},
+		})
+	}
+	return root
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+)
+
+// OcNetworkInstancesConfig openconfig-network-instance config tree, as
+// received in a gnmi Set with json_ietf encoding
+type OcNetworkInstancesConfig struct {
+	NetworkInstances struct {
+		NetworkInstance []OcNetworkInstanceConfig `json:"network-instance"`
+	} `json:"openconfig-network-instance:network-instances"`
+}
+
+// OcNetworkInstanceConfig network-instance list entry
+type OcNetworkInstanceConfig struct {
+	Name   string `json:"name"`
+	Config struct {
+		Name     string  `json:"name"`
+		Type     string  `json:"type"`
+		Enabled  *bool   `json:"enabled"`
+		Vni      *uint32 `json:"opi-intel-e2000:vni"`
+		Loopback string  `json:"opi-intel-e2000:loopback"`
+		Vtep     string  `json:"opi-intel-e2000:vtep"`
+	} `json:"config"`
+	Protocols struct {
+		Protocol []OcProtocolConfig `json:"protocol"`
+	} `json:"protocols"`
+}
+
+// OcProtocolConfig protocol list entry, only the static protocol is mapped
+type OcProtocolConfig struct {
+	Identifier   string `json:"identifier"`
+	Name         string `json:"name"`
+	StaticRoutes struct {
+		Static []OcStaticConfig `json:"static"`
+	} `json:"static-routes"`
+}
+
+// OcStaticConfig static route list entry, the direction and the routing
+// table of the injected route are augmented
+type OcStaticConfig struct {
+	Prefix string `json:"prefix"`
+	Config struct {
+		Direction string `json:"opi-intel-e2000:direction"`
+		Table     uint32 `json:"opi-intel-e2000:routing-table"`
+	} `json:"config"`
+	NextHops struct {
+		NextHop []struct {
+			Index  string `json:"index"`
+			Config struct {
+				NextHop string `json:"next-hop"`
+			} `json:"config"`
+		} `json:"next-hop"`
+	} `json:"next-hops"`
+}
+
+// ocType strips the module prefix of an identityref
+func ocType(identity string) string {
+	return identity[strings.LastIndex(identity, ":")+1:]
+}
+
+// normalize fills the name from the config and maps the default instance to
+// the default underlay vrf
+func (ni *OcNetworkInstanceConfig) normalize() {
+	if ni.Name == "" {
+		ni.Name = ni.Config.Name
+	}
+	if ocType(ni.Config.Type) == "DEFAULT_INSTANCE" {
+		ni.Name = _defaultVrfName()
+	}
+}
+
+// staticRoutes maps the static routes of a network-instance
+func (ni OcNetworkInstanceConfig) staticRoutes() []StaticRoute {
+	var routes []StaticRoute
+	for _, protocol := range ni.Protocols.Protocol {
+		if ocType(protocol.Identifier) != "STATIC" {
+			continue
+		}
+		for _, static := range protocol.StaticRoutes.Static {
+			route := StaticRoute{Vrf: ni.Name, Prefix: static.Prefix, Direction: static.Config.Direction, Table: static.Config.Table}
+			sort.Slice(static.NextHops.NextHop, func(i, j int) bool {
+				return static.NextHops.NextHop[i].Index < static.NextHops.NextHop[j].Index
+			})
+			for _, nexthop := range static.NextHops.NextHop {
+				route.Nexthops = append(route.Nexthops, nexthop.Config.NextHop)
+			}
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// parseOptionalNet parses an optional prefix of the config
+func parseOptionalNet(value string) (*net.IPNet, error) {
+	if value == "" {
+		return nil, nil
+	}
+	ip, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix %q", value)
+	}
+	ipNet.IP = ip
+	return ipNet, nil
+}
+
+// ensureVrf creates the vrf of a network-instance when it does not exist yet
+func (ni OcNetworkInstanceConfig) ensureVrf() error {
+	switch ocType(ni.Config.Type) {
+	case "DEFAULT_INSTANCE":
+		return nil
+	case "", "L3VRF":
+		if _isDefaultVrfName(ni.Name) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("network-instance %s: type %s not supported", ni.Name, ni.Config.Type)
+	}
+	if ni.Config.Enabled != nil && !*ni.Config.Enabled {
+		return fmt.Errorf("network-instance %s: disabling a vrf is not supported, delete it instead", ni.Name)
+	}
+	name := vrfPrefix + ni.Name
+	if vrf, err := infradb.GetVrf(name); err == nil {
+		if ni.Config.Vni != nil && (vrf.Spec.Vni == nil || *vrf.Spec.Vni != *ni.Config.Vni) {
+			return fmt.Errorf("network-instance %s: changing the vni is not supported", ni.Name)
+		}
+		return nil
+	}
+	loopback, err := parseOptionalNet(ni.Config.Loopback)
+	if err != nil {
+		return fmt.Errorf("network-instance %s: %v", ni.Name, err)
+	}
+	vtep, err := parseOptionalNet(ni.Config.Vtep)
+	if err != nil {
+		return fmt.Errorf("network-instance %s: %v", ni.Name, err)
+	}
+	vrf, err := infradb.NewVrfWithArgs(name, ni.Config.Vni, loopback, vtep)
+	if err != nil {
+		return fmt.Errorf("network-instance %s: %v", ni.Name, err)
+	}
+	if err := infradb.CreateVrf(vrf); err != nil {
+		return fmt.Errorf("network-instance %s: %v", ni.Name, err)
+	}
+	log.Printf("intel-e2000: Created vrf %s from openconfig network-instance\n", name)
+	return nil
+}
+
+// ApplyOcNetworkInstances merges the network-instances into the vrfs and
+// injects their static routes, the static routes are injected once the vrf
+// and the nexthops are known so a controller retries the ones reported
+func ApplyOcNetworkInstances(cfg OcNetworkInstancesConfig) error {
+	var problems []string
+	for _, ni := range cfg.NetworkInstances.NetworkInstance {
+		ni.normalize()
+		if err := ni.ensureVrf(); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		for _, route := range ni.staticRoutes() {
+			if err := InjectRoute(route); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("intel-e2000: openconfig network-instances partially applied:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// ReplaceOcNetworkInstances applies the network-instances and withdraws the
+// static routes injected in them and not listed anymore, with all the static
+// routes of the network-instances not listed are withdrawn too, the vrfs not
+// listed are kept
+func ReplaceOcNetworkInstances(cfg OcNetworkInstancesConfig, all bool) error {
+	var problems []string
+	if err := ApplyOcNetworkInstances(cfg); err != nil {
+		problems = append(problems, err.Error())
+	}
+	listed := make(map[string]bool)
+	wanted := make(map[string]bool)
+	for _, ni := range cfg.NetworkInstances.NetworkInstance {
+		ni.normalize()
+		listed[ni.Name] = true
+		for _, route := range ni.staticRoutes() {
+			wanted[staticRouteID(route)] = true
+		}
+	}
+	for _, route := range InjectedRoutes() {
+		if !all && !listed[staticRouteVrf(route)] || wanted[staticRouteID(route)] {
+			continue
+		}
+		if err := WithdrawRoute(route); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("intel-e2000: openconfig network-instances partially replaced:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// DeleteOcNetworkInstances withdraws the static routes listed, a
+// network-instance listed without static routes is deleted with its vrf, the
+// static routes are matched by prefix so their nexthops may be omitted
+func DeleteOcNetworkInstances(cfg OcNetworkInstancesConfig) error {
+	var problems []string
+	for _, ni := range cfg.NetworkInstances.NetworkInstance {
+		ni.normalize()
+		listed := make(map[string]bool)
+		for _, route := range ni.staticRoutes() {
+			listed[staticRouteID(route)] = true
+		}
+		deleteVrf := len(listed) == 0 && !_isDefaultVrfName(ni.Name)
+		var routes []StaticRoute
+		for _, route := range InjectedRoutes() {
+			if staticRouteVrf(route) != ni.Name {
+				continue
+			}
+			if len(listed) == 0 || listed[staticRouteID(route)] {
+				delete(listed, staticRouteID(route))
+				routes = append(routes, route)
+			}
+		}
+		for id := range listed {
+			problems = append(problems, fmt.Sprintf("static route %s was not injected", id))
+		}
+		for _, route := range routes {
+			if err := WithdrawRoute(route); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		if !deleteVrf {
+			continue
+		}
+		if err := infradb.DeleteVrf(vrfPrefix + ni.Name); err != nil {
+			problems = append(problems, fmt.Sprintf("network-instance %s: %v", ni.Name, err))
+			continue
+		}
+		log.Printf("intel-e2000: Deleted vrf %s%s from openconfig network-instance\n", vrfPrefix, ni.Name)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("intel-e2000: openconfig network-instances partially deleted:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// p2pKey config key of the p2p path
+const p2pKey = "p2p"
+
+// P2PConfig p2p path config structure, the routes of the p2p vrfs whose
+// nexthops are all of the listed types are programmed in the p2p tables. Ecmp
+// adds the routes with several nexthops of these types
+type P2PConfig struct {
+	NexthopTypes []string `yaml:"nexthoptypes" json:"nexthoptypes"`
+	Ecmp         bool     `yaml:"ecmp" json:"ecmp"`
+}
+
+// p2pNexthopTypes nexthop types with a p2p neighbor, the ingress p2p table
+// only holds the physical and vxlan nexthops
+var p2pNexthopTypes = map[string]int{
+	"phy":   nm.PHY,
+	"vxlan": nm.VXLAN,
+	"tun":   nm.VXLAN,
+}
+
+var (
+	// p2pLock guards the p2p config
+	p2pLock sync.RWMutex
+
+	// p2pTypes nexthop types of the routes programmed in the p2p tables
+	p2pTypes = map[int]bool{nm.PHY: true}
+
+	// p2pEcmp the ecmp routes are programmed in the p2p tables
+	p2pEcmp = true
+)
+
+// loadP2PConfig reads the nexthop types of the p2p path, the physical
+// nexthops and their ecmp when unset
+func loadP2PConfig() {
+	cfg := P2PConfig{NexthopTypes: []string{"phy"}, Ecmp: true}
+	if err := viper.UnmarshalKey(p2pKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read p2p config: %v\n", err)
+		cfg = P2PConfig{NexthopTypes: []string{"phy"}, Ecmp: true}
+	}
+	types := make(map[int]bool)
+	for _, name := range cfg.NexthopTypes {
+		nhType, ok := p2pNexthopTypes[strings.ToLower(name)]
+		if !ok {
+			log.Printf("intel-e2000: Ignoring p2p nexthop type %s, only phy and vxlan have a p2p neighbor\n", name)
+			continue
+		}
+		types[nhType] = true
+	}
+	if len(types) == 0 {
+		types[nm.PHY] = true
+	}
+	p2pLock.Lock()
+	p2pTypes = types
+	p2pEcmp = cfg.Ecmp
+	p2pLock.Unlock()
+	log.Printf("intel-e2000: P2P path nexthop types %v ecmp %t\n", cfg.NexthopTypes, cfg.Ecmp)
+}
+
+// _isP2PRoute checks the route is programmed in the p2p tables
+func _isP2PRoute(route nm.RouteStruct) bool {
+	if !_isP2PVrf(route.Vrf) || len(route.Nexthops) == 0 {
+		return false
+	}
+	p2pLock.RLock()
+	defer p2pLock.RUnlock()
+	if len(route.Nexthops) > 1 && !p2pEcmp {
+		return false
+	}
+	for _, nexthop := range route.Nexthops {
+		if nexthop == nil || !p2pTypes[nexthop.NhType] {
+			return false
+		}
+	}
+	return true
+}
+
+// _isV6Route checks the route is an ipv6 one
+func _isV6Route(route nm.RouteStruct) bool {
+	return route.Route0.Dst != nil && route.Route0.Dst.IP.To4() == nil
+}
+
+// _p2pV6Route returns the p2p entries of an ipv6 underlay route: the host
+// routes go to the v6 p2p lem table and the prefixes to the v6 p2p routing
+// table under the v6 p2p root lut
+func (l L3Decoder) _p2pV6Route(route nm.RouteStruct, del bool, ecmpFlag bool, entries []interface{}, e EcmpDispatcher) []interface{} {
+	var ec uint16
+	if ecmpFlag {
+		ec = uint16(1)
+	}
+	path, err := _p2pPath(route, !del, ecmpFlag, e)
+	if err != nil {
+		_logUnresolvedRoute(route, err)
+		return entries
+	}
+	var entry p4client.TableEntry
+	if ones, bits := route.Route0.Dst.Mask.Size(); ones == bits {
+		entry = p4client.TableEntry{
+			Tablename: l3P2PRtHostV6,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"vrf":       {bigEndian16(l.getVrfID(route)), "exact"},
+					"direction": {uint16(path.dir), "exact"},
+					"dst_ip":    {route.Route0.Dst, "exact"},
+				},
+				Priority: int32(0),
+			},
+		}
+	} else {
+		entry = p4client.TableEntry{
+			Tablename: l3P2PRtV6,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					"ipv6_table_lpm_root2": {trieIndexPool.GetID(TcamPrefix.P2PV6), "exact"},
+					"dst_ip":               {route.Route0.Dst, "lpm"},
+				},
+				Priority: int32(1),
+			},
+		}
+	}
+	if !del {
+		entry.Action = p4client.Action{
+			ActionName: "evpn_gw_control.set_p2p_neighbor",
+			Params:     []interface{}{uint16(path.neighbor), ec},
+		}
+	}
+	return append(entries, entry)
+}
@@ -9,22 +9,23 @@ package p4translation
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os/exec"
-	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/opiproject/opi-evpn-bridge/pkg/config"
 	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
 	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/common"
 	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/subscriberframework/eventbus"
 	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
 	eb "github.com/opiproject/opi-evpn-bridge/pkg/netlink/eventbus"
 	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -106,43 +107,24 @@ var (
 
 	// Conn default grpc connection
 	Conn *grpc.ClientConn
+
+	// decoderLock guards the decoders against a concurrent reload
+	decoderLock sync.RWMutex
 )
 
-// startSubscriber  set the subscriber handlers
+// startSubscriber  set the subscriber feeding the event stream
 func startSubscriber(eventBus *eb.EventBus, eventType string) {
 	subscriber := eventBus.Subscribe(eventType)
 
 	go func() {
 		for {
 			select {
-			case event := <-subscriber.Ch:
-				log.Printf("intel-e2000: Subscriber for %s received event\n", eventType)
-				switch eventType {
-				case "route_added":
-					handleRouteAdded(event)
-				case "route_updated":
-					handleRouteUpdated(event)
-				case "route_deleted":
-					handleRouteDeleted(event)
-				case "nexthop_added":
-					handleNexthopAdded(event)
-				case "nexthop_updated":
-					handleNexthopUpdated(event)
-				case "nexthop_deleted":
-					handleNexthopDeleted(event)
-				case "fdb_entry_added":
-					handleFbdEntryAdded(event)
-				case "fdb_entry_updated":
-					handleFbdEntryUpdated(event)
-				case "fdb_entry_deleted":
-					handleFbdEntryDeleted(event)
-				case "l2_nexthop_added":
-					handleL2NexthopAdded(event)
-				case "l2_nexthop_updated":
-					handleL2NexthopUpdated(event)
-				case "l2_nexthop_deleted":
-					handleL2NexthopDeleted(event)
+			case event, ok := <-subscriber.Ch:
+				if !ok {
+					return
 				}
+				log.Printf("intel-e2000: Subscriber for %s received event\n", eventType)
+				publishToStream(eventType, event)
 			case <-subscriber.Quit:
 				return
 			}
@@ -150,242 +132,308 @@ func startSubscriber(eventBus *eb.EventBus, eventType string) {
 	}()
 }
 
+// dispatchEvent  dispatch the netlink event to its handler
+func dispatchEvent(eventType string, event interface{}) {
+	decoderLock.RLock()
+	defer decoderLock.RUnlock()
+	eventType, ok := dedupEvent(eventType, event)
+	if !ok {
+		return
+	}
+	var err error
+	switch eventType {
+	case "route_added":
+		err = handleRouteAdded(event)
+	case "route_updated":
+		err = handleRouteUpdated(event)
+	case "route_deleted":
+		err = handleRouteDeleted(event)
+	case "nexthop_added":
+		err = handleNexthopAdded(event)
+	case "nexthop_updated":
+		err = handleNexthopUpdated(event)
+	case "nexthop_deleted":
+		err = handleNexthopDeleted(event)
+	case "fdb_entry_added":
+		err = handleFbdEntryAdded(event)
+	case "fdb_entry_updated":
+		err = handleFbdEntryUpdated(event)
+	case "fdb_entry_deleted":
+		err = handleFbdEntryDeleted(event)
+	case "l2_nexthop_added":
+		err = handleL2NexthopAdded(event)
+	case "l2_nexthop_updated":
+		err = handleL2NexthopUpdated(event)
+	case "l2_nexthop_deleted":
+		err = handleL2NexthopDeleted(event)
+	}
+	if err != nil {
+		failDispatch(eventType, event)
+	}
+}
+
 // handleRouteAdded  handles the added route
-func handleRouteAdded(route interface{}) {
-	var entries []interface{}
+func handleRouteAdded(route interface{}) error {
 	routeData, _ := route.(*nm.RouteStruct)
 	if routeData != nil {
-		entries = L3.translateAddedRoute(*routeData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Printf("intel-e2000: Entry is not of type p4client.TableEntry:- %v\n", e)
-			}
-		}
+		recordChurn(churnRoute, routeChurnKey(*routeData), churnAdd)
+		if err := checkRoute(*routeData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
+		}
+		best, ok := electRoute(*routeData, false)
+		if !ok {
+			log.Printf("intel-e2000: Route %+v from %s metric %d not offloaded, preferring %s metric %d\n", routeData.Key,
+				routeData.Route0.Protocol, routeData.Route0.Priority, best.Route0.Protocol, best.Route0.Priority)
+			return nil
+		}
+		return installRoute(best)
 	}
+	return nil
 }
 
 // handleRouteUpdated  handles the updated route
-func handleRouteUpdated(route interface{}) {
-	var entries []interface{}
+func handleRouteUpdated(route interface{}) error {
 	routeData, _ := route.(*nm.RouteStruct)
 	if routeData != nil {
-		entries = L3.translateDeletedRoute(*routeData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				err := p4client.DelEntry(e)
-				if err != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, err)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
-		entries = L3.translateAddedRoute(*routeData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
+		recordChurn(churnRoute, routeChurnKey(*routeData), churnUpdate)
+		if err := checkRoute(*routeData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
+		}
+		best, ok := electRoute(*routeData, true)
+		if !ok {
+			log.Printf("intel-e2000: Route %+v from %s metric %d not offloaded, preferring %s metric %d\n", routeData.Key,
+				routeData.Route0.Protocol, routeData.Route0.Priority, best.Route0.Protocol, best.Route0.Priority)
+			return nil
+		}
+		return installRoute(best)
 	}
+	return nil
 }
 
 // handleRouteDeleted  handles the deleted route
-func handleRouteDeleted(route interface{}) {
-	var entries []interface{}
+func handleRouteDeleted(route interface{}) error {
 	routeData, _ := route.(*nm.RouteStruct)
 	if routeData != nil {
-		entries = L3.translateDeletedRoute(*routeData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
+		recordChurn(churnRoute, routeChurnKey(*routeData), churnDelete)
+		if err := checkRoute(*routeData); err != nil {
+			log.Printf("%v, never programmed\n", err)
+			return nil
+		}
+		next, hasNext, elected := withdrawCandidate(*routeData)
+		if !elected {
+			log.Printf("intel-e2000: Route %+v from %s was not offloaded\n", routeData.Key, routeData.Route0.Protocol)
+			return nil
+		}
+		if hasNext {
+			log.Printf("intel-e2000: Route %+v from %s withdrawn, falling back to %s\n", routeData.Key, routeData.Route0.Protocol, next.Route0.Protocol)
+			return installRoute(next)
+		}
+		live, ok := uncacheRoute(*routeData)
+		if !ok {
+			log.Printf("intel-e2000: All nexthops of route %+v are down, already withdrawn\n", routeData.Key)
+			dropRouteProbe(routeData.Key)
+			unmeterRoute(routeData.Key)
+			return nil
+		}
+		err := delEntries(L3.translateDeletedRoute(live))
+		dropRouteProbe(routeData.Key)
+		unmeterRoute(routeData.Key)
+		return err
 	}
+	return nil
 }
 
 // handleNexthopAdded  handles the added nexthop
-func handleNexthopAdded(nexthop interface{}) {
-	var entries []interface{}
+func handleNexthopAdded(nexthop interface{}) error {
 	nexthopData, _ := nexthop.(*nm.NexthopStruct)
 	if nexthopData != nil {
-		entries = L3.translateAddedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
-		entries = Vxlan.translateAddedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
+		recordChurn(churnNexthop, nexthopChurnKey(*nexthopData), churnAdd)
+		if err := checkNexthop(*nexthopData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
+		}
+		// The slot is claimed here only, the other events look it up
+		if _, err := claimNeighborSlot(nexthopData.ID); err != nil {
+			log.Printf("%v, not programming\n", err)
+			recordNexthopStatus(*nexthopData, err)
+			return err
+		}
+		if !cacheNexthop(*nexthopData) {
+			log.Printf("intel-e2000: Port of nexthop %+v is down, not programming\n", nexthopData.Key)
+			recordNexthopStatus(*nexthopData, nil)
+			return nil
+		}
+		if spoofedNexthop(*nexthopData) {
+			recordNexthopStatus(*nexthopData, nil)
+			return nil
+		}
+		return programNexthop(*nexthopData)
+	}
+	return nil
+}
+
+// programNexthop writes the entries of a nexthop and records its state
+func programNexthop(nexthop nm.NexthopStruct) error {
+	yieldNeighborNexthop(nexthop.Key)
+	l3Entries := L3.translateAddedNexthop(nexthop)
+	vxlanEntries := Vxlan.translateAddedNexthop(nexthop)
+	err := addEntries(l3Entries)
+	if vxlanErr := addEntries(vxlanEntries); err == nil {
+		err = vxlanErr
 	}
+	recordNexthopStatus(nexthop, err, l3Entries, vxlanEntries)
+	return err
 }
 
 // handleNexthopUpdated  handles the updated nexthop
-//
-//gocognit:ignore
-func handleNexthopUpdated(nexthop interface{}) {
-	var entries []interface{}
+func handleNexthopUpdated(nexthop interface{}) error {
 	nexthopData, _ := nexthop.(*nm.NexthopStruct)
 	if nexthopData != nil {
-		entries = L3.translateDeletedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
+		recordChurn(churnNexthop, nexthopChurnKey(*nexthopData), churnUpdate)
+		if err := checkNexthop(*nexthopData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
+		}
+		if !cacheNexthop(*nexthopData) {
+			log.Printf("intel-e2000: Port of nexthop %+v is down, not programming\n", nexthopData.Key)
+			recordNexthopStatus(*nexthopData, nil)
+			return nil
+		}
+		wasBlocked := unblockNexthop(nexthopData.Key)
+		if !wasBlocked {
+			err := delEntries(L3.translateDeletedNexthop(*nexthopData))
+			if vxlanErr := delEntries(Vxlan.translateDeletedNexthop(*nexthopData)); err == nil {
+				err = vxlanErr
 			}
-		}
-		entries = Vxlan.translateDeletedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
-		entries = L3.translateAddedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
+			if err != nil {
+				return err
 			}
 		}
-		entries = Vxlan.translateAddedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if spoofedNexthop(*nexthopData) {
+			recordNexthopStatus(*nexthopData, nil)
+			return nil
 		}
+		return programNexthop(*nexthopData)
 	}
+	return nil
 }
 
 // handleNexthopDeleted  handles the deleted nexthop
-func handleNexthopDeleted(nexthop interface{}) {
-	var entries []interface{}
+func handleNexthopDeleted(nexthop interface{}) error {
 	nexthopData, _ := nexthop.(*nm.NexthopStruct)
 	if nexthopData != nil {
-		entries = L3.translateDeletedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
-		entries = Vxlan.translateDeletedNexthop(*nexthopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
-		}
+		recordChurn(churnNexthop, nexthopChurnKey(*nexthopData), churnDelete)
+		defer releaseNeighborSlot(nexthopData.ID)
+		if err := checkNexthop(*nexthopData); err != nil {
+			log.Printf("%v, never programmed\n", err)
+			return nil
+		}
+		defer dropNexthopStatus(nexthopData.Key)
+		blocked := unblockNexthop(nexthopData.Key)
+		if !uncacheNexthop(*nexthopData) {
+			log.Printf("intel-e2000: Port of nexthop %+v is down, already withdrawn\n", nexthopData.Key)
+			return nil
+		}
+		if blocked {
+			return nil
+		}
+		err := delEntries(L3.translateDeletedNexthop(*nexthopData))
+		if vxlanErr := delEntries(Vxlan.translateDeletedNexthop(*nexthopData)); err == nil {
+			err = vxlanErr
+		}
+		return err
 	}
+	return nil
 }
 
 // handleFbdEntryAdded  handles the added fdb entry
-func handleFbdEntryAdded(fbdEntry interface{}) {
+func handleFbdEntryAdded(fbdEntry interface{}) error {
 	var entries []interface{}
+	var first error
 	fbdEntryData, _ := fbdEntry.(*nm.FdbEntryStruct)
 	if fbdEntryData != nil {
+		if err := checkFdb(*fbdEntryData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
+		}
+		cacheFdb(*fbdEntryData)
 		entries = Vxlan.translateAddedFdb(*fbdEntryData)
 		for _, entry := range entries {
 			if e, ok := entry.(p4client.TableEntry); ok {
 				er := p4client.AddEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 			}
 		}
+		if spoofedFdb(*fbdEntryData) {
+			return first
+		}
 		entries = Pod.translateAddedFdb(*fbdEntryData)
 		for _, entry := range entries {
 			if e, ok := entry.(p4client.TableEntry); ok {
 				er := p4client.AddEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 			}
 		}
 	}
+	return first
 }
 
 // handleFbdEntryUpdated  handles the updated fdb entry
 //
 //gocognit:ignore
-func handleFbdEntryUpdated(fdbEntry interface{}) {
+func handleFbdEntryUpdated(fdbEntry interface{}) error {
 	var entries []interface{}
+	var first error
 	fbdEntryData, _ := fdbEntry.(*nm.FdbEntryStruct)
 	if fbdEntryData != nil {
+		if err := checkFdb(*fbdEntryData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
+		}
+		cacheFdb(*fbdEntryData)
 		entries = Vxlan.translateDeletedFdb(*fbdEntryData)
 		for _, entry := range entries {
 			if e, ok := entry.(p4client.TableEntry); ok {
 				er := p4client.DelEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 			}
 		}
-		entries = Pod.translateDeletedFdb(*fbdEntryData)
+		if !unblockFdb(fbdEntryData.Key) {
+			entries = Pod.translateDeletedFdb(*fbdEntryData)
+		} else {
+			entries = nil
+		}
 		for _, entry := range entries {
 			if e, ok := entry.(p4client.TableEntry); ok {
 				er := p4client.DelEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
@@ -398,171 +446,166 @@ func handleFbdEntryUpdated(fdbEntry interface{}) {
 				er := p4client.AddEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 			}
 		}
+		if spoofedFdb(*fbdEntryData) {
+			return first
+		}
 		entries = Pod.translateAddedFdb(*fbdEntryData)
 		for _, entry := range entries {
 			if e, ok := entry.(p4client.TableEntry); ok {
 				er := p4client.AddEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 			}
 		}
 	}
+	return first
 }
 
 // handleFbdEntryDeleted  handles the deleted fdb entry
-func handleFbdEntryDeleted(fdbEntry interface{}) {
+func handleFbdEntryDeleted(fdbEntry interface{}) error {
 	var entries []interface{}
+	var first error
 	fbdEntryData, _ := fdbEntry.(*nm.FdbEntryStruct)
 	if fbdEntryData != nil {
+		if err := checkFdb(*fbdEntryData); err != nil {
+			log.Printf("%v, never programmed\n", err)
+			return nil
+		}
+		uncacheFdb(*fbdEntryData)
 		entries = Vxlan.translateDeletedFdb(*fbdEntryData)
 		for _, entry := range entries {
 			if e, ok := entry.(p4client.TableEntry); ok {
 				er := p4client.DelEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 			}
 		}
+		if unblockFdb(fbdEntryData.Key) {
+			return first
+		}
 		entries = Pod.translateDeletedFdb(*fbdEntryData)
 		for _, entry := range entries {
 			if e, ok := entry.(p4client.TableEntry); ok {
 				er := p4client.DelEntry(e)
 				if er != nil {
 					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
+					if first == nil {
+						first = er
+					}
 				}
 			} else {
 				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 			}
 		}
 	}
+	return first
 }
 
 // handleL2NexthopAdded  handles the added l2 nexthop
-func handleL2NexthopAdded(l2NextHop interface{}) {
-	var entries []interface{}
+func handleL2NexthopAdded(l2NextHop interface{}) error {
 	l2NextHopData, _ := l2NextHop.(*nm.L2NexthopStruct)
 	if l2NextHopData != nil {
-		entries = Vxlan.translateAddedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if err := checkL2Nexthop(*l2NextHopData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
 		}
-		entries = Pod.translateAddedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if !cacheL2Nexthop(*l2NextHopData) {
+			log.Printf("intel-e2000: Port of l2 nexthop %+v is down, not programming\n", l2NextHopData.Key)
+			return nil
 		}
+		err := addEntries(Vxlan.translateAddedL2Nexthop(*l2NextHopData))
+		if podErr := addEntries(Pod.translateAddedL2Nexthop(*l2NextHopData)); err == nil {
+			err = podErr
+		}
+		return err
 	}
+	return nil
 }
 
 // handleL2NexthopUpdated  handles the updated l2 nexthop
-//
-//gocognit:ignore
-func handleL2NexthopUpdated(l2NextHop interface{}) {
-	var entries []interface{}
+func handleL2NexthopUpdated(l2NextHop interface{}) error {
 	l2NextHopData, _ := l2NextHop.(*nm.L2NexthopStruct)
 	if l2NextHopData != nil {
-		entries = Vxlan.translateDeletedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if err := checkL2Nexthop(*l2NextHopData); err != nil {
+			log.Printf("%v, not programming\n", err)
+			return nil
 		}
-		entries = Pod.translateDeletedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if !cacheL2Nexthop(*l2NextHopData) {
+			log.Printf("intel-e2000: Port of l2 nexthop %+v is down, not programming\n", l2NextHopData.Key)
+			return nil
 		}
-		entries = Vxlan.translateAddedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		err := delEntries(Vxlan.translateDeletedL2Nexthop(*l2NextHopData))
+		if podErr := delEntries(Pod.translateDeletedL2Nexthop(*l2NextHopData)); err == nil {
+			err = podErr
 		}
-		entries = Pod.translateAddedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.AddEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("iintel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if vxlanErr := addEntries(Vxlan.translateAddedL2Nexthop(*l2NextHopData)); err == nil {
+			err = vxlanErr
+		}
+		if podErr := addEntries(Pod.translateAddedL2Nexthop(*l2NextHopData)); err == nil {
+			err = podErr
 		}
+		return err
 	}
+	return nil
 }
 
 // handleL2NexthopDeleted  handles the deleted l2 nexthop
-func handleL2NexthopDeleted(l2NextHop interface{}) {
-	var entries []interface{}
+func handleL2NexthopDeleted(l2NextHop interface{}) error {
 	l2NextHopData, _ := l2NextHop.(*nm.L2NexthopStruct)
 	if l2NextHopData != nil {
-		entries = Vxlan.translateDeletedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				err := p4client.DelEntry(e)
-				if err != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, err)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if err := checkL2Nexthop(*l2NextHopData); err != nil {
+			log.Printf("%v, never programmed\n", err)
+			return nil
 		}
-		entries = Pod.translateDeletedL2Nexthop(*l2NextHopData)
-		for _, entry := range entries {
-			if e, ok := entry.(p4client.TableEntry); ok {
-				er := p4client.DelEntry(e)
-				if er != nil {
-					log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
-				}
-			} else {
-				log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
-			}
+		if !uncacheL2Nexthop(*l2NextHopData) {
+			log.Printf("intel-e2000: Port of l2 nexthop %+v is down, already withdrawn\n", l2NextHopData.Key)
+			return nil
+		}
+		err := delEntries(Vxlan.translateDeletedL2Nexthop(*l2NextHopData))
+		if podErr := delEntries(Pod.translateDeletedL2Nexthop(*l2NextHopData)); err == nil {
+			err = podErr
 		}
+		return err
 	}
+	return nil
 }
 
 // HandleEvent  handles the infradb events
 func (h *ModuleipuHandler) HandleEvent(eventType string, objectData *eventbus.ObjectData) {
+	if deferObjectEvent(eventType, objectData) {
+		return
+	}
+	handled := objectEventReceived(eventType)
+	seq := logIntent(eventType, objectData)
+	defer ackIntent(seq)
+	decoderLock.RLock()
+	defer decoderLock.RUnlock()
+	defer handled(time.Now())
+	handleObjectEvent(eventType, objectData)
+}
+
+// handleObjectEvent dispatches the infradb object event to its handler
+func handleObjectEvent(eventType string, objectData *eventbus.ObjectData) {
 	switch eventType {
 	case "vrf":
 		log.Printf("intel-e2000: recevied %s %s\n", eventType, objectData.Name)
@@ -572,14 +615,21 @@ func (h *ModuleipuHandler) HandleEvent(eventType string, objectData *eventbus.Ob
 		handlelb(objectData)
 	case "bridge-port":
 		log.Printf("intel-e2000: recevied %s %s\n", eventType, objectData.Name)
+		if deferForDependencies(eventType, objectData) {
+			return
+		}
 		handlebp(objectData)
 	case "svi":
 		log.Printf("intel-e2000: recevied %s %s\n", eventType, objectData.Name)
+		if deferForDependencies(eventType, objectData) {
+			return
+		}
 		handlesvi(objectData)
 	default:
 
 		log.Println("intel-e2000: error: Unknown event type: ", eventType)
 	}
+	releaseDependents(eventType, objectData.Name)
 }
 
 // handlevrf  handles the vrf events
@@ -711,7 +761,6 @@ func handlelb(objectData *eventbus.ObjectData) {
 		comp.Name = intele2000Str
 		comp.Details = details
 		if status {
-			comp.Details = ""
 			comp.CompStatus = common.ComponentStatusSuccess
 			comp.Timer = 0
 		} else {
@@ -917,85 +966,113 @@ func handlesvi(objectData *eventbus.ObjectData) {
 
 // offloadVrf  offload the vrf events
 func offloadVrf(vrf *infradb.Vrf) (string, bool) {
-	if path.Base(vrf.Name) == grdStr {
+	if _isDefaultVrf(vrf) {
 		return "", true
 	}
+	if details := waitForDetail(ObjectRef{Kind: "vrf", Name: vrf.Name}, vrfLateDetail(vrf)); details != "" {
+		return details, true
+	}
 
-	entries := Vxlan.translateAddedVrf(vrf)
-	for _, entry := range entries {
-		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.AddEntry(e)
-			if er != nil {
-				log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-			}
-		} else {
-			log.Println("intel-e2000: Entry is not of type p4client.TableEntry:-", e)
-			return fmt.Sprintf("intel-e2000: Entry is not of type p4client.TableEntry:-%v", e), false
-		}
+	programmed := programmedEntries(vrf.Name)
+	delta := Vxlan.translateUpdatedVrf(vrf, programmed)
+	if err := admitEntries(vrf.Name, delta.Add); err != nil {
+		return err.Error(), false
 	}
-	return "", true
+	failed, entries, err := programDelta(programmed, delta)
+	if failed > 0 && _dualStack(vrf) {
+		entries, err = rollbackVrfFamilies(vrf, delta, entries)
+		recordObjectEntries(vrf.Name, entries)
+		return componentDetails(delta.Entries, failed, err, vrfTcamPrefixes(vrf)...), false
+	}
+	recordObjectEntries(vrf.Name, entries)
+	if errors.Is(err, ErrDeviceUnavailable) {
+		return err.Error(), false
+	}
+	return componentDetails(delta.Entries, failed, err, vrfTcamPrefixes(vrf)...), true
 }
 
 // setUpLb  set up the logical bridge
 func setUpLb(lb *infradb.LogicalBridge) (string, bool) {
-	entries := Vxlan.translateAddedLb(lb)
-	for _, entry := range entries {
-		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.AddEntry(e)
-			if er != nil {
-				log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-			}
-		} else {
-			log.Println("intel-e2000: Entry is not of type p4client.TableEntry:-", e)
-			return fmt.Sprintf("intel-e2000 setUpLb: Entry is not of type p4client.TableEntry:-%v", e), false
-		}
+	programmed := programmedEntries(lb.Name)
+	delta := Vxlan.translateUpdatedLb(lb, programmed)
+	if err := admitEntries(lb.Name, delta.Add); err != nil {
+		return err.Error(), false
 	}
-	return "", true
+	failed, entries, err := programDelta(programmed, delta)
+	recordObjectEntries(lb.Name, entries)
+	if errors.Is(err, ErrDeviceUnavailable) {
+		return err.Error(), false
+	}
+	details := newComponentDetails(delta.Entries, failed, err)
+	details.L2Only = _isL2Only(lb)
+	return details.String(), true
 }
 
 // setUpBp  set up the bridge port
 func setUpBp(bp *infradb.BridgePort) (string, bool) {
-	entries, err := Pod.translateAddedBp(bp)
+	if bp.Metadata != nil && !portUp(vportName(bp.Metadata.VPort)) {
+		log.Printf("intel-e2000: Port %s is down, not programming bridge port %s\n", vportName(bp.Metadata.VPort), bp.Name)
+		return ComponentDetails{Tables: make(map[string]int), PortDown: true}.String(), true
+	}
+	if details := waitForDetail(ObjectRef{Kind: "bridge-port", Name: bp.Name}, bpLateDetail(bp)); details != "" {
+		return details, true
+	}
+	if bulkTrunk(bp) {
+		return setUpBulkBp(bp)
+	}
+	programmed := programmedEntries(bp.Name)
+	delta, err := Pod.translateUpdatedBp(bp, programmed)
 	if err != nil {
 		return err.Error(), false
 	}
-	for _, entry := range entries {
-		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.AddEntry(e)
-			if er != nil {
-				log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-			}
-		} else {
-			log.Println("intel-e2000: Entry is not of type p4client.TableEntry:-", e)
-			return fmt.Sprintf("intel-e2000 setUpBp: Entry is not of type p4client.TableEntry:-%v", e), false
-		}
+	if err := admitEntries(bp.Name, delta.Add); err != nil {
+		return err.Error(), false
 	}
-	return "", true
+	failed, entries, err := programDelta(programmed, delta)
+	recordObjectEntries(bp.Name, entries)
+	if errors.Is(err, ErrDeviceUnavailable) {
+		return err.Error(), false
+	}
+	if err := applyBpRateLimit(bp); err != nil {
+		log.Printf("%v\n", err)
+		return err.Error(), false
+	}
+	return bpDetails(bp, delta.Entries, failed, err).String(), true
 }
 
 // setUpSvi  set up the svi
 func setUpSvi(svi *infradb.Svi) (string, bool) {
-	entries, err := Pod.translateAddedSvi(svi)
+	if details := waitForDetail(ObjectRef{Kind: "svi", Name: svi.Name}, sviLateDetail(svi)); details != "" {
+		return details, true
+	}
+	programmed := programmedEntries(svi.Name)
+	delta, err := Pod.translateUpdatedSvi(svi, programmed)
 	if err != nil {
 		return err.Error(), false
 	}
-	for _, entry := range entries {
-		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.AddEntry(e)
-			if er != nil {
-				log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-			}
-		} else {
-			log.Println("intel-e2000: Entry is not of type p4client.TableEntry:-", e)
-			return fmt.Sprintf("intel-e2000 setUpBp: Entry is not of type p4client.TableEntry:-%v", e), false
-		}
+	if err := admitEntries(svi.Name, delta.Add); err != nil {
+		return err.Error(), false
 	}
-	return "", true
+	failed, entries, werr := programDelta(programmed, delta)
+	recordObjectEntries(svi.Name, entries)
+	attachSvi(svi, entries)
+	if errors.Is(werr, ErrDeviceUnavailable) {
+		return werr.Error(), false
+	}
+	actions, err := applySviMeter(svi)
+	if err != nil {
+		log.Printf("%v\n", err)
+		return err.Error(), false
+	}
+	details := newComponentDetails(delta.Entries, failed, werr)
+	details.NotOffloaded = actions
+	return details.String(), true
 }
 
 // tearDownVrf  tear down the vrf
 func tearDownVrf(vrf *infradb.Vrf) (string, bool) {
-	if path.Base(vrf.Name) == grdStr {
+	dropPending(ObjectRef{Kind: "vrf", Name: vrf.Name})
+	if _isDefaultVrf(vrf) {
 		return "", true
 	}
 	// var entries []interface{}
@@ -1011,6 +1088,7 @@ func tearDownVrf(vrf *infradb.Vrf) (string, bool) {
 			return fmt.Sprintf("intel-e2000 tearDownVrf: Entry is not of type p4client.TableEntry"), false
 		}
 	}
+	forgetObjectEntries(vrf.Name)
 	return "", true
 }
 
@@ -1028,11 +1106,20 @@ func tearDownLb(lb *infradb.LogicalBridge) (string, bool) {
 			return fmt.Sprintf("intel-e2000 tearDownLb: Entry is not of type p4client.TableEntry"), false
 		}
 	}
+	forgetObjectEntries(lb.Name)
 	return "", true
 }
 
 // tearDownBp  tear down the bridge port
 func tearDownBp(bp *infradb.BridgePort) (string, bool) {
+	if cancelBulkJob(bp) {
+		return fmt.Sprintf("intel-e2000: cancelling the programming of bridge port %s", bp.Name), false
+	}
+	dropPending(ObjectRef{Kind: "bridge-port", Name: bp.Name})
+	if bp.Metadata != nil && !portUp(vportName(bp.Metadata.VPort)) {
+		log.Printf("intel-e2000: Port %s is down, bridge port %s already withdrawn\n", vportName(bp.Metadata.VPort), bp.Name)
+		return "", true
+	}
 	entries, err := Pod.translateDeletedBp(bp)
 	if err != nil {
 		return err.Error(), false
@@ -1048,11 +1135,14 @@ func tearDownBp(bp *infradb.BridgePort) (string, bool) {
 			return fmt.Sprintf("intel-e2000 tearDownBp: Entry is not of type p4client.TableEntry"), false
 		}
 	}
+	releaseBpRateLimit(bp)
+	forgetObjectEntries(bp.Name)
 	return "", true
 }
 
 // tearDownSvi  tear down the svi
 func tearDownSvi(svi *infradb.Svi) (string, bool) {
+	dropPending(ObjectRef{Kind: "svi", Name: svi.Name})
 	entries, err := Pod.translateDeletedSvi(svi)
 	if err != nil {
 		return err.Error(), false
@@ -1068,143 +1158,276 @@ func tearDownSvi(svi *infradb.Svi) (string, bool) {
 			return fmt.Sprintf("intel-e2000 tearDownSvi: Entry is not of type p4client.TableEntry"), false
 		}
 	}
+	detachSvi(svi, entries)
+	releaseSviMeter(svi)
+	forgetObjectEntries(svi.Name)
 	return "", true
 }
 
-// Initialize function handles init functionality
-//
-//gocognit:ignore
-func Initialize() {
-	// Netlink Listener
-	startSubscriber(nm.EventBus, nm.RouteAdded)
-	startSubscriber(nm.EventBus, nm.RouteUpdated)
-	startSubscriber(nm.EventBus, nm.RouteDeleted)
-	startSubscriber(nm.EventBus, nm.NexthopAdded)
-	startSubscriber(nm.EventBus, nm.NexthopUpdated)
-	startSubscriber(nm.EventBus, nm.NexthopDeleted)
-	startSubscriber(nm.EventBus, nm.FdbEntryAdded)
-	startSubscriber(nm.EventBus, nm.FdbEntryUpdated)
-	startSubscriber(nm.EventBus, nm.FdbEntryDeleted)
-	startSubscriber(nm.EventBus, nm.L2NexthopAdded)
-	startSubscriber(nm.EventBus, nm.L2NexthopUpdated)
-	startSubscriber(nm.EventBus, nm.L2NexthopDeleted)
-	// InfraDB Listener
-
-	eb := eventbus.EBus
-	for _, subscriberConfig := range config.GlobalConfig.Subscribers {
-		if subscriberConfig.Name == intele2000Str {
-			for _, eventType := range subscriberConfig.Events {
-				eb.StartSubscriber(subscriberConfig.Name, eventType, subscriberConfig.Priority, &ModuleipuHandler{})
-			}
-		}
-	}
-	// Setup p4runtime connection
-	Conn, err := grpc.Dial(defaultAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("intel-e2000: Cannot connect to server: %v\n", err)
-	}
-
-	err1 := p4client.NewP4RuntimeClient(config.GlobalConfig.P4.Config.BinFile, config.GlobalConfig.P4.Config.P4infoFile, Conn)
-	if err1 != nil {
-		log.Printf("intel-e2000: Failed to create P4Runtime client: %v\n", err1)
-	}
-	time.Sleep(time.Second * 60)
-	// add static rules into the pipeline of representators read from config
+// buildRepresentors builds the representors map from the interfaces config
+// and the uplink profiles completed with the discovered uplinks
+func buildRepresentors() map[string][2]string {
 	representors := make(map[string][2]string)
 
-	// Add the physical port representors
-	for i, port := range config.GlobalConfig.Interfaces.PhyPorts {
-		key := fmt.Sprintf("phy%d_rep", i)
-		vsi, mac, err := idsOf(port.Rep)
+	// Add the uplink representors
+	uplinks = discoverUplinks(loadUplinks())
+	for _, uplink := range uplinks {
+		vsi, mac, err := idsOf(uplink.Rep)
 		if err != nil {
-			log.Printf("Error getting ids for port %s: %v", port.Rep, err)
+			log.Printf("Error getting ids for uplink %s port %s: %v", uplink.Name, uplink.Rep, err)
 			continue
 		}
-		representors[key] = [2]string{vsi, mac}
+		representors[uplinkKey(uplink.Name)] = [2]string{vsi, mac}
 	}
 
 	// Add the other interfaces to the representors map
 	// Since these don't have a VSI, we'll just use an empty string for the second element
-	grpcAccVsi, grpcAccMac, err := idsOf(config.GlobalConfig.Interfaces.GrpcAcc)
+	interfaces := GlobalConfig().Interfaces
+	grpcAccVsi, grpcAccMac, err := idsOf(interfaces.GrpcAcc)
 	if err != nil {
 		log.Printf("Error getting ids for grpc_acc: %v", err)
 	} else {
 		representors["grpc_acc"] = [2]string{grpcAccVsi, grpcAccMac}
 	}
 
-	grpcHostVsi, grpcHostMac, err := idsOf(config.GlobalConfig.Interfaces.GrpcHost)
+	grpcHostVsi, grpcHostMac, err := idsOf(interfaces.GrpcHost)
 	if err != nil {
 		log.Printf("Error getting ids for grpc_host: %v", err)
 	} else {
 		representors["grpc_host"] = [2]string{grpcHostVsi, grpcHostMac}
 	}
 
-	vrfMuxVsi, vrfMuxMac, err := idsOf(config.GlobalConfig.Interfaces.VrfMux)
+	vrfMuxVsi, vrfMuxMac, err := idsOf(interfaces.VrfMux)
 	if err != nil {
 		log.Printf("Error getting ids for vrf_mux: %v", err)
 	} else {
 		representors["vrf_mux"] = [2]string{vrfMuxVsi, vrfMuxMac}
 	}
 
-	portMuxVsi, portMuxMac, err := idsOf(config.GlobalConfig.Interfaces.PortMux)
+	portMuxVsi, portMuxMac, err := idsOf(interfaces.PortMux)
 	if err != nil {
 		log.Printf("Error getting ids for port_mux: %v", err)
 	} else {
 		representors["port_mux"] = [2]string{portMuxVsi, portMuxMac}
 	}
-	log.Printf("intel-e2000: REPRESENTORS %+v\n", representors)
-	L3 = L3.L3DecoderInit(representors)
-	Pod = Pod.PodDecoderInit(representors)
-	Vxlan = Vxlan.VxlanDecoderInit(representors)
-	L3entries := L3.StaticAdditions()
-	for _, entry := range L3entries {
+	return representors
+}
+
+// addEntries adds the entries into the pipeline, it returns the first failure
+func addEntries(entries []interface{}) error {
+	var first error
+	notePending(entries, 1)
+	for _, entry := range entries {
 		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.AddEntry(e)
+			manageTable(e.Tablename)
+			if err := claimTcamRow(e); err != nil {
+				log.Printf("%v\n", err)
+				continue
+			}
+			er := writeError(e.Tablename, p4client.AddEntry(e))
 			if er != nil {
 				log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
+				if first == nil {
+					first = er
+				}
+				continue
 			}
+			noteLpmEntry(e, 1)
 		} else {
 			log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 		}
 	}
-	Podentries := Pod.StaticAdditions()
-	for _, entry := range Podentries {
-		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.AddEntry(e)
-			if er != nil {
-				log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, er)
-			}
-		} else {
+	return first
+}
+
+// entryProgrammed checks if the entry is programmed on the device, the tables
+// read are kept in programmed so each table is read once
+func entryProgrammed(e p4client.TableEntry, programmed map[string][]*p4_v1.TableEntry) (bool, error) {
+	tableEntries, read := programmed[e.Tablename]
+	if !read {
+		var err error
+		if tableEntries, err = p4client.GetEntry(e.Tablename); err != nil {
+			return false, err
+		}
+		programmed[e.Tablename] = tableEntries
+	}
+	return p4client.EntryExists(e, tableEntries)
+}
+
+// addStaticEntries adds the static entries into the pipeline idempotently, the
+// entries already programmed (e.g. before a restart) are modified in place
+func addStaticEntries(entries []interface{}) {
+	programmed := make(map[string][]*p4_v1.TableEntry)
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
 			log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
+			continue
+		}
+		manageTable(e.Tablename)
+		if err := claimTcamRow(e); err != nil {
+			log.Printf("%v\n", err)
+			continue
+		}
+		exists, err := entryProgrammed(e, programmed)
+		if err != nil {
+			log.Printf("intel-e2000: failed to read entries of %v error %v\n", e.Tablename, err)
+		}
+		if exists {
+			err = p4client.ModEntry(e)
+		} else {
+			err = p4client.AddEntry(e)
+		}
+		if err != nil {
+			log.Printf("intel-e2000: error programming static entry for %v error %v\n", e.Tablename, err)
 		}
 	}
 }
 
-// DeInitialize function handles stops functionality
-func DeInitialize() {
-	L3entries := L3.StaticDeletions()
-	for _, entry := range L3entries {
+// delEntries deletes the entries from the pipeline, it returns the first
+// failure
+func delEntries(entries []interface{}) error {
+	var first error
+	notePending(entries, -1)
+	for _, entry := range entries {
 		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.DelEntry(e)
+			er := writeError(e.Tablename, p4client.DelEntry(e))
 			if er != nil {
 				log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
+				if first == nil {
+					first = er
+				}
+				continue
 			}
+			releaseTcamRow(e)
+			noteLpmEntry(e, -1)
 		} else {
 			log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 		}
 	}
-	Podentries := Pod.StaticDeletions()
-	for _, entry := range Podentries {
-		if e, ok := entry.(p4client.TableEntry); ok {
-			er := p4client.DelEntry(e)
-			if er != nil {
-				log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, er)
+	return first
+}
+
+// Initialize function handles init functionality
+//
+//gocognit:ignore
+func Initialize() {
+	// validate the representors read from config before touching the pipeline
+	decoderLock.Lock()
+	representors := buildRepresentors()
+	log.Printf("intel-e2000: REPRESENTORS %+v\n", representors)
+	if err := validateRepresentors(representors); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	activeRepresentors = representors
+	configureUplinks()
+	decoderLock.Unlock()
+	loadEcmpSlots()
+	loadInjectedRoutes()
+	loadRoutePreference()
+	loadUnderlayVrfs()
+	loadP2PConfig()
+	loadBackpressureConfig()
+	loadBulkConfig()
+	loadFdbDirection()
+	loadL2ClassConfig()
+	loadChurnConfig()
+	loadTenantConfig()
+	loadDualStackConfig()
+	loadUrpfConfig()
+	loadChaosConfig()
+	// Netlink Listener
+	startEventStream()
+	startSubscriber(nm.EventBus, nm.RouteAdded)
+	startSubscriber(nm.EventBus, nm.RouteUpdated)
+	startSubscriber(nm.EventBus, nm.RouteDeleted)
+	startSubscriber(nm.EventBus, nm.NexthopAdded)
+	startSubscriber(nm.EventBus, nm.NexthopUpdated)
+	startSubscriber(nm.EventBus, nm.NexthopDeleted)
+	startSubscriber(nm.EventBus, nm.FdbEntryAdded)
+	startSubscriber(nm.EventBus, nm.FdbEntryUpdated)
+	startSubscriber(nm.EventBus, nm.FdbEntryDeleted)
+	startSubscriber(nm.EventBus, nm.L2NexthopAdded)
+	startSubscriber(nm.EventBus, nm.L2NexthopUpdated)
+	startSubscriber(nm.EventBus, nm.L2NexthopDeleted)
+	// InfraDB Listener
+	interrupted := openIntentLog()
+
+	eb := eventbus.EBus
+	for _, subscriberConfig := range GlobalConfig().Subscribers {
+		if subscriberConfig.Name == intele2000Str {
+			for _, eventType := range subscriberConfig.Events {
+				eb.StartSubscriber(subscriberConfig.Name, eventType, subscriberConfig.Priority, &ModuleipuHandler{})
 			}
-		} else {
-			log.Println("intel-e2000: Entry is not of type p4client.TableEntry")
 		}
 	}
+	// Setup p4runtime connection
+	var err error
+	Conn, err = grpc.Dial(defaultAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("intel-e2000: Cannot connect to server: %v\n", err)
+	}
+
+	err1 := connectP4Runtime(Conn)
+	if err1 != nil {
+		log.Printf("intel-e2000: Failed to create P4Runtime client: %v\n", err1)
+	}
+	setP4Connected(err1 == nil)
+	time.Sleep(time.Second * 60)
+	// add static rules into the pipeline of representators read from config
+	decoderLock.Lock()
+	L3 = L3.L3DecoderInit(representors)
+	Pod = Pod.PodDecoderInit(representors)
+	Vxlan = Vxlan.VxlanDecoderInit(representors)
+	addStaticEntries(L3.StaticAdditions())
+	addStaticEntries(Pod.StaticAdditions())
+	applyGrpcSteering(L3Decoder{}, L3)
+	loadStaticEntries()
+	if err1 == nil {
+		verifyStaticAdditions()
+	}
+	decoderLock.Unlock()
+	setInitialized()
+	replayIntents(interrupted)
+	replayInjectedRoutes()
+	startLinkMonitor()
+	installConfiguredNeighbors()
+	startNeighborOffload()
+	loadAntiSpoofConfig()
+	loadIPSourceGuardConfig()
+	startDriftWatchdog()
+	startReconciler()
+	startForeignScan()
+	startRouteProbe()
+	startIpfixExport()
+	startTableStats()
+	startTrieGc()
+	startModGc()
+	startPendingRetry()
+}
+
+// DeInitialize function handles stops functionality
+func DeInitialize() {
+	stopPendingRetry()
+	stopModGc()
+	stopTrieGc()
+	stopTableStats()
+	stopReconciler()
+	stopForeignScan()
+	stopIpfixExport()
+	stopRouteProbe()
+	stopDriftWatchdog()
+	stopNeighborOffload()
+	stopLinkMonitor()
+	decoderLock.Lock()
+	delEntries(dropRuleEntries())
+	delEntries(operatorStaticEntries())
+	delEntries(L3.StaticDeletions())
+	applyGrpcSteering(L3, L3Decoder{})
+	delEntries(Pod.StaticDeletions())
+	decoderLock.Unlock()
 
 	// unsubscriber all the events
 	nm.EventBus.Unsubscribe()
+	closeIntentLog()
 }
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/spf13/viper"
+)
+
+// pendingKey config key of the pending objects section
+const pendingKey = "pending"
+
+// PendingConfig pending objects config structure, the interval in seconds
+// between the attempts to translate them again
+type PendingConfig struct {
+	Interval int `yaml:"interval"`
+}
+
+// PendingObject object offloaded without its entries as a detail its
+// translation reads is not known yet
+type PendingObject struct {
+	Object   ObjectRef `json:"object"`
+	Missing  string    `json:"missing"`
+	Since    time.Time `json:"since"`
+	Attempts uint64    `json:"attempts"`
+}
+
+var (
+	// pendingLock guards the pending objects
+	pendingLock sync.Mutex
+
+	// pendingObjects objects waiting for a late detail keyed by reference
+	pendingObjects = make(map[ObjectRef]*PendingObject)
+
+	// pendingDone stops the pending objects retry
+	pendingDone chan struct{}
+)
+
+// _sviMacMissing checks the svi has no mac yet
+func _sviMacMissing(svi *infradb.Svi) bool {
+	return svi.Spec.MacAddress == nil || len(*svi.Spec.MacAddress) == 0
+}
+
+// vrfLateDetail returns the detail the translation of the vrf is missing, the
+// router mac frr reports once it set up the l3vpn
+func vrfLateDetail(vrf *infradb.Vrf) string {
+	if _isL3vpnEnabled(vrf) && len(_vrfRmac(vrf)) == 0 {
+		return "rmac"
+	}
+	return ""
+}
+
+// sviLateDetail returns the detail the translation of the svi is missing
+func sviLateDetail(svi *infradb.Svi) string {
+	if _sviMacMissing(svi) {
+		return "svi mac"
+	}
+	return ""
+}
+
+// bpLateDetail returns the detail the translation of the bridge port is
+// missing, the mac of the svis of its logical bridges
+func bpLateDetail(bp *infradb.BridgePort) string {
+	for _, name := range bp.Spec.LogicalBridges {
+		lb, err := infradb.GetLB(name)
+		if err != nil || lb.Svi == "" {
+			continue
+		}
+		if svi, err := infradb.GetSvi(lb.Svi); err == nil && _sviMacMissing(svi) {
+			return fmt.Sprintf("svi mac of %s", lb.Svi)
+		}
+	}
+	return ""
+}
+
+// waitForDetail records an object missing a detail in the pending objects, or
+// drops it from them once the detail is known. It returns the component
+// details of an object left pending
+func waitForDetail(ref ObjectRef, missing string) string {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	if missing == "" {
+		if p, ok := pendingObjects[ref]; ok {
+			log.Printf("intel-e2000: %s got its %s after %v\n", ref, p.Missing, time.Since(p.Since))
+			delete(pendingObjects, ref)
+		}
+		return ""
+	}
+	if p, ok := pendingObjects[ref]; ok {
+		p.Missing = missing
+		p.Attempts++
+	} else {
+		log.Printf("intel-e2000: %s has no %s yet, translating it once known\n", ref, missing)
+		pendingObjects[ref] = &PendingObject{Object: ref, Missing: missing, Since: time.Now()}
+	}
+	return fmt.Sprintf("intel-e2000: pending %s", missing)
+}
+
+// dropPending drops a deleted object from the pending objects
+func dropPending(ref ObjectRef) {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	delete(pendingObjects, ref)
+}
+
+// retryPending translates again the pending objects whose missing detail
+// shows up, their entries are written through the update handlers
+func retryPending() {
+	pendingLock.Lock()
+	refs := make([]ObjectRef, 0, len(pendingObjects))
+	for ref := range pendingObjects {
+		refs = append(refs, ref)
+	}
+	pendingLock.Unlock()
+	if len(refs) == 0 {
+		return
+	}
+	// Vrfs first, then svis and bridge ports
+	order := map[string]int{"vrf": 0, "svi": 1, "bridge-port": 2}
+	sort.Slice(refs, func(i, j int) bool { return order[refs[i].Kind] < order[refs[j].Kind] })
+
+	decoderLock.RLock()
+	defer decoderLock.RUnlock()
+	for _, ref := range refs {
+		var details string
+		var ok bool
+		switch ref.Kind {
+		case "vrf":
+			vrf, err := infradb.GetVrf(ref.Name)
+			if err != nil {
+				dropPending(ref)
+				continue
+			}
+			details, ok = offloadVrf(vrf)
+		case "svi":
+			svi, err := infradb.GetSvi(ref.Name)
+			if err != nil {
+				dropPending(ref)
+				continue
+			}
+			details, ok = setUpSvi(svi)
+		case "bridge-port":
+			bp, err := infradb.GetBP(ref.Name)
+			if err != nil {
+				dropPending(ref)
+				continue
+			}
+			details, ok = setUpBp(bp)
+		}
+		if !ok {
+			log.Printf("intel-e2000: Failed to translate pending %s: %s\n", ref, details)
+		}
+	}
+}
+
+// startPendingRetry starts the periodic retry of the pending objects and the
+// replay of the injected routes not programmed yet
+func startPendingRetry() {
+	cfg := PendingConfig{Interval: 5}
+	if err := viper.UnmarshalKey(pendingKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read pending objects config: %v\n", err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5
+	}
+	pendingDone = make(chan struct{})
+	done := pendingDone
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				retryPending()
+				replayInjectedRoutes()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// stopPendingRetry stops the periodic retry of the pending objects
+func stopPendingRetry() {
+	if pendingDone != nil {
+		close(pendingDone)
+		pendingDone = nil
+	}
+}
+
+// PendingObjects returns the objects waiting for a late detail
+func PendingObjects() []PendingObject {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+	list := make([]PendingObject, 0, len(pendingObjects))
+	for _, p := range pendingObjects {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Object.String() < list[j].Object.String() })
+	return list
+}
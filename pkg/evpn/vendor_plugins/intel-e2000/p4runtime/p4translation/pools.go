@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/utils"
+)
+
+// trackedPool id pool recording the ids in use so they can be cross-checked
+// against the device
+type trackedPool struct {
+	utils.IDPool
+	name  string
+	size  int
+	inUse map[interface{}]uint32
+}
+
+// newTrackedPool initializes a tracked id pool
+func newTrackedPool(name string, min uint32, max uint32) trackedPool {
+	pool, _ := utils.IDPoolInit(name, min, max)
+	return trackedPool{IDPool: pool, name: name, size: int(max-min) + 1, inUse: make(map[interface{}]uint32)}
+}
+
+// GetID gets the id of the key from the pool
+func (p *trackedPool) GetID(key interface{}) uint32 {
+	id := p.IDPool.GetID(key)
+	if id != 0 {
+		p.inUse[key] = id
+	}
+	return id
+}
+
+// ReleaseID returns the id of the key to the pool
+func (p *trackedPool) ReleaseID(key interface{}) uint32 {
+	id := p.IDPool.ReleaseID(key)
+	if id != 0 {
+		delete(p.inUse, key)
+	}
+	return id
+}
+
+// holds checks the key owns an id of the pool
+func (p *trackedPool) holds(key interface{}) bool {
+	_, ok := p.inUse[key]
+	return ok
+}
+
+// idsInUse returns the keys owning the ids in use keyed by id
+func (p *trackedPool) idsInUse() map[uint32]interface{} {
+	ids := make(map[uint32]interface{}, len(p.inUse))
+	for key, id := range p.inUse {
+		ids[id] = key
+	}
+	return ids
+}
+
+// PoolStatus contents of an id pool with the keys owning the ids and the
+// references held on them
+type PoolStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// PoolStatuses returns the contents of the mod pointer, trie index and ecmp
+// index pools and the neighbor slots, the decoders are held so the pools are consistent
+func PoolStatuses() []PoolStatus {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	return []PoolStatus{
+		{Name: "mod_ptr", Status: strings.TrimSpace(ptrPool.GetPoolStatus())},
+		{Name: "trie_index", Status: strings.TrimSpace(trieIndexPool.GetPoolStatus())},
+		{Name: "ecmp", Status: strings.TrimSpace(ecmpIndexPool.GetPoolStatus())},
+		{Name: "neighbor", Status: fmt.Sprintf("%+v", GetNeighborStats())},
+	}
+}
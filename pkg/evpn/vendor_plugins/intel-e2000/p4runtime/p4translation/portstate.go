@@ -0,0 +1,423 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// vportPrefix name prefix of the vport ports
+const vportPrefix = "vport-"
+
+// ErrUnknownPort the port is neither an uplink nor the vport of a bridge port
+var ErrUnknownPort = errors.New("unknown port")
+
+// PortState administrative and operational state of a port
+type PortState struct {
+	Name      string `json:"name"`
+	AdminDown bool   `json:"admindown"`
+	OperDown  bool   `json:"operdown"`
+}
+
+var (
+	// stateLock guards the port states and the nexthop caches
+	stateLock sync.Mutex
+
+	// portAdminDown ports shut administratively
+	portAdminDown = make(map[string]bool)
+
+	// portOperDown ports whose link is down
+	portOperDown = make(map[string]bool)
+
+	// routeCache last received routes
+	routeCache = make(map[nm.RouteKey]nm.RouteStruct)
+
+	// nexthopCache last received l3 nexthops
+	nexthopCache = make(map[nm.NexthopKey]nm.NexthopStruct)
+
+	// l2NexthopCache last received l2 nexthops
+	l2NexthopCache = make(map[nm.L2NexthopKey]nm.L2NexthopStruct)
+)
+
+// vportName returns the port name of a vport
+func vportName(vport string) string {
+	return vportPrefix + vport
+}
+
+// uplinkOfPort returns the uplink of a port id
+func uplinkOfPort(portID int) (UplinkConfig, bool) {
+	for _, uplink := range uplinks {
+		if uplink.Port == portID {
+			return uplink, true
+		}
+	}
+	return UplinkConfig{}, false
+}
+
+// nexthopPort returns the name of the port a l3 nexthop egresses on
+func nexthopPort(nexthop nm.NexthopStruct) string {
+	switch nexthop.NhType {
+	case nm.PHY:
+		if portID, ok := nexthop.Metadata["egress_vport"].(int); ok {
+			if uplink, found := uplinkOfPort(portID); found {
+				return uplink.Name
+			}
+		}
+	case nm.ACC:
+		if vport, ok := nexthop.Metadata["egress_vport"].(int); ok {
+			return vportName(strconv.Itoa(vport))
+		}
+	case nm.SVI:
+		if vport, ok := nexthop.Metadata["egress_vport"].(string); ok {
+			return vportName(vport)
+		}
+	}
+	return ""
+}
+
+// l2NexthopPort returns the name of the port a l2 nexthop egresses on
+func l2NexthopPort(nexthop nm.L2NexthopStruct) string {
+	if nexthop.Type != nm.BRIDGEPORT {
+		return ""
+	}
+	if vport, ok := nexthop.Metadata["vport_id"].(string); ok {
+		return vportName(vport)
+	}
+	return ""
+}
+
+// portIsUp reports if a port is up, the caller holds the state lock
+func portIsUp(name string) bool {
+	return !portAdminDown[name] && !portOperDown[name]
+}
+
+// portUp reports if a port is up
+func portUp(name string) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	return portIsUp(name)
+}
+
+// liveRoute returns the route restricted to the nexthops on ports which are
+// up and not costed out, false when no nexthop is left, the caller holds the
+// state lock
+func liveRoute(route nm.RouteStruct) (nm.RouteStruct, bool) {
+	if len(route.Nexthops) == 0 {
+		return route, true
+	}
+	var nexthops = make([]*nm.NexthopStruct, 0, len(route.Nexthops))
+	for _, nexthop := range route.Nexthops {
+		if nexthop != nil && !portIsUp(nexthopPort(*nexthop)) {
+			continue
+		}
+		nexthops = append(nexthops, nexthop)
+	}
+	if len(nexthops) == 0 {
+		return route, false
+	}
+	route.Nexthops = costOutMembers(nexthops)
+	return route, true
+}
+
+// routeOnPort reports if one of the nexthops of the route is on the port
+func routeOnPort(route nm.RouteStruct, name string) bool {
+	for _, nexthop := range route.Nexthops {
+		if nexthop != nil && nexthopPort(*nexthop) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheRoute stores the route, returns the live view of the previously
+// stored route (or of the new one when not stored yet) and of the new route
+func cacheRoute(route nm.RouteStruct) (old nm.RouteStruct, oldLive bool, live nm.RouteStruct, newLive bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if cached, found := routeCache[route.Key]; found {
+		old, oldLive = liveRoute(cached)
+	} else {
+		old, oldLive = liveRoute(route)
+	}
+	routeCache[route.Key] = route
+	live, newLive = liveRoute(route)
+	return old, oldLive, live, newLive
+}
+
+// uncacheRoute removes the route and returns its live view
+func uncacheRoute(route nm.RouteStruct) (nm.RouteStruct, bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	if cached, found := routeCache[route.Key]; found {
+		route = cached
+	}
+	delete(routeCache, route.Key)
+	return liveRoute(route)
+}
+
+// cacheNexthop stores the nexthop and reports if its port is up
+func cacheNexthop(nexthop nm.NexthopStruct) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	nexthopCache[nexthop.Key] = nexthop
+	return portIsUp(nexthopPort(nexthop))
+}
+
+// uncacheNexthop removes the nexthop and reports if its port is up
+func uncacheNexthop(nexthop nm.NexthopStruct) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	delete(nexthopCache, nexthop.Key)
+	return portIsUp(nexthopPort(nexthop))
+}
+
+// cacheL2Nexthop stores the l2 nexthop and reports if its port is up
+func cacheL2Nexthop(nexthop nm.L2NexthopStruct) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	l2NexthopCache[nexthop.Key] = nexthop
+	return portIsUp(l2NexthopPort(nexthop))
+}
+
+// uncacheL2Nexthop removes the l2 nexthop and reports if its port is up
+func uncacheL2Nexthop(nexthop nm.L2NexthopStruct) bool {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	delete(l2NexthopCache, nexthop.Key)
+	return portIsUp(l2NexthopPort(nexthop))
+}
+
+// portStaticEntries translates the static entries of a port
+func portStaticEntries(name string, added bool) ([]interface{}, error) {
+	var entries = make([]interface{}, 0)
+
+	if strings.HasPrefix(name, vportPrefix) {
+		bps, err := infradb.GetAllBPs()
+		if err != nil {
+			return nil, err
+		}
+		for _, bp := range bps {
+			if bp.Metadata == nil || vportName(bp.Metadata.VPort) != name {
+				continue
+			}
+			var bpEntries []interface{}
+			if added {
+				bpEntries, err = Pod.translateAddedBp(bp)
+			} else {
+				bpEntries, err = Pod.translateDeletedBp(bp)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if added {
+				recordObjectEntries(bp.Name, bpEntries)
+			} else {
+				forgetObjectEntries(bp.Name)
+			}
+			entries = append(entries, bpEntries...)
+		}
+		return entries, nil
+	}
+	var found bool
+	for _, uplink := range uplinks {
+		if uplink.Name != name {
+			continue
+		}
+		for _, port := range L3._phyPorts {
+			if port.id != uplink.Port {
+				continue
+			}
+			found = true
+			if added {
+				entries = append(entries, L3.phyPortAdditions(port)...)
+			} else {
+				entries = append(entries, L3.phyPortDeletions(port)...)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("intel-e2000: %w %s", ErrUnknownPort, name)
+	}
+	return entries, nil
+}
+
+// portNexthopEntries translates the nexthops egressing on a port
+func portNexthopEntries(name string, added bool) []interface{} {
+	var entries = make([]interface{}, 0)
+	for _, nexthop := range nexthopCache {
+		if nexthopPort(nexthop) != name {
+			continue
+		}
+		if added {
+			nhEntries := L3.translateAddedNexthop(nexthop)
+			recordNexthopStatus(nexthop, nil, nhEntries)
+			entries = append(entries, nhEntries...)
+		} else {
+			entries = append(entries, L3.translateDeletedNexthop(nexthop)...)
+		}
+	}
+	for _, nexthop := range l2NexthopCache {
+		if l2NexthopPort(nexthop) != name {
+			continue
+		}
+		if added {
+			entries = append(entries, Pod.translateAddedL2Nexthop(nexthop)...)
+		} else {
+			entries = append(entries, Pod.translateDeletedL2Nexthop(nexthop)...)
+		}
+	}
+	return entries
+}
+
+// applyPortState changes the state of a port and moves the nexthops and the
+// routes using them accordingly, the caller holds the decoder and state locks
+func applyPortState(name string, change func()) {
+	wasUp := portIsUp(name)
+	var affected []nm.RouteStruct
+	for _, route := range routeCache {
+		if routeOnPort(route, name) {
+			affected = append(affected, route)
+		}
+	}
+	var oldViews []nm.RouteStruct
+	for _, route := range affected {
+		if view, ok := liveRoute(route); ok {
+			oldViews = append(oldViews, view)
+		}
+	}
+	change()
+	if portIsUp(name) == wasUp {
+		return
+	}
+	var newViews []nm.RouteStruct
+	for _, route := range affected {
+		if view, ok := liveRoute(route); ok {
+			newViews = append(newViews, view)
+		}
+	}
+	if wasUp {
+		for _, view := range oldViews {
+			delEntries(L3.translateDeletedRoute(view))
+		}
+		for _, view := range newViews {
+			addEntries(L3.translateAddedRoute(view))
+		}
+		delEntries(portNexthopEntries(name, false))
+		log.Printf("intel-e2000: Port %s down, nexthops withdrawn and %d routes moved\n", name, len(affected))
+		return
+	}
+	addEntries(portNexthopEntries(name, true))
+	for _, view := range oldViews {
+		delEntries(L3.translateDeletedRoute(view))
+	}
+	for _, view := range newViews {
+		addEntries(L3.translateAddedRoute(view))
+	}
+	log.Printf("intel-e2000: Port %s up, nexthops restored and %d routes moved\n", name, len(affected))
+}
+
+// knownPort checks the name is an uplink, configured or discovered, or the
+// vport of a bridge port. A port shut stays known to be restored
+func knownPort(name string) error {
+	if portAdminDown[name] {
+		return nil
+	}
+	if !strings.HasPrefix(name, vportPrefix) {
+		for _, uplink := range uplinks {
+			if uplink.Name == name {
+				return nil
+			}
+		}
+		return fmt.Errorf("intel-e2000: %w %s", ErrUnknownPort, name)
+	}
+	bps, err := infradb.GetAllBPs()
+	if err != nil {
+		return err
+	}
+	for _, bp := range bps {
+		if bp.Metadata != nil && vportName(bp.Metadata.VPort) == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("intel-e2000: %w %s", ErrUnknownPort, name)
+}
+
+// SetPortAdminState shuts or restores a phy port (by uplink name) or a vport
+// (as vport-<id>) withdrawing its static entries and dependent nexthops
+func SetPortAdminState(name string, up bool) error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if err := knownPort(name); err != nil {
+		return err
+	}
+	if portAdminDown[name] == !up {
+		return nil
+	}
+	entries, err := portStaticEntries(name, up)
+	if err != nil {
+		return err
+	}
+	if up {
+		addEntries(entries)
+		applyPortState(name, func() { delete(portAdminDown, name) })
+		log.Printf("intel-e2000: Port %s administratively enabled\n", name)
+	} else {
+		applyPortState(name, func() { portAdminDown[name] = true })
+		delEntries(entries)
+		log.Printf("intel-e2000: Port %s administratively disabled\n", name)
+	}
+	return nil
+}
+
+// SetPortOperState records the link state of a port, the nexthops egressing
+// on a port whose link is down are withdrawn until the link recovers
+func SetPortOperState(name string, up bool) {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if portOperDown[name] == !up {
+		return
+	}
+	log.Printf("intel-e2000: Port %s link %s\n", name, map[bool]string{true: "up", false: "down"}[up])
+	applyPortState(name, func() {
+		if up {
+			delete(portOperDown, name)
+		} else {
+			portOperDown[name] = true
+		}
+	})
+}
+
+// PortStates returns the ports which are down
+func PortStates() []PortState {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	var names = make(map[string]bool)
+	for name := range portAdminDown {
+		names[name] = true
+	}
+	for name := range portOperDown {
+		names[name] = true
+	}
+	var states = make([]PortState, 0, len(names))
+	for name := range names {
+		states = append(states, PortState{Name: name, AdminDown: portAdminDown[name], OperDown: portOperDown[name]})
+	}
+	return states
+}
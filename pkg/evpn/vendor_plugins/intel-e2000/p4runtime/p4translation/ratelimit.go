@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"reflect"
+	"strconv"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"github.com/spf13/viper"
+)
+
+// rateLimitKey config key of the bridge port rate limits
+const rateLimitKey = "bpratelimit"
+
+// BpRate shaper rates of a bridge port in kbit/s, zero leaves a direction
+// unlimited, the burst is in bytes
+type BpRate struct {
+	Ingress int64 `yaml:"ingress"`
+	Egress  int64 `yaml:"egress"`
+	Burst   int64 `yaml:"burst"`
+}
+
+// RateLimitConfig bridge port rate limit config structure, the meters are
+// indexed by vport and the ports set the default rates of the bridge ports
+// whose spec sets no qos
+type RateLimitConfig struct {
+	IngressMeter string            `yaml:"ingressmeter"`
+	EgressMeter  string            `yaml:"egressmeter"`
+	Ports        map[string]BpRate `yaml:"ports"`
+}
+
+// loadRateLimitConfig reads the bridge port rate limits from config
+func loadRateLimitConfig() RateLimitConfig {
+	var cfg RateLimitConfig
+	if err := viper.UnmarshalKey(rateLimitKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read bridge port rate limits: %v\n", err)
+	}
+	return cfg
+}
+
+// meterConfig converts a rate in kbit/s to a single rate meter config in
+// bytes, the burst defaults to 100ms of traffic
+func meterConfig(kbps int64, burst int64) *p4_v1.MeterConfig {
+	rate := kbps * 1000 / 8
+	if burst == 0 {
+		burst = rate / 10
+	}
+	if burst < 1500 {
+		burst = 1500
+	}
+	return &p4_v1.MeterConfig{Cir: rate, Cburst: burst, Pir: rate, Pburst: burst}
+}
+
+// specQosFields names of the qos fields of a bridge port spec and the rate
+// each one sets
+var specQosFields = map[string]func(*BpRate) *int64{
+	"IngressKbps": func(r *BpRate) *int64 { return &r.Ingress },
+	"EgressKbps":  func(r *BpRate) *int64 { return &r.Egress },
+	"BurstBytes":  func(r *BpRate) *int64 { return &r.Burst },
+}
+
+// specRate overrides the rates the qos of a bridge port spec sets. The spec
+// of the infradb the bridge is built against carries no qos yet, so its
+// fields are looked up by name and the config rates stay until it does
+func specRate(spec interface{}, rate BpRate) BpRate {
+	v := reflect.Indirect(reflect.ValueOf(spec))
+	if v.Kind() != reflect.Struct {
+		return rate
+	}
+	qos := v.FieldByName("Qos")
+	if qos.Kind() == reflect.Ptr {
+		qos = qos.Elem()
+	}
+	if qos.Kind() != reflect.Struct {
+		return rate
+	}
+	for name, field := range specQosFields {
+		f := qos.FieldByName(name)
+		var value int64
+		switch {
+		case f.CanInt():
+			value = f.Int()
+		case f.CanUint():
+			value = int64(f.Uint())
+		}
+		if value > 0 {
+			*field(&rate) = value
+		}
+	}
+	return rate
+}
+
+// bpRate returns the rates of a bridge port and its meter index, the qos of
+// its spec and the configured rates as the default
+func bpRate(bp *infradb.BridgePort) (RateLimitConfig, BpRate, int64, bool) {
+	cfg := loadRateLimitConfig()
+	rate := cfg.Ports[path.Base(bp.Name)]
+	if bp.Spec != nil {
+		rate = specRate(bp.Spec, rate)
+	}
+	if (rate.Ingress == 0 && rate.Egress == 0) || bp.Metadata == nil {
+		return cfg, rate, 0, false
+	}
+	port, err := strconv.ParseUint(bp.Metadata.VPort, 10, 16)
+	if err != nil {
+		return cfg, rate, 0, false
+	}
+	return cfg, rate, int64(port), true
+}
+
+// applyBpRateLimit programs the shapers of a bridge port
+func applyBpRateLimit(bp *infradb.BridgePort) error {
+	cfg, rate, index, ok := bpRate(bp)
+	if !ok {
+		return nil
+	}
+	for _, shaper := range []struct {
+		meter string
+		kbps  int64
+	}{{cfg.IngressMeter, rate.Ingress}, {cfg.EgressMeter, rate.Egress}} {
+		if shaper.kbps == 0 {
+			continue
+		}
+		if shaper.meter == "" {
+			return fmt.Errorf("intel-e2000: no meter configured to rate limit bridge port %s", bp.Name)
+		}
+		if err := p4client.SetMeter(shaper.meter, index, meterConfig(shaper.kbps, rate.Burst)); err != nil {
+			return fmt.Errorf("intel-e2000: failed to rate limit bridge port %s on %s: %v", bp.Name, shaper.meter, err)
+		}
+	}
+	log.Printf("intel-e2000: Rate limited bridge port %s to %d/%d kbit/s\n", bp.Name, rate.Ingress, rate.Egress)
+	return nil
+}
+
+// releaseBpRateLimit resets the shapers of a bridge port
+func releaseBpRateLimit(bp *infradb.BridgePort) {
+	cfg, rate, index, ok := bpRate(bp)
+	if !ok {
+		return
+	}
+	if rate.Ingress != 0 && cfg.IngressMeter != "" {
+		if err := p4client.SetMeter(cfg.IngressMeter, index, nil); err != nil {
+			log.Printf("intel-e2000: failed to reset %s of bridge port %s: %v\n", cfg.IngressMeter, bp.Name, err)
+		}
+	}
+	if rate.Egress != 0 && cfg.EgressMeter != "" {
+		if err := p4client.SetMeter(cfg.EgressMeter, index, nil); err != nil {
+			log.Printf("intel-e2000: failed to reset %s of bridge port %s: %v\n", cfg.EgressMeter, bp.Name, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"testing"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+)
+
+// TestSpecRate checks the qos of a spec overrides the configured rates it
+// sets and a spec without qos keeps them
+func TestSpecRate(t *testing.T) {
+	type qos struct {
+		IngressKbps uint64
+		EgressKbps  int64
+	}
+	type spec struct {
+		Name string
+		Qos  *qos
+	}
+	configured := BpRate{Ingress: 1000, Egress: 2000, Burst: 3000}
+
+	got := specRate(&spec{Qos: &qos{IngressKbps: 500}}, configured)
+	if want := (BpRate{Ingress: 500, Egress: 2000, Burst: 3000}); got != want {
+		t.Errorf("spec ingress qos: got %+v, want %+v", got, want)
+	}
+	if got := specRate(&spec{}, configured); got != configured {
+		t.Errorf("spec without qos: got %+v, want %+v", got, configured)
+	}
+	if got := specRate(&infradb.BridgePortSpec{Name: "bp"}, configured); got != configured {
+		t.Errorf("infradb spec: got %+v, want %+v", got, configured)
+	}
+}
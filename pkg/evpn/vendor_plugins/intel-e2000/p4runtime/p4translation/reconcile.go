@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/common"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"github.com/spf13/viper"
+)
+
+// reconcilerKey config key of the reconciler section
+const reconcilerKey = "reconciler"
+
+// ReconcilerConfig reconciler config structure
+type ReconcilerConfig struct {
+	Enabled   bool `yaml:"enabled"`
+	Interval  int  `yaml:"interval"`
+	MaxWrites int  `yaml:"maxwrites"`
+	Prune     bool `yaml:"prune"`
+}
+
+// ReconcilerStats reconciler statistics
+type ReconcilerStats struct {
+	Passes   uint64    `json:"passes"`
+	Added    uint64    `json:"added"`
+	Removed  uint64    `json:"removed"`
+	Deferred uint64    `json:"deferred"`
+	Desired  int       `json:"desired"`
+	Missing  int       `json:"missing"`
+	Extra    int       `json:"extra"`
+	LastPass time.Time `json:"lastpass"`
+}
+
+var (
+	// reconcilerCfg reconciler configuration read from the config file
+	reconcilerCfg ReconcilerConfig
+
+	// reconcilerLock guards the reconciler statistics and the managed tables
+	reconcilerLock sync.Mutex
+
+	// reconcilerStats reconciler statistics
+	reconcilerStats ReconcilerStats
+
+	// managedTables tables written by the plugin
+	managedTables = make(map[string]bool)
+
+	// fdbCache fdb entries received from netlink
+	fdbCache = make(map[nm.FdbKey]nm.FdbEntryStruct)
+
+	// reconcilerDone stops the reconciler
+	reconcilerDone chan struct{}
+)
+
+// manageTable records a table written by the plugin
+func manageTable(table string) {
+	reconcilerLock.Lock()
+	managedTables[table] = true
+	reconcilerLock.Unlock()
+}
+
+// cacheFdb stores the fdb entry
+func cacheFdb(fdb nm.FdbEntryStruct) {
+	stateLock.Lock()
+	fdbCache[fdb.Key] = fdb
+	stateLock.Unlock()
+}
+
+// uncacheFdb removes the fdb entry
+func uncacheFdb(fdb nm.FdbEntryStruct) {
+	stateLock.Lock()
+	delete(fdbCache, fdb.Key)
+	stateLock.Unlock()
+}
+
+// offloaded checks if the intel-e2000 component programmed the object
+func offloaded(components []common.Component) bool {
+	for _, comp := range components {
+		if comp.Name == intele2000Str {
+			return comp.CompStatus == common.ComponentStatusSuccess
+		}
+	}
+	return false
+}
+
+// desiredObjectEntries translates the infradb objects offloaded successfully,
+// the callers write the device back to the translations so they are recorded
+// as the entries programmed of the objects
+func desiredObjectEntries() []interface{} {
+	var entries []interface{}
+	if vrfs, err := infradb.GetAllVrfs(); err == nil {
+		for _, vrf := range vrfs {
+			if _isDefaultVrf(vrf) || vrf.Status == nil || !offloaded(vrf.Status.Components) {
+				continue
+			}
+			delta := Vxlan.translateUpdatedVrf(vrf, programmedEntries(vrf.Name))
+			recordObjectEntries(vrf.Name, delta.Entries)
+			entries = append(entries, delta.Entries...)
+		}
+	}
+	if lbs, err := infradb.GetAllLBs(); err == nil {
+		for _, lb := range lbs {
+			if lb.Status == nil || !offloaded(lb.Status.Components) {
+				continue
+			}
+			delta := Vxlan.translateUpdatedLb(lb, programmedEntries(lb.Name))
+			recordObjectEntries(lb.Name, delta.Entries)
+			entries = append(entries, delta.Entries...)
+		}
+	}
+	if bps, err := infradb.GetAllBPs(); err == nil {
+		for _, bp := range bps {
+			if bp.Status == nil || !offloaded(bp.Status.Components) {
+				continue
+			}
+			if bp.Metadata != nil && !portUp(vportName(bp.Metadata.VPort)) {
+				continue
+			}
+			if delta, err := Pod.translateUpdatedBp(bp, programmedEntries(bp.Name)); err == nil {
+				recordObjectEntries(bp.Name, delta.Entries)
+				entries = append(entries, delta.Entries...)
+			}
+		}
+	}
+	if svis, err := infradb.GetAllSvis(); err == nil {
+		for _, svi := range svis {
+			if svi.Status == nil || !offloaded(svi.Status.Components) {
+				continue
+			}
+			if delta, err := Pod.translateUpdatedSvi(svi, programmedEntries(svi.Name)); err == nil {
+				recordObjectEntries(svi.Name, delta.Entries)
+				entries = append(entries, delta.Entries...)
+			}
+		}
+	}
+	return entries
+}
+
+// desiredNetlinkEntries translates the netlink objects, the ones egressing
+// on a port down are left out as they are withdrawn
+func desiredNetlinkEntries() []interface{} {
+	var entries []interface{}
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	for _, nexthop := range nexthopCache {
+		if !portIsUp(nexthopPort(nexthop)) || nexthopBlocked(nexthop.Key) {
+			continue
+		}
+		entries = append(entries, L3.translateAddedNexthop(nexthop)...)
+		entries = append(entries, Vxlan.translateAddedNexthop(nexthop)...)
+	}
+	for _, nexthop := range l2NexthopCache {
+		if !portIsUp(l2NexthopPort(nexthop)) {
+			continue
+		}
+		entries = append(entries, Vxlan.translateAddedL2Nexthop(nexthop)...)
+		entries = append(entries, Pod.translateAddedL2Nexthop(nexthop)...)
+	}
+	for _, route := range routeCache {
+		if live, ok := liveRoute(route); ok {
+			entries = append(entries, L3.translateAddedRoute(live)...)
+		}
+	}
+	entries = append(entries, offloadedNeighborEntries()...)
+	for _, fdb := range fdbCache {
+		entries = append(entries, Vxlan.translateAddedFdb(fdb)...)
+		if !fdbBlocked(fdb.Key) {
+			entries = append(entries, Pod.translateAddedFdb(fdb)...)
+		}
+	}
+	return entries
+}
+
+// reconcile converges the device tables to the desired state, at most
+// maxwrites entries are written per pass and the rest is left to the next,
+// a standby leaves the device to the active instance
+func reconcile() {
+	if p4client.IsStandby() {
+		return
+	}
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+
+	var desired []interface{}
+	desired = append(desired, expectedStaticEntries()...)
+	desired = append(desired, desiredObjectEntries()...)
+	desired = append(desired, desiredNetlinkEntries()...)
+
+	desiredKeys := make(map[string]bool)
+	tables := make(map[string]bool)
+	reconcilerLock.Lock()
+	for table := range managedTables {
+		tables[table] = true
+	}
+	reconcilerLock.Unlock()
+	for _, entry := range desired {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			tables[e.Tablename] = true
+			if key, err := p4client.EntryMatchKey(e); err == nil {
+				desiredKeys[key] = true
+			}
+		}
+	}
+
+	actualKeys := make(map[string]bool)
+	var extra []*p4_v1.TableEntry
+	for table := range tables {
+		programmed, err := p4client.GetEntry(table)
+		if err != nil {
+			log.Printf("intel-e2000: Reconciler failed to read %s: %v\n", table, err)
+			return
+		}
+		for _, p := range programmed {
+			key := p4client.MatchKey(p)
+			actualKeys[key] = true
+			if !desiredKeys[key] && !foreignAdopted(key) {
+				extra = append(extra, p)
+			}
+		}
+	}
+	var missing []interface{}
+	for _, entry := range desired {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			if key, err := p4client.EntryMatchKey(e); err == nil && !actualKeys[key] {
+				missing = append(missing, e)
+				actualKeys[key] = true
+			}
+		}
+	}
+
+	budget := reconcilerCfg.MaxWrites
+	var added, removed, deferred int
+	for _, entry := range missing {
+		if budget == 0 {
+			deferred++
+			continue
+		}
+		addEntries([]interface{}{entry})
+		added++
+		budget--
+	}
+	if reconcilerCfg.Prune {
+		for _, p := range extra {
+			if budget == 0 {
+				deferred++
+				continue
+			}
+			if err := p4client.DelProgrammedEntry(p); err != nil {
+				log.Printf("intel-e2000: Reconciler failed to remove stale entry: %v\n", err)
+				continue
+			}
+			removed++
+			budget--
+		}
+	}
+	if added != 0 || removed != 0 || deferred != 0 {
+		log.Printf("intel-e2000: Reconciler added %d, removed %d, deferred %d entries (%d missing, %d extra)\n", added, removed, deferred, len(missing), len(extra))
+	}
+
+	reconcilerLock.Lock()
+	reconcilerStats.Passes++
+	reconcilerStats.Added += uint64(added)
+	reconcilerStats.Removed += uint64(removed)
+	reconcilerStats.Deferred += uint64(deferred)
+	reconcilerStats.Desired = len(desiredKeys)
+	reconcilerStats.Missing = len(missing)
+	reconcilerStats.Extra = len(extra)
+	reconcilerStats.LastPass = time.Now()
+	reconcilerLock.Unlock()
+}
+
+// loadReconcilerConfig reads the reconciler config and applies the defaults
+func loadReconcilerConfig() {
+	cfg := ReconcilerConfig{}
+	if err := viper.UnmarshalKey(reconcilerKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read reconciler config: %v\n", err)
+		cfg.Enabled = false
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 60
+	}
+	if cfg.MaxWrites <= 0 {
+		cfg.MaxWrites = 100
+	}
+	reconcilerCfg = cfg
+}
+
+// startReconciler starts the periodic reconciliation of the device tables
+func startReconciler() {
+	loadReconcilerConfig()
+	if !reconcilerCfg.Enabled {
+		return
+	}
+	reconcilerDone = make(chan struct{})
+	done := reconcilerDone
+	go func() {
+		ticker := time.NewTicker(time.Duration(reconcilerCfg.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reconcile()
+			case <-done:
+				return
+			}
+		}
+	}()
+	log.Printf("intel-e2000: Reconciler started, interval %ds, %d writes per pass\n", reconcilerCfg.Interval, reconcilerCfg.MaxWrites)
+}
+
+// stopReconciler stops the reconciler
+func stopReconciler() {
+	if reconcilerDone != nil {
+		close(reconcilerDone)
+		reconcilerDone = nil
+	}
+}
+
+// Reconcile runs a reconciliation pass on demand
+func Reconcile() ReconcilerStats {
+	if reconcilerCfg.MaxWrites == 0 {
+		loadReconcilerConfig()
+	}
+	reconcile()
+	return GetReconcilerStats()
+}
+
+// GetReconcilerStats returns the reconciler statistics
+func GetReconcilerStats() ReconcilerStats {
+	reconcilerLock.Lock()
+	defer reconcilerLock.Unlock()
+	return reconcilerStats
+}
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/config"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// entryKey returns the key of an entry built from its table and match fields
+func entryKey(e p4client.TableEntry) string {
+	fields := make([]string, 0, len(e.TableField.FieldValue))
+	for name, value := range e.TableField.FieldValue {
+		fields = append(fields, fmt.Sprintf("%s=%v", name, value))
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("%s%v/%d", e.Tablename, fields, e.TableField.Priority)
+}
+
+// staticDelta compares two sets of static additions and returns the entries
+// to be deleted and the entries to be added to move from old to new
+func staticDelta(oldEntries []interface{}, newEntries []interface{}) ([]interface{}, []interface{}) {
+	var deletions = make([]interface{}, 0)
+	var additions = make([]interface{}, 0)
+	oldSet := make(map[string]p4client.TableEntry)
+	for _, entry := range oldEntries {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			oldSet[entryKey(e)] = e
+		}
+	}
+	newSet := make(map[string]bool)
+	for _, entry := range newEntries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			continue
+		}
+		key := entryKey(e)
+		newSet[key] = true
+		old, found := oldSet[key]
+		if found && fmt.Sprintf("%v", old.Action) == fmt.Sprintf("%v", e.Action) {
+			continue
+		}
+		if found {
+			// No modify in the driver api, replace the entry
+			deletions = append(deletions, old)
+		}
+		additions = append(additions, e)
+	}
+	for _, entry := range oldEntries {
+		if e, ok := entry.(p4client.TableEntry); ok && !newSet[entryKey(e)] {
+			deletions = append(deletions, e)
+		}
+	}
+	return deletions, additions
+}
+
+var (
+	// configLock guards the global config against the swap of a reload
+	configLock sync.RWMutex
+
+	// activeRepresentors representors the decoders were built from
+	activeRepresentors map[string][2]string
+)
+
+// GlobalConfig returns the global config, the readers go through it as a
+// reload swaps the config while the translation runs
+func GlobalConfig() config.Config {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config.GlobalConfig
+}
+
+// setGlobalConfig swaps the global config
+func setGlobalConfig(cfg config.Config) error {
+	configLock.Lock()
+	defer configLock.Unlock()
+	return config.SetConfig(cfg)
+}
+
+// representorChanges returns the representors added, removed or changed. The
+// routes, nexthops and bridge ports programmed carry the vsis of the
+// representors, they are not retranslated so such a change needs a restart
+func representorChanges(old map[string][2]string, representors map[string][2]string) []string {
+	var changes []string
+	for key, ids := range representors {
+		if prev, ok := old[key]; !ok || prev != ids {
+			changes = append(changes, key)
+		}
+	}
+	for key := range old {
+		if _, ok := representors[key]; !ok {
+			changes = append(changes, key)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// Reload re-reads the config file, checks the representors are unchanged and
+// reprograms only the static entries that changed. The injected routes are
+// kept, the ones of the injected routes file not known yet are added and the
+// ones not programmed are replayed
+func Reload() error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	if GetCanaryState().Result == canaryRunning {
+		return errors.New("intel-e2000: a canary is running, abort it before reloading")
+	}
+	return reload()
+}
+
+// reload reloads the config and swaps the decoders, the caller holds the
+// decoder lock
+func reload() error {
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("intel-e2000: failed to read config file: %v", err)
+	}
+	var cfg config.Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return fmt.Errorf("intel-e2000: failed to parse config file: %v", err)
+	}
+	oldCfg := GlobalConfig()
+	cfg.CfgFile = oldCfg.CfgFile
+	if err := setGlobalConfig(cfg); err != nil {
+		return err
+	}
+
+	oldUplinks := uplinks
+	representors := buildRepresentors()
+	log.Printf("intel-e2000: Reload REPRESENTORS %+v\n", representors)
+	err := validateRepresentors(representors)
+	if changes := representorChanges(activeRepresentors, representors); err == nil && len(changes) != 0 {
+		err = fmt.Errorf("intel-e2000: representors %v changed, the entries programmed are not retranslated, restart to apply", changes)
+	}
+	if err != nil {
+		_ = setGlobalConfig(oldCfg)
+		uplinks = oldUplinks
+		return err
+	}
+	configureUplinks()
+	loadDampeningConfig()
+	loadAntiSpoofConfig()
+	loadIPSourceGuardConfig()
+	loadChaosConfig()
+	loadEventStreamConfig()
+	loadBackpressureConfig()
+	loadBulkConfig()
+	loadFdbDirection()
+	loadL2ClassConfig()
+	loadChurnConfig()
+	loadTenantConfig()
+	loadDualStackConfig()
+	loadUrpfConfig()
+
+	oldEntries := append(L3.StaticAdditions(), Pod.StaticAdditions()...)
+	l3 := L3.L3DecoderInit(representors)
+	pod := Pod.PodDecoderInit(representors)
+	vxlan := Vxlan.VxlanDecoderInit(representors)
+	newEntries := append(l3.StaticAdditions(), pod.StaticAdditions()...)
+
+	deletions, additions := staticDelta(oldEntries, newEntries)
+	log.Printf("intel-e2000: Reload deleting %d and adding %d static entries\n", len(deletions), len(additions))
+	delEntries(deletions)
+	addStaticEntries(additions)
+	applyGrpcSteering(L3, l3)
+
+	L3 = l3
+	Pod = pod
+	Vxlan = vxlan
+	loadStaticEntries()
+	loadRoutePreference()
+	loadUnderlayVrfs()
+	loadP2PConfig()
+	reelectRoutes()
+	reapplyUrpf()
+	loadInjectedRoutes()
+	_replayInjectedRoutes()
+	writeInjectedRoutes()
+	if GetReadiness().P4Connected {
+		verifyStaticAdditions()
+	}
+	return nil
+}
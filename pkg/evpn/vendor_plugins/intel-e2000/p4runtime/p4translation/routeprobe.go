@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// routeProbeKey config key of the route probe section
+const routeProbeKey = "routeprobe"
+
+// RouteProbeConfig route probe config structure. In probe mode the direct
+// counters of the entries of a route newly programmed are watched for window
+// seconds, read every interval seconds, a route whose counters never move is
+// flagged silent: programmed but attracting no traffic
+type RouteProbeConfig struct {
+	Enabled  bool `yaml:"enabled"`
+	Window   int  `yaml:"window"`
+	Interval int  `yaml:"interval"`
+}
+
+// states of a route probe
+const (
+	probeProbing = "probing"
+	probeSilent  = "silent"
+)
+
+// RouteProbe probe of a route newly programmed
+type RouteProbe struct {
+	Vrf        string    `json:"vrf"`
+	Prefix     string    `json:"prefix"`
+	Programmed time.Time `json:"programmed"`
+	State      string    `json:"state"`
+	Packets    int64     `json:"packets"`
+	entries    []interface{}
+}
+
+var (
+	// routeProbeLock guards the route probes
+	routeProbeLock sync.Mutex
+
+	// routeProbeCfg route probe config
+	routeProbeCfg RouteProbeConfig
+
+	// routeProbes probes of the routes keyed by route key, a verified route
+	// is dropped, a silent one kept until reprogrammed or withdrawn
+	routeProbes = make(map[nm.RouteKey]*RouteProbe)
+
+	// routesVerified routes which attracted traffic within the window
+	routesVerified uint64
+
+	// routeProbeDone stops the route probe checks
+	routeProbeDone chan struct{}
+)
+
+// _probeEntries returns the routing entries of a route, the ones carrying
+// the direct counters
+func _probeEntries(entries []interface{}) []interface{} {
+	var probed []interface{}
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			continue
+		}
+		switch e.Tablename {
+		case l3Rt, l3RtHost, l3RtV6, l3RtHostV6, l3P2PRt, l3P2PRtHost, l3P2PRtV6, l3P2PRtHostV6:
+			probed = append(probed, e)
+		}
+	}
+	return probed
+}
+
+// probeRoute starts the probe of a route programmed with the entries
+func probeRoute(route nm.RouteStruct, entries []interface{}) {
+	routeProbeLock.Lock()
+	defer routeProbeLock.Unlock()
+	if !routeProbeCfg.Enabled {
+		return
+	}
+	probed := _probeEntries(entries)
+	if len(probed) == 0 {
+		delete(routeProbes, route.Key)
+		return
+	}
+	var vrf string
+	if route.Vrf != nil {
+		vrf = path.Base(route.Vrf.Name)
+	}
+	routeProbes[route.Key] = &RouteProbe{
+		Vrf:        vrf,
+		Prefix:     route.Key.Dst,
+		Programmed: time.Now(),
+		State:      probeProbing,
+		entries:    probed,
+	}
+}
+
+// dropRouteProbe drops the probe of a route withdrawn
+func dropRouteProbe(key nm.RouteKey) {
+	routeProbeLock.Lock()
+	defer routeProbeLock.Unlock()
+	delete(routeProbes, key)
+}
+
+// checkRouteProbes reads the counters of the routes probed, a route with
+// traffic is verified and a route without any past the window is silent
+func checkRouteProbes() {
+	routeProbeLock.Lock()
+	window := time.Duration(routeProbeCfg.Window) * time.Second
+	probing := make(map[nm.RouteKey]*RouteProbe)
+	for key, probe := range routeProbes {
+		if probe.State == probeProbing {
+			probing[key] = probe
+		}
+	}
+	routeProbeLock.Unlock()
+
+	for key, probe := range probing {
+		packets, _ := sumCounters(probe.entries)
+		routeProbeLock.Lock()
+		if routeProbes[key] != probe {
+			// Reprogrammed or withdrawn while read
+			routeProbeLock.Unlock()
+			continue
+		}
+		probe.Packets = packets
+		switch {
+		case packets > 0:
+			delete(routeProbes, key)
+			routesVerified++
+		case time.Since(probe.Programmed) > window:
+			probe.State = probeSilent
+			log.Printf("intel-e2000: Route %s of vrf %s programmed %v ago attracts no traffic\n", probe.Prefix, probe.Vrf, time.Since(probe.Programmed).Round(time.Second))
+		}
+		routeProbeLock.Unlock()
+	}
+}
+
+// startRouteProbe starts the periodic checks of the route probes
+func startRouteProbe() {
+	cfg := RouteProbeConfig{}
+	if err := viper.UnmarshalKey(routeProbeKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read route probe config: %v\n", err)
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 300
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30
+	}
+	routeProbeLock.Lock()
+	routeProbeCfg = cfg
+	routeProbeLock.Unlock()
+	if !cfg.Enabled {
+		return
+	}
+	routeProbeDone = make(chan struct{})
+	done := routeProbeDone
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				checkRouteProbes()
+			case <-done:
+				return
+			}
+		}
+	}()
+	log.Printf("intel-e2000: Route probe started, window %ds\n", cfg.Window)
+}
+
+// stopRouteProbe stops the route probe checks
+func stopRouteProbe() {
+	if routeProbeDone != nil {
+		close(routeProbeDone)
+		routeProbeDone = nil
+	}
+}
+
+// RoutesVerified returns the number of routes probed which attracted traffic
+// within the window
+func RoutesVerified() uint64 {
+	routeProbeLock.Lock()
+	defer routeProbeLock.Unlock()
+	return routesVerified
+}
+
+// SilentRoutes returns the routes programmed which attracted no traffic
+// within the probe window
+func SilentRoutes() []RouteProbe {
+	var silent = make([]RouteProbe, 0)
+	for _, probe := range RouteProbes() {
+		if probe.State == probeSilent {
+			silent = append(silent, probe)
+		}
+	}
+	return silent
+}
+
+// RouteProbes returns the routes probed and the silent ones
+func RouteProbes() []RouteProbe {
+	routeProbeLock.Lock()
+	defer routeProbeLock.Unlock()
+	list := make([]RouteProbe, 0, len(routeProbes))
+	for _, probe := range routeProbes {
+		list = append(list, RouteProbe{Vrf: probe.Vrf, Prefix: probe.Prefix, Programmed: probe.Programmed, State: probe.State, Packets: probe.Packets})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Vrf != list[j].Vrf {
+			return list[i].Vrf < list[j].Vrf
+		}
+		return list[i].Prefix < list[j].Prefix
+	})
+	return list
+}
@@ -0,0 +1,287 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"path"
+	"sort"
+	"sync"
+
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// routePreferenceKey config key of the protocol administrative distances
+const routePreferenceKey = "routepreference"
+
+// maxDistance distance of the protocols without a preference, they only win
+// over nothing
+const maxDistance = 255
+
+// defaultDistances administrative distances of the protocols as used by zebra,
+// which installs its routes with the distance as kernel metric
+var defaultDistances = map[string]int{
+	"kernel": 0,
+	"boot":   0,
+	"static": 1,
+	"bgp":    20,
+	"ospf":   110,
+	"isis":   115,
+	"rip":    120,
+	"zebra":  150,
+}
+
+// candidateKey identifies a route of a prefix by protocol and metric
+type candidateKey struct {
+	Protocol int
+	Metric   int
+}
+
+// RouteCandidate route of a prefix learnt from one protocol with one metric,
+// only the elected candidate of a prefix is offloaded
+type RouteCandidate struct {
+	Vrf      string `json:"vrf"`
+	Prefix   string `json:"prefix"`
+	Table    int    `json:"table"`
+	Protocol string `json:"protocol"`
+	Distance int    `json:"distance"`
+	Metric   int    `json:"metric"`
+	Elected  bool   `json:"elected"`
+}
+
+var (
+	// routeSelectLock guards the route candidates and the distances
+	routeSelectLock sync.Mutex
+
+	// routeDistances administrative distances keyed by protocol name
+	routeDistances = defaultDistances
+
+	// routeCandidates routes keyed by route key, protocol and metric
+	routeCandidates = make(map[nm.RouteKey]map[candidateKey]nm.RouteStruct)
+
+	// electedCandidates candidate of the route offloaded for a route key
+	electedCandidates = make(map[nm.RouteKey]candidateKey)
+)
+
+// loadRoutePreference reads the administrative distances overriding the
+// defaults of the protocols
+func loadRoutePreference() {
+	var cfg map[string]int
+	if err := viper.UnmarshalKey(routePreferenceKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read route preference config: %v\n", err)
+	}
+	distances := make(map[string]int, len(defaultDistances)+len(cfg))
+	for protocol, distance := range defaultDistances {
+		distances[protocol] = distance
+	}
+	for protocol, distance := range cfg {
+		distances[protocol] = distance
+	}
+	routeSelectLock.Lock()
+	routeDistances = distances
+	routeSelectLock.Unlock()
+}
+
+// keyOf returns the candidate key of a route
+func keyOf(route nm.RouteStruct) candidateKey {
+	return candidateKey{Protocol: int(route.Route0.Protocol), Metric: route.Route0.Priority}
+}
+
+// routeDistance returns the administrative distance of the protocol of a route
+func routeDistance(route nm.RouteStruct) int {
+	if distance, ok := routeDistances[route.Route0.Protocol.String()]; ok {
+		return distance
+	}
+	return maxDistance
+}
+
+// preferredRoute returns the candidate with the lowest distance, the lowest
+// kernel metric and then the lowest protocol number break the ties so the
+// election does not depend on the order the routes were learnt in
+func preferredRoute(candidates map[candidateKey]nm.RouteStruct) (nm.RouteStruct, bool) {
+	var best nm.RouteStruct
+	var found bool
+	for _, route := range candidates {
+		if !found {
+			best, found = route, true
+			continue
+		}
+		d, bd := routeDistance(route), routeDistance(best)
+		switch {
+		case d != bd:
+			if d < bd {
+				best = route
+			}
+		case route.Route0.Priority != best.Route0.Priority:
+			if route.Route0.Priority < best.Route0.Priority {
+				best = route
+			}
+		case route.Route0.Protocol < best.Route0.Protocol:
+			best = route
+		}
+	}
+	return best, found
+}
+
+// electRoute records the route as candidate of its prefix and returns the
+// route to offload, false when the route lost to the elected one. An update
+// replaces the candidates of the same protocol so a changed metric does not
+// leave the previous one behind
+func electRoute(route nm.RouteStruct, update bool) (nm.RouteStruct, bool) {
+	routeSelectLock.Lock()
+	defer routeSelectLock.Unlock()
+	key := keyOf(route)
+	candidates := routeCandidates[route.Key]
+	if candidates == nil {
+		candidates = make(map[candidateKey]nm.RouteStruct)
+		routeCandidates[route.Key] = candidates
+	}
+	if update {
+		for k := range candidates {
+			if k.Protocol == key.Protocol {
+				delete(candidates, k)
+			}
+		}
+	}
+	candidates[key] = route
+	best, _ := preferredRoute(candidates)
+	elected, found := electedCandidates[route.Key]
+	if found && keyOf(best) == elected && elected != key {
+		return best, false
+	}
+	electedCandidates[route.Key] = keyOf(best)
+	return best, true
+}
+
+// withdrawCandidate removes the route from the candidates of its prefix, it
+// returns the next route to offload if the route was the elected one
+func withdrawCandidate(route nm.RouteStruct) (next nm.RouteStruct, hasNext bool, wasElected bool) {
+	routeSelectLock.Lock()
+	defer routeSelectLock.Unlock()
+	key := keyOf(route)
+	elected, found := electedCandidates[route.Key]
+	delete(routeCandidates[route.Key], key)
+	if found && elected != key {
+		return next, false, false
+	}
+	next, hasNext = preferredRoute(routeCandidates[route.Key])
+	if hasNext {
+		electedCandidates[route.Key] = keyOf(next)
+	} else {
+		delete(routeCandidates, route.Key)
+		delete(electedCandidates, route.Key)
+	}
+	return next, hasNext, true
+}
+
+// sameForwarding checks if two routes of a prefix program the same entries,
+// the protocol and the metric are not part of them
+func sameForwarding(a nm.RouteStruct, b nm.RouteStruct) bool {
+	if a.Route0.Dst.String() != b.Route0.Dst.String() || len(a.Nexthops) != len(b.Nexthops) {
+		return false
+	}
+	if a.Vrf == nil || b.Vrf == nil || a.Vrf.Name != b.Vrf.Name {
+		return false
+	}
+	if a.Metadata["direction"] != b.Metadata["direction"] {
+		return false
+	}
+	for i := range a.Nexthops {
+		if a.Nexthops[i].Key != b.Nexthops[i].Key || a.Nexthops[i].ID != b.Nexthops[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
+// installRoute caches the route and programs it in place of the route cached
+// for its prefix, it returns the first write failure
+func installRoute(route nm.RouteStruct) error {
+	stateLock.Lock()
+	_, replaced := routeCache[route.Key]
+	stateLock.Unlock()
+	old, oldOk, live, ok := cacheRoute(route)
+	if replaced && oldOk && ok && sameForwarding(old, live) {
+		// only the metric or the protocol changed, the entries stay in place
+		return nil
+	}
+	var err error
+	if replaced && oldOk {
+		err = delEntries(L3.translateDeletedRoute(old))
+	}
+	if !ok {
+		log.Printf("intel-e2000: All nexthops of route %+v are down, not programming\n", route.Key)
+		dropRouteProbe(route.Key)
+		unmeterRoute(route.Key)
+		return err
+	}
+	yieldNeighborRoute(route.Key)
+	entries := L3.translateAddedRoute(live)
+	if addErr := addEntries(entries); err == nil {
+		err = addErr
+	}
+	probeRoute(live, entries)
+	meterRoute(live, entries)
+	return err
+}
+
+// reelectRoutes elects the routes again after the distances changed and
+// replaces the offloaded routes that lost, the caller holds the decoder lock
+func reelectRoutes() {
+	var changed []nm.RouteStruct
+	routeSelectLock.Lock()
+	for key, candidates := range routeCandidates {
+		best, ok := preferredRoute(candidates)
+		if !ok || keyOf(best) == electedCandidates[key] {
+			continue
+		}
+		electedCandidates[key] = keyOf(best)
+		changed = append(changed, best)
+	}
+	routeSelectLock.Unlock()
+	for _, route := range changed {
+		log.Printf("intel-e2000: Route %s now preferred from %s\n", route.Key.Dst, route.Route0.Protocol)
+		installRoute(route)
+	}
+}
+
+// RouteCandidates returns the routes of the prefixes learnt more than once
+func RouteCandidates() []RouteCandidate {
+	routeSelectLock.Lock()
+	defer routeSelectLock.Unlock()
+	var candidates = make([]RouteCandidate, 0)
+	for key, routes := range routeCandidates {
+		if len(routes) < 2 {
+			continue
+		}
+		for k, route := range routes {
+			var vrf string
+			if route.Vrf != nil {
+				vrf = path.Base(route.Vrf.Name)
+			}
+			candidates = append(candidates, RouteCandidate{
+				Vrf:      vrf,
+				Prefix:   key.Dst,
+				Table:    key.Table,
+				Protocol: route.Route0.Protocol.String(),
+				Distance: routeDistance(route),
+				Metric:   route.Route0.Priority,
+				Elected:  k == electedCandidates[key],
+			})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Prefix != candidates[j].Prefix {
+			return candidates[i].Prefix < candidates[j].Prefix
+		}
+		if candidates[i].Distance != candidates[j].Distance {
+			return candidates[i].Distance < candidates[j].Distance
+		}
+		return candidates[i].Metric < candidates[j].Metric
+	})
+	return candidates
+}
@@ -0,0 +1,299 @@
+//go:build scaletest
+
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/vishvananda/netlink"
+)
+
+// The scale test writes synthetic entries to the device, it is only built
+// into the test builds of the bridge with the scaletest tag
+var _ = registerAdmin("scaletest", scopeOperator, handleScaleTest)
+
+// synthetic objects limits, the nexthop ids are taken high above the ids the
+// netlink module hands out so they do not share their neighbor slots
+const (
+	scaleNexthopBase = 0x6000
+	scaleMaxNexthops = 0x7fff - scaleNexthopBase
+	scaleMaxRoutes   = 1 << 16
+	scaleMaxFdbs     = 1 << 16
+)
+
+// ScaleTest synthetic objects to drive through the translation and write
+// path, the routes are /32 or /24 prefixes counted up from the base prefix
+// and spread over the nexthops
+type ScaleTest struct {
+	Vrf      string `json:"vrf"`
+	Routes   int    `json:"routes"`
+	Nexthops int    `json:"nexthops"`
+	Fdbs     int    `json:"fdbs"`
+	VlanID   int    `json:"vlanid"`
+	Base     string `json:"base"`
+	Host     bool   `json:"host"`
+}
+
+// ScalePhase throughput of the writes of one phase of a scale test
+type ScalePhase struct {
+	Objects  int           `json:"objects"`
+	Entries  int           `json:"entries"`
+	Duration time.Duration `json:"duration"`
+	Rate     float64       `json:"entriespersec"`
+}
+
+// ScaleReport result of a scale test, the occupancy is read with the
+// synthetic objects programmed
+type ScaleReport struct {
+	Test      ScaleTest    `json:"test"`
+	Start     time.Time    `json:"start"`
+	Nexthops  ScalePhase   `json:"nexthops"`
+	Routes    ScalePhase   `json:"routes"`
+	Fdbs      ScalePhase   `json:"fdbs"`
+	Removal   ScalePhase   `json:"removal"`
+	Occupancy []TableUsage `json:"occupancy"`
+}
+
+var (
+	// scaleLock serializes the scale tests and guards the last report
+	scaleLock sync.Mutex
+
+	// scaleReport report of the last scale test
+	scaleReport *ScaleReport
+)
+
+// validate checks the limits of the scale test and applies the defaults
+func (t *ScaleTest) validate() error {
+	if t.Vrf == "" {
+		return fmt.Errorf("scale test needs a vrf")
+	}
+	if t.Nexthops <= 0 {
+		t.Nexthops = 1
+	}
+	if t.Nexthops > scaleMaxNexthops || t.Routes > scaleMaxRoutes || t.Fdbs > scaleMaxFdbs {
+		return fmt.Errorf("scale test limited to %d nexthops, %d routes and %d fdb entries", scaleMaxNexthops, scaleMaxRoutes, scaleMaxFdbs)
+	}
+	if t.Routes < 0 || t.Fdbs < 0 {
+		return fmt.Errorf("invalid object count")
+	}
+	if t.Base == "" {
+		t.Base = "100.64.0.0"
+	}
+	if net.ParseIP(t.Base).To4() == nil {
+		return fmt.Errorf("invalid base prefix %q", t.Base)
+	}
+	if t.Fdbs > 0 && (t.VlanID <= 0 || t.VlanID > 4094) {
+		return fmt.Errorf("fdb entries need a vlan id")
+	}
+	return nil
+}
+
+// newPhase measures the entries written by a phase
+func newPhase(objects int, entries int, start time.Time) ScalePhase {
+	phase := ScalePhase{Objects: objects, Entries: entries, Duration: time.Since(start)}
+	if phase.Duration > 0 {
+		phase.Rate = float64(entries) / phase.Duration.Seconds()
+	}
+	return phase
+}
+
+// scaleNexthop synthesizes a phy nexthop of the scale test
+func scaleNexthop(vrf *infradb.Vrf, i int) nm.NexthopStruct {
+	ip := net.IPv4(198, 18, byte(i>>8), byte(i))
+	return nm.NexthopStruct{
+		ID:     scaleNexthopBase + i,
+		NhType: nm.PHY,
+		Key:    nm.NexthopKey{VrfName: vrf.Name, Dst: ip.String(), Dev: -1 - i},
+		Metadata: map[interface{}]interface{}{
+			"smac":         "02:00:00:00:00:01",
+			"dmac":         fmt.Sprintf("02:5c:%02x:%02x:00:02", byte(i>>8), byte(i)),
+			"egress_vport": PortID.PHY0,
+			"direction":    nm.TX,
+		},
+	}
+}
+
+// scaleRoute synthesizes a route of the scale test
+func scaleRoute(t ScaleTest, vrf *infradb.Vrf, table int, nexthops []nm.NexthopStruct, i int) nm.RouteStruct {
+	base := binary.BigEndian.Uint32(net.ParseIP(t.Base).To4())
+	ip := make(net.IP, 4)
+	mask := net.CIDRMask(24, 32)
+	if t.Host {
+		binary.BigEndian.PutUint32(ip, base+uint32(i))
+		mask = net.CIDRMask(32, 32)
+	} else {
+		binary.BigEndian.PutUint32(ip, base+uint32(i)<<8)
+	}
+	dst := &net.IPNet{IP: ip, Mask: mask}
+	nh := nexthops[i%len(nexthops)]
+	return nm.RouteStruct{
+		Route0:   netlink.Route{Dst: dst, Table: table},
+		Vrf:      vrf,
+		Nexthops: []*nm.NexthopStruct{&nh},
+		Metadata: map[interface{}]interface{}{"direction": nm.RXTX},
+		Key:      nm.RouteKey{Table: table, Dst: dst.String()},
+	}
+}
+
+// scaleFdb synthesizes a vxlan fdb entry of the scale test
+func scaleFdb(t ScaleTest, nexthops []nm.NexthopStruct, i int) nm.FdbEntryStruct {
+	mac := fmt.Sprintf("02:5d:%02x:%02x:%02x:01", byte(i>>16), byte(i>>8), byte(i))
+	return nm.FdbEntryStruct{
+		VlanID: t.VlanID,
+		Mac:    mac,
+		Key:    nm.FdbKey{VlanID: t.VlanID, Mac: mac},
+		Type:   nm.VXLAN,
+		Metadata: map[interface{}]interface{}{
+			"nh_id":     nexthops[i%len(nexthops)].ID,
+			"direction": nm.RXTX,
+		},
+	}
+}
+
+// RunScaleTest synthesizes nexthops, routes and fdb entries, programs them
+// through the decoders and the p4runtime client and removes them again. The
+// decoders are held for the whole test so the events wait until it is done
+func RunScaleTest(t ScaleTest) (ScaleReport, error) {
+	if err := t.validate(); err != nil {
+		return ScaleReport{}, fmt.Errorf("intel-e2000: %v", err)
+	}
+	if p4client.IsStandby() || !GetReadiness().P4Connected {
+		return ScaleReport{}, fmt.Errorf("intel-e2000: scale test needs a connected primary")
+	}
+	name := t.Vrf
+	if !strings.HasPrefix(name, "//") {
+		name = vrfPrefix + name
+	}
+	vrf, err := infradb.GetVrf(name)
+	if err != nil {
+		return ScaleReport{}, fmt.Errorf("intel-e2000: vrf %s not found: %v", t.Vrf, err)
+	}
+	vrfTable, err := _vrfTable(vrf)
+	if vrf.Spec.Vni == nil || err != nil {
+		return ScaleReport{}, fmt.Errorf("intel-e2000: scale test needs an evpn vrf with a routing table")
+	}
+	table := int(vrfTable)
+
+	scaleLock.Lock()
+	defer scaleLock.Unlock()
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+
+	report := ScaleReport{Test: t, Start: time.Now()}
+	log.Printf("intel-e2000: Scale test of %d nexthops, %d routes and %d fdb entries in vrf %s\n", t.Nexthops, t.Routes, t.Fdbs, t.Vrf)
+
+	nexthops := make([]nm.NexthopStruct, t.Nexthops)
+	var removal [][]interface{}
+	start, written := time.Now(), 0
+	for i := range nexthops {
+		nexthops[i] = scaleNexthop(vrf, i)
+		if _, err := claimNeighborSlot(nexthops[i].ID); err != nil {
+			log.Printf("intel-e2000: Scale test nexthop %d not offloaded: %v\n", i, err)
+			continue
+		}
+		entries := L3.translateAddedNexthop(nexthops[i])
+		addEntries(entries)
+		written += len(entries)
+	}
+	report.Nexthops = newPhase(len(nexthops), written, start)
+
+	routes := make([]nm.RouteStruct, t.Routes)
+	start, written = time.Now(), 0
+	for i := range routes {
+		routes[i] = scaleRoute(t, vrf, table, nexthops, i)
+		entries := L3.translateAddedRoute(routes[i])
+		addEntries(entries)
+		written += len(entries)
+	}
+	report.Routes = newPhase(len(routes), written, start)
+
+	fdbs := make([]nm.FdbEntryStruct, t.Fdbs)
+	start, written = time.Now(), 0
+	for i := range fdbs {
+		fdbs[i] = scaleFdb(t, nexthops, i)
+		entries := Vxlan.translateAddedFdb(fdbs[i])
+		addEntries(entries)
+		written += len(entries)
+	}
+	report.Fdbs = newPhase(len(fdbs), written, start)
+
+	pollTableUsage()
+	report.Occupancy = TableUsages()
+
+	for i := range fdbs {
+		removal = append(removal, Vxlan.translateDeletedFdb(fdbs[i]))
+	}
+	for i := range routes {
+		removal = append(removal, L3.translateDeletedRoute(routes[i]))
+	}
+	for i := range nexthops {
+		removal = append(removal, L3.translateDeletedNexthop(nexthops[i]))
+	}
+	start, written = time.Now(), 0
+	for _, entries := range removal {
+		delEntries(entries)
+		written += len(entries)
+	}
+	for i := range nexthops {
+		releaseNeighborSlot(nexthops[i].ID)
+	}
+	report.Removal = newPhase(len(fdbs)+len(routes)+len(nexthops), written, start)
+
+	log.Printf("intel-e2000: Scale test wrote routes at %.0f and removed at %.0f entries/s\n", report.Routes.Rate, report.Removal.Rate)
+	scaleReport = &report
+	return report, nil
+}
+
+// LastScaleReport returns the report of the last scale test
+func LastScaleReport() (ScaleReport, bool) {
+	scaleLock.Lock()
+	defer scaleLock.Unlock()
+	if scaleReport == nil {
+		return ScaleReport{}, false
+	}
+	return *scaleReport, true
+}
+
+// handleScaleTest returns the report of the last scale test on GET and runs
+// one on POST
+func handleScaleTest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report, ok := LastScaleReport()
+		if !ok {
+			http.Error(w, "no scale test run", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	case http.MethodPost:
+		var test ScaleTest
+		if err := json.NewDecoder(r.Body).Decode(&test); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report, err := RunScaleTest(test)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
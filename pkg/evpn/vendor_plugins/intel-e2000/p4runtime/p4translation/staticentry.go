@@ -0,0 +1,310 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"github.com/spf13/viper"
+)
+
+// staticEntriesKey config key of the operator static entries
+const staticEntriesKey = "staticentries"
+
+// StaticEntryField match field of an operator static entry, the match is
+// exact, lpm or ternary and defaults to exact
+type StaticEntryField struct {
+	Name  string `yaml:"name" json:"name"`
+	Value string `yaml:"value" json:"value"`
+	Match string `yaml:"match" json:"match,omitempty"`
+}
+
+// StaticEntry punt or forward rule an operator declares in any table of the
+// pipeline. The plugin owns it: it is validated against the p4info, written,
+// kept on the device by the watchdog and the reconciler, and removed only
+// through the api or the config file. The values are parsed by the bit width
+// of their field or param, macs, ips, prefixes or numbers
+type StaticEntry struct {
+	Name     string             `yaml:"name" json:"name"`
+	Table    string             `yaml:"table" json:"table"`
+	Fields   []StaticEntryField `yaml:"fields" json:"fields"`
+	Priority int32              `yaml:"priority" json:"priority,omitempty"`
+	Action   string             `yaml:"action" json:"action"`
+	Params   []string           `yaml:"params" json:"params,omitempty"`
+	Source   string             `yaml:"-" json:"source,omitempty"`
+	Error    string             `yaml:"-" json:"error,omitempty"`
+	entry    p4client.TableEntry
+}
+
+// sources of the operator static entries
+const (
+	staticFromConfig = "config"
+	staticFromAPI    = "api"
+)
+
+var (
+	// staticEntryLock guards the operator static entries
+	staticEntryLock sync.Mutex
+
+	// operatorEntries operator static entries keyed by name
+	operatorEntries = make(map[string]*StaticEntry)
+)
+
+// parseStaticValue parses the value of a field or a param of the given bit
+// width into the type the driver encodes
+func parseStaticValue(value string, width int32, prefix bool) (interface{}, error) {
+	if prefix && strings.Contains(value, "/") {
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		return ipNet, nil
+	}
+	switch {
+	case width == 48:
+		return net.ParseMAC(value)
+	case width == 32 && net.ParseIP(value) != nil:
+		return net.ParseIP(value).To4(), nil
+	case width > 32:
+		return nil, fmt.Errorf("unsupported bit width %d", width)
+	}
+	n, err := strconv.ParseUint(value, 0, int(width))
+	if err != nil {
+		return nil, err
+	}
+	if width <= 16 {
+		return uint16(n), nil
+	}
+	return uint32(n), nil
+}
+
+// build builds the table entry of an operator static entry and validates it
+// against the p4info
+func (s *StaticEntry) build() error {
+	if s.Name == "" {
+		return errors.New("static entry needs a name")
+	}
+	e := p4client.TableEntry{
+		Tablename: s.Table,
+		TableField: p4client.TableField{
+			FieldValue: make(map[string][2]interface{}),
+			Priority:   s.Priority,
+		},
+		Action: p4client.Action{ActionName: s.Action},
+	}
+	for _, f := range s.Fields {
+		match := strings.ToLower(f.Match)
+		if match == "" {
+			match = "exact"
+		}
+		width, err := p4client.MatchFieldWidth(s.Table, f.Name)
+		if err != nil {
+			return err
+		}
+		value, err := parseStaticValue(f.Value, width, match == "lpm")
+		if err != nil {
+			return fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		e.FieldValue[f.Name] = [2]interface{}{value, match}
+	}
+	widths, err := p4client.ActionParamWidths(s.Action)
+	if err != nil {
+		return err
+	}
+	if len(widths) != len(s.Params) {
+		return fmt.Errorf("action %s takes %d params, got %d", s.Action, len(widths), len(s.Params))
+	}
+	for i, param := range s.Params {
+		value, err := parseStaticValue(param, widths[i], false)
+		if err != nil {
+			return fmt.Errorf("param %d of %s: %v", i, s.Action, err)
+		}
+		e.Params = append(e.Params, value)
+	}
+	if err := p4client.ValidateEntry(e); err != nil {
+		return err
+	}
+	s.entry = e
+	return nil
+}
+
+// staticEntryOwner returns the owner of an entry matching the key among the
+// entries of the plugin, empty when free, the caller holds the decoder lock
+func staticEntryOwner(key string, name string) string {
+	for _, entry := range append(L3.StaticAdditions(), Pod.StaticAdditions()...) {
+		if e, ok := entry.(p4client.TableEntry); ok && entryKey(e) == key {
+			return "the static entries of the plugin"
+		}
+	}
+	objectEntriesLock.Lock()
+	for object, entries := range objectEntries {
+		for _, entry := range entries {
+			if e, ok := entry.(p4client.TableEntry); ok && entryKey(e) == key {
+				objectEntriesLock.Unlock()
+				return object
+			}
+		}
+	}
+	objectEntriesLock.Unlock()
+	staticEntryLock.Lock()
+	defer staticEntryLock.Unlock()
+	for other, s := range operatorEntries {
+		if other != name && entryKey(s.entry) == key {
+			return "static entry " + other
+		}
+	}
+	return ""
+}
+
+// writeStaticEntry writes an operator static entry, an entry already on the
+// device with the same match, e.g. added out of band, is taken over
+func writeStaticEntry(e p4client.TableEntry) error {
+	exists, err := entryProgrammed(e, make(map[string][]*p4_v1.TableEntry))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return addEntries([]interface{}{e})
+	}
+	manageTable(e.Tablename)
+	if err := claimTcamRow(e); err != nil {
+		return err
+	}
+	return writeError(e.Tablename, p4client.ModEntry(e))
+}
+
+// setStaticEntry validates and writes an operator static entry, replacing the
+// entry of the same name, the caller holds the decoder lock
+func setStaticEntry(s StaticEntry, source string) error {
+	if err := s.build(); err != nil {
+		return fmt.Errorf("intel-e2000: invalid static entry %s: %v", s.Name, err)
+	}
+	key := entryKey(s.entry)
+	if owner := staticEntryOwner(key, s.Name); owner != "" {
+		return fmt.Errorf("intel-e2000: static entry %s matches an entry of %s", s.Name, owner)
+	}
+	staticEntryLock.Lock()
+	old, ok := operatorEntries[s.Name]
+	staticEntryLock.Unlock()
+	if ok && old.Source != source {
+		return fmt.Errorf("intel-e2000: static entry %s is set by the %s", s.Name, old.Source)
+	}
+	if ok && entryKey(old.entry) != key {
+		if err := delEntries([]interface{}{old.entry}); err != nil {
+			return fmt.Errorf("intel-e2000: failed to remove the previous static entry %s: %v", s.Name, err)
+		}
+	}
+	s.Source = source
+	s.Error = ""
+	if err := writeStaticEntry(s.entry); err != nil {
+		s.Error = err.Error()
+		log.Printf("intel-e2000: Failed to write static entry %s: %v\n", s.Name, err)
+	} else {
+		log.Printf("intel-e2000: Static entry %s written in %s\n", s.Name, s.Table)
+	}
+	staticEntryLock.Lock()
+	operatorEntries[s.Name] = &s
+	staticEntryLock.Unlock()
+	return nil
+}
+
+// removeStaticEntry removes an operator static entry from the device, the
+// caller holds the decoder lock
+func removeStaticEntry(name string, source string) error {
+	staticEntryLock.Lock()
+	s, ok := operatorEntries[name]
+	staticEntryLock.Unlock()
+	if !ok {
+		return fmt.Errorf("intel-e2000: no static entry %s", name)
+	}
+	if s.Source != source {
+		return fmt.Errorf("intel-e2000: static entry %s is set by the %s", name, s.Source)
+	}
+	if err := delEntries([]interface{}{s.entry}); err != nil {
+		return fmt.Errorf("intel-e2000: failed to remove static entry %s: %v", name, err)
+	}
+	staticEntryLock.Lock()
+	delete(operatorEntries, name)
+	staticEntryLock.Unlock()
+	log.Printf("intel-e2000: Static entry %s removed from %s\n", name, s.Table)
+	return nil
+}
+
+// loadStaticEntries writes the static entries of the config file and removes
+// the ones dropped from it, the caller holds the decoder lock
+func loadStaticEntries() {
+	var cfg []StaticEntry
+	if err := viper.UnmarshalKey(staticEntriesKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read static entries: %v\n", err)
+		return
+	}
+	configured := make(map[string]bool)
+	for _, s := range cfg {
+		configured[s.Name] = true
+		if err := setStaticEntry(s, staticFromConfig); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+	staticEntryLock.Lock()
+	var dropped []string
+	for name, s := range operatorEntries {
+		if s.Source == staticFromConfig && !configured[name] {
+			dropped = append(dropped, name)
+		}
+	}
+	staticEntryLock.Unlock()
+	for _, name := range dropped {
+		if err := removeStaticEntry(name, staticFromConfig); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+}
+
+// operatorStaticEntries returns the entries of the operator static entries
+func operatorStaticEntries() []interface{} {
+	staticEntryLock.Lock()
+	defer staticEntryLock.Unlock()
+	entries := make([]interface{}, 0, len(operatorEntries))
+	for _, s := range operatorEntries {
+		entries = append(entries, s.entry)
+	}
+	return entries
+}
+
+// SetStaticEntry declares or replaces an operator static entry
+func SetStaticEntry(s StaticEntry) error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	return setStaticEntry(s, staticFromAPI)
+}
+
+// DeleteStaticEntry removes an operator static entry declared through the api
+func DeleteStaticEntry(name string) error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	return removeStaticEntry(name, staticFromAPI)
+}
+
+// StaticEntries returns the operator static entries
+func StaticEntries() []StaticEntry {
+	staticEntryLock.Lock()
+	defer staticEntryLock.Unlock()
+	list := make([]StaticEntry, 0, len(operatorEntries))
+	for _, s := range operatorEntries {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
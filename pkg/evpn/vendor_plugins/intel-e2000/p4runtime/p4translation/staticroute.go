@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+	"github.com/vishvananda/netlink"
+)
+
+// injectedRoutesKey config key of the injected routes file
+const injectedRoutesKey = "injectedroutes.path"
+
+// vrfPrefix name prefix of the vrf objects
+const vrfPrefix = "//network.opiproject.org/vrfs/"
+
+// StaticRoute route injected bypassing the kernel routing table
+type StaticRoute struct {
+	Vrf       string   `json:"vrf"`
+	Prefix    string   `json:"prefix"`
+	Nexthops  []string `json:"nexthops"`
+	Direction string   `json:"direction"`
+	Table     uint32   `json:"table,omitempty"`
+}
+
+var (
+	// injectedLock guards the injected routes
+	injectedLock sync.Mutex
+
+	// injectedRoutes routes injected keyed by vrf and prefix, kept across
+	// restarts and replayed until programmed
+	injectedRoutes = make(map[string]StaticRoute)
+
+	// injectedKeys route keys of the injected routes programmed keyed by vrf
+	// and prefix
+	injectedKeys = make(map[string]nm.RouteKey)
+
+	// injectedMissing last replay error of the injected routes not programmed
+	// keyed by vrf and prefix, a replay error is logged once
+	injectedMissing = make(map[string]string)
+)
+
+// staticRouteVrf returns the network-instance name of a static route
+func staticRouteVrf(route StaticRoute) string {
+	return strings.TrimPrefix(route.Vrf, vrfPrefix)
+}
+
+// staticRouteID identifies a static route by its vrf and its masked prefix
+func staticRouteID(route StaticRoute) string {
+	prefix := route.Prefix
+	if _, dst, err := net.ParseCIDR(prefix); err == nil {
+		prefix = dst.String()
+	}
+	return staticRouteVrf(route) + "/" + prefix
+}
+
+// routeDirection converts the direction name to the netlink direction
+func routeDirection(direction string) (int, error) {
+	switch strings.ToLower(direction) {
+	case "", "rxtx":
+		return nm.RXTX, nil
+	case "rx":
+		return nm.RX, nil
+	case "tx":
+		return nm.TX, nil
+	}
+	return 0, fmt.Errorf("invalid direction %q, use rx, tx or rxtx", direction)
+}
+
+// toRouteStruct builds the netlink route of a static route, the nexthops
+// have to be known by the netlink module already
+func (r StaticRoute) toRouteStruct() (nm.RouteStruct, error) {
+	var route nm.RouteStruct
+	name := r.Vrf
+	if !strings.HasPrefix(name, "//") {
+		name = vrfPrefix + name
+	}
+	vrf, err := infradb.GetVrf(name)
+	if err != nil {
+		return route, fmt.Errorf("vrf %s not found: %v", r.Vrf, err)
+	}
+	_, dst, err := net.ParseCIDR(r.Prefix)
+	if err != nil {
+		return route, fmt.Errorf("invalid prefix %q", r.Prefix)
+	}
+	direction, err := routeDirection(r.Direction)
+	if err != nil {
+		return route, err
+	}
+	var table int
+	if vrfTable, err := _vrfTable(vrf); err == nil {
+		table = int(vrfTable)
+	}
+	if r.Table != 0 {
+		if !_isVrfTable(vrf, r.Table) {
+			return route, fmt.Errorf("table %d is not a routing table of vrf %s", r.Table, r.Vrf)
+		}
+		table = int(r.Table)
+	}
+	if len(r.Nexthops) == 0 {
+		return route, fmt.Errorf("route %s needs at least one nexthop", r.Prefix)
+	}
+	stateLock.Lock()
+	for _, gw := range r.Nexthops {
+		var found bool
+		for key, nexthop := range nexthopCache {
+			if key.Dst == gw && key.VrfName == vrf.Name {
+				nh := nexthop
+				route.Nexthops = append(route.Nexthops, &nh)
+				found = true
+				break
+			}
+		}
+		if !found {
+			stateLock.Unlock()
+			return route, fmt.Errorf("nexthop %s not resolved in vrf %s", gw, r.Vrf)
+		}
+	}
+	stateLock.Unlock()
+	route.Route0 = netlink.Route{Dst: dst, Table: table}
+	route.Vrf = vrf
+	route.Metadata = map[interface{}]interface{}{"direction": direction}
+	route.Key = nm.RouteKey{Table: table, Dst: dst.String()}
+	return route, nil
+}
+
+// _injectRoute programs a static route through the L3 decoder, the caller
+// holds the decoder lock
+func _injectRoute(r StaticRoute) error {
+	route, err := r.toRouteStruct()
+	if err != nil {
+		return fmt.Errorf("intel-e2000: %v", err)
+	}
+	stateLock.Lock()
+	_, replaced := routeCache[route.Key]
+	stateLock.Unlock()
+	old, oldOk, live, ok := cacheRoute(route)
+	injectedLock.Lock()
+	injectedRoutes[staticRouteID(r)] = r
+	injectedKeys[staticRouteID(r)] = route.Key
+	delete(injectedMissing, staticRouteID(r))
+	injectedLock.Unlock()
+	if replaced && oldOk {
+		delEntries(L3.translateDeletedRoute(old))
+	}
+	if ok {
+		entries := L3.translateAddedRoute(live)
+		addEntries(entries)
+		probeRoute(live, entries)
+		meterRoute(live, entries)
+	}
+	log.Printf("intel-e2000: Injected route %s in vrf %s via %v\n", r.Prefix, r.Vrf, r.Nexthops)
+	return nil
+}
+
+// InjectRoute programs a static route through the L3 decoder and persists
+// it, the route is replayed on restart once its vrf and nexthops are known
+func InjectRoute(r StaticRoute) error {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	if err := _injectRoute(r); err != nil {
+		return err
+	}
+	writeInjectedRoutes()
+	return nil
+}
+
+// WithdrawRoute removes a static route injected before, the route is matched
+// by vrf and prefix so its nexthops need not be resolved anymore
+func WithdrawRoute(r StaticRoute) error {
+	id := staticRouteID(r)
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	injectedLock.Lock()
+	if _, found := injectedRoutes[id]; !found {
+		injectedLock.Unlock()
+		return fmt.Errorf("intel-e2000: route %s in vrf %s was not injected", r.Prefix, r.Vrf)
+	}
+	key, programmed := injectedKeys[id]
+	delete(injectedRoutes, id)
+	delete(injectedKeys, id)
+	delete(injectedMissing, id)
+	injectedLock.Unlock()
+	writeInjectedRoutes()
+	if !programmed {
+		log.Printf("intel-e2000: Withdrew route %s in vrf %s not programmed yet\n", r.Prefix, r.Vrf)
+		return nil
+	}
+	if live, ok := uncacheRoute(nm.RouteStruct{Key: key}); ok {
+		delEntries(L3.translateDeletedRoute(live))
+	}
+	dropRouteProbe(key)
+	unmeterRoute(key)
+	log.Printf("intel-e2000: Withdrew route %s in vrf %s\n", r.Prefix, r.Vrf)
+	return nil
+}
+
+// InjectedRoutes returns the routes injected, including the ones waiting to
+// be replayed
+func InjectedRoutes() []StaticRoute {
+	injectedLock.Lock()
+	defer injectedLock.Unlock()
+	var routes = make([]StaticRoute, 0, len(injectedRoutes))
+	for _, r := range injectedRoutes {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool { return staticRouteID(routes[i]) < staticRouteID(routes[j]) })
+	return routes
+}
+
+// injectedRouteProgrammed checks an injected route is programmed
+func injectedRouteProgrammed(r StaticRoute) bool {
+	injectedLock.Lock()
+	defer injectedLock.Unlock()
+	_, programmed := injectedKeys[staticRouteID(r)]
+	return programmed
+}
+
+// writeInjectedRoutes persists the injected routes
+func writeInjectedRoutes() {
+	path := viper.GetString(injectedRoutesKey)
+	if path == "" {
+		return
+	}
+	if err := writeStateFile(path, InjectedRoutes()); err != nil {
+		log.Printf("intel-e2000: Failed to write injected routes %s: %v\n", path, err)
+	}
+}
+
+// loadInjectedRoutes reads the routes injected in the previous run, they are
+// programmed by replayInjectedRoutes once their vrf and nexthops are known
+func loadInjectedRoutes() {
+	path := viper.GetString(injectedRoutesKey)
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		log.Printf("intel-e2000: Failed to create injected routes directory: %v\n", err)
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("intel-e2000: Failed to read injected routes %s: %v\n", path, err)
+		}
+		return
+	}
+	var routes []StaticRoute
+	if err := json.Unmarshal(data, &routes); err != nil {
+		log.Printf("intel-e2000: Ignoring corrupt injected routes %s: %v\n", path, err)
+		return
+	}
+	injectedLock.Lock()
+	for _, r := range routes {
+		if _, found := injectedRoutes[staticRouteID(r)]; !found {
+			injectedRoutes[staticRouteID(r)] = r
+		}
+	}
+	injectedLock.Unlock()
+	log.Printf("intel-e2000: Restored %d injected routes\n", len(routes))
+}
+
+// _replayInjectedRoutes programs the injected routes not programmed yet, the
+// ones still missing their vrf or nexthops are retried on the next replay.
+// The caller holds the decoder lock
+func _replayInjectedRoutes() {
+	var routes []StaticRoute
+	injectedLock.Lock()
+	for id, r := range injectedRoutes {
+		if _, programmed := injectedKeys[id]; !programmed {
+			routes = append(routes, r)
+		}
+	}
+	injectedLock.Unlock()
+	for _, r := range routes {
+		err := _injectRoute(r)
+		if err == nil {
+			continue
+		}
+		injectedLock.Lock()
+		if injectedMissing[staticRouteID(r)] != err.Error() {
+			injectedMissing[staticRouteID(r)] = err.Error()
+			log.Printf("intel-e2000: Injected route %s in vrf %s not replayed yet: %v\n", r.Prefix, r.Vrf, err)
+		}
+		injectedLock.Unlock()
+	}
+}
+
+// replayInjectedRoutes programs the injected routes not programmed yet
+func replayInjectedRoutes() {
+	injectedLock.Lock()
+	waiting := len(injectedRoutes) != len(injectedKeys)
+	injectedLock.Unlock()
+	if !waiting {
+		return
+	}
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	_replayInjectedRoutes()
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"sort"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// SviCounters routed traffic of an svi, routed in is the traffic of the
+// bridge ports sent to the svi and routed out the traffic routed to its
+// neighbors
+type SviCounters struct {
+	Name             string `json:"name"`
+	RoutedInPackets  int64  `json:"routedinpackets"`
+	RoutedInBytes    int64  `json:"routedinbytes"`
+	RoutedOutPackets int64  `json:"routedoutpackets"`
+	RoutedOutBytes   int64  `json:"routedoutbytes"`
+}
+
+// sumCounters adds up the direct counters of the entries
+func sumCounters(entries []interface{}) (int64, int64) {
+	var packets, bytes int64
+	for _, entry := range entries {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			continue
+		}
+		data, err := p4client.ReadCounter(e)
+		if err != nil {
+			log.Printf("intel-e2000: failed to read counter of %s: %v\n", e.Tablename, err)
+			continue
+		}
+		packets += data.GetPacketCount()
+		bytes += data.GetByteCount()
+	}
+	return packets, bytes
+}
+
+// sviNexthopEntries returns the nexthop entries of the neighbors of an svi,
+// they are rewritten with the svi mac as source
+func sviNexthopEntries(svi *infradb.Svi) []interface{} {
+	var entries []interface{}
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	for _, nexthop := range nexthopCache {
+		if nexthop.NhType != nm.SVI {
+			continue
+		}
+		if smac, ok := nexthop.Metadata["smac"].(string); !ok || smac != svi.Spec.MacAddress.String() {
+			continue
+		}
+		nhID, err := _p4NexthopID(nexthop, Direction.Tx)
+		if err != nil {
+			// Never offloaded without a neighbor
+			continue
+		}
+		for _, table := range []string{l3NhRx, l3NhTx} {
+			entries = append(entries, p4client.TableEntry{
+				Tablename: table,
+				TableField: p4client.TableField{
+					FieldValue: map[string][2]interface{}{
+						"neighbor":    {uint16(nhID), "exact"},
+						"bit32_zeros": {uint32(0), "exact"},
+					},
+					Priority: int32(0),
+				},
+			})
+		}
+	}
+	return entries
+}
+
+// SviCounterStats returns the routed traffic of the svis programmed
+func SviCounterStats() []SviCounters {
+	stats := make([]SviCounters, 0)
+	svis, err := infradb.GetAllSvis()
+	if err != nil {
+		return stats
+	}
+	sort.Slice(svis, func(i, j int) bool { return svis[i].Name < svis[j].Name })
+
+	decoderLock.RLock()
+	defer decoderLock.RUnlock()
+	for _, svi := range svis {
+		if svi.Spec.MacAddress == nil || !offloaded(svi.Status.Components) {
+			continue
+		}
+		ingress, err := Pod.translateDeletedSvi(svi)
+		if err != nil {
+			log.Printf("intel-e2000: failed to build svi entries of %s: %v\n", svi.Name, err)
+			continue
+		}
+		s := SviCounters{Name: svi.Name}
+		s.RoutedInPackets, s.RoutedInBytes = sumCounters(ingress)
+		s.RoutedOutPackets, s.RoutedOutBytes = sumCounters(sviNexthopEntries(svi))
+		stats = append(stats, s)
+	}
+	return stats
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	p4_v1 "github.com/p4lang/p4runtime/go/p4/v1"
+	"github.com/spf13/viper"
+)
+
+// sviMeterKey config key of the svi routed traffic meters
+const sviMeterKey = "svimeter"
+
+// meter modes
+const (
+	srTcm = "srtcm"
+	trTcm = "trtcm"
+)
+
+// color actions
+const (
+	colorForward = "forward"
+	colorRemark  = "remark"
+	colorDrop    = "drop"
+)
+
+// SviMeter three color meter of the routed traffic of an svi, the rates are
+// in kbit/s and the bursts in bytes. The srtcm mode uses cir, cbs and ebs,
+// the trtcm mode cir, cbs, pir and pbs
+type SviMeter struct {
+	Mode   string `yaml:"mode"`
+	Cir    int64  `yaml:"cir"`
+	Cbs    int64  `yaml:"cbs"`
+	Ebs    int64  `yaml:"ebs"`
+	Pir    int64  `yaml:"pir"`
+	Pbs    int64  `yaml:"pbs"`
+	Green  string `yaml:"green"`
+	Yellow string `yaml:"yellow"`
+	Red    string `yaml:"red"`
+}
+
+// SviMeterConfig svi meter config structure, the meter is indexed by the
+// vlan of the svi, the vrfs set the meter of all their svis and the svis
+// override it
+type SviMeterConfig struct {
+	Meter string              `yaml:"meter"`
+	Vrfs  map[string]SviMeter `yaml:"vrfs"`
+	Svis  map[string]SviMeter `yaml:"svis"`
+}
+
+// loadSviMeterConfig reads the svi meters from config
+func loadSviMeterConfig() SviMeterConfig {
+	var cfg SviMeterConfig
+	if err := viper.UnmarshalKey(sviMeterKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read svi meters: %v\n", err)
+	}
+	return cfg
+}
+
+// meterConfig converts the svi meter to a p4runtime meter config in bytes
+func (m SviMeter) meterConfig() (*p4_v1.MeterConfig, error) {
+	cir := m.Cir * 1000 / 8
+	if cir <= 0 {
+		return nil, fmt.Errorf("meter needs a cir")
+	}
+	switch strings.ToLower(m.Mode) {
+	case "", srTcm:
+		return &p4_v1.MeterConfig{Cir: cir, Cburst: m.Cbs, Pir: cir, Pburst: m.Cbs + m.Ebs}, nil
+	case trTcm:
+		pir := m.Pir * 1000 / 8
+		if pir < cir {
+			return nil, fmt.Errorf("pir %d kbit/s is below cir %d kbit/s", m.Pir, m.Cir)
+		}
+		return &p4_v1.MeterConfig{Cir: cir, Cburst: m.Cbs, Pir: pir, Pburst: m.Pbs}, nil
+	default:
+		return nil, fmt.Errorf("unknown meter mode %q", m.Mode)
+	}
+}
+
+// notOffloadedActions returns the color actions differing from the ones of
+// the pipeline, green and yellow are forwarded and red is dropped
+func (m SviMeter) notOffloadedActions() ([]string, error) {
+	var actions []string
+	for _, c := range []struct {
+		color, action, fixed string
+	}{{"green", m.Green, colorForward}, {"yellow", m.Yellow, colorForward}, {"red", m.Red, colorDrop}} {
+		action := strings.ToLower(c.action)
+		switch action {
+		case "", c.fixed:
+		case colorForward, colorRemark, colorDrop:
+			actions = append(actions, fmt.Sprintf("%s action %s", c.color, action))
+		default:
+			return nil, fmt.Errorf("unknown %s action %q", c.color, c.action)
+		}
+	}
+	return actions, nil
+}
+
+// sviMeter returns the meter configured for an svi and its meter index
+func sviMeter(svi *infradb.Svi) (SviMeterConfig, SviMeter, int64, bool) {
+	cfg := loadSviMeterConfig()
+	m, ok := cfg.Svis[path.Base(svi.Name)]
+	if !ok {
+		m, ok = cfg.Vrfs[path.Base(svi.Spec.Vrf)]
+	}
+	if !ok {
+		return cfg, m, 0, false
+	}
+	lb, err := infradb.GetLB(svi.Spec.LogicalBridge)
+	if err != nil {
+		return cfg, m, 0, false
+	}
+	return cfg, m, int64(lb.Spec.VlanID), true
+}
+
+// applySviMeter programs the meter of the routed traffic of an svi, it
+// returns the color actions the pipeline cannot apply
+func applySviMeter(svi *infradb.Svi) ([]string, error) {
+	cfg, m, index, ok := sviMeter(svi)
+	if !ok {
+		return nil, nil
+	}
+	if cfg.Meter == "" {
+		return nil, fmt.Errorf("intel-e2000: no meter configured to meter svi %s", svi.Name)
+	}
+	config, err := m.meterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("intel-e2000: invalid meter of svi %s: %v", svi.Name, err)
+	}
+	actions, err := m.notOffloadedActions()
+	if err != nil {
+		return nil, fmt.Errorf("intel-e2000: invalid meter of svi %s: %v", svi.Name, err)
+	}
+	if err := p4client.SetMeter(cfg.Meter, index, config); err != nil {
+		return nil, fmt.Errorf("intel-e2000: failed to meter svi %s on %s: %v", svi.Name, cfg.Meter, err)
+	}
+	log.Printf("intel-e2000: Metered svi %s at cir %d pir %d bytes/s\n", svi.Name, config.Cir, config.Pir)
+	return actions, nil
+}
+
+// releaseSviMeter resets the meter of an svi
+func releaseSviMeter(svi *infradb.Svi) {
+	cfg, _, index, ok := sviMeter(svi)
+	if !ok || cfg.Meter == "" {
+		return
+	}
+	if err := p4client.SetMeter(cfg.Meter, index, nil); err != nil {
+		log.Printf("intel-e2000: failed to reset %s of svi %s: %v\n", cfg.Meter, svi.Name, err)
+	}
+}
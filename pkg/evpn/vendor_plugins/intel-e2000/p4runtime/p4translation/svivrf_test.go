@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb/subscriberframework/eventbus"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// noopHandler accepts the infradb events of the objects the tests create
+type noopHandler struct{}
+
+func (noopHandler) HandleEvent(string, *eventbus.ObjectData) {}
+
+// sviTopology creates a vrf, a logical bridge with a svi and a bridge port in
+// the in memory infradb. The vni and the routing table of the vrf differ so
+// a path using the vni as the vrf id is told apart
+func sviTopology(t *testing.T, name string, ptype infradb.BridgePortType, vport string, table uint32) (*infradb.BridgePort, *infradb.Svi) {
+	t.Helper()
+	fuzzDecoders(t)
+	for _, kind := range []string{"vrf", "logical-bridge", "svi", "bridge-port"} {
+		eventbus.EBus.StartSubscriber("svivrf-test", kind, 1, noopHandler{})
+	}
+	if bp, err := infradb.GetBP("//network.opiproject.org/ports/" + name); err == nil {
+		svi, err := infradb.GetSvi("//network.opiproject.org/svis/" + name)
+		if err != nil {
+			t.Fatalf("svi of the %s topology not found: %v", name, err)
+		}
+		return bp, svi
+	}
+	vni := 5000 + table
+	vrf, err := infradb.NewVrfWithArgs(vrfPrefix+name, &vni, nil, &net.IPNet{IP: net.IPv4(10, 0, 0, 1), Mask: net.CIDRMask(32, 32)})
+	if err != nil {
+		t.Fatalf("failed to build vrf: %v", err)
+	}
+	vrf.Metadata.RoutingTable = []*uint32{&table}
+	lb := &infradb.LogicalBridge{
+		Name:        "//network.opiproject.org/bridges/" + name,
+		Spec:        &infradb.LogicalBridgeSpec{VlanID: 10 + table%100},
+		Status:      &infradb.LogicalBridgeStatus{},
+		BridgePorts: make(map[string]bool),
+		MacTable:    make(map[string]string),
+	}
+	sviMac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, byte(table)}
+	svi := &infradb.Svi{
+		Name:   "//network.opiproject.org/svis/" + name,
+		Spec:   &infradb.SviSpec{Vrf: vrf.Name, LogicalBridge: lb.Name, MacAddress: &sviMac},
+		Status: &infradb.SviStatus{},
+	}
+	bpMac := net.HardwareAddr{0x00, 0x22, 0x00, 0x00, byte(table >> 8), byte(table)}
+	bp := &infradb.BridgePort{
+		Name:     "//network.opiproject.org/ports/" + name,
+		Spec:     &infradb.BridgePortSpec{Ptype: ptype, MacAddress: &bpMac, LogicalBridges: []string{lb.Name}},
+		Status:   &infradb.BridgePortStatus{},
+		Metadata: &infradb.BridgePortMetadata{VPort: vport},
+	}
+	for _, create := range []func() error{
+		func() error { return infradb.CreateVrf(vrf) },
+		func() error { return infradb.CreateLB(lb) },
+		func() error { return infradb.CreateSvi(svi) },
+		func() error { return infradb.CreateBP(bp) },
+	} {
+		if err := create(); err != nil {
+			t.Fatalf("failed to create the %s topology: %v", name, err)
+		}
+	}
+	return bp, svi
+}
+
+// sviEntries returns the svi ingress entries of a table keyed by match
+func sviEntries(t *testing.T, entries []interface{}, table string) map[string]p4client.TableEntry {
+	t.Helper()
+	out := make(map[string]p4client.TableEntry)
+	for _, entry := range entries {
+		if e, ok := entry.(p4client.TableEntry); ok && e.Tablename == table {
+			out[entryKey(e)] = e
+		}
+	}
+	return out
+}
+
+// checkSameSviEntries checks the bridge port and the svi translations program
+// the same svi ingress entries with the routing table as the vrf id
+func checkSameSviEntries(t *testing.T, ptype infradb.BridgePortType, table string, name string, routingTable uint32) {
+	bp, svi := sviTopology(t, name, ptype, fmt.Sprint(routingTable%64+8), routingTable)
+	bpEntries, err := Pod.translateAddedBp(bp)
+	if err != nil {
+		t.Fatalf("bridge port translation failed: %v", err)
+	}
+	sviObj, err := infradb.GetSvi(svi.Name)
+	if err != nil {
+		t.Fatalf("svi not found: %v", err)
+	}
+	sviEntriesOut, err := Pod.translateAddedSvi(sviObj)
+	if err != nil {
+		t.Fatalf("svi translation failed: %v", err)
+	}
+	fromBp := sviEntries(t, bpEntries, table)
+	fromSvi := sviEntries(t, sviEntriesOut, table)
+	if len(fromBp) != 1 || len(fromSvi) != 1 {
+		t.Fatalf("expected one %s entry from each path, got %d from the bridge port and %d from the svi", table, len(fromBp), len(fromSvi))
+	}
+	for key, e := range fromBp {
+		other, ok := fromSvi[key]
+		if !ok {
+			t.Fatalf("svi path has no %s entry matching %s", table, key)
+		}
+		if !reflect.DeepEqual(e.Action, other.Action) {
+			t.Errorf("%s actions differ: bridge port %+v, svi %+v", table, e.Action, other.Action)
+		}
+		params := e.Action.Params
+		if vrfID := params[len(params)-1]; vrfID != uint16(routingTable) {
+			t.Errorf("%s vrf id is %v, expected the routing table %d", table, vrfID, routingTable)
+		}
+	}
+}
+
+func TestSviVrfParamTrunk(t *testing.T) {
+	checkSameSviEntries(t, infradb.Trunk, portInSviTrunk, "trunk", 1001)
+}
+
+func TestSviVrfParamAccess(t *testing.T) {
+	checkSameSviEntries(t, infradb.Access, portInSviAccess, "access", 1002)
+}
+
+func TestSviVrfParamV6(t *testing.T) {
+	checkSameSviEntries(t, infradb.Trunk, portInSviTrunkV6, "trunk", 1001)
+	checkSameSviEntries(t, infradb.Access, portInSviAccessV6, "access", 1002)
+}
+
+func TestSviVrfParamOutOfRange(t *testing.T) {
+	fuzzDecoders(t)
+	table := uint32(0x10000)
+	vrf := &infradb.Vrf{Name: vrfPrefix + "wide", Spec: &infradb.VrfSpec{}, Metadata: &infradb.VrfMetadata{RoutingTable: []*uint32{&table}}}
+	if _, _, err := _sviVrfParams(vrf); err == nil {
+		t.Fatalf("routing table %d accepted as a 16 bits vrf id", table)
+	}
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// tableStatsKey config key of the table statistics section
+const tableStatsKey = "tablestats"
+
+// TableStatsConfig table statistics config structure
+type TableStatsConfig struct {
+	Enabled       bool           `yaml:"enabled"`
+	Interval      int            `yaml:"interval"`
+	HighWatermark float64        `yaml:"highwatermark"`
+	Capacity      map[string]int `yaml:"capacity"`
+}
+
+// TableUsage occupancy of a table on the device
+type TableUsage struct {
+	Name      string    `json:"name"`
+	Entries   int       `json:"entries"`
+	Capacity  int       `json:"capacity"`
+	Occupancy float64   `json:"occupancy"`
+	Updated   time.Time `json:"updated"`
+}
+
+var (
+	// tableStatsCfg table statistics configuration read from the config file
+	tableStatsCfg TableStatsConfig
+
+	// tableLock guards the table capacities and usage
+	tableLock sync.Mutex
+
+	// tableCapacity capacity of the tables from the p4info and the config
+	tableCapacity = make(map[string]int)
+
+	// tableUsage last usage read of the tables
+	tableUsage = make(map[string]TableUsage)
+
+	// tableStatsDone stops the table statistics poller
+	tableStatsDone chan struct{}
+)
+
+// readP4InfoSizes reads the size of the tables from a p4info text file
+func readP4InfoSizes(p4infoPath string) (map[string]int, error) {
+	sizes := make(map[string]int)
+	file, err := os.Open(p4infoPath)
+	if err != nil {
+		return sizes, err
+	}
+	defer file.Close()
+
+	var depth int
+	var name string
+	var size int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if depth == 0 {
+			if line == "tables {" {
+				depth, name, size = 1, "", 0
+			}
+			continue
+		}
+		switch {
+		case strings.HasSuffix(line, "{"):
+			depth++
+		case line == "}":
+			depth--
+			if depth == 0 && name != "" {
+				sizes[name] = size
+			}
+		case name == "" && strings.HasPrefix(line, "name:"):
+			name = strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "name:")), "\"")
+		case depth == 1 && strings.HasPrefix(line, "size:"):
+			size, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "size:")))
+		}
+	}
+	return sizes, scanner.Err()
+}
+
+// loadTableStatsConfig reads the table statistics config and the capacity of
+// the tables, the capacities configured override the p4info sizes
+func loadTableStatsConfig() {
+	cfg := TableStatsConfig{}
+	if err := viper.UnmarshalKey(tableStatsKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read table stats config: %v\n", err)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30
+	}
+	if cfg.HighWatermark <= 0 || cfg.HighWatermark > 1 {
+		cfg.HighWatermark = 0.9
+	}
+	sizes, err := readP4InfoSizes(GlobalConfig().P4.Config.P4infoFile)
+	if err != nil {
+		log.Printf("intel-e2000: Failed to read table sizes from p4info: %v\n", err)
+	}
+	for table, capacity := range cfg.Capacity {
+		sizes[table] = capacity
+	}
+	tableLock.Lock()
+	tableStatsCfg = cfg
+	tableCapacity = sizes
+	tableLock.Unlock()
+}
+
+// pollTableUsage reads the number of entries of the tables from the device
+func pollTableUsage() {
+	tables := make(map[string]bool)
+	tableLock.Lock()
+	for table := range tableCapacity {
+		tables[table] = true
+	}
+	tableLock.Unlock()
+	reconcilerLock.Lock()
+	for table := range managedTables {
+		tables[table] = true
+	}
+	reconcilerLock.Unlock()
+
+	now := time.Now()
+	for table := range tables {
+		entries, err := p4client.GetEntry(table)
+		if err != nil {
+			log.Printf("intel-e2000: Failed to read usage of %s: %v\n", table, err)
+			continue
+		}
+		tableLock.Lock()
+		usage := TableUsage{Name: table, Entries: len(entries), Capacity: tableCapacity[table], Updated: now}
+		if usage.Capacity > 0 {
+			usage.Occupancy = float64(usage.Entries) / float64(usage.Capacity)
+		}
+		previous := tableUsage[table]
+		tableUsage[table] = usage
+		delete(tablePending, table)
+		highWatermark := tableStatsCfg.HighWatermark
+		tableLock.Unlock()
+		if usage.Occupancy >= highWatermark && previous.Occupancy < highWatermark {
+			log.Printf("intel-e2000: Table %s at %.0f%% of its capacity (%d/%d)\n", table, usage.Occupancy*100, usage.Entries, usage.Capacity)
+		}
+	}
+}
+
+// startTableStats starts the periodic read of the table usage
+func startTableStats() {
+	loadTableStatsConfig()
+	if !tableStatsCfg.Enabled {
+		return
+	}
+	tableStatsDone = make(chan struct{})
+	done := tableStatsDone
+	go func() {
+		ticker := time.NewTicker(time.Duration(tableStatsCfg.Interval) * time.Second)
+		defer ticker.Stop()
+		pollTableUsage()
+		for {
+			select {
+			case <-ticker.C:
+				pollTableUsage()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// stopTableStats stops the table usage poller
+func stopTableStats() {
+	if tableStatsDone != nil {
+		close(tableStatsDone)
+		tableStatsDone = nil
+	}
+}
+
+// TableUsages returns the last usage read of the tables
+func TableUsages() []TableUsage {
+	tableLock.Lock()
+	defer tableLock.Unlock()
+	var usages = make([]TableUsage, 0, len(tableUsage))
+	for _, usage := range tableUsage {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Name < usages[j].Name })
+	return usages
+}
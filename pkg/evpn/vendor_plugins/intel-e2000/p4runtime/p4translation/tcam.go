@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// tcamPrefixField ternary field of the tcam tables
+const tcamPrefixField = "user_meta.cmeta.tcam_prefix"
+
+// tcamFullMask mask Buildmfs programs the ternary fields with
+const tcamFullMask = 0xFFFFFFFF
+
+// maxTcamConflicts number of tcam conflicts kept for the admin api
+const maxTcamConflicts = 100
+
+// tcamRow row of a tcam table
+type tcamRow struct {
+	prefix uint32
+	mask   uint32
+}
+
+// TcamConflict tcam row rejected because its precedence is ambiguous
+type TcamConflict struct {
+	Table    string    `json:"table"`
+	Priority int32     `json:"priority"`
+	Prefix   uint32    `json:"prefix"`
+	Existing uint32    `json:"existing"`
+	Reason   string    `json:"reason"`
+	Time     time.Time `json:"time"`
+}
+
+var (
+	// tcamLock guards the tcam rows and conflicts
+	tcamLock sync.Mutex
+
+	// tcamRows tcam rows programmed keyed by table and priority
+	tcamRows = make(map[string]map[int32][]tcamRow)
+
+	// tcamConflicts last tcam conflicts detected
+	tcamConflicts []TcamConflict
+)
+
+// tcamRowOf returns the row of an entry of the tcam tables
+func tcamRowOf(e p4client.TableEntry) (tcamRow, bool) {
+	if e.Tablename != tcamEntries && e.Tablename != tcamEntries2 {
+		return tcamRow{}, false
+	}
+	value, ok := e.TableField.FieldValue[tcamPrefixField]
+	if !ok {
+		return tcamRow{}, false
+	}
+	switch v := value[0].(type) {
+	case uint32:
+		return tcamRow{prefix: v, mask: tcamFullMask}, true
+	case uint64:
+		return tcamRow{prefix: uint32(v), mask: tcamFullMask}, true
+	}
+	return tcamRow{}, false
+}
+
+// overlaps checks if two ternary rows match a common key
+func (r tcamRow) overlaps(o tcamRow) bool {
+	mask := r.mask & o.mask
+	return r.prefix&mask == o.prefix&mask
+}
+
+// claimTcamRow checks a tcam row does not share its priority with an
+// overlapping row, whose precedence would be left to the hardware, and
+// records it, the entries of the other tables are always accepted
+func claimTcamRow(e p4client.TableEntry) error {
+	row, ok := tcamRowOf(e)
+	if !ok {
+		return nil
+	}
+	priority := e.TableField.Priority
+	tcamLock.Lock()
+	defer tcamLock.Unlock()
+	conflict := TcamConflict{Table: e.Tablename, Priority: priority, Prefix: row.prefix, Time: time.Now()}
+	if priority <= 0 {
+		conflict.Reason = "no trie index allocated"
+		return recordTcamConflict(conflict)
+	}
+	for _, existing := range tcamRows[e.Tablename][priority] {
+		if existing == row {
+			return nil
+		}
+		if existing.overlaps(row) {
+			conflict.Existing = existing.prefix
+			conflict.Reason = "overlapping prefix with the same priority"
+			return recordTcamConflict(conflict)
+		}
+	}
+	if tcamRows[e.Tablename] == nil {
+		tcamRows[e.Tablename] = make(map[int32][]tcamRow)
+	}
+	tcamRows[e.Tablename][priority] = append(tcamRows[e.Tablename][priority], row)
+	return nil
+}
+
+// recordTcamConflict keeps the conflict and returns it as error, the caller
+// holds the tcam lock
+func recordTcamConflict(conflict TcamConflict) error {
+	tcamConflicts = append(tcamConflicts, conflict)
+	if len(tcamConflicts) > maxTcamConflicts {
+		tcamConflicts = tcamConflicts[len(tcamConflicts)-maxTcamConflicts:]
+	}
+	return fmt.Errorf("intel-e2000: tcam conflict in %s priority %d prefix %d: %s", conflict.Table, conflict.Priority, conflict.Prefix, conflict.Reason)
+}
+
+// releaseTcamRow forgets a tcam row deleted
+func releaseTcamRow(e p4client.TableEntry) {
+	row, ok := tcamRowOf(e)
+	if !ok {
+		return
+	}
+	priority := e.TableField.Priority
+	tcamLock.Lock()
+	defer tcamLock.Unlock()
+	rows := tcamRows[e.Tablename][priority]
+	for i, existing := range rows {
+		if existing == row {
+			tcamRows[e.Tablename][priority] = append(rows[:i], rows[i+1:]...)
+			break
+		}
+	}
+	if len(tcamRows[e.Tablename][priority]) == 0 {
+		delete(tcamRows[e.Tablename], priority)
+	}
+}
+
+// TcamConflicts returns the last tcam conflicts detected
+func TcamConflicts() []TcamConflict {
+	tcamLock.Lock()
+	defer tcamLock.Unlock()
+	return append([]TcamConflict{}, tcamConflicts...)
+}
@@ -0,0 +1,283 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// tenantsKey config key of the admin tenants section
+const tenantsKey = "admintenants"
+
+// AdminTenant tenant delegated a scoped access to the admin api, its token
+// only sees and touches the vrfs listed and the vrfs of the vnis listed
+type AdminTenant struct {
+	Name  string   `yaml:"name"`
+	Token string   `yaml:"token"`
+	Vrfs  []string `yaml:"vrfs"`
+	Vnis  []uint32 `yaml:"vnis"`
+}
+
+// TenantConfig admin tenants config structure. With an operator token set
+// the requests carrying neither it nor a tenant token are refused, without
+// one they may only read, the admin api fails closed for the changes
+type TenantConfig struct {
+	OperatorToken string        `yaml:"operatortoken"`
+	Tenants       []AdminTenant `yaml:"tenants"`
+}
+
+// TenantScope scope of a tenant request, the vrfs it is restricted to
+type TenantScope struct {
+	Tenant string   `json:"tenant"`
+	Vrfs   []string `json:"vrfs"`
+	vrfs   map[string]bool
+}
+
+// scopeCtxKey context key of the scope of a request
+type scopeCtxKey struct{}
+
+var (
+	// tenantLock guards the tenants config
+	tenantLock sync.Mutex
+
+	// tenantCfg admin tenants config
+	tenantCfg TenantConfig
+)
+
+// loadTenantConfig reads the admin tenants config, the tenants without a
+// token are dropped
+func loadTenantConfig() {
+	cfg := TenantConfig{}
+	if err := viper.UnmarshalKey(tenantsKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read admin tenants config: %v\n", err)
+	}
+	var tenants []AdminTenant
+	for _, t := range cfg.Tenants {
+		if t.Token == "" {
+			log.Printf("intel-e2000: Ignoring admin tenant %q without a token\n", t.Name)
+			continue
+		}
+		tenants = append(tenants, t)
+	}
+	cfg.Tenants = tenants
+	tenantLock.Lock()
+	tenantCfg = cfg
+	tenantLock.Unlock()
+}
+
+// tokenMatches compares the tokens in constant time
+func tokenMatches(token string, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// requestToken returns the bearer token of a request
+func requestToken(r *http.Request) string {
+	return strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+}
+
+// scopeOf builds the scope of a tenant, the vrfs of its vnis are resolved at
+// the time of the request
+func scopeOf(t AdminTenant) *TenantScope {
+	s := &TenantScope{Tenant: t.Name, Vrfs: make([]string, 0), vrfs: make(map[string]bool)}
+	for _, vrf := range t.Vrfs {
+		s.vrfs[path.Base(vrf)] = true
+	}
+	if len(t.Vnis) != 0 {
+		if vrfs, err := infradb.GetAllVrfs(); err == nil {
+			for _, vrf := range vrfs {
+				if vrf.Spec == nil || vrf.Spec.Vni == nil {
+					continue
+				}
+				for _, vni := range t.Vnis {
+					if *vrf.Spec.Vni == vni {
+						s.vrfs[path.Base(vrf.Name)] = true
+					}
+				}
+			}
+		}
+	}
+	for vrf := range s.vrfs {
+		s.Vrfs = append(s.Vrfs, vrf)
+	}
+	return s
+}
+
+// allows checks the vrf is in the scope, a nil scope is the operator one
+func (s *TenantScope) allows(vrf string) bool {
+	return s == nil || s.vrfs[path.Base(vrf)]
+}
+
+// requestScope returns the scope of a request, nil for the operator
+func requestScope(r *http.Request) *TenantScope {
+	s, _ := r.Context().Value(scopeCtxKey{}).(*TenantScope)
+	return s
+}
+
+// readOnly checks the request does not change the state of the device
+func readOnly(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// scopeAdmin authenticates the requests of an admin endpoint and restricts
+// the tenant ones to the endpoints of the tenant scope within their vrfs.
+// Without an operator token the requests without a token only read, the
+// changes need a configured token
+func scopeAdmin(e adminEndpoint) http.Handler {
+	next := e.handler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantLock.Lock()
+		cfg := tenantCfg
+		tenantLock.Unlock()
+		token := requestToken(r)
+		if tokenMatches(token, cfg.OperatorToken) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cfg.OperatorToken == "" && token == "" {
+			if !readOnly(r) {
+				http.Error(w, "no operator token configured, the admin api is read only", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, t := range cfg.Tenants {
+			if !tokenMatches(token, t.Token) {
+				continue
+			}
+			if e.scope != scopeTenant {
+				http.Error(w, "endpoint not available to tenant "+t.Name, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeCtxKey{}, scopeOf(t))))
+			return
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// scopedRoutes returns the injected routes of the vrfs in scope
+func scopedRoutes(s *TenantScope) []StaticRoute {
+	routes := make([]StaticRoute, 0)
+	for _, route := range InjectedRoutes() {
+		if s.allows(route.Vrf) {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// scopedRouteProbes returns the route probes of the vrfs in scope
+func scopedRouteProbes(s *TenantScope) []RouteProbe {
+	probes := make([]RouteProbe, 0)
+	for _, probe := range RouteProbes() {
+		if s.allows(probe.Vrf) {
+			probes = append(probes, probe)
+		}
+	}
+	return probes
+}
+
+// scopedChurn restricts a churn report to the prefixes and nexthops of the
+// vrfs in scope, their keys start with the vrf name
+func scopedChurn(s *TenantScope, report ChurnReport) ChurnReport {
+	if s == nil {
+		return report
+	}
+	filter := func(counts []ChurnCount) []ChurnCount {
+		kept := make([]ChurnCount, 0)
+		for _, c := range counts {
+			if vrf, _, found := strings.Cut(c.Key, " "); found && vrf != "table" && s.allows(vrf) {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}
+	report.Prefixes = filter(report.Prefixes)
+	report.Nexthops = filter(report.Nexthops)
+	report.Events = 0
+	for _, c := range append(report.Prefixes, report.Nexthops...) {
+		report.Events += c.Total
+	}
+	return report
+}
+
+// scopedNexthopMtus returns the nexthop mtus of the vrfs in scope
+func scopedNexthopMtus(s *TenantScope) []NexthopMtu {
+	mtus := make([]NexthopMtu, 0)
+	for _, mtu := range NexthopMtus() {
+		if s.allows(mtu.Vrf) {
+			mtus = append(mtus, mtu)
+		}
+	}
+	return mtus
+}
+
+// scopedNexthopStatuses returns the nexthop states of the vrfs in scope
+func scopedNexthopStatuses(s *TenantScope) []NexthopStatus {
+	statuses := make([]NexthopStatus, 0)
+	for _, status := range NexthopStatuses() {
+		if s.allows(status.Vrf) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// scopedDropRules returns the drop rules of the vrfs in scope, the mac and
+// spi rules are not bound to a vrf and only the operator sees them
+func scopedDropRules(s *TenantScope) []DropRule {
+	rules := make([]DropRule, 0)
+	for _, d := range DropRules() {
+		if s == nil || (d.Kind == dropByPrefix && d.Vrf != "" && s.allows(d.Vrf)) {
+			rules = append(rules, d)
+		}
+	}
+	return rules
+}
+
+// dropRuleInScope checks a tenant may set or remove the drop rule, a prefix
+// rule of a vrf in scope not replacing a rule out of scope, a rule removed
+// is only known by its name
+func dropRuleInScope(s *TenantScope, d DropRule, remove bool) bool {
+	for _, rule := range DropRules() {
+		if rule.Name != d.Name {
+			continue
+		}
+		if rule.Kind != dropByPrefix || rule.Vrf == "" || !s.allows(rule.Vrf) {
+			return false
+		}
+		if remove {
+			return true
+		}
+	}
+	return !remove && strings.EqualFold(d.Kind, dropByPrefix) && d.Vrf != "" && s.allows(d.Vrf)
+}
+
+// FlushTenant reprograms the routes of the vrfs in scope, the entries of the
+// other tenants are left alone, a nil scope reprograms all the routes
+func FlushTenant(s *TenantScope) int {
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+	routes := liveRoutes(func(route nm.RouteStruct) bool {
+		return route.Vrf != nil && s.allows(route.Vrf.Name)
+	})
+	_, failed := moveRoutes(routes, L3, L3)
+	if s != nil {
+		log.Printf("intel-e2000: Flushed %d routes of tenant %s, %d failed\n", len(routes), s.Tenant, failed)
+	}
+	return len(routes)
+}
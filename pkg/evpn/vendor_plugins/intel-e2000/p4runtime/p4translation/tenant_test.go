@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestScopeAdmin checks the tenants only reach the endpoints of the tenant
+// scope and the requests without a token only read
+func TestScopeAdmin(t *testing.T) {
+	tenantLock.Lock()
+	old := tenantCfg
+	tenantCfg = TenantConfig{OperatorToken: "op", Tenants: []AdminTenant{{Name: "blue", Token: "blue", Vrfs: []string{"blue"}}}}
+	tenantLock.Unlock()
+	t.Cleanup(func() {
+		tenantLock.Lock()
+		tenantCfg = old
+		tenantLock.Unlock()
+	})
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		if s := requestScope(r); s != nil && !s.allows("blue") {
+			t.Errorf("scope of tenant %s misses its vrf", s.Tenant)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	for _, tc := range []struct {
+		scope adminScope
+		token string
+		code  int
+	}{
+		{scopeOperator, "op", http.StatusOK},
+		{scopeOperator, "blue", http.StatusForbidden},
+		{scopeTenant, "blue", http.StatusOK},
+		{scopeTenant, "red", http.StatusUnauthorized},
+		{scopeTenant, "", http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest(http.MethodGet, AdminPrefix+"test", nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		scopeAdmin(adminEndpoint{path: "test", scope: tc.scope, handler: ok}).ServeHTTP(w, r)
+		if w.Code != tc.code {
+			t.Errorf("scope %d with token %q: got %d, want %d", tc.scope, tc.token, w.Code, tc.code)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// trieGcKey config key of the trie index garbage collection section
+const trieGcKey = "triegc"
+
+// lpmRootField field of the lpm entries referencing their trie index
+const lpmRootField = "ipv4_table_lpm_root1"
+
+// lpmRootFieldV6 field of the ipv6 lpm entries referencing their trie index
+const lpmRootFieldV6 = "ipv6_table_lpm_root1"
+
+// lpmRootOf returns the trie index a vrf lpm entry of either family is under
+func lpmRootOf(e p4client.TableEntry) (uint32, bool) {
+	switch e.Tablename {
+	case l3Rt:
+		return fieldID(e, lpmRootField)
+	case l3RtV6:
+		return fieldID(e, lpmRootFieldV6)
+	}
+	return 0, false
+}
+
+// TrieGcConfig trie index garbage collection config structure
+type TrieGcConfig struct {
+	Interval int `yaml:"interval"`
+}
+
+// TrieGcStats trie index garbage collection statistics
+type TrieGcStats struct {
+	Roots     int       `json:"roots"`
+	Runs      uint64    `json:"runs"`
+	Reclaimed uint64    `json:"reclaimed"`
+	LastRun   time.Time `json:"lastrun"`
+}
+
+var (
+	// trieLock guards the trie index references and statistics
+	trieLock sync.Mutex
+
+	// trieRefs prefixes referencing the trie index of a tcam prefix
+	trieRefs = make(map[uint64]map[netip.Prefix]bool)
+
+	// lpmRefs lpm entries programmed per trie index
+	lpmRefs = make(map[uint32]int)
+
+	// trieGcStats trie index garbage collection statistics
+	trieGcStats TrieGcStats
+
+	// trieGcDone stops the periodic garbage collection
+	trieGcDone chan struct{}
+)
+
+// noteTrieRef records a prefix taking or releasing the trie index of a tcam prefix
+func noteTrieRef(tcam uint64, ref netip.Prefix, taken bool) {
+	trieLock.Lock()
+	defer trieLock.Unlock()
+	if taken {
+		if trieRefs[tcam] == nil {
+			trieRefs[tcam] = make(map[netip.Prefix]bool)
+		}
+		trieRefs[tcam][ref] = true
+		return
+	}
+	delete(trieRefs[tcam], ref)
+	if len(trieRefs[tcam]) == 0 {
+		delete(trieRefs, tcam)
+	}
+}
+
+// trieRef returns the reference a route prefix holds on a trie index, the
+// masked prefix so the add and the delete match whatever object carries it
+func trieRef(prefix *net.IPNet) netip.Prefix {
+	if prefix == nil {
+		return netip.Prefix{}
+	}
+	addr, ok := netip.AddrFromSlice(prefix.IP)
+	if !ok {
+		return netip.Prefix{}
+	}
+	ones, bits := prefix.Mask.Size()
+	if addr.Is4In6() && bits == 128 {
+		ones -= 96
+	}
+	return netip.PrefixFrom(addr.Unmap(), ones).Masked()
+}
+
+// noteLpmEntry counts the lpm entries programmed or removed per trie index
+func noteLpmEntry(e p4client.TableEntry, delta int) {
+	tidx, ok := lpmRootOf(e)
+	if !ok {
+		return
+	}
+	trieLock.Lock()
+	defer trieLock.Unlock()
+	lpmRefs[tidx] += delta
+	if lpmRefs[tidx] <= 0 {
+		delete(lpmRefs, tidx)
+	}
+}
+
+// collectTrieIndexes reclaims the trie indexes whose tcam root is programmed
+// with no lpm entry referencing it anymore, e.g. after a failed delete, the
+// root is removed and the index returned to the pool
+func collectTrieIndexes() int {
+	if p4client.IsStandby() {
+		return 0
+	}
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+
+	type root struct {
+		priority int32
+		row      tcamRow
+	}
+	var leaked []root
+	var roots int
+	tcamLock.Lock()
+	trieLock.Lock()
+	for priority, rows := range tcamRows[tcamEntries] {
+		for _, row := range rows {
+			roots++
+			if lpmRefs[uint32(priority)] == 0 {
+				leaked = append(leaked, root{priority: priority, row: row})
+			}
+		}
+	}
+	trieLock.Unlock()
+	tcamLock.Unlock()
+
+	var reclaimed int
+	for _, r := range leaked {
+		entry := p4client.TableEntry{
+			Tablename: tcamEntries,
+			TableField: p4client.TableField{
+				FieldValue: map[string][2]interface{}{
+					tcamPrefixField: {r.row.prefix, "ternary"},
+				},
+				Priority: r.priority,
+			},
+		}
+		if err := p4client.DelEntry(entry); err != nil {
+			log.Printf("intel-e2000: Failed to remove leaked tcam root %d priority %d: %v\n", r.row.prefix, r.priority, err)
+			continue
+		}
+		releaseTcamRow(entry)
+		tcam := uint64(r.row.prefix)
+		trieLock.Lock()
+		refs := trieRefs[tcam]
+		delete(trieRefs, tcam)
+		trieLock.Unlock()
+		for ref := range refs {
+			trieIndexPool.ReleaseIDWithRef(tcam, ref)
+		}
+		log.Printf("intel-e2000: Reclaimed trie index %d of tcam prefix %d (%d stale references)\n", r.priority, r.row.prefix, len(refs))
+		reclaimed++
+	}
+
+	trieLock.Lock()
+	trieGcStats.Roots = roots - reclaimed
+	trieGcStats.Runs++
+	trieGcStats.Reclaimed += uint64(reclaimed)
+	trieGcStats.LastRun = time.Now()
+	trieLock.Unlock()
+	return reclaimed
+}
+
+// startTrieGc starts the periodic trie index garbage collection
+func startTrieGc() {
+	cfg := TrieGcConfig{}
+	if err := viper.UnmarshalKey(trieGcKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read trie gc config: %v\n", err)
+		return
+	}
+	if cfg.Interval <= 0 {
+		return
+	}
+	trieGcDone = make(chan struct{})
+	done := trieGcDone
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				collectTrieIndexes()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// stopTrieGc stops the periodic trie index garbage collection
+func stopTrieGc() {
+	if trieGcDone != nil {
+		close(trieGcDone)
+		trieGcDone = nil
+	}
+}
+
+// CompactTrieIndexes runs a trie index garbage collection on demand
+func CompactTrieIndexes() TrieGcStats {
+	collectTrieIndexes()
+	return GetTrieGcStats()
+}
+
+// GetTrieGcStats returns the trie index garbage collection statistics
+func GetTrieGcStats() TrieGcStats {
+	trieLock.Lock()
+	defer trieLock.Unlock()
+	return trieGcStats
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"path"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/spf13/viper"
+)
+
+// underlayVrfsKey config key of the underlay vrfs
+const underlayVrfsKey = "underlayvrfs"
+
+// UnderlayVrf underlay vrf config structure. A default vrf carries the
+// underlay routes and is not offloaded as an evpn vrf, a p2p vrf programs the
+// routes of its physical nexthops in the p2p tables for the vxlan traffic
+type UnderlayVrf struct {
+	Name    string `yaml:"name" json:"name"`
+	Default bool   `yaml:"default" json:"default"`
+	P2P     bool   `yaml:"p2p" json:"p2p"`
+}
+
+// defaultUnderlayVrfs underlay vrfs used when the config has none
+var defaultUnderlayVrfs = []UnderlayVrf{{Name: grdStr, Default: true, P2P: true}}
+
+var (
+	// underlayLock guards the underlay vrfs
+	underlayLock sync.RWMutex
+
+	// underlayVrfs underlay vrfs keyed by vrf name
+	underlayVrfs = underlayVrfMap(defaultUnderlayVrfs)
+
+	// defaultVrfName name of the vrf of the default network instance
+	defaultVrfName = grdStr
+)
+
+// underlayVrfMap returns the underlay vrfs keyed by name
+func underlayVrfMap(vrfs []UnderlayVrf) map[string]UnderlayVrf {
+	m := make(map[string]UnderlayVrf, len(vrfs))
+	for _, v := range vrfs {
+		m[path.Base(v.Name)] = v
+	}
+	return m
+}
+
+// loadUnderlayVrfs reads the underlay vrfs, the grd is the default and p2p
+// vrf unless the config lists the underlay vrfs
+func loadUnderlayVrfs() {
+	var cfg []UnderlayVrf
+	if err := viper.UnmarshalKey(underlayVrfsKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read underlay vrfs config: %v\n", err)
+		cfg = nil
+	}
+	vrfs := make([]UnderlayVrf, 0, len(cfg))
+	for _, v := range cfg {
+		if v.Name == "" {
+			log.Printf("intel-e2000: Ignoring underlay vrf without name %+v\n", v)
+			continue
+		}
+		vrfs = append(vrfs, v)
+	}
+	if len(vrfs) == 0 {
+		vrfs = defaultUnderlayVrfs
+	}
+	name := ""
+	for _, v := range vrfs {
+		if v.Default {
+			name = path.Base(v.Name)
+			break
+		}
+	}
+	if name == "" {
+		name = grdStr
+	}
+	underlayLock.Lock()
+	underlayVrfs = underlayVrfMap(vrfs)
+	defaultVrfName = name
+	underlayLock.Unlock()
+	log.Printf("intel-e2000: Underlay vrfs %+v\n", vrfs)
+}
+
+// _underlayVrf returns the underlay config of the vrf named name
+func _underlayVrf(name string) (UnderlayVrf, bool) {
+	underlayLock.RLock()
+	defer underlayLock.RUnlock()
+	v, ok := underlayVrfs[path.Base(name)]
+	return v, ok
+}
+
+// _isDefaultVrf checks the vrf is a default underlay vrf
+func _isDefaultVrf(vrf *infradb.Vrf) bool {
+	if vrf == nil {
+		return false
+	}
+	v, ok := _underlayVrf(vrf.Name)
+	return ok && v.Default
+}
+
+// _isP2PVrf checks the routes of the vrf are programmed in the p2p tables
+func _isP2PVrf(vrf *infradb.Vrf) bool {
+	if vrf == nil {
+		return false
+	}
+	v, ok := _underlayVrf(vrf.Name)
+	return ok && v.P2P
+}
+
+// _isDefaultVrfName checks the vrf named name is a default underlay vrf
+func _isDefaultVrfName(name string) bool {
+	v, ok := _underlayVrf(name)
+	return ok && v.Default
+}
+
+// _defaultVrfName returns the name of the vrf of the default network instance
+func _defaultVrfName() string {
+	underlayLock.RLock()
+	defer underlayLock.RUnlock()
+	return defaultVrfName
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+)
+
+// EntryDelta entries to be written to move an object from the entries
+// programmed to its new translation. Modify holds the entries whose match is
+// kept and whose action changed, Entries the whole new translation
+type EntryDelta struct {
+	Add     []interface{}
+	Modify  []interface{}
+	Delete  []interface{}
+	Entries []interface{}
+}
+
+var (
+	// objectEntriesLock guards the entries programmed per object
+	objectEntriesLock sync.Mutex
+
+	// objectEntries entries programmed keyed by infradb object name
+	objectEntries = make(map[string][]interface{})
+)
+
+// recordObjectEntries records the entries programmed for an object
+func recordObjectEntries(name string, entries []interface{}) {
+	objectEntriesLock.Lock()
+	defer objectEntriesLock.Unlock()
+	objectEntries[name] = entries
+}
+
+// programmedEntries returns the entries programmed for an object, nil when
+// the object was never programmed
+func programmedEntries(name string) []interface{} {
+	objectEntriesLock.Lock()
+	defer objectEntriesLock.Unlock()
+	return objectEntries[name]
+}
+
+// forgetObjectEntries drops the entries of a deleted object
+func forgetObjectEntries(name string) {
+	objectEntriesLock.Lock()
+	defer objectEntriesLock.Unlock()
+	delete(objectEntries, name)
+}
+
+// entryDelta compares the entries programmed with the new translation of an
+// object and returns the minimal set of writes between them
+func entryDelta(programmed []interface{}, translated []interface{}) EntryDelta {
+	delta := EntryDelta{Entries: translated}
+	oldSet := make(map[string]p4client.TableEntry)
+	for _, entry := range programmed {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			oldSet[entryKey(e)] = e
+		}
+	}
+	newSet := make(map[string]bool)
+	for _, entry := range translated {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			delta.Add = append(delta.Add, entry)
+			continue
+		}
+		key := entryKey(e)
+		if newSet[key] {
+			continue
+		}
+		newSet[key] = true
+		old, found := oldSet[key]
+		switch {
+		case !found:
+			delta.Add = append(delta.Add, e)
+		case !reflect.DeepEqual(old.Action, e.Action):
+			delta.Modify = append(delta.Modify, e)
+		}
+	}
+	for _, entry := range programmed {
+		if e, ok := entry.(p4client.TableEntry); ok && !newSet[entryKey(e)] {
+			delta.Delete = append(delta.Delete, e)
+		}
+	}
+	return delta
+}
+
+// translateUpdatedVrf translates the updated vrf into the writes from the
+// entries programmed
+func (v VxlanDecoder) translateUpdatedVrf(vrf *infradb.Vrf, programmed []interface{}) EntryDelta {
+	return entryDelta(programmed, v.translateAddedVrf(vrf))
+}
+
+// translateUpdatedLb translates the updated lb into the writes from the
+// entries programmed
+func (v VxlanDecoder) translateUpdatedLb(lb *infradb.LogicalBridge, programmed []interface{}) EntryDelta {
+	return entryDelta(programmed, v.translateAddedLb(lb))
+}
+
+// translateUpdatedBp translates the updated bp into the writes from the
+// entries programmed
+func (p PodDecoder) translateUpdatedBp(bp *infradb.BridgePort, programmed []interface{}) (EntryDelta, error) {
+	entries, err := p.translateAddedBp(bp)
+	if err != nil {
+		return EntryDelta{}, err
+	}
+	return entryDelta(programmed, entries), nil
+}
+
+// translateUpdatedSvi translates the updated svi into the writes from the
+// entries programmed
+func (p PodDecoder) translateUpdatedSvi(svi *infradb.Svi, programmed []interface{}) (EntryDelta, error) {
+	entries, err := p.translateAddedSvi(svi)
+	if err != nil {
+		return EntryDelta{}, err
+	}
+	return entryDelta(programmed, entries), nil
+}
+
+// programDelta writes the delta of an object, deletions first so that the
+// entries replaced free their room. It returns the count of the writes
+// failed, the entries left programmed and the first failure
+func programDelta(programmed []interface{}, delta EntryDelta) (int, []interface{}, error) {
+	var failed int
+	var first error
+	fail := func(err error) {
+		failed++
+		if first == nil {
+			first = err
+		}
+	}
+	// The entries whose delete or modify failed stay programmed as they were
+	var result []interface{}
+	for _, entry := range delta.Delete {
+		e := entry.(p4client.TableEntry)
+		if err := writeError(e.Tablename, p4client.DelEntry(e)); err != nil {
+			log.Printf("intel-e2000: error deleting entry for %v error %v\n", e.Tablename, err)
+			result = append(result, e)
+			fail(err)
+		}
+	}
+	stale := make(map[string]p4client.TableEntry)
+	for _, entry := range programmed {
+		if e, ok := entry.(p4client.TableEntry); ok {
+			stale[entryKey(e)] = e
+		}
+	}
+	skip := make(map[string]bool)
+	for _, entry := range delta.Modify {
+		e := entry.(p4client.TableEntry)
+		if err := writeError(e.Tablename, p4client.ModEntry(e)); err != nil {
+			log.Printf("intel-e2000: error modifying entry for %v error %v\n", e.Tablename, err)
+			result = append(result, stale[entryKey(e)])
+			skip[entryKey(e)] = true
+			fail(err)
+		}
+	}
+	for _, entry := range delta.Add {
+		e, ok := entry.(p4client.TableEntry)
+		if !ok {
+			log.Println("intel-e2000: Entry is not of type p4client.TableEntry:-", entry)
+			fail(nil)
+			continue
+		}
+		if err := writeError(e.Tablename, p4client.AddEntry(e)); err != nil {
+			log.Printf("intel-e2000: error adding entry for %v error %v\n", e.Tablename, err)
+			skip[entryKey(e)] = true
+			fail(err)
+		}
+	}
+	for _, entry := range delta.Entries {
+		if e, ok := entry.(p4client.TableEntry); ok && !skip[entryKey(e)] {
+			result = append(result, e)
+		}
+	}
+	return failed, result, first
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/viper"
+)
+
+// uplinksKey config key of the named uplink profiles
+const uplinksKey = "interfaces.uplinks"
+
+// UplinkRole structure of the uplink roles
+var UplinkRole = struct {
+	Underlay, Ipsec, Management string
+}{
+	Underlay:   "underlay",
+	Ipsec:      "ipsec",
+	Management: "management",
+}
+
+// UplinkConfig uplink profile config structure
+type UplinkConfig struct {
+	Name    string `yaml:"name"`
+	Rep     string `yaml:"rep"`
+	Port    int    `yaml:"port"`
+	Role    string `yaml:"role"`
+	Speed   int    `yaml:"speed"`
+	Fec     string `yaml:"fec"`
+	Autoneg string `yaml:"autoneg"`
+	Ptp     bool   `yaml:"ptp"`
+}
+
+// uplinks uplink profiles in use
+var uplinks []UplinkConfig
+
+// uplinkKey returns the representors map key of an uplink
+func uplinkKey(name string) string {
+	return name + "_rep"
+}
+
+// loadUplinks reads the uplink profiles from config, the legacy phyports
+// list is mapped to underlay uplinks named phy0..phyN
+func loadUplinks() []UplinkConfig {
+	var profiles []UplinkConfig
+	if err := viper.UnmarshalKey(uplinksKey, &profiles); err != nil {
+		log.Printf("intel-e2000: Failed to read uplink profiles: %v\n", err)
+	}
+	if len(profiles) != 0 {
+		for i := range profiles {
+			if profiles[i].Role == "" {
+				profiles[i].Role = UplinkRole.Underlay
+			}
+		}
+		return profiles
+	}
+	for i, port := range GlobalConfig().Interfaces.PhyPorts {
+		profiles = append(profiles, UplinkConfig{
+			Name: fmt.Sprintf("phy%d", i),
+			Rep:  port.Rep,
+			Port: i,
+			Role: UplinkRole.Underlay,
+		})
+	}
+	return profiles
+}
+
+// uplinksOfRole returns the uplinks having the given role
+func uplinksOfRole(role string) []UplinkConfig {
+	var profiles []UplinkConfig
+	for _, uplink := range uplinks {
+		if uplink.Role == role {
+			profiles = append(profiles, uplink)
+		}
+	}
+	return profiles
+}
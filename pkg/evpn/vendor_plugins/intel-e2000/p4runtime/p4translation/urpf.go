@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// urpfKey config key of the reverse path forwarding section, the same one
+// the linux vendor module applies to the rp_filter of the slow path
+const urpfKey = "urpf"
+
+const (
+	// urpfV4  evpn p4 table name
+	urpfV4 = "evpn_gw_control.vrf_urpf_table" // VRFs ipv4 reverse path check
+	//                            TableKeys (
+	//                                vrf,                   // Exact
+	//                                direction,             // Exact
+	//                            )
+	//                            Actions (
+	//                                set_urpf_mode(mode),
+	//                            )
+
+	// urpfV6  evpn p4 table name
+	urpfV6 = "evpn_gw_control.vrf_urpf_v6_table" // VRFs ipv6 reverse path check
+	//                            TableKeys (
+	//                                vrf,                   // Exact
+	//                                direction,             // Exact
+	//                            )
+	//                            Actions (
+	//                                set_urpf_mode(mode),
+	//                            )
+)
+
+// urpf modes of the set_urpf_mode action, the pipeline looks the source
+// address up in the routing tables of the vrf of the family, loose drops the
+// packets without a route and strict the ones whose route leaves through
+// another port than the one they came in
+const (
+	urpfOff    = 0
+	urpfStrict = 1
+	urpfLoose  = 2
+)
+
+// UrpfConfig reverse path forwarding config structure, the mode is off,
+// loose or strict per vrf name
+type UrpfConfig struct {
+	Vrfs map[string]string `yaml:"vrfs"`
+}
+
+var (
+	// urpfLock guards the urpf modes
+	urpfLock sync.Mutex
+
+	// urpfModes urpf mode keyed by vrf name, the vrfs off are left out
+	urpfModes = make(map[string]int)
+)
+
+// loadUrpfConfig reads the reverse path forwarding config, the unknown
+// modes are dropped
+func loadUrpfConfig() {
+	var cfg UrpfConfig
+	if err := viper.UnmarshalKey(urpfKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read urpf config: %v\n", err)
+	}
+	modes := make(map[string]int, len(cfg.Vrfs))
+	for vrf, name := range cfg.Vrfs {
+		mode, err := urpfModeOf(name)
+		if err != nil {
+			log.Printf("intel-e2000: Ignoring urpf config of vrf %s: %v\n", vrf, err)
+			continue
+		}
+		if mode != urpfOff {
+			modes[strings.ToLower(path.Base(vrf))] = mode
+		}
+	}
+	urpfLock.Lock()
+	urpfModes = modes
+	urpfLock.Unlock()
+}
+
+// urpfModeOf converts the configured mode to the one of the pipeline
+func urpfModeOf(mode string) (int, error) {
+	switch strings.ToLower(mode) {
+	case "", "off":
+		return urpfOff, nil
+	case "strict":
+		return urpfStrict, nil
+	case "loose":
+		return urpfLoose, nil
+	default:
+		return urpfOff, fmt.Errorf("unknown urpf mode %q", mode)
+	}
+}
+
+// urpfMode returns the urpf mode of a vrf
+func urpfMode(vrf *infradb.Vrf) int {
+	urpfLock.Lock()
+	defer urpfLock.Unlock()
+	return urpfModes[strings.ToLower(path.Base(vrf.Name))]
+}
+
+// _urpfDirectionMode returns the mode checked in a direction. The traffic
+// of the network side comes in through the vxlan tunnel whose replies do not
+// go back through it, so strict only holds for the traffic of the hosts and
+// the network side is checked loosely as the mux representor of the slow path
+func _urpfDirectionMode(mode int, direction int) int {
+	if mode == urpfStrict && direction == Direction.Rx {
+		return urpfLoose
+	}
+	return mode
+}
+
+// _vrfUrpfEntries translates the urpf mode of a vrf into the entries of both
+// families and both directions, a vrf off gets none. The delete entries only
+// carry the match
+func _vrfUrpfEntries(vrf *infradb.Vrf, del bool) []interface{} {
+	var entries = make([]interface{}, 0)
+	mode := urpfMode(vrf)
+	if mode == urpfOff {
+		return entries
+	}
+	vrfTable, err := _vrfTable(vrf)
+	if err != nil {
+		log.Printf("intel-e2000: urpf of vrf %s not programmed: %v\n", vrf.Name, err)
+		return entries
+	}
+	for _, table := range []string{urpfV4, urpfV6} {
+		for _, direction := range []int{Direction.Rx, Direction.Tx} {
+			e := p4client.TableEntry{
+				Tablename: table,
+				TableField: p4client.TableField{
+					FieldValue: map[string][2]interface{}{
+						"vrf":       {bigEndian16(vrfTable), "exact"},
+						"direction": {uint16(direction), "exact"},
+					},
+					Priority: int32(0),
+				},
+			}
+			if !del {
+				e.Action = p4client.Action{
+					ActionName: "evpn_gw_control.set_urpf_mode",
+					Params:     []interface{}{uint32(_urpfDirectionMode(mode, direction))},
+				}
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// reapplyUrpf reprograms the vrfs offloaded after the urpf modes changed,
+// only the delta of their entries is written. The caller holds the decoder
+// lock
+func reapplyUrpf() {
+	vrfs, err := infradb.GetAllVrfs()
+	if err != nil {
+		return
+	}
+	for _, vrf := range vrfs {
+		if _isDefaultVrf(vrf) || vrf.Status == nil || !offloaded(vrf.Status.Components) {
+			continue
+		}
+		programmed := programmedEntries(vrf.Name)
+		delta := Vxlan.translateUpdatedVrf(vrf, programmed)
+		if len(delta.Add)+len(delta.Modify)+len(delta.Delete) == 0 {
+			continue
+		}
+		failed, entries, err := programDelta(programmed, delta)
+		recordObjectEntries(vrf.Name, entries)
+		if failed > 0 {
+			log.Printf("intel-e2000: urpf of vrf %s not reapplied, %d writes failed: %v\n", vrf.Name, failed, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+
+// Package p4translation translates the evpn objects into p4 entries
+package p4translation
+
+import (
+	"testing"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	p4client "github.com/opiproject/opi-intel-bridge/pkg/evpn/vendor_plugins/intel-e2000/p4runtime/p4driverapi"
+	"github.com/spf13/viper"
+)
+
+// TestVrfUrpfEntries checks a strict vrf gets the check of both families,
+// loose on the network side, and a vrf off gets none
+func TestVrfUrpfEntries(t *testing.T) {
+	viper.Set(urpfKey, map[string]interface{}{"vrfs": map[string]string{"red": "strict", "blue": "bogus"}})
+	loadUrpfConfig()
+	defer func() {
+		viper.Set(urpfKey, nil)
+		loadUrpfConfig()
+	}()
+
+	table := uint32(1700)
+	vrf := &infradb.Vrf{Name: vrfPrefix + "red", Metadata: &infradb.VrfMetadata{RoutingTable: []*uint32{&table}}}
+	modes := make(map[string]uint32)
+	for _, entry := range _vrfUrpfEntries(vrf, false) {
+		e := entry.(p4client.TableEntry)
+		if vrfID := e.TableField.FieldValue["vrf"][0]; vrfID != bigEndian16(table) {
+			t.Errorf("%s: vrf %v, want the routing table %d", e.Tablename, vrfID, table)
+		}
+		direction := e.TableField.FieldValue["direction"][0].(uint16)
+		modes[e.Tablename+"/"+map[uint16]string{0: "rx", 1: "tx"}[direction]] = e.Action.Params[0].(uint32)
+	}
+	want := map[string]uint32{
+		urpfV4 + "/rx": urpfLoose, urpfV4 + "/tx": urpfStrict,
+		urpfV6 + "/rx": urpfLoose, urpfV6 + "/tx": urpfStrict,
+	}
+	if len(modes) != len(want) {
+		t.Fatalf("urpf entries: got %v, want %v", modes, want)
+	}
+	for key, mode := range want {
+		if modes[key] != mode {
+			t.Errorf("%s: mode %d, want %d", key, modes[key], mode)
+		}
+	}
+	if got := len(_vrfUrpfEntries(vrf, true)); got != len(want) {
+		t.Errorf("urpf delete entries: got %d, want %d", got, len(want))
+	}
+
+	vrf.Name = vrfPrefix + "blue"
+	if got := _vrfUrpfEntries(vrf, false); len(got) != 0 {
+		t.Errorf("vrf with an unknown mode: got %v, want no entries", got)
+	}
+}
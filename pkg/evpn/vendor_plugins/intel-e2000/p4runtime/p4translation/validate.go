@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// requiredRepresentors representors the decoders can not work without
+var requiredRepresentors = []string{"vrf_mux", "port_mux", "grpc_acc", "grpc_host"}
+
+// vsiMaxRange highest vsi which still fits the egress vsi after the offset
+var vsiMaxRange = uint64(math.MaxUint16 - 16)
+
+// validateRepresentors checks the representors map and the plugin config and
+// reports every problem found in one error
+func validateRepresentors(representors map[string][2]string) error {
+	var problems []string
+
+	for _, key := range requiredRepresentors {
+		if _, ok := representors[key]; !ok {
+			problems = append(problems, fmt.Sprintf("representor %s is missing, check the interfaces section of the config file", key))
+		}
+	}
+	var underlayFound bool
+	names := make(map[string]bool)
+	ports := make(map[int]bool)
+	for _, uplink := range uplinks {
+		switch uplink.Role {
+		case UplinkRole.Underlay, UplinkRole.Ipsec, UplinkRole.Management:
+		default:
+			problems = append(problems, fmt.Sprintf("uplink %s has an unknown role %q, use underlay, ipsec or management", uplink.Name, uplink.Role))
+		}
+		if names[uplink.Name] {
+			problems = append(problems, fmt.Sprintf("uplink name %s is used more than once", uplink.Name))
+		}
+		names[uplink.Name] = true
+		if ports[uplink.Port] {
+			problems = append(problems, fmt.Sprintf("uplink %s port %d is used by another uplink", uplink.Name, uplink.Port))
+		}
+		ports[uplink.Port] = true
+		if uplink.Port < PortID.PHY0 || uplink.Port > PortID.PHY3 {
+			problems = append(problems, fmt.Sprintf("uplink %s port %d is out of range %d-%d", uplink.Name, uplink.Port, PortID.PHY0, PortID.PHY3))
+		}
+		switch uplink.Autoneg {
+		case "", "on", "off":
+		default:
+			problems = append(problems, fmt.Sprintf("uplink %s autoneg %q must be on or off", uplink.Name, uplink.Autoneg))
+		}
+		if uplink.Speed < 0 {
+			problems = append(problems, fmt.Sprintf("uplink %s speed %d must be a positive number of Mb/s", uplink.Name, uplink.Speed))
+		}
+		if _, ok := representors[uplinkKey(uplink.Name)]; !ok {
+			problems = append(problems, fmt.Sprintf("uplink %s representor %s not found", uplink.Name, uplink.Rep))
+		} else if uplink.Role == UplinkRole.Underlay {
+			underlayFound = true
+		}
+	}
+	if !underlayFound {
+		problems = append(problems, "no underlay uplink found, configure interfaces.uplinks or interfaces.phyports or enable interfaces.discovery")
+	}
+	for key, ids := range representors {
+		vsi, err := strconv.ParseUint(ids[0], 10, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("representor %s has an invalid vsi %q", key, ids[0]))
+		} else if vsi > vsiMaxRange {
+			problems = append(problems, fmt.Sprintf("representor %s vsi %d is out of range 0-%d", key, vsi, vsiMaxRange))
+		}
+		if !isValidMAC(ids[1]) {
+			problems = append(problems, fmt.Sprintf("representor %s has an invalid mac %q", key, ids[1]))
+		}
+	}
+	problems = append(problems, roleConflicts(configuredRoles(), representors)...)
+	problems = append(problems, readDefaultVsis().problems()...)
+	for _, addr := range viper.GetStringSlice("grpc.server_addresses") {
+		if net.ParseIP(addr) == nil {
+			problems = append(problems, fmt.Sprintf("grpc server address %q is not a valid ip address", addr))
+		}
+	}
+	if _, _, err := net.SplitHostPort(defaultAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("p4runtime address %q is not in ip_address:port format", defaultAddr))
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("intel-e2000: invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
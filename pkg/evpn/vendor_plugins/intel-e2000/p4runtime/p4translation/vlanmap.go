@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"log"
+	"path"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+	"github.com/spf13/viper"
+)
+
+// vlanMapsKey config key of the vlan translations of the trunk bridge ports
+const vlanMapsKey = "vlanmaps"
+
+// VlanMapping translation between the vlan a tenant uses on a trunk bridge
+// port and the vlan of the logical bridge
+type VlanMapping struct {
+	Customer uint32 `yaml:"customer"`
+	Bridge   uint32 `yaml:"bridge"`
+}
+
+var (
+	// vlanMapLock guards the vlan translations programmed
+	vlanMapLock sync.Mutex
+
+	// programmedVlanMaps customer vlans keyed by bridge vlan the trunk bridge
+	// ports were programmed with
+	programmedVlanMaps = make(map[string]map[uint32]uint32)
+)
+
+// configuredVlanMap returns the customer vlans keyed by bridge vlan of a
+// trunk bridge port, a mapping reusing a vlan of another one is ignored
+func configuredVlanMap(bp *infradb.BridgePort) map[uint32]uint32 {
+	var cfg map[string][]VlanMapping
+	if err := viper.UnmarshalKey(vlanMapsKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read vlan maps: %v\n", err)
+		return nil
+	}
+	mappings, ok := cfg[path.Base(bp.Name)]
+	if !ok {
+		return nil
+	}
+	vlanMap := make(map[uint32]uint32)
+	customers := make(map[uint32]bool)
+	for _, m := range mappings {
+		if m.Customer == 0 || m.Customer > 4094 || m.Bridge == 0 {
+			log.Printf("intel-e2000: Ignoring invalid vlan mapping %+v of bridge port %s\n", m, bp.Name)
+			continue
+		}
+		if _, found := vlanMap[m.Bridge]; found || customers[m.Customer] {
+			log.Printf("intel-e2000: Ignoring overlapping vlan mapping %+v of bridge port %s\n", m, bp.Name)
+			continue
+		}
+		vlanMap[m.Bridge] = m.Customer
+		customers[m.Customer] = true
+	}
+	for _, name := range bp.Spec.LogicalBridges {
+		lb, err := infradb.GetLB(name)
+		if err != nil {
+			continue
+		}
+		if _, mapped := vlanMap[lb.Spec.VlanID]; !mapped && customers[lb.Spec.VlanID] {
+			log.Printf("intel-e2000: Ignoring the vlan maps of bridge port %s, vlan %d is both a customer and an untranslated vlan\n", bp.Name, lb.Spec.VlanID)
+			return nil
+		}
+	}
+	return vlanMap
+}
+
+// recordVlanMap returns the vlan translations of a trunk bridge port being
+// added and records them
+func recordVlanMap(bp *infradb.BridgePort) map[uint32]uint32 {
+	vlanMap := configuredVlanMap(bp)
+	vlanMapLock.Lock()
+	programmedVlanMaps[bp.Name] = vlanMap
+	vlanMapLock.Unlock()
+	return vlanMap
+}
+
+// releaseVlanMap returns the vlan translations of a trunk bridge port being
+// deleted and forgets them
+func releaseVlanMap(bp *infradb.BridgePort) map[uint32]uint32 {
+	vlanMap := vlanMapOf(bp)
+	vlanMapLock.Lock()
+	delete(programmedVlanMaps, bp.Name)
+	vlanMapLock.Unlock()
+	return vlanMap
+}
+
+// vlanMapOf returns the vlan translations a trunk bridge port was programmed
+// with, or the configured ones if it was not programmed yet
+func vlanMapOf(bp *infradb.BridgePort) map[uint32]uint32 {
+	vlanMapLock.Lock()
+	vlanMap, programmed := programmedVlanMaps[bp.Name]
+	vlanMapLock.Unlock()
+	if !programmed {
+		return configuredVlanMap(bp)
+	}
+	return vlanMap
+}
+
+// customerVlan returns the vlan a logical bridge vlan is seen with on the
+// wire of a trunk bridge port
+func customerVlan(vlanMap map[uint32]uint32, vid uint32) uint32 {
+	if customer, ok := vlanMap[vid]; ok {
+		return customer
+	}
+	return vid
+}
+
+// nexthopCustomerVlan returns the vlan pushed by an l2 nexthop of a trunk
+// bridge port
+func nexthopCustomerVlan(nexthop nm.L2NexthopStruct) uint32 {
+	vport, ok := nexthop.Metadata["vport_id"].(string)
+	if !ok {
+		return uint32(nexthop.VlanID)
+	}
+	bp, ok := bpOfVport(vport)
+	if !ok {
+		return uint32(nexthop.VlanID)
+	}
+	return customerVlan(vlanMapOf(bp), uint32(nexthop.VlanID))
+}
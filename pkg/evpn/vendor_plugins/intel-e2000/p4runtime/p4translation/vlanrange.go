@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	"github.com/spf13/viper"
+)
+
+// trunkVlansKey config key of the allowed vlans of the trunk bridge ports
+const trunkVlansKey = "trunkvlans"
+
+// vlanRange inclusive range of vlan ids
+type vlanRange struct {
+	lo, hi uint32
+}
+
+var (
+	// trunkVlanLock guards the allowed vlans programmed
+	trunkVlanLock sync.Mutex
+
+	// programmedTrunkVlans allowed vlans the trunk bridge ports were
+	// programmed with, the entries are removed with the same ranges
+	programmedTrunkVlans = make(map[string][]vlanRange)
+)
+
+// parseVlanRanges parses a list of vlans and vlan ranges like "10,100-199",
+// the overlapping and adjacent ranges are merged
+func parseVlanRanges(value string) ([]vlanRange, error) {
+	var ranges []vlanRange
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		lo, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 12)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vlan %q", part)
+		}
+		hi := lo
+		if len(bounds) == 2 {
+			hi, err = strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 12)
+			if err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid vlan range %q", part)
+			}
+		}
+		ranges = append(ranges, vlanRange{lo: uint32(lo), hi: uint32(hi)})
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].lo < ranges[j].lo })
+	var merged []vlanRange
+	for _, r := range ranges {
+		if n := len(merged); n != 0 && r.lo <= merged[n-1].hi+1 {
+			if r.hi > merged[n-1].hi {
+				merged[n-1].hi = r.hi
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged, nil
+}
+
+// vlanAllowed checks if the vlan is in the ranges, no ranges allow them all
+func vlanAllowed(ranges []vlanRange, vid uint32) bool {
+	if ranges == nil {
+		return true
+	}
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].hi >= vid })
+	return i < len(ranges) && ranges[i].lo <= vid
+}
+
+// configuredTrunkVlans returns the allowed vlans of a trunk bridge port in
+// the config, nil when it carries all the vlans of its logical bridges
+func configuredTrunkVlans(bp *infradb.BridgePort) []vlanRange {
+	var cfg map[string]string
+	if err := viper.UnmarshalKey(trunkVlansKey, &cfg); err != nil {
+		log.Printf("intel-e2000: Failed to read trunk vlans: %v\n", err)
+		return nil
+	}
+	value, ok := cfg[path.Base(bp.Name)]
+	if !ok {
+		return nil
+	}
+	ranges, err := parseVlanRanges(value)
+	if err != nil {
+		log.Printf("intel-e2000: Ignoring trunk vlans of bridge port %s: %v\n", bp.Name, err)
+		return nil
+	}
+	if ranges == nil {
+		ranges = []vlanRange{}
+	}
+	return ranges
+}
+
+// recordTrunkVlans returns the allowed vlans of a trunk bridge port being
+// added and records them
+func recordTrunkVlans(bp *infradb.BridgePort) []vlanRange {
+	ranges := configuredTrunkVlans(bp)
+	trunkVlanLock.Lock()
+	programmedTrunkVlans[bp.Name] = ranges
+	trunkVlanLock.Unlock()
+	return ranges
+}
+
+// releaseTrunkVlans returns the allowed vlans of a trunk bridge port being
+// deleted and forgets them
+func releaseTrunkVlans(bp *infradb.BridgePort) []vlanRange {
+	ranges := trunkVlans(bp)
+	trunkVlanLock.Lock()
+	delete(programmedTrunkVlans, bp.Name)
+	trunkVlanLock.Unlock()
+	return ranges
+}
+
+// trunkVlans returns the allowed vlans a trunk bridge port was programmed
+// with, or the configured ones if it was not programmed yet
+func trunkVlans(bp *infradb.BridgePort) []vlanRange {
+	trunkVlanLock.Lock()
+	ranges, programmed := programmedTrunkVlans[bp.Name]
+	trunkVlanLock.Unlock()
+	if !programmed {
+		return configuredTrunkVlans(bp)
+	}
+	return ranges
+}
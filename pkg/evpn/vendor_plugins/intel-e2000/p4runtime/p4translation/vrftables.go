@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright (c) 2022-2023 Intel Corporation, or its subsidiaries.
+// Copyright (C) 2023 Nordix Foundation.
+//
+//nolint:all
+package p4translation
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/opiproject/opi-evpn-bridge/pkg/infradb"
+	nm "github.com/opiproject/opi-evpn-bridge/pkg/netlink"
+)
+
+// _vrfTables returns the kernel routing tables of the vrf, the main table
+// first followed by the secondary tables such as the leaked ones
+func _vrfTables(vrf *infradb.Vrf) []uint32 {
+	var tables []uint32
+	if vrf == nil || vrf.Metadata == nil {
+		return tables
+	}
+	for _, table := range vrf.Metadata.RoutingTable {
+		if table != nil {
+			tables = append(tables, *table)
+		}
+	}
+	return tables
+}
+
+// _vrfTable returns the main routing table of the vrf, the one the traffic
+// entering the vrf is looked up in
+func _vrfTable(vrf *infradb.Vrf) (uint32, error) {
+	tables := _vrfTables(vrf)
+	if len(tables) == 0 {
+		return 0, fmt.Errorf("intel-e2000: %w routing table", ErrMissingMetadata)
+	}
+	return tables[0], nil
+}
+
+// _sviVrfParams returns the tx tcam prefix and the vrf id the svi ingress
+// entries of the bridge ports set, the trunk, access and native vlan paths of
+// both the bridge port and the svi translation go through it. The vrf id is
+// the main routing table of the vrf
+func _sviVrfParams(vrf *infradb.Vrf) (uint32, uint16, error) {
+	vrfTable, err := _vrfTable(vrf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if vrfTable > math.MaxUint16 {
+		return 0, 0, fmt.Errorf("intel-e2000: routing table %d of vrf %s exceeds the 16 bits vrf id", vrfTable, vrf.Name)
+	}
+	tcamPrefix, err := _getTcamPrefix(vrfTable, Direction.Tx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(tcamPrefix), uint16(vrfTable), nil
+}
+
+// _isVrfTable checks the table belongs to the vrf
+func _isVrfTable(vrf *infradb.Vrf, table uint32) bool {
+	for _, t := range _vrfTables(vrf) {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// _routeTable returns the routing table of the vrf the route is programmed
+// in, the table the kernel holds the route in when it belongs to the vrf and
+// the main table of the vrf otherwise
+func _routeTable(route nm.RouteStruct) uint32 {
+	if route.Route0.Table > 0 && _isVrfTable(route.Vrf, uint32(route.Route0.Table)) {
+		return uint32(route.Route0.Table)
+	}
+	table, _ := _vrfTable(route.Vrf)
+	return table
+}